@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kwilteam/kwil-db/core/client"
+	clientType "github.com/kwilteam/kwil-db/core/client/types"
+	"github.com/kwilteam/kwil-db/core/crypto"
+	"github.com/kwilteam/kwil-db/core/crypto/auth"
+	"github.com/kwilteam/kwil-db/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	"github.com/trufnetwork/node/internal/migrations/runner"
+)
+
+const usage = `Usage: migrate [flags] <status|up|dry-run|baseline <migration>>
+
+Applies the embedded production migrations to a node, recording each applied
+file and its checksum in the schema_migrations table.
+
+Commands:
+  status    show every migration and whether it is pending, applied or changed
+  up        apply all pending migrations in order
+  dry-run   list the migrations that up would apply, without executing them
+  baseline  record <migration> and the ones before it as applied, without executing
+            them. For nodes set up by the former scripts/migrate.sh, which records
+            nothing: run "baseline 000-initial-data.sql", then "up" applies the rest.
+
+Flags:
+`
+
+func init() {
+	zap.ReplaceGlobals(zap.Must(zap.NewProduction()))
+}
+
+func main() {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	provider := flags.String("provider", os.Getenv("PROVIDER"), "node RPC endpoint (env PROVIDER)")
+	privateKey := flags.String("private-key", os.Getenv("PRIVATE_KEY"), "hex encoded secp256k1 private key (env PRIVATE_KEY)")
+	chainID := flags.String("chain-id", os.Getenv("CHAIN_ID"), "expected chain ID, empty to accept the node's (env CHAIN_ID)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:])
+
+	// baseline takes the name of the last migration to record
+	expectedArgs := 1
+	if flags.Arg(0) == "baseline" {
+		expectedArgs = 2
+	}
+	if flags.NArg() != expectedArgs {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(context.Background(), flags.Args(), *provider, *privateKey, *chainID); err != nil {
+		zap.L().Fatal("migration failed", zap.Error(err))
+	}
+}
+
+func run(ctx context.Context, args []string, provider, privateKey, chainID string) error {
+	if provider == "" {
+		return errors.New("PROVIDER is not set")
+	}
+	if privateKey == "" {
+		return errors.New("PRIVATE_KEY is not set")
+	}
+
+	migs, err := migrations.GetMigrations()
+	if err != nil {
+		return err
+	}
+
+	cl, err := newKwilClient(ctx, provider, privateKey, chainID)
+	if err != nil {
+		return err
+	}
+	r := runner.New(cl, migs)
+
+	command := args[0]
+	switch command {
+	case "status":
+		statuses, err := r.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.State == runner.StatePending {
+				fmt.Printf("%-8s %s\n", s.State, s.Name)
+				continue
+			}
+			fmt.Printf("%-8s %s (height %d)\n", s.State, s.Name, s.AppliedAt)
+		}
+	case "up", "dry-run":
+		dryRun := command == "dry-run"
+		applied, err := r.Up(ctx, dryRun)
+		for _, m := range applied {
+			if dryRun {
+				fmt.Printf("would apply %s\n", m.Name)
+			} else {
+				fmt.Printf("applied %s\n", m.Name)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "baseline":
+		recorded, err := r.Baseline(ctx, args[1], false)
+		for _, m := range recorded {
+			fmt.Printf("recorded %s\n", m.Name)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("unknown command %q", command)
+	}
+
+	return nil
+}
+
+// kwilClient adapts the kwil client to runner.Client.
+type kwilClient struct {
+	cl *client.Client
+}
+
+func newKwilClient(ctx context.Context, provider, privateKey, chainID string) (*kwilClient, error) {
+	keyBytes, err := hex.DecodeString(strings.TrimPrefix(privateKey, "0x"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid private key")
+	}
+	key, err := crypto.UnmarshalSecp256k1PrivateKey(keyBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid private key")
+	}
+
+	opts := clientType.DefaultOptions()
+	opts.Signer = &auth.EthPersonalSigner{Key: *key}
+	opts.ChainID = chainID
+
+	cl, err := client.NewClient(ctx, provider, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create client")
+	}
+
+	return &kwilClient{cl: cl}, nil
+}
+
+func (k *kwilClient) Execute(ctx context.Context, stmt string) error {
+	txHash, err := k.cl.ExecuteSQL(ctx, stmt, nil, clientType.WithSyncBroadcast(true))
+	if err != nil {
+		return err
+	}
+
+	res, err := k.cl.WaitTx(ctx, txHash, time.Second)
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for tx %s", txHash)
+	}
+	if res.Result.Code != uint32(types.CodeOk) {
+		return errors.Errorf("tx %s failed: %s", txHash, res.Result.Log)
+	}
+
+	return nil
+}
+
+func (k *kwilClient) Query(ctx context.Context, stmt string) ([][]any, error) {
+	res, err := k.cl.Query(ctx, stmt, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return res.Values, nil
+}
@@ -183,7 +183,7 @@ func TestBench(t *testing.T) {
 		schemaTest := kwilTesting.SchemaTest{
 			Name:          "benchmark_test_" + strconv.Itoa(i),
 			FunctionTests: groupOfTests,
-			SeedScripts:   migrations.GetSeedScriptPaths(),
+			SeedScripts:   migrations.GetSeedScriptPathsFor(migrations.SetBenchmark),
 		}
 
 		t.Run(schemaTest.Name, func(t *testing.T) {
@@ -101,7 +101,6 @@ func setVisibilityAndWhitelist(ctx context.Context, platform *kwilTesting.Platfo
 	parentStreamId := getStreamId(treeNode.Parent)
 	metadataToInsert := []procedure.InsertMetadataInput{
 		{Key: string(types.ComposeVisibilityKey), Value: strconv.Itoa(int(util.PrivateVisibility)), ValType: string(types.ComposeVisibilityKey.GetType())},
-		{Key: string(types.AllowComposeStreamKey), Value: parentStreamId.String(), ValType: string(types.AllowComposeStreamKey.GetType())},
 		{Key: string(types.ReadVisibilityKey), Value: strconv.Itoa(int(util.PrivateVisibility)), ValType: string(types.ReadVisibilityKey.GetType())},
 		{Key: string(types.AllowReadWalletKey), Value: readerAddress.Address(), ValType: string(types.AllowReadWalletKey.GetType())},
 	}
@@ -116,14 +115,6 @@ func setVisibilityAndWhitelist(ctx context.Context, platform *kwilTesting.Platfo
 		})
 	}
 
-	for _, streamId := range getMockStreamIds(1000) {
-		metadataToInsert = append(metadataToInsert, procedure.InsertMetadataInput{
-			Key:     string(types.AllowComposeStreamKey),
-			Value:   streamId.String(),
-			ValType: string(types.AllowComposeStreamKey.GetType()),
-		})
-	}
-
 	// for all inputs, add the locator and height
 	for i := range metadataToInsert {
 		metadataToInsert[i].Locator = stream.Locator
@@ -136,6 +127,19 @@ func setVisibilityAndWhitelist(ctx context.Context, platform *kwilTesting.Platfo
 			return errors.Wrap(err, "failed to insert metadata")
 		}
 	}
+
+	// compose whitelists hold the full locator of the parent, all streams share the data provider
+	parentStreamIds := append([]util.StreamId{*parentStreamId}, getMockStreamIds(1000)...)
+	for _, streamId := range parentStreamIds {
+		if err := procedure.GrantComposePermission(ctx, procedure.GrantComposePermissionInput{
+			Platform:      platform,
+			Locator:       stream.Locator,
+			ParentLocator: types.StreamLocator{StreamId: streamId, DataProvider: stream.Locator.DataProvider},
+			Height:        1,
+		}); err != nil {
+			return errors.Wrap(err, "failed to grant compose permission")
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,123 @@
+/*
+    SCHEMA ADDITIONS
+
+    000-initial-data.sql is applied on running nodes and the migration runner refuses schema
+    files that change after being applied, so tables and columns added since live here.
+    The runner applies this file once: existing tables are altered, new ones are created.
+    It sorts right after 000-initial-data.sql, before the actions that use them.
+
+    Columns:
+    - streams.archived_at: Soft deletion of streams
+    - primitive_events.is_tombstone: Retraction revisions of records
+    - primitive_events.visible_from: Embargoed records
+    - metadata.expires_at: Time-limited grants
+
+    Tables:
+    - stream_ownership_transfers: Pending two-step ownership transfers
+    - access_groups, access_group_members: Reusable sets of wallets that streams can grant access to
+    - audit_log: Append-only trail of every mutating action
+    - stream_aliases: Human-readable names of streams, unique per data provider
+    - block_timestamps: Wall-clock time of the block heights that changed the data
+ */
+
+-- block height of the soft deletion, NULL while the stream is live
+ALTER TABLE streams ADD COLUMN IF NOT EXISTS archived_at INT8;
+
+-- retraction revision, hides the record from created_at onward
+ALTER TABLE primitive_events ADD COLUMN IF NOT EXISTS is_tombstone BOOL;
+UPDATE primitive_events SET is_tombstone = false WHERE is_tombstone IS NULL;
+ALTER TABLE primitive_events ALTER COLUMN is_tombstone SET DEFAULT false;
+ALTER TABLE primitive_events ALTER COLUMN is_tombstone SET NOT NULL;
+
+-- embargo: block height from which non-writers can read the record, NULL = immediately
+ALTER TABLE primitive_events ADD COLUMN IF NOT EXISTS visible_from INT8;
+
+-- block height from which the row no longer applies, NULL = never (time-limited grants)
+ALTER TABLE metadata ADD COLUMN IF NOT EXISTS expires_at INT8;
+
+-- Pending two-step ownership transfers, at most one per stream
+CREATE TABLE IF NOT EXISTS stream_ownership_transfers (
+    data_provider TEXT NOT NULL,
+    stream_id TEXT NOT NULL,
+    proposed_owner TEXT NOT NULL,
+    proposed_by TEXT NOT NULL, -- owner at proposal time, the proposal is void once ownership changes
+    created_at INT8 NOT NULL, -- block height
+    expires_at INT8 NOT NULL, -- block height from which the proposal can't be accepted
+
+    PRIMARY KEY (data_provider, stream_id),
+    FOREIGN KEY (data_provider, stream_id)
+        REFERENCES streams(data_provider, stream_id)
+        ON DELETE CASCADE
+);
+
+-- For listing the proposals addressed to a wallet
+CREATE INDEX IF NOT EXISTS sot_proposed_owner_idx ON stream_ownership_transfers (proposed_owner);
+
+-- Access groups: wallets granted read or write access together, see 015-access-groups.sql
+CREATE TABLE IF NOT EXISTS access_groups (
+    group_id TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    created_at INT8 NOT NULL, -- block height
+
+    PRIMARY KEY (group_id),
+    CHECK (LENGTH(group_id) > 0 AND LENGTH(group_id) <= 64)
+);
+
+CREATE TABLE IF NOT EXISTS access_group_members (
+    group_id TEXT NOT NULL,
+    wallet TEXT NOT NULL,
+    created_at INT8 NOT NULL, -- block height
+
+    PRIMARY KEY (group_id, wallet),
+    FOREIGN KEY (group_id)
+        REFERENCES access_groups(group_id)
+        ON DELETE CASCADE
+);
+
+-- For checking the groups of a wallet
+CREATE INDEX IF NOT EXISTS agm_wallet_idx ON access_group_members (wallet, group_id);
+
+-- Append-only audit trail written by every mutating action, see 016-audit-log.sql
+CREATE TABLE IF NOT EXISTS audit_log (
+    txid TEXT NOT NULL,
+    log_index INT8 NOT NULL, -- order of the entry within its transaction
+    created_at INT8 NOT NULL, -- block height
+    caller TEXT NOT NULL,
+    action TEXT NOT NULL,
+    -- no foreign key, entries outlive the streams they refer to
+    data_provider TEXT, -- NULL for actions not tied to a stream, e.g. access groups
+    stream_id TEXT,
+    payload TEXT, -- compact summary of the arguments, e.g. "key=min_value type=float value=0"
+
+    PRIMARY KEY (txid, log_index)
+);
+
+CREATE INDEX IF NOT EXISTS audit_stream_idx ON audit_log (data_provider, stream_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_caller_idx ON audit_log (caller, created_at);
+CREATE INDEX IF NOT EXISTS audit_action_idx ON audit_log (action, created_at);
+
+-- Aliases resolve to a stream of the same data provider, see 019-stream-aliases.sql
+CREATE TABLE IF NOT EXISTS stream_aliases (
+    data_provider TEXT NOT NULL,
+    alias TEXT NOT NULL,
+    stream_id TEXT NOT NULL,
+    created_at INT8 NOT NULL, -- block height of the registration or the last transfer
+
+    PRIMARY KEY (data_provider, alias),
+    FOREIGN KEY (data_provider, stream_id)
+        REFERENCES streams(data_provider, stream_id)
+        ON DELETE CASCADE,
+    CHECK (LENGTH(alias) > 0 AND LENGTH(alias) <= 64)
+);
+
+-- For listing the aliases of a stream
+CREATE INDEX IF NOT EXISTS sa_stream_idx ON stream_aliases (data_provider, stream_id);
+
+-- Wall-clock time of the heights written by mutating actions, for frozen_at by time, see 024-block-timestamps.sql
+CREATE TABLE IF NOT EXISTS block_timestamps (
+    height INT8 PRIMARY KEY,
+    block_timestamp INT8 NOT NULL -- unix seconds
+);
+
+-- For finding the last height at or before a time
+CREATE INDEX IF NOT EXISTS bt_timestamp_idx ON block_timestamps (block_timestamp, height);
@@ -52,6 +52,8 @@ CREATE OR REPLACE ACTION create_stream(
         ($read_visibility_uuid,           $data_provider, $stream_id, 'read_visibility',            NULL,           0,    NULL,                  $current_block),
         ($readonly_key_stream_owner_uuid, $data_provider, $stream_id, 'readonly_key',  'stream_owner', NULL, NULL,                  $current_block),
         ($readonly_key_readonly_key_uuid, $data_provider, $stream_id, 'readonly_key',  'readonly_key', NULL, NULL,                  $current_block);
+
+    log_audit_event('create_stream', $data_provider, $stream_id, 'stream_type=' || $stream_type);
 };
 
 /**
@@ -233,6 +235,10 @@ CREATE OR REPLACE ACTION create_streams(
         created_at,
         NULL::INT8
     FROM args;
+
+    for $i in 1..array_length($stream_ids) {
+        log_audit_event('create_streams', $data_provider, $stream_ids[$i], 'stream_type=' || $stream_types[$i]);
+    }
 };
 
 
@@ -249,6 +255,24 @@ CREATE OR REPLACE ACTION insert_metadata(
     $value TEXT,
     $val_type TEXT
 ) PUBLIC {
+    insert_metadata_row($data_provider, $stream_id, $key, $value, $val_type, NULL);
+
+    log_audit_event('insert_metadata', $data_provider, $stream_id, 'key=' || $key || ' type=' || $val_type || ' value=' || COALESCE($value, 'NULL'));
+};
+
+/**
+ * insert_metadata_row: Validates and inserts a metadata row for insert_metadata and
+ * grant_stream_access, which log it. $expires_at is the block height from which a
+ * grant stops applying, NULL for metadata that doesn't expire.
+ */
+CREATE OR REPLACE ACTION insert_metadata_row(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $key TEXT,
+    $value TEXT,
+    $val_type TEXT,
+    $expires_at INT8
+) PRIVATE {
     -- Initialize value variables
     $value_i INT;
     $value_s TEXT;
@@ -277,6 +301,50 @@ CREATE OR REPLACE ACTION insert_metadata(
     } else {
         ERROR(FORMAT('Unknown type used "%s". Valid types = "float" | "bool" | "int" | "ref" | "string"', $val_type));
     }
+
+    -- Validate keys that change how the stream is computed
+    if $key = 'aggregation_method' {
+        if $val_type != 'string' OR !is_valid_aggregation_method($value) {
+            ERROR(FORMAT('Invalid aggregation_method "%s". Valid methods = "weighted_mean" | "weighted_sum" | "weighted_median" | "geometric_mean"', $value));
+        }
+        if !is_primitive_stream($data_provider, $stream_id) {
+            check_aggregation_method($data_provider, $stream_id, $value);
+        }
+    }
+    if $key = 'fill_mode' {
+        if $val_type != 'string' OR !is_valid_fill_mode($value) {
+            ERROR(FORMAT('Invalid fill_mode "%s". Valid modes = "locf" | "linear" | "none"', $value));
+        }
+    }
+
+    -- Validation rules are only read with their own type (see validate_record_inserts)
+    if ($key = 'min_value' OR $key = 'max_value' OR $key = 'max_pct_change') AND $val_type != 'float' {
+        ERROR(FORMAT('Validation rule "%s" must be of type "float"', $key));
+    }
+    if $key = 'min_event_time' AND $val_type != 'int' {
+        ERROR('Validation rule "min_event_time" must be of type "int"');
+    }
+    if $key = 'allow_backfill' AND $val_type != 'bool' {
+        ERROR('Validation rule "allow_backfill" must be of type "bool"');
+    }
+
+    -- Compose whitelists need the data provider of the parent along with its stream id,
+    -- which a single value can't hold
+    if $key = 'allow_compose_stream' {
+        ERROR('"allow_compose_stream" needs the data provider of the parent stream, use grant_compose_permission');
+    }
+
+    -- Access groups are referenced by group_id, see 015-access-groups.sql. Only the group owner
+    -- can grant access through it, otherwise members could be added to someone else's streams
+    if $key = 'allow_read_group' OR $key = 'allow_write_group' {
+        if $val_type != 'string' {
+            ERROR(FORMAT('"%s" must be of type "string"', $key));
+        }
+        -- errors if the group doesn't exist
+        if !is_access_group_owner($value, $lower_caller) {
+            ERROR('Only the group owner can grant access through the access group: ' || $value);
+        }
+    }
     
     -- Check if the key is read-only
     $is_readonly BOOL := false;
@@ -308,7 +376,8 @@ CREATE OR REPLACE ACTION insert_metadata(
         value_s, 
         value_b, 
         value_ref, 
-        created_at
+        created_at,
+        expires_at
     ) VALUES (
         $uuid, 
         $data_provider, 
@@ -319,7 +388,8 @@ CREATE OR REPLACE ACTION insert_metadata(
         $value_s, 
         $value_b, 
         LOWER($value_ref), 
-        $current_block
+        $current_block,
+        $expires_at
     );
 };
 
@@ -380,6 +450,8 @@ CREATE OR REPLACE ACTION disable_metadata(
     WHERE row_id = $row_id
     AND data_provider = $data_provider
     AND stream_id = $stream_id;
+
+    log_audit_event('disable_metadata', $data_provider, $stream_id, 'key=' || $metadata_key || ' row_id=' || $row_id::TEXT);
 };
 
 /**
@@ -434,7 +506,13 @@ CREATE OR REPLACE ACTION check_ethereum_address(
 };
 
 /**
- * delete_stream: Removes a stream and all associated data.
+ * delete_stream: Archives a stream, hiding it from listings and queries.
+ * Records, taxonomies and metadata are kept, so restore_stream can bring it back
+ * within the grace period (get_archive_grace_period). The stream_id stays reserved while
+ * archived, until the owner purges the stream with purge_stream after the grace period.
+ * With the deletion_guard metadata set to 1, streams still used by a composed stream can't be deleted.
+ * Only the taxonomy active at the block timestamp counts for each composed stream, so future
+ * and superseded definitions don't block the deletion.
  * Only stream owner can perform this action.
  */
 CREATE OR REPLACE ACTION delete_stream(
@@ -449,7 +527,110 @@ CREATE OR REPLACE ACTION delete_stream(
         ERROR('Only stream owner can delete the stream');
     }
 
-    DELETE FROM streams WHERE data_provider = $data_provider AND stream_id = $stream_id;
+    $deletion_guard INT := COALESCE(get_latest_metadata_int($data_provider, $stream_id, 'deletion_guard'), 0);
+    if $deletion_guard == 1 {
+        for $dependent in get_stream_dependents($data_provider, $stream_id, false, @block_timestamp) {
+            ERROR('Stream is used by composed stream: data_provider=' || $dependent.data_provider || ' stream_id=' || $dependent.stream_id);
+        }
+    }
+
+    UPDATE streams SET archived_at = @height
+    WHERE data_provider = $data_provider AND stream_id = $stream_id;
+
+    log_audit_event('delete_stream', $data_provider, $stream_id, NULL);
+};
+
+/**
+ * restore_stream: Brings back a stream archived by delete_stream.
+ * Only possible within the grace period after the deletion.
+ * Only stream owner can perform this action.
+ */
+CREATE OR REPLACE ACTION restore_stream(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $lower_caller := LOWER(@caller);
+
+    $archived_at INT8;
+    $found BOOL := false;
+    for $row in SELECT archived_at FROM streams WHERE data_provider = $data_provider AND stream_id = $stream_id {
+        $archived_at := $row.archived_at;
+        $found := true;
+    }
+    if !$found OR $archived_at IS NULL {
+        ERROR('Stream is not archived: data_provider=' || $data_provider || ' stream_id=' || $stream_id);
+    }
+
+    -- is_stream_owner doesn't see archived streams, check the owner metadata directly
+    $is_owner BOOL := false;
+    for $row in get_metadata($data_provider, $stream_id, 'stream_owner', $lower_caller, 1, 0, 'created_at DESC') {
+        $is_owner := true;
+    }
+    if !$is_owner {
+        ERROR('Only stream owner can restore the stream');
+    }
+
+    if @height - $archived_at > get_archive_grace_period() {
+        ERROR('Grace period to restore the stream is over, archived at block ' || $archived_at::TEXT);
+    }
+
+    UPDATE streams SET archived_at = NULL
+    WHERE data_provider = $data_provider AND stream_id = $stream_id;
+
+    log_audit_event('restore_stream', $data_provider, $stream_id, 'archived_at=' || $archived_at::TEXT);
+};
+
+/**
+ * purge_stream: Permanently deletes a stream archived by delete_stream, with its records,
+ * taxonomies, metadata and aliases. Only possible once the grace period is over, after which
+ * the stream_id can be created again.
+ * Only stream owner can perform this action.
+ */
+CREATE OR REPLACE ACTION purge_stream(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $lower_caller := LOWER(@caller);
+
+    $archived_at INT8;
+    $found BOOL := false;
+    for $row in SELECT archived_at FROM streams WHERE data_provider = $data_provider AND stream_id = $stream_id {
+        $archived_at := $row.archived_at;
+        $found := true;
+    }
+    if !$found OR $archived_at IS NULL {
+        ERROR('Stream is not archived: data_provider=' || $data_provider || ' stream_id=' || $stream_id);
+    }
+
+    -- is_stream_owner doesn't see archived streams, check the owner metadata directly
+    $is_owner BOOL := false;
+    for $row in get_metadata($data_provider, $stream_id, 'stream_owner', $lower_caller, 1, 0, 'created_at DESC') {
+        $is_owner := true;
+    }
+    if !$is_owner {
+        ERROR('Only stream owner can purge the stream');
+    }
+
+    $grace_period INT8 := get_archive_grace_period();
+    if @height - $archived_at <= $grace_period {
+        ERROR('Stream can still be restored, it can be purged after block ' || ($archived_at + $grace_period)::TEXT);
+    }
+
+    -- taxonomies, records, metadata and aliases cascade
+    DELETE FROM streams
+    WHERE data_provider = $data_provider AND stream_id = $stream_id;
+
+    log_audit_event('purge_stream', $data_provider, $stream_id, 'archived_at=' || $archived_at::TEXT);
+};
+
+/**
+ * get_archive_grace_period: Number of blocks after delete_stream during which restore_stream
+ * can bring the stream back. Once it's over, the stream can only be purged.
+ */
+CREATE OR REPLACE ACTION get_archive_grace_period() PUBLIC view returns (grace_period INT8) {
+    return 100000;
 };
 
 /**
@@ -530,6 +711,7 @@ CREATE OR REPLACE ACTION is_stream_owner_batch(
     ),
     arguments AS (
         SELECT 
+            idx,
             stream_arrays.data_providers[idx] AS data_provider,
             stream_arrays.stream_ids[idx] AS stream_id
         FROM indexes
@@ -538,6 +720,7 @@ CREATE OR REPLACE ACTION is_stream_owner_batch(
     -- Check which streams are owned by the wallet
     ownership_check AS (
         SELECT 
+            a.idx,
             a.data_provider,
             a.stream_id,
             CASE WHEN m.value_ref IS NOT NULL AND LOWER(m.value_ref) = $lowercase_wallet THEN true ELSE false END AS is_owner
@@ -555,7 +738,8 @@ CREATE OR REPLACE ACTION is_stream_owner_batch(
         o.data_provider,
         o.stream_id,
         o.is_owner
-    FROM ownership_check o;
+    FROM ownership_check o
+    ORDER BY o.idx;
 };
 
 /**
@@ -567,7 +751,7 @@ CREATE OR REPLACE ACTION is_primitive_stream(
 ) PUBLIC view returns (is_primitive BOOL) {
     $data_provider := LOWER($data_provider);
     for $row in SELECT stream_type FROM streams 
-        WHERE data_provider = $data_provider AND stream_id = $stream_id LIMIT 1 {
+        WHERE data_provider = $data_provider AND stream_id = $stream_id AND archived_at IS NULL LIMIT 1 {
         return $row.stream_type = 'primitive';
     }
     
@@ -622,12 +806,13 @@ CREATE OR REPLACE ACTION is_primitive_stream_batch(
         a.stream_id,
         COALESCE(s.stream_type = 'primitive', false) AS is_primitive
     FROM arguments a
-    LEFT JOIN streams s ON a.data_provider = s.data_provider AND a.stream_id = s.stream_id;
+    LEFT JOIN streams s ON a.data_provider = s.data_provider AND a.stream_id = s.stream_id AND s.archived_at IS NULL;
 };
 
 /**
  * get_metadata: Retrieves metadata for a stream with pagination and filtering.
  * Supports ordering by creation time and filtering by key and reference.
+ * Disabled and expired rows are skipped. $stream_id can be an alias of the stream.
  */
 CREATE OR REPLACE ACTION get_metadata(
     $data_provider TEXT,
@@ -647,6 +832,7 @@ CREATE OR REPLACE ACTION get_metadata(
     created_at INT
 ) {
     $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
 
     -- Set default values if parameters are null
     if $limit IS NULL {
@@ -669,6 +855,7 @@ CREATE OR REPLACE ACTION get_metadata(
         FROM metadata
            WHERE metadata_key = $key
             AND disabled_at IS NULL
+            AND (expires_at IS NULL OR expires_at > @height)
             AND ($ref IS NULL OR LOWER(value_ref) = LOWER($ref))
             AND stream_id = $stream_id
             AND data_provider = $data_provider
@@ -717,6 +904,23 @@ CREATE OR REPLACE ACTION get_latest_metadata_int(
     RETURN $result;
 };
 
+/**
+ * get_latest_metadata_float: Retrieves the latest metadata value for a stream.
+ */
+CREATE OR REPLACE ACTION get_latest_metadata_float(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $key TEXT
+) PUBLIC view returns (value NUMERIC(36,18)) {
+    $data_provider := LOWER($data_provider);
+
+    $result NUMERIC(36,18);
+    for $row in get_latest_metadata($data_provider, $stream_id, $key, NULL) {
+        $result := $row.value_f;
+    }
+    RETURN $result;
+};
+
 /**
  * get_latest_metadata_ref: Retrieves the latest metadata value for a stream.
  */
@@ -990,8 +1194,29 @@ CREATE OR REPLACE ACTION get_category_streams(
     FROM substreams;
 };
 
+/**
+ * resolve_stream_alias: Returns the stream_id an alias of the data provider points to.
+ * Stream ids and unknown aliases are returned as is, so public queries can take either.
+ */
+CREATE OR REPLACE ACTION resolve_stream_alias(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PUBLIC view returns (stream_id TEXT) {
+    -- aliases can't have the stream_id format, see register_stream_alias
+    if check_stream_id_format($stream_id) {
+        RETURN $stream_id;
+    }
+
+    for $row in SELECT stream_id FROM stream_aliases
+        WHERE data_provider = LOWER($data_provider) AND alias = $stream_id {
+        RETURN $row.stream_id;
+    }
+    RETURN $stream_id;
+};
+
 /**
  * stream_exists: Simple check if a stream exists in the database.
+ * Archived streams don't exist for readers and writers.
  */
 CREATE OR REPLACE ACTION stream_exists(
     $data_provider TEXT,
@@ -999,7 +1224,7 @@ CREATE OR REPLACE ACTION stream_exists(
 ) PUBLIC view returns (result BOOL) {
     $data_provider := LOWER($data_provider);
 
-    for $row in SELECT 1 FROM streams WHERE data_provider = $data_provider AND stream_id = $stream_id {
+    for $row in SELECT 1 FROM streams WHERE data_provider = $data_provider AND stream_id = $stream_id AND archived_at IS NULL {
         return true;
     }
     return false;
@@ -1052,9 +1277,13 @@ CREATE OR REPLACE ACTION stream_exists_batch(
         a.stream_id,
         CASE WHEN s.data_provider IS NOT NULL THEN true ELSE false END AS stream_exists
     FROM arguments a
-    LEFT JOIN streams s ON a.data_provider = s.data_provider AND a.stream_id = s.stream_id;
+    LEFT JOIN streams s ON a.data_provider = s.data_provider AND a.stream_id = s.stream_id AND s.archived_at IS NULL;
 };
 
+/**
+ * transfer_stream_ownership: Gives the stream to a new owner in a single step.
+ * A mistyped address locks the stream, prefer propose_stream_ownership.
+ */
 CREATE OR REPLACE ACTION transfer_stream_ownership(
     $data_provider TEXT,
     $stream_id TEXT,
@@ -1078,6 +1307,179 @@ CREATE OR REPLACE ACTION transfer_stream_ownership(
     WHERE metadata_key = 'stream_owner'
     AND data_provider = $data_provider
     AND stream_id = $stream_id;
+
+    -- A pending proposal of the previous owner is void
+    DELETE FROM stream_ownership_transfers
+    WHERE data_provider = $data_provider
+    AND stream_id = $stream_id;
+
+    log_audit_event('transfer_stream_ownership', $data_provider, $stream_id, 'new_owner=' || $new_owner);
+};
+
+/**
+ * propose_stream_ownership: First step of an ownership transfer.
+ * The stream keeps its owner until the proposed owner accepts with accept_stream_ownership.
+ * The proposal expires after $expires_in blocks (default 100800), and a new proposal
+ * replaces the pending one.
+ */
+CREATE OR REPLACE ACTION propose_stream_ownership(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $new_owner TEXT,
+    $expires_in INT8
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $new_owner := LOWER($new_owner);
+    $lower_caller := LOWER(@caller);
+
+    if !is_stream_owner($data_provider, $stream_id, $lower_caller) {
+        ERROR('Only stream owner can propose an ownership transfer');
+    }
+
+    if NOT check_ethereum_address($new_owner) {
+        ERROR('Invalid new owner address. Must be a valid Ethereum address: ' || $new_owner);
+    }
+
+    if $new_owner = $lower_caller {
+        ERROR('Wallet is already the stream owner');
+    }
+
+    $expires_in := COALESCE($expires_in, 100800);
+    if $expires_in <= 0 {
+        ERROR('expires_in must be a positive number of blocks');
+    }
+
+    DELETE FROM stream_ownership_transfers
+    WHERE data_provider = $data_provider
+    AND stream_id = $stream_id;
+
+    INSERT INTO stream_ownership_transfers (data_provider, stream_id, proposed_owner, proposed_by, created_at, expires_at)
+    VALUES ($data_provider, $stream_id, $new_owner, $lower_caller, @height, @height + $expires_in);
+
+    log_audit_event('propose_stream_ownership', $data_provider, $stream_id, 'proposed_owner=' || $new_owner || ' expires_at=' || (@height + $expires_in)::TEXT);
+};
+
+/**
+ * accept_stream_ownership: Second step of an ownership transfer.
+ * Only the proposed owner can accept, before the proposal expires.
+ */
+CREATE OR REPLACE ACTION accept_stream_ownership(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $lower_caller := LOWER(@caller);
+
+    if !stream_exists($data_provider, $stream_id) {
+        ERROR('Stream does not exist: data_provider=' || $data_provider || ' stream_id=' || $stream_id);
+    }
+
+    $proposed_owner TEXT;
+    $proposed_by TEXT;
+    $expires_at INT8;
+    for $row in SELECT proposed_owner, proposed_by, expires_at
+        FROM stream_ownership_transfers
+        WHERE data_provider = $data_provider
+        AND stream_id = $stream_id {
+        $proposed_owner := $row.proposed_owner;
+        $proposed_by := $row.proposed_by;
+        $expires_at := $row.expires_at;
+    }
+
+    if $proposed_owner IS NULL {
+        ERROR('No pending ownership transfer for the stream');
+    }
+    if $proposed_owner != $lower_caller {
+        ERROR('Only the proposed owner can accept the ownership transfer');
+    }
+    if @height >= $expires_at {
+        ERROR('Ownership transfer proposal expired at block ' || $expires_at::TEXT);
+    }
+    -- the proposal only stands while its proposer still owns the stream
+    if !is_stream_owner($data_provider, $stream_id, $proposed_by) {
+        ERROR('Ownership transfer proposal is no longer valid, the stream owner changed');
+    }
+
+    UPDATE metadata SET value_ref = $lower_caller
+    WHERE metadata_key = 'stream_owner'
+    AND data_provider = $data_provider
+    AND stream_id = $stream_id;
+
+    DELETE FROM stream_ownership_transfers
+    WHERE data_provider = $data_provider
+    AND stream_id = $stream_id;
+
+    log_audit_event('accept_stream_ownership', $data_provider, $stream_id, 'previous_owner=' || $proposed_by);
+};
+
+/**
+ * cancel_stream_ownership_transfer: Withdraws the pending ownership transfer of a stream.
+ * Only the stream owner can cancel.
+ */
+CREATE OR REPLACE ACTION cancel_stream_ownership_transfer(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $lower_caller := LOWER(@caller);
+
+    if !is_stream_owner($data_provider, $stream_id, $lower_caller) {
+        ERROR('Only stream owner can cancel an ownership transfer');
+    }
+
+    $has_proposal BOOL := false;
+    for $row in SELECT 1 FROM stream_ownership_transfers
+        WHERE data_provider = $data_provider
+        AND stream_id = $stream_id {
+        $has_proposal := true;
+    }
+    if !$has_proposal {
+        ERROR('No pending ownership transfer for the stream');
+    }
+
+    DELETE FROM stream_ownership_transfers
+    WHERE data_provider = $data_provider
+    AND stream_id = $stream_id;
+
+    log_audit_event('cancel_stream_ownership_transfer', $data_provider, $stream_id, NULL);
+};
+
+/**
+ * get_pending_ownership_transfers: Lists the ownership transfers that can still be accepted.
+ * Filters are optional: a stream ($data_provider and $stream_id), and/or the proposed owner.
+ */
+CREATE OR REPLACE ACTION get_pending_ownership_transfers(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $proposed_owner TEXT
+) PUBLIC view returns table(
+    data_provider TEXT,
+    stream_id TEXT,
+    proposed_owner TEXT,
+    proposed_by TEXT,
+    created_at INT8,
+    expires_at INT8
+) {
+    $data_provider := LOWER($data_provider);
+    $proposed_owner := LOWER($proposed_owner);
+
+    RETURN SELECT t.data_provider, t.stream_id, t.proposed_owner, t.proposed_by, t.created_at, t.expires_at
+        FROM stream_ownership_transfers t
+        JOIN streams s ON s.data_provider = t.data_provider AND s.stream_id = t.stream_id AND s.archived_at IS NULL
+        WHERE ($data_provider IS NULL OR t.data_provider = $data_provider)
+        AND ($stream_id IS NULL OR t.stream_id = $stream_id)
+        AND ($proposed_owner IS NULL OR t.proposed_owner = $proposed_owner)
+        AND t.expires_at > @height
+        -- proposals of a previous owner are void
+        AND EXISTS (
+            SELECT 1 FROM metadata m
+            WHERE m.data_provider = t.data_provider
+            AND m.stream_id = t.stream_id
+            AND m.metadata_key = 'stream_owner'
+            AND m.disabled_at IS NULL
+            AND LOWER(m.value_ref) = t.proposed_by
+        )
+        ORDER BY t.created_at ASC, t.data_provider ASC, t.stream_id ASC;
 };
 
 /**
@@ -1119,7 +1521,8 @@ CREATE OR REPLACE ACTION filter_streams_by_existence(
         $exists := false;
         for $row in SELECT 1 FROM streams 
             WHERE LOWER(data_provider) = LOWER($dp) 
-            AND stream_id = $sid {
+            AND stream_id = $sid
+            AND archived_at IS NULL {
             $exists := true;
         }
         
@@ -1173,7 +1576,8 @@ CREATE OR REPLACE ACTION list_streams(
                   stream_type,
                   created_at
            FROM streams
-           WHERE $data_provider IS NULL OR $data_provider = '' OR LOWER(data_provider) = LOWER($data_provider)
+           WHERE ($data_provider IS NULL OR $data_provider = '' OR LOWER(data_provider) = LOWER($data_provider))
+             AND archived_at IS NULL
            ORDER BY
                CASE WHEN $order_by = 'created_at DESC' THEN created_at END DESC,
                CASE WHEN $order_by = 'created_at ASC' THEN created_at END ASC,
@@ -1182,4 +1586,95 @@ CREATE OR REPLACE ACTION list_streams(
                CASE WHEN $order_by = 'stream_type ASC' THEN stream_type END ASC,
                CASE WHEN $order_by = 'stream_type DESC' THEN stream_type END DESC
                LIMIT $limit OFFSET $offset;
-};
\ No newline at end of file
+};
+
+/**
+ * log_audit_event: Appends an entry to the audit log for the current transaction.
+ * $data_provider and $stream_id are NULL for actions not tied to a stream.
+ */
+CREATE OR REPLACE ACTION log_audit_event(
+    $action TEXT,
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $payload TEXT
+) PRIVATE {
+    $log_index INT8 := 0;
+    for $row in SELECT COUNT(*) AS entries FROM audit_log WHERE txid = @txid {
+        $log_index := $row.entries;
+    }
+
+    INSERT INTO audit_log (txid, log_index, created_at, caller, action, data_provider, stream_id, payload)
+    VALUES (@txid, $log_index, @height, LOWER(@caller), $action, LOWER($data_provider), $stream_id, $payload);
+};
+
+/**
+ * record_block_timestamp: Maps the current height to the block timestamp, once per height.
+ * Called by the actions writing records (insert_record, insert_records_batch, retract_record),
+ * so every height frozen_at can tell apart is mapped.
+ * Blocks without a timestamp aren't mapped. See 024-block-timestamps.sql.
+ */
+CREATE OR REPLACE ACTION record_block_timestamp() PRIVATE {
+    if @block_timestamp <= 0 {
+        RETURN;
+    }
+    for $row in SELECT height FROM block_timestamps WHERE height = @height {
+        RETURN;
+    }
+    INSERT INTO block_timestamps (height, block_timestamp)
+    VALUES (@height, @block_timestamp);
+};
+
+/**
+ * log_record_inserts: Logs a batch of records with one entry per stream,
+ * summarized as "records=N event_time=min..max", followed by $suffix if given.
+ */
+CREATE OR REPLACE ACTION log_record_inserts(
+    $action TEXT,
+    $data_provider TEXT[],
+    $stream_id TEXT[],
+    $event_time INT8[],
+    $suffix TEXT
+) PRIVATE {
+    $num_records INT := array_length($data_provider);
+    $log_dp TEXT[];
+    $log_sid TEXT[];
+    $log_payload TEXT[];
+
+    for $row in WITH RECURSIVE
+    indexes AS (
+        SELECT 1 AS idx
+        UNION ALL
+        SELECT idx + 1 FROM indexes
+        WHERE idx < $num_records
+    ),
+    record_arrays AS (
+        SELECT
+            $data_provider AS data_providers,
+            $stream_id AS stream_ids,
+            $event_time AS event_times
+    ),
+    arguments AS (
+        SELECT
+            LOWER(record_arrays.data_providers[idx]) AS data_provider,
+            record_arrays.stream_ids[idx] AS stream_id,
+            record_arrays.event_times[idx] AS event_time
+        FROM indexes
+        JOIN record_arrays ON 1=1
+    )
+    SELECT data_provider, stream_id, COUNT(*) AS records, MIN(event_time) AS min_event_time, MAX(event_time) AS max_event_time
+    FROM arguments
+    GROUP BY data_provider, stream_id
+    ORDER BY data_provider, stream_id {
+        $payload TEXT := 'records=' || $row.records::TEXT || ' event_time=' || $row.min_event_time::TEXT || '..' || $row.max_event_time::TEXT;
+        if $suffix IS NOT NULL {
+            $payload := $payload || ' ' || $suffix;
+        }
+        $log_dp := array_append($log_dp, $row.data_provider);
+        $log_sid := array_append($log_sid, $row.stream_id);
+        $log_payload := array_append($log_payload, $payload);
+    }
+
+    for $i in 1..COALESCE(array_length($log_dp), 0) {
+        log_audit_event($action, $log_dp[$i], $log_sid[$i], $log_payload[$i]);
+    }
+};
@@ -1,6 +1,6 @@
 /**
  * is_allowed_to_read: Checks if a wallet can read a specific stream.
- * Considers stream visibility and explicit read permissions.
+ * Considers stream visibility and explicit read permissions, for the wallet or its access groups.
  */
 CREATE OR REPLACE ACTION is_allowed_to_read(
     $data_provider TEXT,
@@ -38,13 +38,19 @@ CREATE OR REPLACE ACTION is_allowed_to_read(
         return true;
     }
 
+    -- Check if the wallet is allowed through one of the stream's access groups
+    if is_wallet_in_stream_access_group($data_provider, $stream_id, 'allow_read_group', $lowercase_wallet_address) {
+        return true;
+    }
+
     -- none of the above authorized, so return false
     return false;
 };
 
 /**
- * is_allowed_to_compose: Checks if a wallet can compose a stream.
- * Considers compose visibility and explicit compose permissions.
+ * is_allowed_to_compose: Checks if a stream can compose another stream.
+ * Considers compose visibility and explicit compose permissions. Streams of other owners
+ * can compose it when it's public or when its owner whitelisted them (see grant_compose_permission).
  */
 CREATE OR REPLACE ACTION is_allowed_to_compose(
     $data_provider TEXT,
@@ -61,14 +67,7 @@ CREATE OR REPLACE ACTION is_allowed_to_compose(
         ERROR('Stream does not exist: data_provider=' || $data_provider || ' stream_id=' || $stream_id);
     }
     if !stream_exists($composing_data_provider, $composing_stream_id) {
-        ERROR('Stream does not exist: data_provider=' || $data_provider || ' stream_id=' || $child_stream_id);
-    }
-    
-    -- check if it's from the same data provider
-    $stream_owner := get_latest_metadata_ref($data_provider, $stream_id, 'stream_owner', NULL);
-    $composing_stream_owner := get_latest_metadata_ref($composing_data_provider, $composing_stream_id, 'stream_owner', NULL);
-    if $stream_owner != $composing_stream_owner {
-        ERROR('Composing stream must be from the same data provider: data_provider=' || $data_provider || ' composing_data_provider=' || $composing_data_provider);
+        ERROR('Stream does not exist: data_provider=' || $composing_data_provider || ' stream_id=' || $composing_stream_id);
     }
 
     -- Check if the stream is private
@@ -83,9 +82,17 @@ CREATE OR REPLACE ACTION is_allowed_to_compose(
         return true;
     }
 
-    -- Check if the wallet is allowed to compose the stream
-    if get_latest_metadata_ref($data_provider, $stream_id, 'allow_compose_stream', $composing_stream_id) IS DISTINCT FROM NULL {
-        -- wallet is allowed to compose the stream
+    -- Check if the composing stream is whitelisted by its full locator (see grant_compose_permission)
+    for $row in SELECT 1
+        FROM metadata m
+        WHERE m.data_provider = $data_provider
+        AND m.stream_id = $stream_id
+        AND m.metadata_key = 'allow_compose_stream'
+        AND m.disabled_at IS NULL
+        AND m.value_ref = $composing_stream_id
+        AND m.value_s = $composing_data_provider
+        LIMIT 1 {
+        -- composing stream is allowed to compose the stream
         return true;
     }
 
@@ -321,6 +328,7 @@ CREATE OR REPLACE ACTION is_allowed_to_read_all(
             LEFT JOIN streams s 
                 ON rs.data_provider = s.data_provider 
                 AND rs.stream_id = s.stream_id
+                AND s.archived_at IS NULL
             WHERE s.data_provider IS NULL
         ),
         -- Find substreams that are private
@@ -351,6 +359,7 @@ CREATE OR REPLACE ACTION is_allowed_to_read_all(
                     AND m.metadata_key = 'allow_read_wallet'
                     AND LOWER(m.value_ref) = LOWER($wallet_address)
                     AND m.disabled_at IS NULL
+                    AND (m.expires_at IS NULL OR m.expires_at > @height)
                 LIMIT 1
             ) 
             -- check if it's not the owner
@@ -364,6 +373,19 @@ CREATE OR REPLACE ACTION is_allowed_to_read_all(
                     AND LOWER(m.value_ref) = LOWER($wallet_address)
                 LIMIT 1
             ) 
+            -- check if it's not allowed through an access group
+            AND NOT EXISTS (
+                SELECT 1
+                FROM metadata m
+                JOIN access_group_members gm ON gm.group_id = m.value_s
+                WHERE m.data_provider = p.data_provider
+                    AND m.stream_id = p.stream_id
+                    AND m.metadata_key = 'allow_read_group'
+                    AND m.disabled_at IS NULL
+                    AND (m.expires_at IS NULL OR m.expires_at > @height)
+                    AND gm.wallet = LOWER($wallet_address)
+                LIMIT 1
+            )
         )
     SELECT 
         (SELECT COUNT(*) FROM inexisting_substreams) AS missing_count,
@@ -599,6 +621,7 @@ CREATE OR REPLACE ACTION is_allowed_to_compose_all(
             LEFT JOIN streams s
               ON p.child_data_provider = s.data_provider
              AND p.child_stream_id = s.stream_id
+             AND s.archived_at IS NULL
             WHERE s.data_provider IS NULL
         ),
         -- For each edge, if the child is private, check that the child whitelists its parent.
@@ -624,6 +647,7 @@ CREATE OR REPLACE ACTION is_allowed_to_compose_all(
                   AND m2.metadata_key = 'allow_compose_stream'
                   AND m2.disabled_at IS NULL
                   AND m2.value_ref = p.parent_stream_id::text
+                  AND m2.value_s = p.parent_data_provider
                 LIMIT 1
             )
             -- check if both aren't from the same owner, which could mean that they have permission by default
@@ -666,7 +690,7 @@ CREATE OR REPLACE ACTION is_allowed_to_compose_all(
 
 /**
  * is_wallet_allowed_to_write: Checks if a wallet can write to a stream.
- * Grants write access if wallet is stream owner or has explicit permission.
+ * Grants write access if wallet is stream owner or has explicit permission, directly or through an access group.
  */
 CREATE OR REPLACE ACTION is_wallet_allowed_to_write(
     $data_provider TEXT,
@@ -694,13 +718,18 @@ CREATE OR REPLACE ACTION is_wallet_allowed_to_write(
         return true;
     }
 
+    -- Check if the wallet is allowed through one of the stream's access groups
+    if is_wallet_in_stream_access_group($data_provider, $stream_id, 'allow_write_group', $wallet) {
+        return true;
+    }
+
     return false;
 };
 
 /**
  * is_wallet_allowed_to_write_batch: Checks if a wallet can write to multiple streams.
- * Checks permission for each stream in the provided arrays and returns the valid streams.
- * Useful for batch operations to validate permissions efficiently.
+ * Returns a row per stream, in the order of the arguments, telling whether the wallet owns it
+ * or has explicit write permission. Useful for batch operations to validate permissions efficiently.
  */
 CREATE OR REPLACE ACTION is_wallet_allowed_to_write_batch(
     $data_providers TEXT[],
@@ -716,12 +745,12 @@ CREATE OR REPLACE ACTION is_wallet_allowed_to_write_batch(
     }
     $wallet := LOWER($wallet);
 
-    $exist_array BOOLEAN[];
+    $owner_array BOOLEAN[];
     $permission_array BOOLEAN[];
 
     -- Check if the wallet is the stream owner
     for $row in is_stream_owner_batch($data_providers, $stream_ids, $wallet) {
-        $exist_array := array_append($exist_array, $row.stream_exists);
+        $owner_array := array_append($owner_array, $row.is_owner);
     }
 
     -- Check if the wallet has explicit write permission for each stream
@@ -729,16 +758,15 @@ CREATE OR REPLACE ACTION is_wallet_allowed_to_write_batch(
         $permission_array := array_append($permission_array, $row.has_permission);
     }
 
-    for $idx in array_length($exist_array) {
-        if $exist_array[$idx] AND $permission_array[$idx] {
-            return NEXT $data_providers[$idx], $stream_ids[$idx], true;
-        }
+    for $idx in 1..array_length($owner_array) {
+        return NEXT $data_providers[$idx], $stream_ids[$idx], $owner_array[$idx] OR $permission_array[$idx];
     }
 };
 
 /**
  * has_write_permission_batch: Checks if a wallet has explicit write permission for multiple streams.
- * This doesn't check ownership, nor existence, only explicit permissions via allow_write_wallet metadata.
+ * This doesn't check ownership, nor existence, only explicit permissions via allow_write_wallet
+ * and allow_write_group metadata.
  * Returns a table indicating permission status for each stream.
  */
 CREATE OR REPLACE ACTION has_write_permission_batch(
@@ -777,31 +805,141 @@ CREATE OR REPLACE ACTION has_write_permission_batch(
     ),
     arguments AS (
         SELECT 
+            idx,
             stream_arrays.data_providers[idx] AS data_provider,
             stream_arrays.stream_ids[idx] AS stream_id
         FROM indexes
         JOIN stream_arrays ON 1=1
     ),
-    -- Check which streams have explicit write permission for the wallet
+    -- Check which streams have explicit write permission for the wallet, directly or through an access group
     permission_check AS (
         SELECT 
+            a.idx,
             a.data_provider,
             a.stream_id,
-            CASE WHEN m.value_ref IS NOT NULL THEN true ELSE false END AS has_permission
+            CASE WHEN EXISTS (
+                SELECT 1
+                FROM metadata m
+                WHERE m.data_provider = a.data_provider
+                  AND m.stream_id = a.stream_id
+                  AND m.metadata_key = 'allow_write_wallet'
+                  AND LOWER(m.value_ref) = $lowercase_wallet
+                  AND m.disabled_at IS NULL
+                  AND (m.expires_at IS NULL OR m.expires_at > @height)
+            ) OR EXISTS (
+                SELECT 1
+                FROM metadata m
+                JOIN access_group_members gm ON gm.group_id = m.value_s
+                WHERE m.data_provider = a.data_provider
+                  AND m.stream_id = a.stream_id
+                  AND m.metadata_key = 'allow_write_group'
+                  AND m.disabled_at IS NULL
+                  AND (m.expires_at IS NULL OR m.expires_at > @height)
+                  AND gm.wallet = $lowercase_wallet
+            ) THEN true ELSE false END AS has_permission
         FROM arguments a
-        LEFT JOIN (
-            SELECT data_provider, stream_id, value_ref
-            FROM metadata
-            WHERE metadata_key = 'allow_write_wallet'
-              AND LOWER(value_ref) = $lowercase_wallet
-              AND disabled_at IS NULL
-            ORDER BY created_at DESC
-        ) m ON a.data_provider = m.data_provider AND a.stream_id = m.stream_id
     )
     -- Combine results
     SELECT 
         p.data_provider,
         p.stream_id,
         p.has_permission
-    FROM permission_check p;
+    FROM permission_check p
+    ORDER BY p.idx;
+};
+
+/**
+ * grant_stream_access: Grants read or write access to a wallet or an access group until a block height.
+ * Works like insert_metadata (see insert_metadata_row) with one of the keys allow_read_wallet, allow_write_wallet,
+ * allow_read_group or allow_write_group, but the grant stops applying at $expires_at.
+ */
+CREATE OR REPLACE ACTION grant_stream_access(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $key TEXT,
+    $grantee TEXT,
+    $expires_at INT8
+) PUBLIC {
+    $val_type TEXT;
+    if $key = 'allow_read_wallet' OR $key = 'allow_write_wallet' {
+        $val_type := 'ref';
+        if NOT check_ethereum_address(LOWER($grantee)) {
+            ERROR('Invalid grantee address. Must be a valid Ethereum address: ' || $grantee);
+        }
+    } elseif $key = 'allow_read_group' OR $key = 'allow_write_group' {
+        $val_type := 'string';
+    } else {
+        ERROR(FORMAT('Unknown grant key "%s". Valid keys = "allow_read_wallet" | "allow_write_wallet" | "allow_read_group" | "allow_write_group"', $key));
+    }
+
+    if $expires_at IS NULL OR $expires_at <= @height {
+        ERROR('expires_at must be a block height in the future');
+    }
+
+    -- checks ownership and inserts the grant
+    insert_metadata_row($data_provider, $stream_id, $key, $grantee, $val_type, $expires_at);
+
+    log_audit_event('grant_stream_access', $data_provider, $stream_id, 'key=' || $key || ' grantee=' || $grantee || ' expires_at=' || $expires_at::TEXT);
+};
+
+/**
+ * get_expiring_grants: Lists the grants of a data provider's streams that expire within
+ * $within_blocks blocks. Expired and disabled grants are not listed.
+ */
+CREATE OR REPLACE ACTION get_expiring_grants(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $within_blocks INT8
+) PUBLIC view returns table(
+    stream_id TEXT,
+    row_id UUID,
+    metadata_key TEXT,
+    grantee TEXT,
+    expires_at INT8
+) {
+    $data_provider := LOWER($data_provider);
+
+    if $within_blocks IS NULL OR $within_blocks < 0 {
+        ERROR('within_blocks must be a positive number of blocks');
+    }
+
+    RETURN SELECT m.stream_id, m.row_id, m.metadata_key, COALESCE(m.value_ref, m.value_s) AS grantee, m.expires_at
+        FROM metadata m
+        WHERE m.data_provider = $data_provider
+        AND ($stream_id IS NULL OR m.stream_id = $stream_id)
+        AND m.metadata_key IN ('allow_read_wallet', 'allow_write_wallet', 'allow_read_group', 'allow_write_group')
+        AND m.disabled_at IS NULL
+        AND m.expires_at > @height
+        AND m.expires_at <= @height + $within_blocks
+        ORDER BY m.expires_at ASC, m.stream_id ASC, m.metadata_key ASC;
+};
+
+/**
+ * grant_compose_permission: Whitelists a parent stream, by data provider and stream id,
+ * to compose a stream with private compose_visibility. The parent can belong to another owner.
+ * Stored as allow_compose_stream metadata, revoked with disable_metadata.
+ */
+CREATE OR REPLACE ACTION grant_compose_permission(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $parent_data_provider TEXT,
+    $parent_stream_id TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $parent_data_provider := LOWER($parent_data_provider);
+    $lower_caller TEXT := LOWER(@caller);
+
+    if !is_stream_owner($data_provider, $stream_id, $lower_caller) {
+        ERROR('Only stream owner can grant compose permission');
+    }
+
+    if NOT check_ethereum_address($parent_data_provider) {
+        ERROR('Invalid parent data provider. Must be a valid Ethereum address: ' || $parent_data_provider);
+    }
+
+    $row_id UUID := uuid_generate_kwil(@txid || 'allow_compose_stream' || $parent_data_provider || $parent_stream_id);
+    INSERT INTO metadata (row_id, data_provider, stream_id, metadata_key, value_s, value_ref, created_at)
+    VALUES ($row_id, $data_provider, $stream_id, 'allow_compose_stream', $parent_data_provider, $parent_stream_id, @height);
+
+    log_audit_event('grant_compose_permission', $data_provider, $stream_id, 'parent=' || $parent_data_provider || '/' || $parent_stream_id);
 };
@@ -1,6 +1,156 @@
+/**
+ * validate_record_inserts: Enforces the validation rules of the streams on records about to be inserted.
+ * Rules are optional stream metadata:
+ *   - min_value, max_value (float): bounds of the value
+ *   - max_pct_change (float): max change against the previous record, in percent
+ *   - min_event_time (int): earliest accepted event_time
+ *   - allow_backfill (bool): when false, event_time must be after every stored record
+ * The latest record of each stream is tracked across the whole batch, starting from the
+ * latest stored one, so rows of other streams in between don't reset it. The previous
+ * record is that latest record, or for a backfilled row the latest one stored before
+ * its event_time.
+ * Errors on the first invalid row, with its position in the batch.
+ */
+CREATE OR REPLACE ACTION validate_record_inserts(
+    $data_provider TEXT[],
+    $stream_id TEXT[],
+    $event_time INT8[],
+    $value NUMERIC(36,18)[]
+) PRIVATE view {
+    -- rules of the current stream, reloaded when the batch moves to another stream
+    $rules_data_provider TEXT;
+    $rules_stream_id TEXT;
+    $min_value NUMERIC(36,18);
+    $max_value NUMERIC(36,18);
+    $max_pct_change NUMERIC(36,18);
+    $min_event_time INT8;
+    $allow_backfill BOOL;
+
+    -- latest record of each stream seen in the batch, keyed by data_provider/stream_id
+    $latest_keys TEXT[] := []::TEXT[];
+    $latest_event_times INT8[] := []::INT8[];
+    $latest_values NUMERIC(36,18)[] := []::NUMERIC(36,18)[];
+
+    for $i in 1..array_length($data_provider) {
+        if $rules_stream_id IS NULL OR $rules_data_provider != $data_provider[$i] OR $rules_stream_id != $stream_id[$i] {
+            $rules_data_provider := $data_provider[$i];
+            $rules_stream_id := $stream_id[$i];
+            $min_value := get_latest_metadata_float($rules_data_provider, $rules_stream_id, 'min_value');
+            $max_value := get_latest_metadata_float($rules_data_provider, $rules_stream_id, 'max_value');
+            $max_pct_change := get_latest_metadata_float($rules_data_provider, $rules_stream_id, 'max_pct_change');
+            $min_event_time := get_latest_metadata_int($rules_data_provider, $rules_stream_id, 'min_event_time');
+            $allow_backfill := COALESCE(get_latest_metadata_bool($rules_data_provider, $rules_stream_id, 'allow_backfill'), true);
+        }
+
+        $row_desc TEXT := format('record %s (stream_id=%s, event_time=%s, value=%s)', $i, $stream_id[$i], $event_time[$i], $value[$i]);
+
+        if $min_value IS NOT NULL AND $value[$i] < $min_value {
+            ERROR(format('%s rejected: value is below min_value %s', $row_desc, $min_value));
+        }
+        if $max_value IS NOT NULL AND $value[$i] > $max_value {
+            ERROR(format('%s rejected: value is above max_value %s', $row_desc, $max_value));
+        }
+        if $min_event_time IS NOT NULL AND $event_time[$i] < $min_event_time {
+            ERROR(format('%s rejected: event_time is before min_event_time %s', $row_desc, $min_event_time));
+        }
+
+        if $allow_backfill AND $max_pct_change IS NULL {
+            continue;
+        }
+
+        -- find the latest record of the stream, loading the stored one on its first row
+        $latest_key TEXT := $data_provider[$i] || '/' || $stream_id[$i];
+        $latest_idx INT := 0;
+        $latest_count INT := COALESCE(array_length($latest_keys), 0);
+        if $latest_count > 0 {
+            for $j in 1..$latest_count {
+                if $latest_keys[$j] = $latest_key {
+                    $latest_idx := $j;
+                }
+            }
+        }
+        if $latest_idx = 0 {
+            $stored_event_time INT8;
+            $stored_value NUMERIC(36,18);
+            for $row in SELECT event_time, value
+                FROM (
+                    SELECT
+                        pe.event_time,
+                        pe.value,
+                        pe.is_tombstone,
+                        ROW_NUMBER() OVER (
+                            PARTITION BY pe.event_time
+                            ORDER BY pe.created_at DESC
+                        ) as rn
+                    FROM primitive_events pe
+                    WHERE pe.data_provider = $data_provider[$i]
+                    AND pe.stream_id = $stream_id[$i]
+                ) revisions
+                WHERE revisions.rn = 1 AND revisions.is_tombstone = false -- skip values replaced or retracted by a later revision
+                ORDER BY event_time DESC
+                LIMIT 1 {
+                $stored_event_time := $row.event_time;
+                $stored_value := $row.value;
+            }
+            $latest_keys := array_append($latest_keys, $latest_key);
+            $latest_event_times := array_append($latest_event_times, $stored_event_time);
+            $latest_values := array_append($latest_values, $stored_value);
+            $latest_idx := $latest_count + 1;
+        }
+        $latest_event_time INT8 := $latest_event_times[$latest_idx];
+        $latest_value NUMERIC(36,18) := $latest_values[$latest_idx];
+
+        if !$allow_backfill AND $latest_event_time IS NOT NULL AND $event_time[$i] <= $latest_event_time {
+            ERROR(format('%s rejected: backfill is not allowed, latest event_time is %s', $row_desc, $latest_event_time));
+        }
+
+        if $max_pct_change IS NOT NULL {
+            $previous_value NUMERIC(36,18);
+            if $latest_event_time IS NULL OR $latest_event_time < $event_time[$i] {
+                $previous_value := $latest_value;
+            } else {
+                for $row in SELECT value
+                    FROM (
+                        SELECT
+                            pe.event_time,
+                            pe.value,
+                            pe.is_tombstone,
+                            ROW_NUMBER() OVER (
+                                PARTITION BY pe.event_time
+                                ORDER BY pe.created_at DESC
+                            ) as rn
+                        FROM primitive_events pe
+                        WHERE pe.data_provider = $data_provider[$i]
+                        AND pe.stream_id = $stream_id[$i]
+                        AND pe.event_time < $event_time[$i]
+                    ) revisions
+                    WHERE revisions.rn = 1 AND revisions.is_tombstone = false -- skip values replaced or retracted by a later revision
+                    ORDER BY event_time DESC
+                    LIMIT 1 {
+                    $previous_value := $row.value;
+                }
+            }
+
+            -- a change from zero has no percentage
+            if $previous_value IS NOT NULL AND $previous_value != 0::NUMERIC(36,18) {
+                $pct_change NUMERIC(72,36) := ABS($value[$i]::NUMERIC(72,36) - $previous_value::NUMERIC(72,36))
+                    * 100::NUMERIC(72,36) / ABS($previous_value::NUMERIC(72,36));
+                if $pct_change > $max_pct_change::NUMERIC(72,36) {
+                    ERROR(format('%s rejected: change of %s%% from previous value %s exceeds max_pct_change %s', $row_desc, $pct_change::NUMERIC(36,18), $previous_value, $max_pct_change));
+                }
+            }
+        }
+
+        if $latest_event_time IS NULL OR $event_time[$i] >= $latest_event_time {
+            $latest_event_times[$latest_idx] := $event_time[$i];
+            $latest_values[$latest_idx] := $value[$i];
+        }
+    }
+};
+
 /**
  * insert_record: Adds a new data point to a primitive stream.
- * Validates write permissions and stream existence before insertion.
+ * Validates write permissions, stream existence and the stream's validation rules before insertion.
  */
 CREATE OR REPLACE ACTION insert_record(
     $data_provider TEXT,
@@ -25,17 +175,23 @@ CREATE OR REPLACE ACTION insert_record(
         ERROR('stream is not a primitive stream');
     }
 
+    -- Ensure the record passes the validation rules of the stream
+    validate_record_inserts(ARRAY[$data_provider], ARRAY[$stream_id], ARRAY[$event_time], ARRAY[$value]);
+
     $current_block INT := @height;
 
     -- Insert the new record into the primitive_events table
     INSERT INTO primitive_events (stream_id, data_provider, event_time, value, created_at)
     VALUES ($stream_id, $data_provider, $event_time, $value, $current_block);
+    record_block_timestamp();
+
+    log_audit_event('insert_record', $data_provider, $stream_id, 'event_time=' || $event_time::TEXT || ' value=' || $value::TEXT);
 };
 
 
 /**
  * insert_records: Adds multiple new data points to a primitive stream in batch.
- * Validates write permissions and stream existence for each record before insertion.
+ * Validates write permissions, stream existence and validation rules for each record before insertion.
  */
 CREATE OR REPLACE ACTION insert_records(
     $data_provider TEXT[],
@@ -43,6 +199,44 @@ CREATE OR REPLACE ACTION insert_records(
     $event_time INT8[],
     $value NUMERIC(36,18)[]
 ) PUBLIC {
+    insert_records_batch($data_provider, $stream_id, $event_time, $value, NULL);
+};
+
+/**
+ * insert_embargoed_records: Adds a batch of records that stay hidden until a release.
+ * Works like insert_records, but readers only see the records from block height
+ * $visible_from onward. Writers of the stream, allow_write_group members included,
+ * read them ahead, see get_embargo_cutoff.
+ * Releases are block heights only: the height of a future wall-clock time isn't known
+ * until its block is produced, so a release time has to be converted to the height
+ * expected by then by the publisher.
+ */
+CREATE OR REPLACE ACTION insert_embargoed_records(
+    $data_provider TEXT[],
+    $stream_id TEXT[],
+    $event_time INT8[],
+    $value NUMERIC(36,18)[],
+    $visible_from INT8
+) PUBLIC {
+    if $visible_from IS NULL {
+        ERROR('visible_from is required for embargoed records');
+    }
+
+    insert_records_batch($data_provider, $stream_id, $event_time, $value, $visible_from);
+};
+
+/**
+ * insert_records_batch: Validates and inserts a batch of records at the current height,
+ * embargoed until $visible_from unless it's NULL. Logs a single audit entry for the batch,
+ * under insert_embargoed_records when embargoed.
+ */
+CREATE OR REPLACE ACTION insert_records_batch(
+    $data_provider TEXT[],
+    $stream_id TEXT[],
+    $event_time INT8[],
+    $value NUMERIC(36,18)[],
+    $visible_from INT8
+) PRIVATE {
     for $i in 1..array_length($data_provider) {
         $data_provider[$i] := LOWER($data_provider[$i]);
     }
@@ -76,6 +270,9 @@ CREATE OR REPLACE ACTION insert_records(
         }
     }
 
+    -- Ensure each record passes the validation rules of its stream
+    validate_record_inserts($data_provider, $stream_id, $event_time, $value);
+
     -- Insert all records using WITH RECURSIVE pattern to avoid round trips
     WITH RECURSIVE 
     indexes AS (
@@ -100,13 +297,87 @@ CREATE OR REPLACE ACTION insert_records(
         FROM indexes
         JOIN record_arrays ON 1=1
     )
-    INSERT INTO primitive_events (stream_id, data_provider, event_time, value, created_at, truflation_created_at)
+    INSERT INTO primitive_events (stream_id, data_provider, event_time, value, created_at, truflation_created_at, visible_from)
     SELECT 
         stream_id, 
         data_provider, 
         event_time, 
         value, 
         $current_block,
-        NULL
+        NULL,
+        $visible_from
     FROM arguments;
-};
\ No newline at end of file
+    record_block_timestamp();
+
+    if $visible_from IS NULL {
+        log_record_inserts('insert_records', $data_provider, $stream_id, $event_time, NULL);
+    } else {
+        log_record_inserts('insert_embargoed_records', $data_provider, $stream_id, $event_time, 'visible_from=' || $visible_from::TEXT);
+    }
+};
+
+/**
+ * retract_record: Withdraws the record of a primitive stream at an event time.
+ * Inserts a tombstone revision at the current height, so queries with a frozen_at
+ * at or after it skip the record, while earlier frozen_at queries still see it.
+ * A new insert_record at the same event time makes a value visible again.
+ * A record written in the same block is turned into the tombstone in place, as the
+ * primary key allows a single revision per block.
+ */
+CREATE OR REPLACE ACTION retract_record(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $event_time INT8
+) PUBLIC {
+    $data_provider TEXT := LOWER($data_provider);
+    $lower_caller TEXT := LOWER(@caller);
+    -- Ensure the wallet is allowed to write
+    if !is_wallet_allowed_to_write($data_provider, $stream_id, $lower_caller) {
+        ERROR('wallet not allowed to write');
+    }
+
+    -- Ensure that the stream/contract is existent
+    if !stream_exists($data_provider, $stream_id) {
+        ERROR('stream does not exist');
+    }
+
+    -- Ensure that the stream is a primitive stream
+    if is_primitive_stream($data_provider, $stream_id) == false {
+        ERROR('stream is not a primitive stream');
+    }
+
+    -- Only the latest revision counts: there must be a visible record to retract
+    $has_record BOOL := false;
+    $latest_created_at INT8;
+    for $row in SELECT is_tombstone, created_at
+        FROM primitive_events
+        WHERE data_provider = $data_provider
+        AND stream_id = $stream_id
+        AND event_time = $event_time
+        ORDER BY created_at DESC
+        LIMIT 1 {
+        $has_record := !$row.is_tombstone;
+        $latest_created_at := $row.created_at;
+    }
+    if !$has_record {
+        ERROR('no record to retract at event_time ' || $event_time::TEXT);
+    }
+
+    $current_block INT := @height;
+
+    -- The tombstone value is never read, queries skip tombstone revisions
+    if $latest_created_at = $current_block {
+        UPDATE primitive_events
+        SET value = 0::NUMERIC(36,18), is_tombstone = true, visible_from = NULL
+        WHERE data_provider = $data_provider
+        AND stream_id = $stream_id
+        AND event_time = $event_time
+        AND created_at = $current_block;
+    } else {
+        INSERT INTO primitive_events (stream_id, data_provider, event_time, value, created_at, is_tombstone)
+        VALUES ($stream_id, $data_provider, $event_time, 0::NUMERIC(36,18), $current_block, true);
+    }
+    record_block_timestamp();
+
+    log_audit_event('retract_record', $data_provider, $stream_id, 'event_time=' || $event_time::TEXT);
+};
@@ -47,6 +47,19 @@ CREATE OR REPLACE ACTION insert_taxonomy(
         $start_date := 0;
     }
 
+    -- Reject children that (indirectly) include the parent, whatever the start_date.
+    for $i in 1..$num_children {
+        $cycle_path TEXT := get_taxonomy_cycle_path($data_provider, $stream_id, $child_data_providers[$i], $child_stream_ids[$i]);
+        if $cycle_path IS NOT NULL {
+            ERROR('taxonomy would create a cycle: ' || $cycle_path);
+        }
+    }
+
+    -- Reject children whose tree sets another aggregation method than the parent's
+    for $i in 1..$num_children {
+        check_aggregation_method_link($data_provider, $stream_id, $child_data_providers[$i], $child_stream_ids[$i]);
+    }
+
     -- Retrieve the current group_sequence for this parent and increment it by 1.
     $new_group_sequence := get_current_group_sequence($data_provider, $stream_id, true) + 1;
 
@@ -81,6 +94,114 @@ CREATE OR REPLACE ACTION insert_taxonomy(
             $start_date          -- Start date of the taxonomy.
         );
     }
+
+    log_audit_event('insert_taxonomy', $data_provider, $stream_id, 'group_sequence=' || $new_group_sequence::TEXT || ' children=' || $num_children::TEXT || ' start_time=' || $start_date::TEXT);
+};
+
+/**
+ * get_taxonomy_cycle_path: Checks if adding a child to a parent would create a cycle.
+ * Every non-disabled definition counts, whatever its start_time or group_sequence,
+ * since a definition overshadowed today may apply again once the newer one is disabled.
+ * Returns the shortest cycle as "provider/stream -> ... -> provider/stream", or NULL if none.
+ */
+CREATE OR REPLACE ACTION get_taxonomy_cycle_path(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $child_data_provider TEXT,
+    $child_stream_id TEXT
+) private view returns (path TEXT) {
+    $data_provider := LOWER($data_provider);
+    $child_data_provider := LOWER($child_data_provider);
+    $no_path TEXT;
+
+    -- streams reachable from the child, the child included
+    $num_reachable INT := 0;
+    $closes_cycle BOOL := false;
+    for $row in WITH RECURSIVE reachable AS (
+        SELECT $child_data_provider::TEXT AS data_provider, $child_stream_id::TEXT AS stream_id
+        UNION
+        SELECT t.child_data_provider, t.child_stream_id
+        FROM reachable r
+        JOIN taxonomies t
+          ON t.data_provider = r.data_provider
+         AND t.stream_id     = r.stream_id
+        WHERE t.disabled_at IS NULL
+    )
+    SELECT data_provider, stream_id FROM reachable {
+        $num_reachable := $num_reachable + 1;
+        if $row.data_provider == $data_provider AND $row.stream_id == $stream_id {
+            $closes_cycle := true;
+        }
+    }
+
+    if !$closes_cycle {
+        return $no_path;
+    }
+
+    -- shortest distance from the child to each reachable stream.
+    -- a shortest path never visits a stream twice, so it's bounded by the reachable count
+    $level_data_providers TEXT[];
+    $level_stream_ids TEXT[];
+    $level_distances INT8[];
+    $parent_distance INT8 := 0;
+    for $row in WITH RECURSIVE levels AS (
+        SELECT $child_data_provider::TEXT AS data_provider, $child_stream_id::TEXT AS stream_id, 0::INT8 AS distance
+        UNION
+        SELECT t.child_data_provider, t.child_stream_id, l.distance + 1
+        FROM levels l
+        JOIN taxonomies t
+          ON t.data_provider = l.data_provider
+         AND t.stream_id     = l.stream_id
+        WHERE t.disabled_at IS NULL
+          AND l.distance < $num_reachable
+          -- the parent ends the path
+          AND NOT (l.data_provider = $data_provider AND l.stream_id = $stream_id)
+    )
+    SELECT data_provider, stream_id, MIN(distance)::INT8 AS distance
+    FROM levels
+    GROUP BY data_provider, stream_id
+    ORDER BY distance ASC, data_provider ASC, stream_id ASC {
+        $level_data_providers := array_append($level_data_providers, $row.data_provider);
+        $level_stream_ids := array_append($level_stream_ids, $row.stream_id);
+        $level_distances := array_append($level_distances, $row.distance);
+        if $row.data_provider == $data_provider AND $row.stream_id == $stream_id {
+            $parent_distance := $row.distance;
+        }
+    }
+    $num_levels INT := array_length($level_distances);
+
+    -- walk back from the parent to the child, one distance at a time
+    $path TEXT := $data_provider || '/' || $stream_id;
+    $current_data_provider TEXT := $data_provider;
+    $current_stream_id TEXT := $stream_id;
+    for $step in 1..$parent_distance {
+        $previous_distance INT8 := $parent_distance - $step;
+        for $i in 1..$num_levels {
+            if $level_distances[$i] == $previous_distance {
+                $candidate_data_provider TEXT := $level_data_providers[$i];
+                $candidate_stream_id TEXT := $level_stream_ids[$i];
+                $is_previous BOOL := false;
+                for $edge in SELECT 1 FROM taxonomies
+                    WHERE data_provider = $candidate_data_provider
+                    AND stream_id = $candidate_stream_id
+                    AND child_data_provider = $current_data_provider
+                    AND child_stream_id = $current_stream_id
+                    AND disabled_at IS NULL
+                    LIMIT 1 {
+                    $is_previous := true;
+                }
+                if $is_previous {
+                    $path := $candidate_data_provider || '/' || $candidate_stream_id || ' -> ' || $path;
+                    $current_data_provider := $candidate_data_provider;
+                    $current_stream_id := $candidate_stream_id;
+                    break;
+                }
+            }
+        }
+    }
+
+    -- the new definition closes the cycle
+    return $data_provider || '/' || $stream_id || ' -> ' || $path;
 };
 
 /**
@@ -185,4 +306,106 @@ CREATE OR REPLACE ACTION disable_taxonomy(
     WHERE data_provider = $data_provider
     AND stream_id = $stream_id
     AND group_sequence = $group_sequence;
+
+    log_audit_event('disable_taxonomy', $data_provider, $stream_id, 'group_sequence=' || $group_sequence::TEXT);
+};
+
+
+/**
+ * get_stream_dependents: Finds the composed streams that use a stream as a child.
+ * Walks taxonomies upward, the reverse of get_category_streams.
+ * Only effective definitions count: not disabled, and not overshadowed by a newer
+ * group_sequence with the same start_time.
+ * With $active_at, only the definition active at that time is considered for each parent,
+ * otherwise any effective definition, past or future, counts.
+ * With $recursive, dependents of dependents are included; depth is the shortest distance.
+ */
+CREATE OR REPLACE ACTION get_stream_dependents(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $recursive BOOL,
+    $active_at INT8
+) PUBLIC view returns table(
+    data_provider TEXT,
+    stream_id TEXT,
+    depth INT8
+) {
+    $data_provider := LOWER($data_provider);
+
+    if !stream_exists($data_provider, $stream_id) {
+        ERROR('Stream does not exist: data_provider=' || $data_provider || ' stream_id=' || $stream_id);
+    }
+
+    $follow_parents BOOL := COALESCE($recursive, false);
+
+    RETURN WITH RECURSIVE dependents AS (
+        SELECT
+            t.data_provider,
+            t.stream_id,
+            1::INT8 AS distance
+        FROM taxonomies t
+        WHERE t.child_data_provider = $data_provider
+          AND t.child_stream_id     = $stream_id
+          AND t.disabled_at IS NULL
+          -- not overshadowed by a newer version with the same start_time
+          AND t.group_sequence = (
+                SELECT MAX(t2.group_sequence)
+                FROM taxonomies t2
+                WHERE t2.data_provider = t.data_provider
+                  AND t2.stream_id     = t.stream_id
+                  AND t2.start_time    = t.start_time
+                  AND t2.disabled_at   IS NULL
+              )
+          -- the version active at $active_at, if given
+          AND ($active_at IS NULL OR t.start_time = (
+                SELECT MAX(t3.start_time)
+                FROM taxonomies t3
+                WHERE t3.data_provider = t.data_provider
+                  AND t3.stream_id     = t.stream_id
+                  AND t3.disabled_at   IS NULL
+                  AND t3.start_time   <= $active_at
+              ))
+
+        UNION
+
+        SELECT
+            t.data_provider,
+            t.stream_id,
+            d.distance + 1
+        FROM dependents d
+        JOIN taxonomies t
+          ON t.child_data_provider = d.data_provider
+         AND t.child_stream_id     = d.stream_id
+        WHERE $follow_parents
+          -- bounds the walk if taxonomies ever form a cycle
+          AND d.distance < 100
+          AND t.disabled_at IS NULL
+          -- not overshadowed by a newer version with the same start_time
+          AND t.group_sequence = (
+                SELECT MAX(t2.group_sequence)
+                FROM taxonomies t2
+                WHERE t2.data_provider = t.data_provider
+                  AND t2.stream_id     = t.stream_id
+                  AND t2.start_time    = t.start_time
+                  AND t2.disabled_at   IS NULL
+              )
+          -- the version active at $active_at, if given
+          AND ($active_at IS NULL OR t.start_time = (
+                SELECT MAX(t3.start_time)
+                FROM taxonomies t3
+                WHERE t3.data_provider = t.data_provider
+                  AND t3.stream_id     = t.stream_id
+                  AND t3.disabled_at   IS NULL
+                  AND t3.start_time   <= $active_at
+              ))
+    )
+    SELECT d.data_provider, d.stream_id, MIN(d.distance)::INT8 AS depth
+    FROM dependents d
+    -- archived streams don't depend on anything anymore
+    JOIN streams s
+      ON s.data_provider = d.data_provider
+     AND s.stream_id     = d.stream_id
+     AND s.archived_at   IS NULL
+    GROUP BY d.data_provider, d.stream_id
+    ORDER BY MIN(d.distance) ASC, d.data_provider ASC, d.stream_id ASC;
 };
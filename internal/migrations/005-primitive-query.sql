@@ -1,7 +1,38 @@
+/**
+ * get_embargo_cutoff: Returns the highest visible_from the caller can read in a stream.
+ * Embargoed records (insert_embargoed_records) are released at their visible_from height,
+ * and a query as of $frozen_at only sees the records released by then. Writers of the
+ * stream (owner, allow_write_wallet, allow_write_group members) read them ahead.
+ * Without a block height, only the records that aren't embargoed or whose release height
+ * was already reached by a write are readable.
+ */
+CREATE OR REPLACE ACTION get_embargo_cutoff(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $frozen_at INT8
+) PRIVATE view returns (cutoff INT8) {
+    if is_wallet_allowed_to_write($data_provider, $stream_id, @caller) {
+        return 9223372036854775000;
+    }
+
+    $current_height INT8 := @height;
+    if $current_height < 0 {
+        -- views called outside of a block (and syncing nodes) have no height, only the
+        -- heights already written to block_timestamps are known to have passed
+        $current_height := 0;
+        for $row in SELECT height FROM block_timestamps ORDER BY height DESC LIMIT 1 {
+            $current_height := $row.height;
+        }
+    }
+    return LEAST($current_height, COALESCE($frozen_at, $current_height));
+};
+
 /**
  * get_record_primitive: Retrieves time series data for primitive streams.
  * Handles gap filling by using the last value before the requested range.
  * Validates read permissions and supports time-based filtering.
+ * Records retracted by retract_record are skipped unless frozen_at predates the retraction.
+ * Embargoed records (insert_embargoed_records) are skipped until released, see get_embargo_cutoff.
  */
 CREATE OR REPLACE ACTION get_record_primitive(
     $data_provider TEXT,
@@ -24,6 +55,7 @@ CREATE OR REPLACE ACTION get_record_primitive(
     $effective_from INT8 := COALESCE($from, 0);
     $effective_to INT8 := COALESCE($to, $max_int8);
     $effective_frozen_at INT8 := COALESCE($frozen_at, $max_int8);
+    $embargo_cutoff INT8 := get_embargo_cutoff($data_provider, $stream_id, $frozen_at);
 
     -- for historical consistency, if both from and to are omitted, return the latest record
     if $from IS NULL AND $to IS NULL {
@@ -35,21 +67,28 @@ CREATE OR REPLACE ACTION get_record_primitive(
 
 
     RETURN WITH
-    -- Get base records within time range
+    -- Get base records within time range: the latest revision of each event_time created by
+    -- frozen_at among those the caller can read, unless it's a tombstone (retract_record)
     interval_records AS (
-        SELECT
-            pe.event_time,
-            pe.value,
-            ROW_NUMBER() OVER (
-                PARTITION BY pe.event_time
-                ORDER BY pe.created_at DESC
-            ) as rn
-        FROM primitive_events pe
-        WHERE pe.data_provider = $data_provider
-            AND pe.stream_id = $stream_id
-            AND pe.created_at <= $effective_frozen_at
-            AND pe.event_time > $effective_from
-            AND pe.event_time <= $effective_to
+        SELECT event_time, value
+        FROM (
+            SELECT
+                pe.event_time,
+                pe.value,
+                pe.is_tombstone,
+                ROW_NUMBER() OVER (
+                    PARTITION BY pe.event_time
+                    ORDER BY pe.created_at DESC
+                ) as rn
+            FROM primitive_events pe
+            WHERE pe.data_provider = $data_provider
+                AND pe.stream_id = $stream_id
+                AND pe.created_at <= $effective_frozen_at
+                AND COALESCE(pe.visible_from, 0) <= $embargo_cutoff -- embargo, see get_embargo_cutoff
+                AND pe.event_time > $effective_from
+                AND pe.event_time <= $effective_to
+        ) revisions
+        WHERE revisions.rn = 1 AND revisions.is_tombstone = false
     ),
 
     -- get anchor at or before from date
@@ -61,6 +100,17 @@ CREATE OR REPLACE ACTION get_record_primitive(
             AND pe.stream_id = $stream_id
             AND pe.event_time <= $effective_from
             AND pe.created_at <= $effective_frozen_at
+            AND COALESCE(pe.visible_from, 0) <= $embargo_cutoff -- embargo, see get_embargo_cutoff
+            AND pe.is_tombstone = false
+            AND NOT EXISTS ( -- replaced or retracted by a later revision
+                SELECT 1 FROM primitive_events later
+                WHERE later.data_provider = pe.data_provider
+                AND later.stream_id = pe.stream_id
+                AND later.event_time = pe.event_time
+                AND later.created_at > pe.created_at
+                AND later.created_at <= $effective_frozen_at
+                AND COALESCE(later.visible_from, 0) <= $embargo_cutoff
+            )
         ORDER BY pe.event_time DESC, pe.created_at DESC
         LIMIT 1
     ),
@@ -72,7 +122,6 @@ CREATE OR REPLACE ACTION get_record_primitive(
         UNION ALL
         -- Add filtered base records
         SELECT event_time, value FROM interval_records
-        WHERE rn = 1
     )
     -- Final selection with fallback
     SELECT event_time, value FROM combined_results
@@ -103,6 +152,7 @@ CREATE OR REPLACE ACTION get_last_record_primitive(
     $max_int8 INT8 := 9223372036854775000;
     $effective_before INT8 := COALESCE($before, $max_int8);
     $effective_frozen_at INT8 := COALESCE($frozen_at, $max_int8);
+    $embargo_cutoff INT8 := get_embargo_cutoff($data_provider, $stream_id, $frozen_at);
 
     RETURN SELECT pe.event_time, pe.value
         FROM primitive_events pe
@@ -110,6 +160,17 @@ CREATE OR REPLACE ACTION get_last_record_primitive(
         AND pe.stream_id = $stream_id
         AND pe.event_time < $effective_before
         AND pe.created_at <= $effective_frozen_at
+        AND COALESCE(pe.visible_from, 0) <= $embargo_cutoff -- embargo, see get_embargo_cutoff
+        AND pe.is_tombstone = false
+        AND NOT EXISTS ( -- replaced or retracted by a later revision
+            SELECT 1 FROM primitive_events later
+            WHERE later.data_provider = pe.data_provider
+            AND later.stream_id = pe.stream_id
+            AND later.event_time = pe.event_time
+            AND later.created_at > pe.created_at
+            AND later.created_at <= $effective_frozen_at
+            AND COALESCE(later.visible_from, 0) <= $embargo_cutoff
+        )
         ORDER BY pe.event_time DESC, pe.created_at DESC
         LIMIT 1;
 };
@@ -137,6 +198,7 @@ CREATE OR REPLACE ACTION get_first_record_primitive(
     $max_int8 INT8 := 9223372036854775000;
     $effective_after INT8 := COALESCE($after, 0);
     $effective_frozen_at INT8 := COALESCE($frozen_at, $max_int8);
+    $embargo_cutoff INT8 := get_embargo_cutoff($data_provider, $stream_id, $frozen_at);
 
     RETURN SELECT pe.event_time, pe.value
         FROM primitive_events pe
@@ -144,6 +206,17 @@ CREATE OR REPLACE ACTION get_first_record_primitive(
         AND pe.stream_id = $stream_id
         AND pe.event_time >= $effective_after
         AND pe.created_at <= $effective_frozen_at
+        AND COALESCE(pe.visible_from, 0) <= $embargo_cutoff -- embargo, see get_embargo_cutoff
+        AND pe.is_tombstone = false
+        AND NOT EXISTS ( -- replaced or retracted by a later revision
+            SELECT 1 FROM primitive_events later
+            WHERE later.data_provider = pe.data_provider
+            AND later.stream_id = pe.stream_id
+            AND later.event_time = pe.event_time
+            AND later.created_at > pe.created_at
+            AND later.created_at <= $effective_frozen_at
+            AND COALESCE(later.visible_from, 0) <= $embargo_cutoff
+        )
         ORDER BY pe.event_time ASC, pe.created_at DESC
         LIMIT 1;
 };
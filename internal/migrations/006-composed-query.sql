@@ -6,8 +6,12 @@
  * - Time-varying weights assigned to child streams.
  * - Aggregating values based on current weights.
  * - Handling overshadowing taxonomy definitions (using the latest version).
- * - Filling gaps in data using Last Observation Carried Forward (LOCF).
+ * - Filling gaps in data using Last Observation Carried Forward (LOCF). Streams with
+ *   another `fill_mode` are computed by get_record_composed_filled (022-fill-modes.sql).
  * - Time-travel queries using the $frozen_at parameter.
+ * - Skipping primitive records retracted by a tombstone revision (retract_record).
+ * - Skipping embargoed primitive records before their visible_from height (insert_embargoed_records, see get_embargo_cutoff).
+ * - The stream's `aggregation_method` metadata (see 012-composed-aggregation-methods.sql).
  *
  * It employs a delta-based calculation method for efficiency, computing changes
  * in weighted sums and weight sums rather than recalculating the full state at
@@ -48,11 +52,6 @@ RETURNS TABLE(
 )  {
     $data_provider  := LOWER($data_provider);
     $lower_caller TEXT := LOWER(@caller);
-    -- Define boundary defaults and effective values
-    $max_int8 := 9223372036854775000;          -- "Infinity" sentinel for INT8
-    $effective_from := COALESCE($from, 0);      -- Lower bound, default 0
-    $effective_to := COALESCE($to, $max_int8);  -- Upper bound, default "infinity"
-    $effective_frozen_at := COALESCE($frozen_at, $max_int8);
 
     -- Validate time range
     IF $from IS NOT NULL AND $to IS NOT NULL AND $from > $to {
@@ -67,6 +66,36 @@ RETURNS TABLE(
         ERROR('Not allowed to compose stream');
     }
 
+    FOR $row IN internal_get_record_composed($data_provider, $stream_id, $from, $to, $frozen_at, NULL) {
+        RETURN NEXT $row.event_time, $row.value;
+    }
+};
+
+/**
+ * internal_get_record_composed: get_record_composed without the permission checks, with the
+ * taxonomies as of $taxonomy_height (see get_composed_primitive_weights), NULL for the current
+ * ones. get_record_revisions_composed replays a stream with it at every revision height.
+ * Doesn't check permissions, callers are responsible for it.
+ */
+CREATE OR REPLACE ACTION internal_get_record_composed(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $taxonomy_height INT8
+) PRIVATE VIEW
+RETURNS TABLE(
+    event_time INT8,
+    value NUMERIC(36,18)
+)  {
+    $data_provider  := LOWER($data_provider);
+    -- Define boundary defaults and effective values
+    $max_int8 := 9223372036854775000;          -- "Infinity" sentinel for INT8
+    $effective_from := COALESCE($from, 0);      -- Lower bound, default 0
+    $effective_to := COALESCE($to, $max_int8);  -- Upper bound, default "infinity"
+    $effective_frozen_at := COALESCE($frozen_at, $max_int8);
+
         -- for historical consistency, if both from and to are omitted, return the latest record
     if $from IS NULL AND $to IS NULL {
         FOR $row IN get_last_record_composed($data_provider, $stream_id, NULL, $effective_frozen_at) {
@@ -75,172 +104,105 @@ RETURNS TABLE(
         RETURN;
     }
 
-    RETURN WITH RECURSIVE
-    /*----------------------------------------------------------------------
-     * HIERARCHY CTE: Recursively resolves the dependency tree defined by taxonomies.
-     *
-     * Purpose: Determines the effective weighted contribution of every stream
-     * (down to the primitives) to the root composed stream over time.
-     *
-     * - Calculates the cumulative `raw_weight` for each path from the root to a child.
-     * - Determines the validity interval (`group_sequence_start`, `group_sequence_end`)
-     *   for each weighted relationship, handling overshadowing definitions.
-     * - Filters based on the query time range (`$effective_from`, `$effective_to`)
-     *   and an anchor point before `$effective_from`.
-     *
-     * Overshadowing Logic: Uses a LEFT JOIN anti-join pattern (`t2 IS NULL`) to select
-     * only the taxonomy definition with the highest `group_sequence` for any given
-     * `start_time`, ensuring that later definitions supersede earlier ones.
-     *
-     * Interval Calculation:
-     *   - `group_sequence_end` is derived using `LEAD` to find the next `start_time`
-     *     for the same parent stream.
-     *   - In the recursive step, the effective interval is the intersection
-     *     (GREATEST start, LEAST end) of the parent's and child's intervals.
-     *---------------------------------------------------------------------*/
-    hierarchy AS (
-      -- Base Case: Direct children of the root composed stream.
-      SELECT
-          t1.data_provider AS parent_data_provider,
-          t1.stream_id AS parent_stream_id,
-          t1.child_data_provider,
-          t1.child_stream_id,
-          t1.weight AS raw_weight,
-          t1.start_time AS group_sequence_start,
-          -- Calculate end time based on the start of the next definition
-          COALESCE(ot.next_start, $max_int8) - 1 AS group_sequence_end
-      FROM
-          taxonomies t1
-      -- Anti-join: Ensures we select the row with the highest group_sequence
-      -- for a given (dp, sid, start_time) by checking if a row t2 with a
-      -- higher sequence exists. We keep t1 only if no such t2 is found.
-      LEFT JOIN taxonomies t2
-        ON t1.data_provider = t2.data_provider
-       AND t1.stream_id = t2.stream_id
-       AND t1.start_time = t2.start_time
-       AND t1.group_sequence < t2.group_sequence -- t2 must have a strictly higher sequence
-       AND t2.disabled_at IS NULL -- Ignore disabled rows for overshadowing comparison
-      -- Join to find the start_time of the next taxonomy definition for this parent
-      JOIN (
-          SELECT
-              dt.data_provider, dt.stream_id, dt.start_time,
-              LEAD(dt.start_time) OVER (PARTITION BY dt.data_provider, dt.stream_id ORDER BY dt.start_time) AS next_start
-          FROM ( -- Select distinct start times within the relevant range plus anchor
-                 SELECT DISTINCT t_ot.data_provider, t_ot.stream_id, t_ot.start_time FROM taxonomies t_ot
-                 WHERE t_ot.data_provider = $data_provider AND t_ot.stream_id = $stream_id AND t_ot.disabled_at IS NULL AND t_ot.start_time <= $effective_to
-                 -- Anchor logic: Find the latest taxonomy start at or before $effective_from
-                 AND t_ot.start_time >= COALESCE((SELECT t2_anchor.start_time FROM taxonomies t2_anchor WHERE t2_anchor.data_provider=t_ot.data_provider AND t2_anchor.stream_id=t_ot.stream_id AND t2_anchor.disabled_at IS NULL AND t2_anchor.start_time<=$effective_from ORDER BY t2_anchor.start_time DESC, t2_anchor.group_sequence DESC LIMIT 1),0)
-               ) dt
-      ) ot
-        ON t1.data_provider = ot.data_provider
-       AND t1.stream_id     = ot.stream_id
-       AND t1.start_time    = ot.start_time
-      WHERE
-          t1.data_provider = $data_provider -- Filter for the specific root stream
-      AND t1.stream_id     = $stream_id
-      AND t1.disabled_at   IS NULL
-      AND t2.group_sequence IS NULL -- Keep t1 only if no row t2 with a higher sequence was found
-      -- Apply time range filter to the taxonomy start time
-      AND t1.start_time <= $effective_to
-      -- Anchor logic: Ensure we include the relevant taxonomy active at $effective_from
-      AND t1.start_time >= COALESCE(
-            (SELECT t_anchor_base.start_time
-             FROM taxonomies t_anchor_base
-             WHERE t_anchor_base.data_provider = t1.data_provider -- Correlated subquery
-               AND t_anchor_base.stream_id     = t1.stream_id     -- Correlated subquery
-               AND t_anchor_base.disabled_at   IS NULL
-               AND t_anchor_base.start_time   <= $effective_from
-             ORDER BY t_anchor_base.start_time DESC, t_anchor_base.group_sequence DESC
-             LIMIT 1
-            ), 0 -- Default to 0 if no anchor found
-          )
+    -- weighted_mean and weighted_sum use the delta method below, other methods need full states
+    $aggregation_method TEXT := get_aggregation_method($data_provider, $stream_id);
+    if $aggregation_method = 'weighted_median' OR $aggregation_method = 'geometric_mean' {
+        FOR $row IN get_record_composed_by_state($data_provider, $stream_id, $from, $to, $frozen_at, $aggregation_method, $taxonomy_height) {
+            RETURN NEXT $row.event_time, $row.value;
+        }
+        RETURN;
+    }
 
-      UNION ALL
+    -- Effective weights of the primitives over the range, see get_composed_primitive_weights,
+    -- with the highest visible_from the caller can read in each, see get_embargo_cutoff
+    $pw_data_providers := []::TEXT[];
+    $pw_stream_ids := []::TEXT[];
+    $pw_raw_weights := []::NUMERIC(36,18)[];
+    $pw_starts := []::INT8[];
+    $pw_ends := []::INT8[];
+    $pw_cutoffs := []::INT8[];
+    for $pw in get_composed_primitive_weights($data_provider, $stream_id, $from, $to, $taxonomy_height) {
+        $pw_data_providers := array_append($pw_data_providers, $pw.data_provider);
+        $pw_stream_ids := array_append($pw_stream_ids, $pw.stream_id);
+        $pw_raw_weights := array_append($pw_raw_weights, $pw.raw_weight);
+        $pw_starts := array_append($pw_starts, $pw.group_sequence_start);
+        $pw_ends := array_append($pw_ends, $pw.group_sequence_end);
+        $pw_cutoff INT8 := get_embargo_cutoff($pw.data_provider, $pw.stream_id, $frozen_at);
+        $pw_cutoffs := array_append($pw_cutoffs, $pw_cutoff);
+    }
+    -- no primitive contributes to the range
+    if COALESCE(array_length($pw_data_providers), 0) = 0 {
+        RETURN;
+    }
 
-      -- Recursive Step: Children of the children found in the previous level.
-      SELECT
-          parent.parent_data_provider,
-          parent.parent_stream_id,
-          t1_child.child_data_provider,
-          t1_child.child_stream_id,
-          -- Multiply parent weight by child weight for cumulative effect
-          (parent.raw_weight * t1_child.weight)::NUMERIC(36,18) AS raw_weight,
-          -- Effective interval start is the later of the parent's or child's start
-          GREATEST(parent.group_sequence_start, t1_child.start_time) AS group_sequence_start,
-          -- Effective interval end is the earlier of the parent's or child's end
-          LEAST(parent.group_sequence_end, (COALESCE(ot_child.next_start, $max_int8) - 1)) AS group_sequence_end
-      FROM
-          hierarchy parent -- Result from the previous recursion level
-      -- Join parent with potential child taxonomies
-      JOIN taxonomies t1_child
-        ON t1_child.data_provider = parent.child_data_provider
-       AND t1_child.stream_id     = parent.child_stream_id
-      -- Anti-join for child overshadowing (same pattern as base case)
-      LEFT JOIN taxonomies t2_child
-        ON t1_child.data_provider = t2_child.data_provider
-       AND t1_child.stream_id = t2_child.stream_id
-       AND t1_child.start_time = t2_child.start_time
-       AND t1_child.group_sequence < t2_child.group_sequence -- t2 must be higher
-       AND t2_child.disabled_at IS NULL -- Ignore disabled rows
-      -- Join to get the next start time for the child interval end calculation
-      JOIN (
-          SELECT
-              dt.data_provider, dt.stream_id, dt.start_time,
-              LEAD(dt.start_time) OVER ( PARTITION BY dt.data_provider, dt.stream_id ORDER BY dt.start_time ) AS next_start
-          FROM ( -- Select distinct start times for all potentially relevant children
-                 SELECT DISTINCT t_otc.data_provider, t_otc.stream_id, t_otc.start_time FROM taxonomies t_otc
-                 WHERE t_otc.disabled_at IS NULL AND t_otc.start_time <= $effective_to
-                 -- Anchor logic for children (find earliest relevant start)
-                 AND t_otc.start_time >= COALESCE((SELECT MIN(t2_min.start_time) FROM taxonomies t2_min WHERE t2_min.disabled_at IS NULL AND t2_min.start_time <= $effective_from), 0)
-               ) dt
-      ) ot_child
-        ON t1_child.data_provider = ot_child.data_provider
-       AND t1_child.stream_id     = ot_child.stream_id
-       AND t1_child.start_time    = ot_child.start_time
-      WHERE
-          t1_child.disabled_at IS NULL
-      AND t2_child.group_sequence IS NULL -- Keep t1_child only if no higher sequence row found
-      -- Interval Overlap Check: Ensure parent and child intervals overlap
-      AND t1_child.start_time <= parent.group_sequence_end
-      AND (COALESCE(ot_child.next_start, $max_int8) - 1) >= parent.group_sequence_start
-      -- Apply child time range/anchor filters to t1_child
-      AND t1_child.start_time <= $effective_to
-      AND t1_child.start_time >= COALESCE(
-            (SELECT t_anchor_child.start_time
-             FROM taxonomies t_anchor_child
-             WHERE t_anchor_child.data_provider = t1_child.data_provider -- Correlated
-               AND t_anchor_child.stream_id     = t1_child.stream_id     -- Correlated
-               AND t_anchor_child.disabled_at   IS NULL
-               AND t_anchor_child.start_time   <= $effective_from
-             ORDER BY t_anchor_child.start_time DESC, t_anchor_child.group_sequence DESC
-             LIMIT 1
-            ), 0
-          )
+    RETURN WITH RECURSIVE
+    indexes AS (
+        SELECT 1 AS idx
+        UNION ALL
+        SELECT idx + 1 FROM indexes
+        WHERE idx < array_length($pw_data_providers)
+    ),
+    weight_arrays AS (
+        SELECT
+            $pw_data_providers AS data_providers,
+            $pw_stream_ids AS stream_ids,
+            $pw_raw_weights AS raw_weights,
+            $pw_starts AS group_sequence_starts,
+            $pw_ends AS group_sequence_ends,
+            $pw_cutoffs AS embargo_cutoffs
     ),
 
     /*----------------------------------------------------------------------
-     * PRIMITIVE_WEIGHTS CTE: Filters the hierarchy to find leaf nodes (primitives).
-     *
-     * Purpose: Extracts the final effective weight and validity interval for each
-     * primitive stream that contributes to the composed result. A primitive may appear
-     * multiple times if its effective weight changes due to taxonomy updates higher
-     * up the tree.
+     * PRIMITIVE_WEIGHTS CTE: Effective weight and validity interval of each
+     * primitive stream that contributes to the composed result. A primitive may
+     * appear multiple times if its effective weight changes due to taxonomy
+     * updates higher up the tree.
      *--------------------------------------------------------------------*/
     primitive_weights AS (
-      SELECT
-          h.child_data_provider AS data_provider,
-          h.child_stream_id     AS stream_id,
-          h.raw_weight,
-          h.group_sequence_start,
-          h.group_sequence_end
-      FROM hierarchy h
-      -- Join with streams table to identify primitives
-      WHERE EXISTS (
-          SELECT 1 FROM streams s
-          WHERE s.data_provider = h.child_data_provider
-            AND s.stream_id     = h.child_stream_id
-            AND s.stream_type   = 'primitive'
-      )
+        SELECT
+            weight_arrays.data_providers[idx] AS data_provider,
+            weight_arrays.stream_ids[idx] AS stream_id,
+            weight_arrays.raw_weights[idx]::NUMERIC(36,18) AS raw_weight,
+            weight_arrays.group_sequence_starts[idx] AS group_sequence_start,
+            weight_arrays.group_sequence_ends[idx] AS group_sequence_end,
+            weight_arrays.embargo_cutoffs[idx] AS embargo_cutoff
+        FROM indexes
+        JOIN weight_arrays ON 1=1
+    ),
+
+    primitive_cutoffs AS (
+        SELECT DISTINCT data_provider, stream_id, embargo_cutoff
+        FROM primitive_weights
+    ),
+
+    /*----------------------------------------------------------------------
+     * LATEST_REVISIONS CTE: The current record of each primitive at each
+     * event_time. Keeps the latest revision created by $frozen_at among those
+     * the caller can read (see get_embargo_cutoff), and drops the records whose
+     * latest revision is a tombstone (retract_record).
+     *---------------------------------------------------------------------*/
+    latest_revisions AS (
+        SELECT data_provider, stream_id, event_time, value
+        FROM (
+            SELECT
+                pe.data_provider,
+                pe.stream_id,
+                pe.event_time,
+                pe.value,
+                pe.is_tombstone,
+                ROW_NUMBER() OVER (
+                    PARTITION BY pe.data_provider, pe.stream_id, pe.event_time
+                    ORDER BY pe.created_at DESC
+                ) as rn
+            FROM primitive_events pe
+            JOIN primitive_cutoffs pc
+              ON pc.data_provider = pe.data_provider
+             AND pc.stream_id = pe.stream_id
+            WHERE pe.event_time <= $effective_to
+              AND pe.created_at <= $effective_frozen_at
+              AND COALESCE(pe.visible_from, 0) <= pc.embargo_cutoff -- embargo, see get_embargo_cutoff
+        ) revisions
+        WHERE revisions.rn = 1 AND revisions.is_tombstone = false
     ),
 
     /*----------------------------------------------------------------------
@@ -255,7 +217,7 @@ RETURNS TABLE(
         FROM (
             -- 1. Primitive event times strictly within the requested range
             SELECT pe.event_time
-            FROM primitive_events pe
+            FROM latest_revisions pe
             JOIN primitive_weights pw -- Only events from relevant primitives during their active weight interval
               ON pe.data_provider = pw.data_provider
              AND pe.stream_id = pw.stream_id
@@ -263,7 +225,6 @@ RETURNS TABLE(
              AND pe.event_time <= pw.group_sequence_end
             WHERE pe.event_time > $effective_from
               AND pe.event_time <= $effective_to
-              AND pe.created_at <= $effective_frozen_at -- Apply frozen_at
 
             UNION
 
@@ -283,14 +244,13 @@ RETURNS TABLE(
             FROM (
                 -- Latest primitive event at or before start
                 SELECT pe.event_time
-                FROM primitive_events pe
+                FROM latest_revisions pe
                 JOIN primitive_weights pw -- Check relevance against weight intervals
                   ON pe.data_provider = pw.data_provider
                  AND pe.stream_id = pw.stream_id
                  AND pe.event_time >= pw.group_sequence_start
                  AND pe.event_time <= pw.group_sequence_end
                 WHERE pe.event_time <= $effective_from
-                  AND pe.created_at <= $effective_frozen_at
 
                 UNION
 
@@ -325,49 +285,29 @@ RETURNS TABLE(
                 pe_inner.value,
                 ROW_NUMBER() OVER (
                     PARTITION BY pe_inner.data_provider, pe_inner.stream_id
-                    ORDER BY pe_inner.event_time DESC, pe_inner.created_at DESC -- Tie-break by creation time
+                    ORDER BY pe_inner.event_time DESC
                 ) as rn
-            FROM primitive_events pe_inner
+            FROM latest_revisions pe_inner
             WHERE pe_inner.event_time <= $effective_from -- At or before the start
-              AND EXISTS ( -- Ensure the primitive exists in the resolved hierarchy
-                  SELECT 1 FROM primitive_weights pw_exists
-                  WHERE pw_exists.data_provider = pe_inner.data_provider AND pw_exists.stream_id = pe_inner.stream_id
-              )
-              AND pe_inner.created_at <= $effective_frozen_at
         ) pe
         WHERE pe.rn = 1 -- Select the latest state
     ),
 
     -- Step 2: Find distinct primitive events strictly WITHIN the interval ($from < time <= $to).
     primitive_events_in_interval AS (
-        SELECT
+        SELECT DISTINCT
             pe.data_provider,
             pe.stream_id,
             pe.event_time,
             pe.value
-        FROM (
-             -- Use ROW_NUMBER to pick the latest created_at for duplicate event_times
-             SELECT
-                pe_inner.data_provider,
-                pe_inner.stream_id,
-                pe_inner.event_time,
-                pe_inner.created_at,
-                pe_inner.value,
-                ROW_NUMBER() OVER (
-                    PARTITION BY pe_inner.data_provider, pe_inner.stream_id, pe_inner.event_time
-                    ORDER BY pe_inner.created_at DESC
-                ) as rn
-            FROM primitive_events pe_inner
-            JOIN primitive_weights pw_check -- Ensure validity against *a* taxonomy interval
-                ON pe_inner.data_provider = pw_check.data_provider
-               AND pe_inner.stream_id = pw_check.stream_id
-               AND pe_inner.event_time >= pw_check.group_sequence_start
-               AND pe_inner.event_time <= pw_check.group_sequence_end
-            WHERE pe_inner.event_time > $effective_from -- Strictly after start
-                AND pe_inner.event_time <= $effective_to    -- At or before end
-                AND pe_inner.created_at <= $effective_frozen_at
-        ) pe
-        WHERE pe.rn = 1 -- Select the latest created_at for each (dp, sid, et)
+        FROM latest_revisions pe
+        JOIN primitive_weights pw_check -- Ensure validity against *a* taxonomy interval
+            ON pe.data_provider = pw_check.data_provider
+           AND pe.stream_id = pw_check.stream_id
+           AND pe.event_time >= pw_check.group_sequence_start
+           AND pe.event_time <= pw_check.group_sequence_end
+        WHERE pe.event_time > $effective_from -- Strictly after start
+            AND pe.event_time <= $effective_to    -- At or before end
     ),
 
     -- Step 3: Combine initial states and interval events.
@@ -508,10 +448,11 @@ RETURNS TABLE(
         LEFT JOIN final_deltas fd ON fd.event_time = act.time_point -- Left join to keep all times
     ),
 
-    -- Step 12: Compute the aggregated value (Weighted Average)
+    -- Step 12: Compute the aggregated value (Weighted Average, or Weighted Sum if configured)
     aggregated AS (
         SELECT cv.event_time,
-               CASE WHEN cv.cum_sw = 0::numeric(36,18) THEN 0::numeric(72,18)
+               CASE WHEN $aggregation_method = 'weighted_sum' THEN cv.cum_ws
+                    WHEN cv.cum_sw = 0::numeric(36,18) THEN 0::numeric(72,18)
                     ELSE cv.cum_ws / cv.cum_sw::numeric(72,18)
                    END AS value
         FROM cumulative_values cv
@@ -612,4 +553,206 @@ RETURNS TABLE(
     )
     SELECT event_time, value FROM result
     ORDER BY 1;
-};
\ No newline at end of file
+};
+
+/**
+ * get_composed_primitive_weights: Resolves the effective weight of every primitive
+ * contributing to a composed stream over [$from, $to], starting from the taxonomy
+ * active at $from. A primitive is returned once per interval of constant weight.
+ *
+ * Only the taxonomies as of $taxonomy_height are used: created at or before it, and not disabled
+ * by then. A NULL $taxonomy_height uses the current ones.
+ *
+ * Shared by get_record_composed, get_index_composed and get_composed_primitive_states.
+ * Doesn't check permissions, callers are responsible for it.
+ */
+CREATE OR REPLACE ACTION get_composed_primitive_weights(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $taxonomy_height INT8
+) PRIVATE VIEW
+RETURNS TABLE(
+    data_provider TEXT,
+    stream_id TEXT,
+    raw_weight NUMERIC(36,18),
+    group_sequence_start INT8,
+    group_sequence_end INT8
+) {
+    $data_provider := LOWER($data_provider);
+    $max_int8 := 9223372036854775000;
+    $effective_from := COALESCE($from, 0);
+    $effective_to := COALESCE($to, $max_int8);
+    $effective_taxonomy_height := COALESCE($taxonomy_height, $max_int8);
+
+    RETURN WITH RECURSIVE
+    /*----------------------------------------------------------------------
+     * HIERARCHY CTE: Recursively resolves the dependency tree defined by taxonomies.
+     *
+     * Purpose: Determines the effective weighted contribution of every stream
+     * (down to the primitives) to the root composed stream over time.
+     *
+     * - Calculates the cumulative `raw_weight` for each path from the root to a child.
+     * - Determines the validity interval (`group_sequence_start`, `group_sequence_end`)
+     *   for each weighted relationship, handling overshadowing definitions.
+     * - Filters based on the query time range (`$effective_from`, `$effective_to`)
+     *   and an anchor point before `$effective_from`.
+     *
+     * Overshadowing Logic: Uses a LEFT JOIN anti-join pattern (`t2 IS NULL`) to select
+     * only the taxonomy definition with the highest `group_sequence` for any given
+     * `start_time`, ensuring that later definitions supersede earlier ones.
+     *
+     * Interval Calculation:
+     *   - `group_sequence_end` is derived using `LEAD` to find the next `start_time`
+     *     for the same parent stream.
+     *   - In the recursive step, the effective interval is the intersection
+     *     (GREATEST start, LEAST end) of the parent's and child's intervals.
+     *---------------------------------------------------------------------*/
+    hierarchy AS (
+      -- Base Case: Direct children of the root composed stream.
+      SELECT
+          t1.data_provider AS parent_data_provider,
+          t1.stream_id AS parent_stream_id,
+          t1.child_data_provider,
+          t1.child_stream_id,
+          t1.weight AS raw_weight,
+          t1.start_time AS group_sequence_start,
+          -- Calculate end time based on the start of the next definition
+          COALESCE(ot.next_start, $max_int8) - 1 AS group_sequence_end
+      FROM
+          taxonomies t1
+      -- Anti-join: Ensures we select the row with the highest group_sequence
+      -- for a given (dp, sid, start_time) by checking if a row t2 with a
+      -- higher sequence exists. We keep t1 only if no such t2 is found.
+      LEFT JOIN taxonomies t2
+        ON t1.data_provider = t2.data_provider
+       AND t1.stream_id = t2.stream_id
+       AND t1.start_time = t2.start_time
+       AND t1.group_sequence < t2.group_sequence -- t2 must have a strictly higher sequence
+       AND t2.created_at <= $effective_taxonomy_height AND (t2.disabled_at IS NULL OR t2.disabled_at > $effective_taxonomy_height) -- Ignore disabled rows for overshadowing comparison
+      -- Join to find the start_time of the next taxonomy definition for this parent
+      JOIN (
+          SELECT
+              dt.data_provider, dt.stream_id, dt.start_time,
+              LEAD(dt.start_time) OVER (PARTITION BY dt.data_provider, dt.stream_id ORDER BY dt.start_time) AS next_start
+          FROM ( -- Select distinct start times within the relevant range plus anchor
+                 SELECT DISTINCT t_ot.data_provider, t_ot.stream_id, t_ot.start_time FROM taxonomies t_ot
+                 WHERE t_ot.data_provider = $data_provider AND t_ot.stream_id = $stream_id AND t_ot.created_at <= $effective_taxonomy_height AND (t_ot.disabled_at IS NULL OR t_ot.disabled_at > $effective_taxonomy_height) AND t_ot.start_time <= $effective_to
+                 -- Anchor logic: Find the latest taxonomy start at or before $effective_from
+                 AND t_ot.start_time >= COALESCE((SELECT t2_anchor.start_time FROM taxonomies t2_anchor WHERE t2_anchor.data_provider=t_ot.data_provider AND t2_anchor.stream_id=t_ot.stream_id AND t2_anchor.created_at <= $effective_taxonomy_height AND (t2_anchor.disabled_at IS NULL OR t2_anchor.disabled_at > $effective_taxonomy_height) AND t2_anchor.start_time<=$effective_from ORDER BY t2_anchor.start_time DESC, t2_anchor.group_sequence DESC LIMIT 1),0)
+               ) dt
+      ) ot
+        ON t1.data_provider = ot.data_provider
+       AND t1.stream_id     = ot.stream_id
+       AND t1.start_time    = ot.start_time
+      WHERE
+          t1.data_provider = $data_provider -- Filter for the specific root stream
+      AND t1.stream_id     = $stream_id
+      AND t1.created_at <= $effective_taxonomy_height AND (t1.disabled_at IS NULL OR t1.disabled_at > $effective_taxonomy_height)
+      AND t2.group_sequence IS NULL -- Keep t1 only if no row t2 with a higher sequence was found
+      -- Apply time range filter to the taxonomy start time
+      AND t1.start_time <= $effective_to
+      -- Anchor logic: Ensure we include the relevant taxonomy active at $effective_from
+      AND t1.start_time >= COALESCE(
+            (SELECT t_anchor_base.start_time
+             FROM taxonomies t_anchor_base
+             WHERE t_anchor_base.data_provider = t1.data_provider -- Correlated subquery
+               AND t_anchor_base.stream_id     = t1.stream_id     -- Correlated subquery
+               AND t_anchor_base.created_at <= $effective_taxonomy_height AND (t_anchor_base.disabled_at IS NULL OR t_anchor_base.disabled_at > $effective_taxonomy_height)
+               AND t_anchor_base.start_time   <= $effective_from
+             ORDER BY t_anchor_base.start_time DESC, t_anchor_base.group_sequence DESC
+             LIMIT 1
+            ), 0 -- Default to 0 if no anchor found
+          )
+
+      UNION ALL
+
+      -- Recursive Step: Children of the children found in the previous level.
+      SELECT
+          parent.parent_data_provider,
+          parent.parent_stream_id,
+          t1_child.child_data_provider,
+          t1_child.child_stream_id,
+          -- Multiply parent weight by child weight for cumulative effect
+          (parent.raw_weight * t1_child.weight)::NUMERIC(36,18) AS raw_weight,
+          -- Effective interval start is the later of the parent's or child's start
+          GREATEST(parent.group_sequence_start, t1_child.start_time) AS group_sequence_start,
+          -- Effective interval end is the earlier of the parent's or child's end
+          LEAST(parent.group_sequence_end, (COALESCE(ot_child.next_start, $max_int8) - 1)) AS group_sequence_end
+      FROM
+          hierarchy parent -- Result from the previous recursion level
+      -- Join parent with potential child taxonomies
+      JOIN taxonomies t1_child
+        ON t1_child.data_provider = parent.child_data_provider
+       AND t1_child.stream_id     = parent.child_stream_id
+      -- Anti-join for child overshadowing (same pattern as base case)
+      LEFT JOIN taxonomies t2_child
+        ON t1_child.data_provider = t2_child.data_provider
+       AND t1_child.stream_id = t2_child.stream_id
+       AND t1_child.start_time = t2_child.start_time
+       AND t1_child.group_sequence < t2_child.group_sequence -- t2 must be higher
+       AND t2_child.created_at <= $effective_taxonomy_height AND (t2_child.disabled_at IS NULL OR t2_child.disabled_at > $effective_taxonomy_height) -- Ignore disabled rows
+      -- Join to get the next start time for the child interval end calculation
+      JOIN (
+          SELECT
+              dt.data_provider, dt.stream_id, dt.start_time,
+              LEAD(dt.start_time) OVER ( PARTITION BY dt.data_provider, dt.stream_id ORDER BY dt.start_time ) AS next_start
+          FROM ( -- Select distinct start times for all potentially relevant children
+                 SELECT DISTINCT t_otc.data_provider, t_otc.stream_id, t_otc.start_time FROM taxonomies t_otc
+                 WHERE t_otc.created_at <= $effective_taxonomy_height AND (t_otc.disabled_at IS NULL OR t_otc.disabled_at > $effective_taxonomy_height) AND t_otc.start_time <= $effective_to
+                 -- Anchor logic for children (find earliest relevant start)
+                 AND t_otc.start_time >= COALESCE((SELECT MIN(t2_min.start_time) FROM taxonomies t2_min WHERE t2_min.created_at <= $effective_taxonomy_height AND (t2_min.disabled_at IS NULL OR t2_min.disabled_at > $effective_taxonomy_height) AND t2_min.start_time <= $effective_from), 0)
+               ) dt
+      ) ot_child
+        ON t1_child.data_provider = ot_child.data_provider
+       AND t1_child.stream_id     = ot_child.stream_id
+       AND t1_child.start_time    = ot_child.start_time
+      WHERE
+          t1_child.created_at <= $effective_taxonomy_height AND (t1_child.disabled_at IS NULL OR t1_child.disabled_at > $effective_taxonomy_height)
+      AND t2_child.group_sequence IS NULL -- Keep t1_child only if no higher sequence row found
+      -- Interval Overlap Check: Ensure parent and child intervals overlap
+      AND t1_child.start_time <= parent.group_sequence_end
+      AND (COALESCE(ot_child.next_start, $max_int8) - 1) >= parent.group_sequence_start
+      -- Apply child time range/anchor filters to t1_child
+      AND t1_child.start_time <= $effective_to
+      AND t1_child.start_time >= COALESCE(
+            (SELECT t_anchor_child.start_time
+             FROM taxonomies t_anchor_child
+             WHERE t_anchor_child.data_provider = t1_child.data_provider -- Correlated
+               AND t_anchor_child.stream_id     = t1_child.stream_id     -- Correlated
+               AND t_anchor_child.created_at <= $effective_taxonomy_height AND (t_anchor_child.disabled_at IS NULL OR t_anchor_child.disabled_at > $effective_taxonomy_height)
+               AND t_anchor_child.start_time   <= $effective_from
+             ORDER BY t_anchor_child.start_time DESC, t_anchor_child.group_sequence DESC
+             LIMIT 1
+            ), 0
+          )
+    ),
+
+    /*----------------------------------------------------------------------
+     * PRIMITIVE_WEIGHTS CTE: Filters the hierarchy to find leaf nodes (primitives).
+     *
+     * Purpose: Extracts the final effective weight and validity interval for each
+     * primitive stream that contributes to the composed result. A primitive may appear
+     * multiple times if its effective weight changes due to taxonomy updates higher
+     * up the tree.
+     *--------------------------------------------------------------------*/
+    primitive_weights AS (
+      SELECT
+          h.child_data_provider AS data_provider,
+          h.child_stream_id     AS stream_id,
+          h.raw_weight,
+          h.group_sequence_start,
+          h.group_sequence_end
+      FROM hierarchy h
+      -- Join with streams table to identify primitives
+      WHERE EXISTS (
+          SELECT 1 FROM streams s
+          WHERE s.data_provider = h.child_data_provider
+            AND s.stream_id     = h.child_stream_id
+            AND s.stream_type   = 'primitive'
+      )
+    )
+    SELECT data_provider, stream_id, raw_weight, group_sequence_start, group_sequence_end
+    FROM primitive_weights;
+};
@@ -33,47 +33,73 @@ RETURNS TABLE(
     $latest_event_time INT8;
 
     /*
-     * Step 2: Recursively gather all children (ignoring overshadow),
-     *         then identify primitive leaves.
+     * Step 2: Primitive leaves (ignoring overshadow), see get_composed_primitive_leaves,
+     *         with the highest visible_from the caller can read in each, see get_embargo_cutoff.
      */
-    for $row in WITH RECURSIVE all_taxonomies AS (
-      /* 2a) Direct children of ($data_provider, $stream_id) */
-      SELECT
-        t.data_provider,
-        t.stream_id,
-        t.child_data_provider,
-        t.child_stream_id
-      FROM taxonomies t
-      WHERE t.data_provider = $data_provider
-        AND t.stream_id     = $stream_id
-
-      UNION
+    $leaf_data_providers := []::TEXT[];
+    $leaf_stream_ids := []::TEXT[];
+    $leaf_cutoffs := []::INT8[];
+    for $leaf in get_composed_primitive_leaves($data_provider, $stream_id) {
+        $leaf_data_providers := array_append($leaf_data_providers, $leaf.data_provider);
+        $leaf_stream_ids := array_append($leaf_stream_ids, $leaf.stream_id);
+        $leaf_cutoff INT8 := get_embargo_cutoff($leaf.data_provider, $leaf.stream_id, $frozen_at);
+        $leaf_cutoffs := array_append($leaf_cutoffs, $leaf_cutoff);
+    }
+    if COALESCE(array_length($leaf_data_providers), 0) = 0 {
+        RETURN;
+    }
 
-      /* 2b) For each discovered child, gather its own children */
+    for $row in WITH RECURSIVE
+    indexes AS (
+      SELECT 1 AS idx
+      UNION ALL
+      SELECT idx + 1 FROM indexes
+      WHERE idx < array_length($leaf_data_providers)
+    ),
+    leaf_arrays AS (
       SELECT
-        at.child_data_provider AS data_provider,
-        at.child_stream_id     AS stream_id,
-        t.child_data_provider,
-        t.child_stream_id
-      FROM all_taxonomies at
-      JOIN taxonomies t
-        ON t.data_provider = at.child_data_provider
-       AND t.stream_id     = at.child_stream_id
+        $leaf_data_providers AS data_providers,
+        $leaf_stream_ids AS stream_ids,
+        $leaf_cutoffs AS embargo_cutoffs
     ),
     primitive_leaves AS (
-      /* Keep only references pointing to primitive streams */
-      SELECT DISTINCT
-        at.child_data_provider AS data_provider,
-        at.child_stream_id     AS stream_id
-      FROM all_taxonomies at
-      JOIN streams s
-        ON s.data_provider = at.child_data_provider
-       AND s.stream_id     = at.child_stream_id
-       AND s.stream_type   = 'primitive'
+      SELECT
+        leaf_arrays.data_providers[idx] AS data_provider,
+        leaf_arrays.stream_ids[idx] AS stream_id,
+        leaf_arrays.embargo_cutoffs[idx] AS embargo_cutoff
+      FROM indexes
+      JOIN leaf_arrays ON 1=1
+    ),
+    /*
+     * Current record of each leaf at each event_time: the latest revision created by
+     * $frozen_at among those the caller can read, unless it's a tombstone.
+     */
+    latest_revisions AS (
+      SELECT data_provider, stream_id, event_time, value
+      FROM (
+        SELECT
+          pe.data_provider,
+          pe.stream_id,
+          pe.event_time,
+          pe.value,
+          pe.is_tombstone,
+          ROW_NUMBER() OVER (
+            PARTITION BY pe.data_provider, pe.stream_id, pe.event_time
+            ORDER BY pe.created_at DESC
+          ) AS rn
+        FROM primitive_events pe
+        JOIN primitive_leaves pl
+          ON pl.data_provider = pe.data_provider
+         AND pl.stream_id     = pe.stream_id
+        WHERE pe.event_time   <= $effective_before
+          AND pe.created_at   <= $effective_frozen_at
+          AND COALESCE(pe.visible_from, 0) <= pl.embargo_cutoff -- embargo, see get_embargo_cutoff
+      ) revisions
+      WHERE revisions.rn = 1 AND revisions.is_tombstone = false
     ),
     /*
      * Step 3: In each primitive, pick the single latest event_time <= effective_before.
-     *         ROW_NUMBER=1 => that "latest" champion. Tie-break by created_at DESC.
+     *         ROW_NUMBER=1 => that "latest" champion.
      */
     latest_events AS (
       SELECT
@@ -81,17 +107,14 @@ RETURNS TABLE(
         pl.stream_id,
         pe.event_time,
         pe.value,
-        pe.created_at,
         ROW_NUMBER() OVER (
           PARTITION BY pl.data_provider, pl.stream_id
-          ORDER BY pe.event_time DESC, pe.created_at DESC
+          ORDER BY pe.event_time DESC
         ) AS rn
       FROM primitive_leaves pl
-      JOIN primitive_events pe
+      JOIN latest_revisions pe
         ON pe.data_provider = pl.data_provider
        AND pe.stream_id     = pl.stream_id
-      WHERE pe.event_time   <= $effective_before
-        AND pe.created_at   <= $effective_frozen_at
     ),
     latest_values AS (
       /* Step 4: Filter to rn=1 => the single latest event per (dp, sid) */
@@ -164,47 +187,73 @@ RETURNS TABLE(
     $earliest_event_time INT8;
 
     /*
-     * Step 2: Recursively gather all children (ignoring overshadow),
-     *         then identify primitive leaves.
+     * Step 2: Primitive leaves (ignoring overshadow), see get_composed_primitive_leaves,
+     *         with the highest visible_from the caller can read in each, see get_embargo_cutoff.
      */
-    for $row in WITH RECURSIVE all_taxonomies AS (
-      /* 2a) Direct children of ($data_provider, $stream_id) */
-      SELECT
-        t.data_provider,
-        t.stream_id,
-        t.child_data_provider,
-        t.child_stream_id
-      FROM taxonomies t
-      WHERE t.data_provider = $data_provider
-        AND t.stream_id     = $stream_id
-
-      UNION
+    $leaf_data_providers := []::TEXT[];
+    $leaf_stream_ids := []::TEXT[];
+    $leaf_cutoffs := []::INT8[];
+    for $leaf in get_composed_primitive_leaves($data_provider, $stream_id) {
+        $leaf_data_providers := array_append($leaf_data_providers, $leaf.data_provider);
+        $leaf_stream_ids := array_append($leaf_stream_ids, $leaf.stream_id);
+        $leaf_cutoff INT8 := get_embargo_cutoff($leaf.data_provider, $leaf.stream_id, $frozen_at);
+        $leaf_cutoffs := array_append($leaf_cutoffs, $leaf_cutoff);
+    }
+    if COALESCE(array_length($leaf_data_providers), 0) = 0 {
+        RETURN;
+    }
 
-      /* 2b) For each discovered child, gather its own children */
+    for $row in WITH RECURSIVE
+    indexes AS (
+      SELECT 1 AS idx
+      UNION ALL
+      SELECT idx + 1 FROM indexes
+      WHERE idx < array_length($leaf_data_providers)
+    ),
+    leaf_arrays AS (
       SELECT
-        at.child_data_provider AS data_provider,
-        at.child_stream_id     AS stream_id,
-        t.child_data_provider,
-        t.child_stream_id
-      FROM all_taxonomies at
-      JOIN taxonomies t
-        ON t.data_provider = at.child_data_provider
-       AND t.stream_id     = at.child_stream_id
+        $leaf_data_providers AS data_providers,
+        $leaf_stream_ids AS stream_ids,
+        $leaf_cutoffs AS embargo_cutoffs
     ),
     primitive_leaves AS (
-      /* Keep only references pointing to primitive streams */
-      SELECT DISTINCT
-        at.child_data_provider AS data_provider,
-        at.child_stream_id     AS stream_id
-      FROM all_taxonomies at
-      JOIN streams s
-        ON s.data_provider = at.child_data_provider
-       AND s.stream_id     = at.child_stream_id
-       AND s.stream_type   = 'primitive'
+      SELECT
+        leaf_arrays.data_providers[idx] AS data_provider,
+        leaf_arrays.stream_ids[idx] AS stream_id,
+        leaf_arrays.embargo_cutoffs[idx] AS embargo_cutoff
+      FROM indexes
+      JOIN leaf_arrays ON 1=1
+    ),
+    /*
+     * Current record of each leaf at each event_time: the latest revision created by
+     * $frozen_at among those the caller can read, unless it's a tombstone.
+     */
+    latest_revisions AS (
+      SELECT data_provider, stream_id, event_time, value
+      FROM (
+        SELECT
+          pe.data_provider,
+          pe.stream_id,
+          pe.event_time,
+          pe.value,
+          pe.is_tombstone,
+          ROW_NUMBER() OVER (
+            PARTITION BY pe.data_provider, pe.stream_id, pe.event_time
+            ORDER BY pe.created_at DESC
+          ) AS rn
+        FROM primitive_events pe
+        JOIN primitive_leaves pl
+          ON pl.data_provider = pe.data_provider
+         AND pl.stream_id     = pe.stream_id
+        WHERE pe.event_time   >= $effective_after
+          AND pe.created_at   <= $effective_frozen_at
+          AND COALESCE(pe.visible_from, 0) <= pl.embargo_cutoff -- embargo, see get_embargo_cutoff
+      ) revisions
+      WHERE revisions.rn = 1 AND revisions.is_tombstone = false
     ),
     /*
      * Step 3: In each primitive, pick the single earliest event_time >= effective_after.
-     *         ROW_NUMBER=1 => that "earliest" champion. Tie-break by created_at DESC.
+     *         ROW_NUMBER=1 => that "earliest" champion.
      */
     earliest_events AS (
       SELECT
@@ -212,17 +261,14 @@ RETURNS TABLE(
         pl.stream_id,
         pe.event_time,
         pe.value,
-        pe.created_at,
         ROW_NUMBER() OVER (
           PARTITION BY pl.data_provider, pl.stream_id
-          ORDER BY pe.event_time ASC, pe.created_at DESC
+          ORDER BY pe.event_time ASC
         ) AS rn
       FROM primitive_leaves pl
-      JOIN primitive_events pe
+      JOIN latest_revisions pe
         ON pe.data_provider = pl.data_provider
        AND pe.stream_id     = pl.stream_id
-      WHERE pe.event_time   >= $effective_after
-        AND pe.created_at   <= $effective_frozen_at
     ),
     earliest_values AS (
       /* Step 4: Filter to rn=1 => the single earliest event per (dp, sid) */
@@ -317,134 +363,117 @@ RETURNS TABLE(
         RETURN;
     }
 
+    -- For methods other than weighted_mean, index the aggregated series against its own base value.
+    -- The weighted mean keeps indexing each primitive first, which is what the CTEs below do.
+    $aggregation_method TEXT := get_aggregation_method($data_provider, $stream_id);
+    if $aggregation_method != 'weighted_mean' {
+        $method_base_value := internal_get_base_value($data_provider, $stream_id, $effective_base_time, $effective_frozen_at);
+        if $method_base_value = 0::NUMERIC(36,18) {
+            ERROR('base value is zero, cannot compute index');
+        }
+        for $row in get_record_composed($data_provider, $stream_id, $from, $to, $frozen_at) {
+            $method_indexed_value NUMERIC(36,18) := ($row.value * 100::NUMERIC(36,18)) / $method_base_value;
+            RETURN NEXT $row.event_time, $method_indexed_value;
+        }
+        RETURN;
+    }
+
 
-    -- For detailed explanations of the CTEs below (hierarchy, primitive_weights,
+    -- For detailed explanations of the CTEs below (primitive_weights,
     -- cleaned_event_times, initial_primitive_states, primitive_events_in_interval,
     -- all_primitive_points, first_value_times, effective_weight_changes, unified_events),
     -- please refer to the comments in the `get_record_composed` action
     -- in 006-composed-query.sql. The logic is largely identical.
 
-    RETURN WITH RECURSIVE
-    hierarchy AS (
-      SELECT
-          t1.data_provider AS parent_data_provider,
-          t1.stream_id AS parent_stream_id,
-          t1.child_data_provider,
-          t1.child_stream_id,
-          t1.weight AS raw_weight,
-          t1.start_time AS group_sequence_start,
-          COALESCE(ot.next_start, $max_int8) - 1 AS group_sequence_end
-      FROM
-          taxonomies t1
-      LEFT JOIN taxonomies t2
-        ON t1.data_provider = t2.data_provider
-       AND t1.stream_id = t2.stream_id
-       AND t1.start_time = t2.start_time
-       AND t1.group_sequence < t2.group_sequence
-       AND t2.disabled_at IS NULL
-      JOIN (
-          SELECT
-              dt.data_provider, dt.stream_id, dt.start_time,
-              LEAD(dt.start_time) OVER (PARTITION BY dt.data_provider, dt.stream_id ORDER BY dt.start_time) AS next_start
-          FROM ( SELECT DISTINCT t_ot.data_provider, t_ot.stream_id, t_ot.start_time FROM taxonomies t_ot
-                 WHERE t_ot.data_provider = $data_provider AND t_ot.stream_id = $stream_id AND t_ot.disabled_at IS NULL AND t_ot.start_time <= $effective_to
-                 AND t_ot.start_time >= COALESCE((SELECT t2_anchor.start_time FROM taxonomies t2_anchor WHERE t2_anchor.data_provider=t_ot.data_provider AND t2_anchor.stream_id=t_ot.stream_id AND t2_anchor.disabled_at IS NULL AND t2_anchor.start_time<=$effective_from ORDER BY t2_anchor.start_time DESC, t2_anchor.group_sequence DESC LIMIT 1),0)
-               ) dt
-      ) ot
-        ON t1.data_provider = ot.data_provider
-       AND t1.stream_id     = ot.stream_id
-       AND t1.start_time    = ot.start_time
-      WHERE
-          t1.data_provider = $data_provider
-      AND t1.stream_id     = $stream_id
-      AND t1.disabled_at   IS NULL
-      AND t2.group_sequence IS NULL
-      AND t1.start_time <= $effective_to
-      AND t1.start_time >= COALESCE(
-            (SELECT t_anchor_base.start_time
-             FROM taxonomies t_anchor_base
-             WHERE t_anchor_base.data_provider = t1.data_provider
-               AND t_anchor_base.stream_id     = t1.stream_id
-               AND t_anchor_base.disabled_at   IS NULL
-               AND t_anchor_base.start_time   <= $effective_from
-             ORDER BY t_anchor_base.start_time DESC, t_anchor_base.group_sequence DESC
-             LIMIT 1
-            ), 0
-          )
+    -- Effective weights of the primitives over the range, see get_composed_primitive_weights,
+    -- with the highest visible_from the caller can read in each, see get_embargo_cutoff
+    $pw_data_providers := []::TEXT[];
+    $pw_stream_ids := []::TEXT[];
+    $pw_raw_weights := []::NUMERIC(36,18)[];
+    $pw_starts := []::INT8[];
+    $pw_ends := []::INT8[];
+    $pw_cutoffs := []::INT8[];
+    for $pw in get_composed_primitive_weights($data_provider, $stream_id, $from, $to, NULL) {
+        $pw_data_providers := array_append($pw_data_providers, $pw.data_provider);
+        $pw_stream_ids := array_append($pw_stream_ids, $pw.stream_id);
+        $pw_raw_weights := array_append($pw_raw_weights, $pw.raw_weight);
+        $pw_starts := array_append($pw_starts, $pw.group_sequence_start);
+        $pw_ends := array_append($pw_ends, $pw.group_sequence_end);
+        $pw_cutoff INT8 := get_embargo_cutoff($pw.data_provider, $pw.stream_id, $frozen_at);
+        $pw_cutoffs := array_append($pw_cutoffs, $pw_cutoff);
+    }
+    -- no primitive contributes to the range
+    if COALESCE(array_length($pw_data_providers), 0) = 0 {
+        RETURN;
+    }
 
-      UNION ALL
+    RETURN WITH RECURSIVE
+    indexes AS (
+        SELECT 1 AS idx
+        UNION ALL
+        SELECT idx + 1 FROM indexes
+        WHERE idx < array_length($pw_data_providers)
+    ),
+    weight_arrays AS (
+        SELECT
+            $pw_data_providers AS data_providers,
+            $pw_stream_ids AS stream_ids,
+            $pw_raw_weights AS raw_weights,
+            $pw_starts AS group_sequence_starts,
+            $pw_ends AS group_sequence_ends,
+            $pw_cutoffs AS embargo_cutoffs
+    ),
+    primitive_weights AS (
+        SELECT
+            weight_arrays.data_providers[idx] AS data_provider,
+            weight_arrays.stream_ids[idx] AS stream_id,
+            weight_arrays.raw_weights[idx]::NUMERIC(36,18) AS raw_weight,
+            weight_arrays.group_sequence_starts[idx] AS group_sequence_start,
+            weight_arrays.group_sequence_ends[idx] AS group_sequence_end,
+            weight_arrays.embargo_cutoffs[idx] AS embargo_cutoff
+        FROM indexes
+        JOIN weight_arrays ON 1=1
+    ),
 
-      SELECT
-          parent.parent_data_provider,
-          parent.parent_stream_id,
-          t1_child.child_data_provider,
-          t1_child.child_stream_id,
-          (parent.raw_weight * t1_child.weight)::NUMERIC(36,18) AS raw_weight,
-          GREATEST(parent.group_sequence_start, t1_child.start_time) AS group_sequence_start,
-          LEAST(parent.group_sequence_end, (COALESCE(ot_child.next_start, $max_int8) - 1)) AS group_sequence_end
-      FROM
-          hierarchy parent
-      JOIN taxonomies t1_child
-        ON t1_child.data_provider = parent.child_data_provider
-       AND t1_child.stream_id     = parent.child_stream_id
-      LEFT JOIN taxonomies t2_child
-        ON t1_child.data_provider = t2_child.data_provider
-       AND t1_child.stream_id = t2_child.stream_id
-       AND t1_child.start_time = t2_child.start_time
-       AND t1_child.group_sequence < t2_child.group_sequence
-       AND t2_child.disabled_at IS NULL
-      JOIN (
-          SELECT
-              dt.data_provider, dt.stream_id, dt.start_time,
-              LEAD(dt.start_time) OVER ( PARTITION BY dt.data_provider, dt.stream_id ORDER BY dt.start_time ) AS next_start
-          FROM ( SELECT DISTINCT t_otc.data_provider, t_otc.stream_id, t_otc.start_time FROM taxonomies t_otc
-                 WHERE t_otc.disabled_at IS NULL AND t_otc.start_time <= $effective_to
-                 AND t_otc.start_time >= COALESCE((SELECT MIN(t2_min.start_time) FROM taxonomies t2_min WHERE t2_min.disabled_at IS NULL AND t2_min.start_time <= $effective_from), 0)
-               ) dt
-      ) ot_child
-        ON t1_child.data_provider = ot_child.data_provider
-       AND t1_child.stream_id     = ot_child.stream_id
-       AND t1_child.start_time    = ot_child.start_time
-      WHERE
-          t1_child.disabled_at IS NULL
-      AND t2_child.group_sequence IS NULL
-      AND t1_child.start_time <= parent.group_sequence_end
-      AND (COALESCE(ot_child.next_start, $max_int8) - 1) >= parent.group_sequence_start
-      AND t1_child.start_time <= $effective_to
-      AND t1_child.start_time >= COALESCE(
-            (SELECT t_anchor_child.start_time
-             FROM taxonomies t_anchor_child
-             WHERE t_anchor_child.data_provider = t1_child.data_provider
-               AND t_anchor_child.stream_id     = t1_child.stream_id
-               AND t_anchor_child.disabled_at   IS NULL
-               AND t_anchor_child.start_time   <= $effective_from
-             ORDER BY t_anchor_child.start_time DESC, t_anchor_child.group_sequence DESC
-             LIMIT 1
-            ), 0
-          )
+    primitive_cutoffs AS (
+        SELECT DISTINCT data_provider, stream_id, embargo_cutoff
+        FROM primitive_weights
     ),
 
-    primitive_weights AS (
-      SELECT
-          h.child_data_provider AS data_provider,
-          h.child_stream_id     AS stream_id,
-          h.raw_weight,
-          h.group_sequence_start,
-          h.group_sequence_end
-      FROM hierarchy h
-      WHERE EXISTS (
-          SELECT 1 FROM streams s
-          WHERE s.data_provider = h.child_data_provider
-            AND s.stream_id     = h.child_stream_id
-            AND s.stream_type   = 'primitive'
-      )
+    /*----------------------------------------------------------------------
+     * LATEST_REVISIONS CTE: The current record of each primitive at each
+     * event_time. Keeps the latest revision created by $frozen_at among those
+     * the caller can read (see get_embargo_cutoff), and drops the records whose
+     * latest revision is a tombstone (retract_record).
+     *---------------------------------------------------------------------*/
+    latest_revisions AS (
+        SELECT data_provider, stream_id, event_time, value
+        FROM (
+            SELECT
+                pe.data_provider,
+                pe.stream_id,
+                pe.event_time,
+                pe.value,
+                pe.is_tombstone,
+                ROW_NUMBER() OVER (
+                    PARTITION BY pe.data_provider, pe.stream_id, pe.event_time
+                    ORDER BY pe.created_at DESC
+                ) as rn
+            FROM primitive_events pe
+            JOIN primitive_cutoffs pc
+              ON pc.data_provider = pe.data_provider
+             AND pc.stream_id = pe.stream_id
+            WHERE pe.created_at <= $effective_frozen_at -- no event_time bound, the base value may lie after $to
+              AND COALESCE(pe.visible_from, 0) <= pc.embargo_cutoff -- embargo, see get_embargo_cutoff
+        ) revisions
+        WHERE revisions.rn = 1 AND revisions.is_tombstone = false
     ),
 
     cleaned_event_times AS (
         SELECT DISTINCT event_time
         FROM (
             SELECT pe.event_time
-            FROM primitive_events pe
+            FROM latest_revisions pe
             JOIN primitive_weights pw
               ON pe.data_provider = pw.data_provider
              AND pe.stream_id = pw.stream_id
@@ -452,7 +481,6 @@ RETURNS TABLE(
              AND pe.event_time <= pw.group_sequence_end
             WHERE pe.event_time > $effective_from
               AND pe.event_time <= $effective_to
-              AND pe.created_at <= $effective_frozen_at
 
             UNION
 
@@ -468,14 +496,13 @@ RETURNS TABLE(
             SELECT event_time
             FROM (
                 SELECT pe.event_time
-                FROM primitive_events pe
+                FROM latest_revisions pe
                 JOIN primitive_weights pw
                   ON pe.data_provider = pw.data_provider
                  AND pe.stream_id = pw.stream_id
                  AND pe.event_time >= pw.group_sequence_start
                  AND pe.event_time <= pw.group_sequence_end
                 WHERE pe.event_time <= $effective_from
-                  AND pe.created_at <= $effective_frozen_at
 
                 UNION
 
@@ -503,47 +530,28 @@ RETURNS TABLE(
                 pe_inner.value,
                 ROW_NUMBER() OVER (
                     PARTITION BY pe_inner.data_provider, pe_inner.stream_id
-                    ORDER BY pe_inner.event_time DESC, pe_inner.created_at DESC
+                    ORDER BY pe_inner.event_time DESC
                 ) as rn
-            FROM primitive_events pe_inner
+            FROM latest_revisions pe_inner
             WHERE pe_inner.event_time <= $effective_from
-              AND EXISTS (
-                  SELECT 1 FROM primitive_weights pw_exists
-                  WHERE pw_exists.data_provider = pe_inner.data_provider AND pw_exists.stream_id = pe_inner.stream_id
-              )
-              AND pe_inner.created_at <= $effective_frozen_at
         ) pe
         WHERE pe.rn = 1
     ),
 
     primitive_events_in_interval AS (
-        SELECT
+        SELECT DISTINCT
             pe.data_provider,
             pe.stream_id,
             pe.event_time,
             pe.value
-        FROM (
-             SELECT
-                pe_inner.data_provider,
-                pe_inner.stream_id,
-                pe_inner.event_time,
-                pe_inner.created_at,
-                pe_inner.value,
-                ROW_NUMBER() OVER (
-                    PARTITION BY pe_inner.data_provider, pe_inner.stream_id, pe_inner.event_time
-                    ORDER BY pe_inner.created_at DESC
-                ) as rn
-            FROM primitive_events pe_inner
-            JOIN primitive_weights pw_check
-                ON pe_inner.data_provider = pw_check.data_provider
-               AND pe_inner.stream_id = pw_check.stream_id
-               AND pe_inner.event_time >= pw_check.group_sequence_start
-               AND pe_inner.event_time <= pw_check.group_sequence_end
-            WHERE pe_inner.event_time > $effective_from
-                AND pe_inner.event_time <= $effective_to
-                AND pe_inner.created_at <= $effective_frozen_at
-        ) pe
-        WHERE pe.rn = 1
+        FROM latest_revisions pe
+        JOIN primitive_weights pw_check
+            ON pe.data_provider = pw_check.data_provider
+           AND pe.stream_id = pw_check.stream_id
+           AND pe.event_time >= pw_check.group_sequence_start
+           AND pe.event_time <= pw_check.group_sequence_end
+        WHERE pe.event_time > $effective_from
+            AND pe.event_time <= $effective_to
     ),
 
     all_primitive_points AS (
@@ -573,16 +581,9 @@ RETURNS TABLE(
                         -- Then latest event at or before base time
                         CASE WHEN p_base.event_time <= $effective_base_time THEN p_base.event_time END DESC NULLS LAST,
                         -- Then earliest event after base time
-                        CASE WHEN p_base.event_time > $effective_base_time THEN p_base.event_time END ASC NULLS LAST,
-                        -- Tie-break by creation time
-                        p_base.created_at DESC
+                        CASE WHEN p_base.event_time > $effective_base_time THEN p_base.event_time END ASC NULLS LAST
                 ) as rn
-            FROM primitive_events p_base
-            WHERE EXISTS ( -- Ensure the primitive is part of the hierarchy
-                SELECT 1 FROM primitive_weights pw_base
-                WHERE pw_base.data_provider = p_base.data_provider AND pw_base.stream_id = p_base.stream_id
-            )
-            AND p_base.created_at <= $effective_frozen_at
+            FROM latest_revisions p_base
         ) bv_calc
         WHERE bv_calc.rn = 1
     ),
@@ -874,4 +875,57 @@ CREATE OR REPLACE ACTION internal_get_base_value(
     
     -- If no value is found at all, return an error
     ERROR('no base value found');
-};
\ No newline at end of file
+};
+
+/**
+ * get_composed_primitive_leaves: Lists the primitive streams found below a composed
+ * stream through any of its taxonomies, overshadowed or not.
+ * Doesn't check permissions, callers are responsible for it.
+ */
+CREATE OR REPLACE ACTION get_composed_primitive_leaves(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PRIVATE VIEW
+RETURNS TABLE(
+    data_provider TEXT,
+    stream_id TEXT
+) {
+    $data_provider := LOWER($data_provider);
+
+    RETURN WITH RECURSIVE all_taxonomies AS (
+      /* Direct children of ($data_provider, $stream_id) */
+      SELECT
+        t.data_provider,
+        t.stream_id,
+        t.child_data_provider,
+        t.child_stream_id
+      FROM taxonomies t
+      WHERE t.data_provider = $data_provider
+        AND t.stream_id     = $stream_id
+
+      UNION
+
+      /* For each discovered child, gather its own children */
+      SELECT
+        at.child_data_provider AS data_provider,
+        at.child_stream_id     AS stream_id,
+        t.child_data_provider,
+        t.child_stream_id
+      FROM all_taxonomies at
+      JOIN taxonomies t
+        ON t.data_provider = at.child_data_provider
+       AND t.stream_id     = at.child_stream_id
+    ),
+    primitive_leaves AS (
+      /* Keep only references pointing to primitive streams */
+      SELECT DISTINCT
+        at.child_data_provider AS data_provider,
+        at.child_stream_id     AS stream_id
+      FROM all_taxonomies at
+      JOIN streams s
+        ON s.data_provider = at.child_data_provider
+       AND s.stream_id     = at.child_stream_id
+       AND s.stream_type   = 'primitive'
+    )
+    SELECT data_provider, stream_id FROM primitive_leaves;
+};
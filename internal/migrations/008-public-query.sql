@@ -1,6 +1,7 @@
 /**
  * get_record: Public facade for retrieving time series data.
  * Routes to primitive or composed implementation based on stream type.
+ * Gaps are filled according to the stream's fill_mode metadata (LOCF by default).
  */
 CREATE OR REPLACE ACTION get_record(
     $data_provider TEXT,
@@ -13,6 +14,17 @@ CREATE OR REPLACE ACTION get_record(
     value NUMERIC(36,18)
 ) {
     $data_provider  := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+
+    -- Streams that don't carry the last observation forward, see 022-fill-modes.sql
+    $fill_mode TEXT := get_fill_mode($data_provider, $stream_id);
+    if $fill_mode != 'locf' {
+        for $row in get_record_filled($data_provider, $stream_id, $from, $to, $frozen_at, $fill_mode) {
+            RETURN NEXT $row.event_time, $row.value;
+        }
+        RETURN;
+    }
+
     -- Check if the stream is primitive or composed
     $is_primitive BOOL := is_primitive_stream($data_provider, $stream_id);
     
@@ -42,6 +54,7 @@ CREATE OR REPLACE ACTION get_last_record(
     value NUMERIC(36,18)
 ) {
     $data_provider  := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
     -- Check if the stream is primitive or composed
     $is_primitive BOOL := is_primitive_stream($data_provider, $stream_id);
     
@@ -73,6 +86,7 @@ CREATE OR REPLACE ACTION get_first_record(
     value NUMERIC(36,18)
 ) {
     $data_provider  := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
     -- Check if the stream is primitive or composed
     $is_primitive BOOL := is_primitive_stream($data_provider, $stream_id);
 
@@ -99,6 +113,7 @@ CREATE OR REPLACE ACTION get_base_value(
     $frozen_at INT8
 ) PUBLIC view returns (value NUMERIC(36,18)) {
     $data_provider  := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
     $lower_caller TEXT := LOWER(@caller);
     -- Check read permissions
     if !is_allowed_to_read_all($data_provider, $stream_id, $lower_caller, NULL, $base_time) {
@@ -193,6 +208,7 @@ CREATE OR REPLACE ACTION get_base_value(
 /**
  * get_index: Calculates indexed values relative to a base value.
  * Routes to primitive or composed implementation based on stream type.
+ * Gaps are filled according to the stream's fill_mode metadata (LOCF by default).
  */
 CREATE OR REPLACE ACTION get_index(
     $data_provider TEXT,
@@ -206,6 +222,17 @@ CREATE OR REPLACE ACTION get_index(
     value NUMERIC(36,18)
 ) {
     $data_provider  := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+
+    -- Streams that don't carry the last observation forward, see 022-fill-modes.sql
+    $fill_mode TEXT := get_fill_mode($data_provider, $stream_id);
+    if $fill_mode != 'locf' {
+        for $row in get_index_filled($data_provider, $stream_id, $from, $to, $frozen_at, $base_time, $fill_mode) {
+            RETURN NEXT $row.event_time, $row.value;
+        }
+        RETURN;
+    }
+
     -- Check if the stream is primitive or composed
     $is_primitive BOOL := is_primitive_stream($data_provider, $stream_id);
     
@@ -221,6 +248,11 @@ CREATE OR REPLACE ACTION get_index(
     }
 };
 
+/**
+ * get_index_change: Percent change of the index over $time_interval seconds.
+ * Points without a previous point, with a zero previous value or whose change overflows are skipped,
+ * get_index_change_by_type (021-index-change-metrics.sql) flags them instead.
+ */
 CREATE OR REPLACE ACTION get_index_change(
     $data_provider TEXT,
     $stream_id TEXT,
@@ -235,121 +267,9 @@ RETURNS TABLE (
     value NUMERIC(36,18)
 )
 {
-    $data_provider  := LOWER($data_provider);
-    /*
-     * 1. Parameter checks
-     */
-    
-    IF $time_interval IS NULL {
-        ERROR('time_interval is required');
-    }
-
-    -- Current arrays
-    $current_dates  := []::INT8[];
-    $current_values := []::NUMERIC(36,18)[];
-    $current_count  := 0;
-
-    -- Prev arrays
-    $prev_dates  := []::INT8[];
-    $prev_values := []::NUMERIC(36,18)[];
-    $prev_count  := 0;
-
-    /*
-     * 3. Gather CURRENT data from get_index(...) into $current_*
-     */
-    
-    FOR $row IN get_index($data_provider, $stream_id, $from, $to, $frozen_at, $base_time) {
-        -- Bump the counter (use 1-based indexing for arrays)
-        $current_dates := array_append($current_dates, $row.event_time);
-        $current_values := array_append($current_values, $row.value);
-    }
-
-    $current_count := array_length($current_dates);
-
-    IF $current_count = 0 {
-        -- No current data => no output
-        RETURN;
-    }
-
-    /*
-     * 4. We know we'll need "previous" data from earliest to latest possible.
-     *    The earliest needed is: min(current_date) - time_interval
-     *    The latest  needed is: max(current_date) - time_interval
-     *
-     *    Because get_index returns ascending times, we can gather them in one pass.
-     */
-
-    $earliest_needed := $current_dates[1]  - ($time_interval)::INT8;
-    $latest_needed   := $current_dates[$current_count] - ($time_interval)::INT8;
-
-    -- If the user passed $from and $to, it's possible earliest_needed < from. 
-    -- We can use that or just rely on earliest_needed < to. 
-    -- We'll just do the direct range here:
-    FOR $row IN get_index($data_provider, $stream_id, $earliest_needed, $latest_needed, $frozen_at, $base_time) {
-        $prev_dates := array_append($prev_dates, $row.event_time);
-        $prev_values := array_append($prev_values, $row.value);
-    }
-
-    $prev_count := array_length($prev_dates);
-
-    IF $prev_count = 0 {
-        -- If no previous data at all, then there's nothing to compare => no output
-        RETURN;
-    }
-
-    /*
-     * 5. "Two-pointer" pass:
-     *    - i => index in current arrays  (1..$current_count)
-     *    - j => index in prev arrays     (1..$prev_count)
-     *
-     *    Move i from 1..$current_count.
-     *    For each i, move j forward while the next item is still ≤ $target
-     *    stops once j+1 would exceed that threshold.
-     *
-     *    Then prev_dates[j] is the "best match" if it's ≤ that target.
-     */
-
-    $j := 1;  -- pointer for the prev arrays
-    
-    $matches_found := 0;
-    $matches_skipped_prev_gt_target := 0;
-    $matches_skipped_zero_value := 0;
-
-    FOR $i IN 1..$current_count {
-        $target := $current_dates[$i] - ($time_interval)::INT8;
-        
-        -- Move j forward while the next item is still ≤ $target
-        FOR $k IN $j..$prev_count {
-            $next_index := $k + 1;
-            -- interpreter can't support short circuiting here
-            -- then we split the ifs to avoid out of bounds errors
-            IF $k < $prev_count {
-                IF $prev_dates[$next_index] <= $target {
-                    $j := $next_index;
-                } ELSE {
-                    BREAK;  -- we've gone as far as we can
-                }
-            } ELSE {
-                BREAK;  -- we've gone as far as we can
-            }
-        }
-        
-        -- Check if the found prev_date is <= target
-        IF $j <= $prev_count AND $prev_dates[$j] <= $target {
-            IF $prev_values[$j] != 0::NUMERIC(36,18) {
-                $change := (
-                    ($current_values[$i] - $prev_values[$j])
-                    * 100::NUMERIC(36,18)
-                ) / $prev_values[$j];
-                
-                RETURN NEXT $current_dates[$i], $change;
-                $matches_found := $matches_found + 1;
-            } ELSE {
-                $matches_skipped_zero_value := $matches_skipped_zero_value + 1;
-            }
-        } ELSE {
-            $matches_skipped_prev_gt_target := $matches_skipped_prev_gt_target + 1;
+    for $row in get_index_change_by_type($data_provider, $stream_id, $from, $to, $frozen_at, $base_time, $time_interval, 'percent') {
+        if $row.status = 'ok' {
+            RETURN NEXT $row.event_time, $row.value;
         }
     }
-    
 }
\ No newline at end of file
@@ -2,6 +2,8 @@
  * truflation_last_deployed_date: Returns the last deployed date of the Truflation data provider.
  * This action checks if the caller has read access to the specified stream and ensures that the stream is a primitive stream.
  * If both conditions are met, it retrieves the last deployed date from the primitive_events table.
+ * Only the current revision of each record counts: replaced revisions, retracted records
+ * (retract_record) and records still embargoed for the caller (get_embargo_cutoff) are skipped.
  */
 CREATE OR REPLACE ACTION truflation_last_deployed_date(
     $data_provider TEXT,
@@ -21,16 +23,28 @@ CREATE OR REPLACE ACTION truflation_last_deployed_date(
         ERROR('stream is not a primitive stream');
     }
 
-    RETURN SELECT truflation_created_at
-           FROM primitive_events
-           WHERE data_provider = $data_provider
-             AND stream_id = $stream_id
-           ORDER BY truflation_created_at DESC LIMIT 1;
+    $embargo_cutoff INT8 := get_embargo_cutoff($data_provider, $stream_id, NULL);
+
+    RETURN SELECT pe.truflation_created_at
+           FROM primitive_events pe
+           WHERE pe.data_provider = $data_provider
+             AND pe.stream_id = $stream_id
+             AND COALESCE(pe.visible_from, 0) <= $embargo_cutoff -- embargo, see get_embargo_cutoff
+             AND pe.is_tombstone = false
+             AND NOT EXISTS ( -- replaced or retracted by a later revision
+                 SELECT 1 FROM primitive_events later
+                 WHERE later.data_provider = pe.data_provider
+                   AND later.stream_id = pe.stream_id
+                   AND later.event_time = pe.event_time
+                   AND later.created_at > pe.created_at
+                   AND COALESCE(later.visible_from, 0) <= $embargo_cutoff
+             )
+           ORDER BY pe.truflation_created_at DESC NULLS LAST LIMIT 1;
 };
 
 /**
  * truflation_insert_records: Adds multiple new data points to a primitive stream in batch.
- * Validates write permissions and stream existence for each record before insertion.
+ * Validates write permissions, stream existence and validation rules for each record before insertion.
  * This action is specifically designed for the Truflation data provider as it requires the truflation_created_at field.
  */
 CREATE OR REPLACE ACTION truflation_insert_records(
@@ -72,6 +86,9 @@ CREATE OR REPLACE ACTION truflation_insert_records(
         }
     }
 
+    -- Ensure each record passes the validation rules of its stream
+    validate_record_inserts($data_provider, $stream_id, $event_time, $value);
+
     -- Insert all records using WITH RECURSIVE pattern to avoid round trips
     WITH RECURSIVE
     indexes AS (
@@ -107,4 +124,6 @@ CREATE OR REPLACE ACTION truflation_insert_records(
         $current_block,
         truflation_created_at
     FROM arguments;
+
+    log_record_inserts('truflation_insert_records', $data_provider, $stream_id, $event_time, NULL);
 };
\ No newline at end of file
@@ -0,0 +1,148 @@
+/**
+ * get_bucket_start: Returns the start of the calendar bucket containing a timestamp.
+ * Buckets are UTC based: 'day', 'week' (starting on Monday) or 'month'.
+ * Month boundaries are computed with integer civil-date arithmetic, so the result
+ * doesn't depend on the database timezone. Divisions round down, so timestamps before
+ * 1970 fall in the bucket they belong to.
+ */
+CREATE OR REPLACE ACTION get_bucket_start(
+    $event_time INT8,
+    $bucket TEXT
+) PRIVATE view returns (bucket_start INT8) {
+    $seconds_per_day INT8 := 86400;
+    $day INT8 := $event_time / $seconds_per_day;
+    if $event_time < 0 AND $event_time % $seconds_per_day != 0 {
+        $day := $day - 1;
+    }
+
+    if $bucket = 'day' {
+        return $day * $seconds_per_day;
+    }
+
+    if $bucket = 'week' {
+        -- 1970-01-01 was a Thursday, so the Monday of a day is 3 days shifted
+        return ($day - ((($day + 3) % 7 + 7) % 7)) * $seconds_per_day;
+    }
+
+    if $bucket = 'month' {
+        -- days since 0000-03-01, so leap days fall at the end of each year
+        $z INT8 := $day + 719468;
+        $era INT8 := $z / 146097;
+        if $z < 0 AND $z % 146097 != 0 {
+            $era := $era - 1;
+        }
+        $day_of_era INT8 := $z - $era * 146097;
+        $year_of_era INT8 := ($day_of_era - $day_of_era / 1460 + $day_of_era / 36524 - $day_of_era / 146096) / 365;
+        $day_of_year INT8 := $day_of_era - (365 * $year_of_era + $year_of_era / 4 - $year_of_era / 100);
+        $month_index INT8 := (5 * $day_of_year + 2) / 153;
+        $day_of_month INT8 := $day_of_year - (153 * $month_index + 2) / 5;
+        return ($day - $day_of_month) * $seconds_per_day;
+    }
+
+    ERROR(format('invalid bucket: %s (expected day, week or month)', $bucket));
+};
+
+/**
+ * get_record_aggregated: Rolls up a stream into calendar buckets.
+ * Works for primitive and composed streams through get_record, so the stream's fill_mode
+ * and frozen_at behave exactly as they do there. The point get_record returns for $from
+ * (the LOCF anchor before $from, or the interpolated value at $from with linear) is
+ * attributed to the bucket containing $from. With none, buckets only hold records.
+ * Methods: 'avg', 'first', 'last', 'min', 'max'.
+ * Returns one row per bucket that has data, keyed by the bucket start.
+ */
+CREATE OR REPLACE ACTION get_record_aggregated(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $bucket TEXT,
+    $method TEXT
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $data_provider  := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+    $lower_caller TEXT := LOWER(@caller);
+
+    if $bucket IS NULL OR ($bucket != 'day' AND $bucket != 'week' AND $bucket != 'month') {
+        ERROR(format('invalid bucket: %s (expected day, week or month)', COALESCE($bucket, 'NULL')));
+    }
+    if $method IS NULL OR ($method != 'avg' AND $method != 'first' AND $method != 'last' AND $method != 'min' AND $method != 'max') {
+        ERROR(format('invalid method: %s (expected avg, first, last, min or max)', COALESCE($method, 'NULL')));
+    }
+
+    if !is_allowed_to_read_all($data_provider, $stream_id, $lower_caller, $from, $to) {
+        ERROR('Not allowed to read stream');
+    }
+
+    $has_bucket BOOL := false;
+    $current_bucket INT8;
+    $first_value NUMERIC(36,18);
+    $last_value NUMERIC(36,18);
+    $min_value NUMERIC(36,18);
+    $max_value NUMERIC(36,18);
+    $sum_value NUMERIC(72,36); -- a bucket's sum can exceed NUMERIC(36,18) even when its average doesn't
+    $count INT8;
+
+    for $row in get_record($data_provider, $stream_id, $from, $to, $frozen_at) {
+        $bucket_time := $row.event_time;
+        if $from IS NOT NULL AND $bucket_time < $from {
+            $bucket_time := $from;
+        }
+        $row_bucket := get_bucket_start($bucket_time, $bucket);
+
+        if $has_bucket AND $row_bucket != $current_bucket {
+            -- bucket is complete, emit it
+            if $method = 'avg' {
+                RETURN NEXT $current_bucket, ($sum_value / $count::NUMERIC(72,36))::NUMERIC(36,18);
+            } elseif $method = 'first' {
+                RETURN NEXT $current_bucket, $first_value;
+            } elseif $method = 'last' {
+                RETURN NEXT $current_bucket, $last_value;
+            } elseif $method = 'min' {
+                RETURN NEXT $current_bucket, $min_value;
+            } else {
+                RETURN NEXT $current_bucket, $max_value;
+            }
+            $has_bucket := false;
+        }
+
+        if !$has_bucket {
+            $has_bucket := true;
+            $current_bucket := $row_bucket;
+            $first_value := $row.value;
+            $min_value := $row.value;
+            $max_value := $row.value;
+            $sum_value := 0::NUMERIC(72,36);
+            $count := 0;
+        }
+
+        $last_value := $row.value;
+        $sum_value := $sum_value + $row.value::NUMERIC(72,36);
+        $count := $count + 1;
+        if $row.value < $min_value {
+            $min_value := $row.value;
+        }
+        if $row.value > $max_value {
+            $max_value := $row.value;
+        }
+    }
+
+    -- emit the last open bucket
+    if $has_bucket {
+        if $method = 'avg' {
+            RETURN NEXT $current_bucket, ($sum_value / $count::NUMERIC(72,36))::NUMERIC(36,18);
+        } elseif $method = 'first' {
+            RETURN NEXT $current_bucket, $first_value;
+        } elseif $method = 'last' {
+            RETURN NEXT $current_bucket, $last_value;
+        } elseif $method = 'min' {
+            RETURN NEXT $current_bucket, $min_value;
+        } else {
+            RETURN NEXT $current_bucket, $max_value;
+        }
+    }
+};
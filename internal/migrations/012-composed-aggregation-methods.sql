@@ -0,0 +1,627 @@
+/**
+ * Aggregation methods for composed streams.
+ *
+ * A composed stream combines its primitive leaves using the method stored in
+ * its `aggregation_method` metadata (string):
+ *   - weighted_mean (default): sum(weight * value) / sum(weight)
+ *   - weighted_sum: sum(weight * value)
+ *   - weighted_median: the lowest value whose cumulative weight, sorted by
+ *     value, reaches half of the total weight
+ *   - geometric_mean: exp(sum(weight * ln(value)) / sum(weight)), values must be positive
+ *
+ * Weights are the effective (multiplied) weights of the primitive leaves, exactly
+ * as used by get_record_composed. weighted_mean and weighted_sum are computed by the
+ * delta method in get_record_composed; the other methods need every primitive's
+ * state at each time point and are computed from get_composed_primitive_states.
+ */
+
+/**
+ * get_aggregation_method: Returns the aggregation method of a stream.
+ * Defaults to weighted_mean when the metadata is not set.
+ *
+ * The primitives are combined with the effective weights of the whole tree, so the
+ * method of the stream applies at every level. Composed streams below it that set
+ * another method are refused when the metadata or the taxonomy is written, see
+ * check_aggregation_method; the ones that don't set it follow the queried stream.
+ */
+CREATE OR REPLACE ACTION get_aggregation_method(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PRIVATE view returns (method TEXT) {
+    $data_provider := LOWER($data_provider);
+    return COALESCE(get_latest_metadata_string($data_provider, $stream_id, 'aggregation_method'), 'weighted_mean');
+};
+
+/**
+ * get_set_aggregation_methods: Lists the composed streams that set aggregation_method among
+ * a stream and its ancestors ($ancestors) or descendants, through enabled taxonomies.
+ */
+CREATE OR REPLACE ACTION get_set_aggregation_methods(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $ancestors BOOL
+) PRIVATE view returns table(
+    data_provider TEXT,
+    stream_id TEXT,
+    method TEXT
+) {
+    $data_provider := LOWER($data_provider);
+
+    if $ancestors {
+        for $row in WITH RECURSIVE linked AS (
+            SELECT $data_provider::TEXT AS data_provider, $stream_id::TEXT AS stream_id
+            UNION
+            SELECT t.data_provider, t.stream_id
+            FROM linked l
+            JOIN taxonomies t
+              ON t.child_data_provider = l.data_provider
+             AND t.child_stream_id = l.stream_id
+            WHERE t.disabled_at IS NULL
+        )
+        SELECT l.data_provider, l.stream_id
+        FROM linked l
+        JOIN streams s
+          ON s.data_provider = l.data_provider
+         AND s.stream_id = l.stream_id
+         AND s.stream_type = 'composed' {
+            $method TEXT := get_latest_metadata_string($row.data_provider, $row.stream_id, 'aggregation_method');
+            if $method IS NOT NULL {
+                RETURN NEXT $row.data_provider, $row.stream_id, $method;
+            }
+        }
+        RETURN;
+    }
+
+    for $row in WITH RECURSIVE linked AS (
+        SELECT $data_provider::TEXT AS data_provider, $stream_id::TEXT AS stream_id
+        UNION
+        SELECT t.child_data_provider, t.child_stream_id
+        FROM linked l
+        JOIN taxonomies t
+          ON t.data_provider = l.data_provider
+         AND t.stream_id = l.stream_id
+        WHERE t.disabled_at IS NULL
+    )
+    SELECT l.data_provider, l.stream_id
+    FROM linked l
+    JOIN streams s
+      ON s.data_provider = l.data_provider
+     AND s.stream_id = l.stream_id
+     AND s.stream_type = 'composed' {
+        $method TEXT := get_latest_metadata_string($row.data_provider, $row.stream_id, 'aggregation_method');
+        if $method IS NOT NULL {
+            RETURN NEXT $row.data_provider, $row.stream_id, $method;
+        }
+    }
+};
+
+/**
+ * check_aggregation_method: Errors if setting $method on a composed stream would disagree with
+ * an ancestor or a descendant that sets another one. Called by insert_metadata.
+ */
+CREATE OR REPLACE ACTION check_aggregation_method(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $method TEXT
+) PRIVATE view {
+    $data_provider := LOWER($data_provider);
+
+    for $ancestors in ARRAY[true, false] {
+        for $row in get_set_aggregation_methods($data_provider, $stream_id, $ancestors) {
+            if ($row.data_provider != $data_provider OR $row.stream_id != $stream_id) AND $row.method != $method {
+                ERROR(format('nested aggregation methods are not supported: %s/%s would use %s, %s/%s uses %s',
+                    $data_provider, $stream_id, $method, $row.data_provider, $row.stream_id, $row.method));
+            }
+        }
+    }
+};
+
+/**
+ * check_aggregation_method_link: Errors if a taxonomy from a parent to a child would put composed
+ * streams setting different aggregation methods above one another. Called by insert_taxonomy.
+ */
+CREATE OR REPLACE ACTION check_aggregation_method_link(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $child_data_provider TEXT,
+    $child_stream_id TEXT
+) PRIVATE view {
+    for $up in get_set_aggregation_methods($data_provider, $stream_id, true) {
+        for $down in get_set_aggregation_methods($child_data_provider, $child_stream_id, false) {
+            if $up.method != $down.method {
+                ERROR(format('nested aggregation methods are not supported: %s/%s uses %s, %s/%s uses %s',
+                    $up.data_provider, $up.stream_id, $up.method, $down.data_provider, $down.stream_id, $down.method));
+            }
+        }
+    }
+};
+
+/**
+ * is_valid_aggregation_method: Checks a value for the aggregation_method metadata.
+ */
+CREATE OR REPLACE ACTION is_valid_aggregation_method(
+    $method TEXT
+) PRIVATE view returns (is_valid BOOL) {
+    return $method = 'weighted_mean'
+        OR $method = 'weighted_sum'
+        OR $method = 'weighted_median'
+        OR $method = 'geometric_mean';
+};
+
+/**
+ * internal_ln: Natural logarithm of a positive number.
+ * Reduces the argument to [1, 2) by powers of two, then sums the
+ * series ln(y) = 2 * atanh((y - 1) / (y + 1)).
+ */
+CREATE OR REPLACE ACTION internal_ln(
+    $x NUMERIC(72,36)
+) PRIVATE view returns (result NUMERIC(72,36)) {
+    if $x <= 0::NUMERIC(72,36) {
+        ERROR(format('logarithm of non-positive value: %s', $x));
+    }
+
+    $ln2 NUMERIC(72,36) := 0.693147180559945309417232121458176568::NUMERIC(72,36);
+    $one NUMERIC(72,36) := 1::NUMERIC(72,36);
+    $two NUMERIC(72,36) := 2::NUMERIC(72,36);
+
+    -- x = y * 2^k with y in [1, 2)
+    $y NUMERIC(72,36) := $x;
+    $k INT8 := 0;
+    for $i in 1..256 {
+        if $y < $two {
+            break;
+        }
+        $y := $y / $two;
+        $k := $k + 1;
+    }
+    for $i in 1..256 {
+        if $y >= $one {
+            break;
+        }
+        $y := $y * $two;
+        $k := $k - 1;
+    }
+
+    $z NUMERIC(72,36) := ($y - $one) / ($y + $one);
+    $z2 NUMERIC(72,36) := $z * $z;
+    $term NUMERIC(72,36) := $z;
+    $sum NUMERIC(72,36) := 0::NUMERIC(72,36);
+    for $n in 0..80 {
+        if $term = 0::NUMERIC(72,36) {
+            break;
+        }
+        $sum := $sum + $term / (2 * $n + 1)::NUMERIC(72,36);
+        $term := $term * $z2;
+    }
+
+    return $two * $sum + $k::NUMERIC(72,36) * $ln2;
+};
+
+/**
+ * internal_exp: Exponential of a number.
+ * Reduces the argument to r = x - k * ln(2), sums the Taylor series of e^r,
+ * then scales back by 2^k.
+ */
+CREATE OR REPLACE ACTION internal_exp(
+    $x NUMERIC(72,36)
+) PRIVATE view returns (result NUMERIC(72,36)) {
+    $ln2 NUMERIC(72,36) := 0.693147180559945309417232121458176568::NUMERIC(72,36);
+    $two NUMERIC(72,36) := 2::NUMERIC(72,36);
+    $half_ln2 NUMERIC(72,36) := $ln2 / $two;
+
+    -- x = r + k * ln(2) with |r| <= ln(2) / 2
+    $r NUMERIC(72,36) := $x;
+    $k INT8 := 0;
+    for $i in 1..4096 {
+        if $r <= $half_ln2 {
+            break;
+        }
+        $r := $r - $ln2;
+        $k := $k + 1;
+    }
+    for $i in 1..4096 {
+        if $r >= 0::NUMERIC(72,36) - $half_ln2 {
+            break;
+        }
+        $r := $r + $ln2;
+        $k := $k - 1;
+    }
+
+    $term NUMERIC(72,36) := 1::NUMERIC(72,36);
+    $sum NUMERIC(72,36) := 1::NUMERIC(72,36);
+    for $n in 1..80 {
+        $term := $term * $r / $n::NUMERIC(72,36);
+        if $term = 0::NUMERIC(72,36) {
+            break;
+        }
+        $sum := $sum + $term;
+    }
+
+    if $k > 0 {
+        for $i in 1..$k {
+            $sum := $sum * $two;
+        }
+    } elseif $k < 0 {
+        $negative_k INT8 := 0 - $k;
+        for $i in 1..$negative_k {
+            $sum := $sum / $two;
+        }
+    }
+
+    return $sum;
+};
+
+/**
+ * get_composed_primitive_states: Returns the state of every contributing primitive
+ * (LOCF value and effective weight) at each time the composed value may change.
+ *
+ * Output times are the value/weight change times within [$from, $to] plus the
+ * latest change at or before $from, mirroring the points get_record_composed returns.
+ * Primitives without a value yet, or with zero weight, are omitted.
+ *
+ * The taxonomy tree is resolved by get_composed_primitive_weights, with the taxonomies as of
+ * $taxonomy_height (NULL for the current ones), and the primitive
+ * timelines (initial_primitive_states through unified_events) are identical to
+ * get_record_composed in 006-composed-query.sql.
+ * Doesn't check permissions, callers are responsible for it.
+ */
+CREATE OR REPLACE ACTION get_composed_primitive_states(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $taxonomy_height INT8
+) PRIVATE VIEW
+RETURNS TABLE(
+    event_time INT8,
+    data_provider TEXT,
+    stream_id TEXT,
+    value NUMERIC(36,18),
+    weight NUMERIC(36,18)
+) {
+    $data_provider := LOWER($data_provider);
+    $max_int8 := 9223372036854775000;
+    $effective_from := COALESCE($from, 0);
+    $effective_to := COALESCE($to, $max_int8);
+    $effective_frozen_at := COALESCE($frozen_at, $max_int8);
+
+    -- Effective weights of the primitives over the range, see get_composed_primitive_weights,
+    -- with the highest visible_from the caller can read in each, see get_embargo_cutoff
+    $pw_data_providers := []::TEXT[];
+    $pw_stream_ids := []::TEXT[];
+    $pw_raw_weights := []::NUMERIC(36,18)[];
+    $pw_starts := []::INT8[];
+    $pw_ends := []::INT8[];
+    $pw_cutoffs := []::INT8[];
+    for $pw in get_composed_primitive_weights($data_provider, $stream_id, $from, $to, $taxonomy_height) {
+        $pw_data_providers := array_append($pw_data_providers, $pw.data_provider);
+        $pw_stream_ids := array_append($pw_stream_ids, $pw.stream_id);
+        $pw_raw_weights := array_append($pw_raw_weights, $pw.raw_weight);
+        $pw_starts := array_append($pw_starts, $pw.group_sequence_start);
+        $pw_ends := array_append($pw_ends, $pw.group_sequence_end);
+        $pw_cutoff INT8 := get_embargo_cutoff($pw.data_provider, $pw.stream_id, $frozen_at);
+        $pw_cutoffs := array_append($pw_cutoffs, $pw_cutoff);
+    }
+    -- no primitive contributes to the range
+    if COALESCE(array_length($pw_data_providers), 0) = 0 {
+        RETURN;
+    }
+
+    RETURN WITH RECURSIVE
+    indexes AS (
+        SELECT 1 AS idx
+        UNION ALL
+        SELECT idx + 1 FROM indexes
+        WHERE idx < array_length($pw_data_providers)
+    ),
+    weight_arrays AS (
+        SELECT
+            $pw_data_providers AS data_providers,
+            $pw_stream_ids AS stream_ids,
+            $pw_raw_weights AS raw_weights,
+            $pw_starts AS group_sequence_starts,
+            $pw_ends AS group_sequence_ends,
+            $pw_cutoffs AS embargo_cutoffs
+    ),
+    primitive_weights AS (
+        SELECT
+            weight_arrays.data_providers[idx] AS data_provider,
+            weight_arrays.stream_ids[idx] AS stream_id,
+            weight_arrays.raw_weights[idx]::NUMERIC(36,18) AS raw_weight,
+            weight_arrays.group_sequence_starts[idx] AS group_sequence_start,
+            weight_arrays.group_sequence_ends[idx] AS group_sequence_end,
+            weight_arrays.embargo_cutoffs[idx] AS embargo_cutoff
+        FROM indexes
+        JOIN weight_arrays ON 1=1
+    ),
+
+    primitive_cutoffs AS (
+        SELECT DISTINCT data_provider, stream_id, embargo_cutoff
+        FROM primitive_weights
+    ),
+
+    /*----------------------------------------------------------------------
+     * LATEST_REVISIONS CTE: The current record of each primitive at each
+     * event_time. Keeps the latest revision created by $frozen_at among those
+     * the caller can read (see get_embargo_cutoff), and drops the records whose
+     * latest revision is a tombstone (retract_record).
+     *---------------------------------------------------------------------*/
+    latest_revisions AS (
+        SELECT data_provider, stream_id, event_time, value
+        FROM (
+            SELECT
+                pe.data_provider,
+                pe.stream_id,
+                pe.event_time,
+                pe.value,
+                pe.is_tombstone,
+                ROW_NUMBER() OVER (
+                    PARTITION BY pe.data_provider, pe.stream_id, pe.event_time
+                    ORDER BY pe.created_at DESC
+                ) as rn
+            FROM primitive_events pe
+            JOIN primitive_cutoffs pc
+              ON pc.data_provider = pe.data_provider
+             AND pc.stream_id = pe.stream_id
+            WHERE pe.event_time <= $effective_to
+              AND pe.created_at <= $effective_frozen_at
+              AND COALESCE(pe.visible_from, 0) <= pc.embargo_cutoff -- embargo, see get_embargo_cutoff
+        ) revisions
+        WHERE revisions.rn = 1 AND revisions.is_tombstone = false
+    ),
+
+    -- Step 1: Find initial states (value at or before $effective_from)
+    initial_primitive_states AS (
+        SELECT
+            pe.data_provider,
+            pe.stream_id,
+            pe.event_time, -- Keep the actual time of the initial event
+            pe.value
+        FROM (
+            -- Use ROW_NUMBER to find the latest event per primitive before/at $from
+            SELECT
+                pe_inner.data_provider,
+                pe_inner.stream_id,
+                pe_inner.event_time,
+                pe_inner.value,
+                ROW_NUMBER() OVER (
+                    PARTITION BY pe_inner.data_provider, pe_inner.stream_id
+                    ORDER BY pe_inner.event_time DESC
+                ) as rn
+            FROM latest_revisions pe_inner
+            WHERE pe_inner.event_time <= $effective_from -- At or before the start
+        ) pe
+        WHERE pe.rn = 1 -- Select the latest state
+    ),
+
+    -- Step 2: Find distinct primitive events strictly WITHIN the interval ($from < time <= $to).
+    primitive_events_in_interval AS (
+        SELECT DISTINCT
+            pe.data_provider,
+            pe.stream_id,
+            pe.event_time,
+            pe.value
+        FROM latest_revisions pe
+        JOIN primitive_weights pw_check -- Ensure validity against *a* taxonomy interval
+            ON pe.data_provider = pw_check.data_provider
+           AND pe.stream_id = pw_check.stream_id
+           AND pe.event_time >= pw_check.group_sequence_start
+           AND pe.event_time <= pw_check.group_sequence_end
+        WHERE pe.event_time > $effective_from -- Strictly after start
+            AND pe.event_time <= $effective_to    -- At or before end
+    ),
+
+    -- Step 3: Combine initial states and interval events.
+    all_primitive_points AS (
+        SELECT data_provider, stream_id, event_time, value FROM initial_primitive_states
+        UNION ALL
+        SELECT data_provider, stream_id, event_time, value FROM primitive_events_in_interval
+    ),
+
+    -- Step 4: Calculate value change (delta_value) for each primitive.
+    primitive_event_changes AS (
+        SELECT * FROM (
+                          SELECT data_provider, stream_id, event_time, value,
+                                 COALESCE(value - LAG(value) OVER (PARTITION BY data_provider, stream_id ORDER BY event_time), value)::numeric(36,18) AS delta_value
+                          FROM all_primitive_points
+                      ) calc WHERE delta_value != 0::numeric(36,18)
+    ),
+
+    -- Step 5: Find the first time each primitive provides a value. (Added for correctness)
+    first_value_times AS (
+        SELECT
+            data_provider,
+            stream_id,
+            MIN(event_time) as first_value_time
+        FROM all_primitive_points -- Based on combined initial state and interval events
+        GROUP BY data_provider, stream_id
+    ),
+
+    -- Step 6: Generate effective weight change events based on first value time. (Added for correctness)
+    effective_weight_changes AS (
+        -- Positive delta: Occurs at the LATER of weight definition start OR first value time
+        SELECT
+            pw.data_provider,
+            pw.stream_id,
+            GREATEST(pw.group_sequence_start, fvt.first_value_time) AS event_time, -- Use effective start time
+            pw.raw_weight AS weight_delta
+        FROM primitive_weights pw
+        INNER JOIN first_value_times fvt -- Only consider primitives that HAVE values
+            ON pw.data_provider = fvt.data_provider AND pw.stream_id = fvt.stream_id
+        -- Ensure the calculated effective start time is still within the weight's defined interval
+        WHERE GREATEST(pw.group_sequence_start, fvt.first_value_time) <= pw.group_sequence_end
+          AND pw.raw_weight != 0::numeric(36,18)
+
+        UNION ALL
+
+        -- Negative delta: Occurs when the original weight interval ends
+        SELECT
+            pw.data_provider,
+            pw.stream_id,
+            pw.group_sequence_end + 1 AS event_time,
+            -pw.raw_weight AS weight_delta
+        FROM primitive_weights pw
+        INNER JOIN first_value_times fvt -- Ensure we only add a negative delta if a positive one was possible
+            ON pw.data_provider = fvt.data_provider AND pw.stream_id = fvt.stream_id
+        -- Check the same validity condition as the positive delta
+        WHERE GREATEST(pw.group_sequence_start, fvt.first_value_time) <= pw.group_sequence_end
+          AND pw.raw_weight != 0::numeric(36,18)
+          -- don't emit closing delta for open interval
+          AND pw.group_sequence_end < ($max_int8 - 1)
+    ),
+
+    -- Step 7: Combine value and *effective* weight changes into a unified timeline.
+    unified_events AS (
+        SELECT
+            pec.data_provider,
+            pec.stream_id,
+            pec.event_time,
+            pec.delta_value,
+            0::numeric(36,18) AS weight_delta
+        FROM primitive_event_changes pec
+
+        UNION ALL
+
+        -- *Effective* Weight changes (deltas)
+        SELECT
+            ewc.data_provider,
+            ewc.stream_id,
+            ewc.event_time,
+            0::numeric(36,18) AS delta_value,
+            ewc.weight_delta
+        FROM effective_weight_changes ewc -- Use effective changes
+    ),
+
+    -- Value and weight of each primitive after every change, peers at the same time included
+    state_points AS (
+        SELECT DISTINCT
+            data_provider,
+            stream_id,
+            event_time,
+            (SUM(delta_value) OVER (PARTITION BY data_provider, stream_id ORDER BY event_time))::numeric(36,18) AS value,
+            (SUM(weight_delta) OVER (PARTITION BY data_provider, stream_id ORDER BY event_time))::numeric(36,18) AS weight
+        FROM unified_events
+    ),
+
+    change_times AS (
+        SELECT DISTINCT event_time FROM state_points
+    ),
+
+    -- Changes in range, plus the anchor carried into the range
+    output_times AS (
+        SELECT event_time FROM change_times
+        WHERE event_time >= $effective_from
+          AND event_time <= $effective_to
+
+        UNION
+
+        SELECT anchor.event_time FROM (
+            SELECT MAX(event_time) AS event_time
+            FROM change_times
+            WHERE event_time <= $effective_from
+        ) anchor
+        WHERE anchor.event_time IS NOT NULL
+    )
+
+    SELECT
+        ot.event_time,
+        sp.data_provider,
+        sp.stream_id,
+        sp.value,
+        sp.weight
+    FROM output_times ot
+    JOIN state_points sp
+      ON sp.event_time = (
+            SELECT MAX(sp_latest.event_time)
+            FROM state_points sp_latest
+            WHERE sp_latest.data_provider = sp.data_provider
+              AND sp_latest.stream_id = sp.stream_id
+              AND sp_latest.event_time <= ot.event_time
+         )
+    WHERE sp.weight != 0::numeric(36,18)
+    ORDER BY ot.event_time ASC, sp.value ASC, sp.data_provider ASC, sp.stream_id ASC;
+};
+
+/**
+ * aggregate_state_values: Combines the values of the primitives at a single point.
+ * Values must be sorted ascending, as returned by get_composed_primitive_states.
+ */
+CREATE OR REPLACE ACTION aggregate_state_values(
+    $values NUMERIC(36,18)[],
+    $weights NUMERIC(36,18)[],
+    $method TEXT
+) PRIVATE view returns (value NUMERIC(36,18)) {
+    $count := array_length($values);
+    $total_weight NUMERIC(36,18) := 0::NUMERIC(36,18);
+    for $i in 1..$count {
+        $total_weight := $total_weight + $weights[$i];
+    }
+
+    if $method = 'weighted_median' {
+        -- walk the sorted values until half of the weight is covered
+        $cumulative_weight NUMERIC(36,18) := 0::NUMERIC(36,18);
+        for $i in 1..$count {
+            $cumulative_weight := $cumulative_weight + $weights[$i];
+            if $cumulative_weight * 2::NUMERIC(36,18) >= $total_weight {
+                return $values[$i];
+            }
+        }
+        return $values[$count];
+    }
+
+    if $method = 'geometric_mean' {
+        $weighted_log_sum NUMERIC(72,36) := 0::NUMERIC(72,36);
+        for $i in 1..$count {
+            if $values[$i] <= 0::NUMERIC(36,18) {
+                ERROR(format('geometric_mean requires positive values, got %s', $values[$i]));
+            }
+            $weighted_log_sum := $weighted_log_sum + $weights[$i]::NUMERIC(72,36) * internal_ln($values[$i]::NUMERIC(72,36));
+        }
+        return internal_exp($weighted_log_sum / $total_weight::NUMERIC(72,36))::NUMERIC(36,18);
+    }
+
+    ERROR(format('aggregation method %s is not computed by state', $method));
+};
+
+/**
+ * get_record_composed_by_state: Computes a composed series with a method that needs
+ * the full state of the primitives at each point (weighted_median, geometric_mean),
+ * with the taxonomies as of $taxonomy_height (see get_composed_primitive_weights).
+ * Doesn't check permissions, callers are responsible for it.
+ */
+CREATE OR REPLACE ACTION get_record_composed_by_state(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $method TEXT,
+    $taxonomy_height INT8
+) PRIVATE VIEW
+RETURNS TABLE(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $current_time INT8;
+    $values := []::NUMERIC(36,18)[];
+    $weights := []::NUMERIC(36,18)[];
+
+    -- rows arrive grouped by event_time; emit a point whenever the group changes
+    for $row in get_composed_primitive_states($data_provider, $stream_id, $from, $to, $frozen_at, $taxonomy_height) {
+        if $current_time IS NOT NULL AND $row.event_time != $current_time {
+            $aggregated_value NUMERIC(36,18) := aggregate_state_values($values, $weights, $method);
+            RETURN NEXT $current_time, $aggregated_value;
+            $values := []::NUMERIC(36,18)[];
+            $weights := []::NUMERIC(36,18)[];
+        }
+        $current_time := $row.event_time;
+        $values := array_append($values, $row.value);
+        $weights := array_append($weights, $row.weight);
+    }
+
+    if $current_time IS NOT NULL {
+        $last_value NUMERIC(36,18) := aggregate_state_values($values, $weights, $method);
+        RETURN NEXT $current_time, $last_value;
+    }
+};
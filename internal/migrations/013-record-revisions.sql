@@ -0,0 +1,342 @@
+/**
+ * get_record_revisions: Lists every revision of a stream's records in [$from, $to].
+ * For primitive streams, each row is a stored revision of an event_time.
+ * For composed streams, each row is a change of the computed value at a block height.
+ * Retractions are returned with is_tombstone = true and a NULL value.
+ * Embargoed revisions are only listed once visible, except for writers of the stream.
+ * Rows are ordered by created_at, then event_time.
+ */
+CREATE OR REPLACE ACTION get_record_revisions(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18),
+    created_at INT8,
+    truflation_created_at TEXT,
+    is_tombstone BOOL
+) {
+    $data_provider  := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+    $lower_caller TEXT := LOWER(@caller);
+
+    if !is_allowed_to_read_all($data_provider, $stream_id, $lower_caller, $from, $to) {
+        ERROR('Not allowed to read stream');
+    }
+
+    if is_primitive_stream($data_provider, $stream_id) {
+        for $row in get_record_revisions_primitive($data_provider, $stream_id, $from, $to, NULL, NULL, NULL) {
+            RETURN NEXT $row.event_time, $row.value, $row.created_at, $row.truflation_created_at, $row.is_tombstone;
+        }
+    } else {
+        for $row in get_record_revisions_composed($data_provider, $stream_id, $from, $to, NULL, NULL, NULL) {
+            RETURN NEXT $row.event_time, $row.value, $row.created_at, $row.truflation_created_at, $row.is_tombstone;
+        }
+    }
+};
+
+/**
+ * get_record_revisions_primitive: Returns the stored revisions of a primitive stream.
+ * With $after_created_at, only the revisions after ($after_created_at, $after_event_time)
+ * are returned, at most $limit of them (see get_record_revisions_page).
+ * Doesn't check permissions, callers are responsible for it.
+ */
+CREATE OR REPLACE ACTION get_record_revisions_primitive(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $after_created_at INT8,
+    $after_event_time INT8,
+    $limit INT
+) PRIVATE view returns table(
+    event_time INT8,
+    value NUMERIC(36,18),
+    created_at INT8,
+    truflation_created_at TEXT,
+    is_tombstone BOOL
+) {
+    $max_int8 INT8 := 9223372036854775000;
+    $effective_from INT8 := COALESCE($from, 0);
+    $effective_to INT8 := COALESCE($to, $max_int8);
+    $embargo_cutoff INT8 := get_embargo_cutoff($data_provider, $stream_id, NULL);
+
+    RETURN SELECT
+            pe.event_time,
+            CASE WHEN pe.is_tombstone THEN NULL::NUMERIC(36,18) ELSE pe.value END AS value,
+            pe.created_at,
+            pe.truflation_created_at,
+            pe.is_tombstone
+        FROM primitive_events pe
+        WHERE pe.data_provider = $data_provider
+        AND pe.stream_id = $stream_id
+        AND pe.event_time >= $effective_from
+        AND pe.event_time <= $effective_to
+        AND COALESCE(pe.visible_from, 0) <= $embargo_cutoff -- embargo, see get_embargo_cutoff
+        AND ($after_created_at IS NULL
+            OR pe.created_at > $after_created_at
+            OR (pe.created_at = $after_created_at AND pe.event_time > $after_event_time))
+        ORDER BY pe.created_at ASC, pe.event_time ASC
+        LIMIT $limit;
+};
+
+/**
+ * get_record_revisions_composed: Replays a composed stream at every height where one
+ * of its primitives got a revision or one of its taxonomies was created or disabled, and
+ * returns the points that changed against the previous height. Each height is replayed with
+ * the taxonomies as of that height (internal_get_record_composed), the primitives are those
+ * that were ever part of the category. A point that disappears (e.g. retracted) is returned
+ * as a tombstone.
+ * The anchor before $from is not part of the range, so it's skipped, and revisions before
+ * $from are only replayed while they change the value carried into the range.
+ * Cost grows with the number of revision heights, keep the range narrow.
+ * With $after_created_at, only the heights from $after_created_at on are replayed, from the
+ * state of the height before it, and at most $limit points after ($after_created_at,
+ * $after_event_time) are returned (see get_record_revisions_page).
+ * Checks the compose permissions once, before the replays; callers are responsible for
+ * the read permissions.
+ */
+CREATE OR REPLACE ACTION get_record_revisions_composed(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $after_created_at INT8,
+    $after_event_time INT8,
+    $limit INT
+) PRIVATE view returns table(
+    event_time INT8,
+    value NUMERIC(36,18),
+    created_at INT8,
+    truflation_created_at TEXT,
+    is_tombstone BOOL
+) {
+    $data_provider := LOWER($data_provider);
+    $max_int8 INT8 := 9223372036854775000;
+    -- explicit bounds, internal_get_record_composed returns only the latest record when both are NULL
+    $effective_from INT8 := COALESCE($from, 0);
+    $effective_to INT8 := COALESCE($to, $max_int8);
+
+    IF $from IS NOT NULL AND $to IS NOT NULL AND $from > $to {
+        ERROR(format('Invalid time range: from (%s) > to (%s)', $from, $to));
+    }
+    -- once here, the replays below don't check permissions
+    IF !is_allowed_to_compose_all($data_provider, $stream_id, $from, $to) {
+        ERROR('Not allowed to compose stream');
+    }
+
+    -- every stream that was ever part of the category, primitive leaves and disabled
+    -- taxonomies included, with the highest visible_from the caller can read in each,
+    -- see get_embargo_cutoff
+    $category_data_providers TEXT[];
+    $category_stream_ids TEXT[];
+    $category_cutoffs INT8[];
+    for $stream in WITH RECURSIVE category AS (
+        SELECT $data_provider AS data_provider, $stream_id AS stream_id
+        UNION
+        SELECT t.child_data_provider, t.child_stream_id
+        FROM taxonomies t
+        JOIN category c
+          ON t.data_provider = c.data_provider
+         AND t.stream_id = c.stream_id
+    )
+    SELECT data_provider, stream_id FROM category {
+        $category_data_providers := array_append($category_data_providers, $stream.data_provider);
+        $category_stream_ids := array_append($category_stream_ids, $stream.stream_id);
+        $stream_cutoff INT8 := get_embargo_cutoff($stream.data_provider, $stream.stream_id, NULL);
+        $category_cutoffs := array_append($category_cutoffs, $stream_cutoff);
+    }
+    $num_streams INT := array_length($category_stream_ids);
+
+    -- heights where a primitive got a revision that may affect the range, where an
+    -- embargoed revision was released to the caller, or where a taxonomy changed.
+    -- a revision before $from only affects the range while it's the value carried into it:
+    -- it's skipped when the primitive has a current record between it and $from at that height
+    $heights INT8[];
+    for $height_row in WITH RECURSIVE
+    indexes AS (
+        SELECT 1 AS idx
+        UNION ALL
+        SELECT idx + 1 FROM indexes
+        WHERE idx < $num_streams
+    ),
+    stream_arrays AS (
+        SELECT
+            $category_data_providers AS data_providers,
+            $category_stream_ids AS stream_ids,
+            $category_cutoffs AS embargo_cutoffs
+    ),
+    category_streams AS (
+        SELECT
+            stream_arrays.data_providers[idx] AS data_provider,
+            stream_arrays.stream_ids[idx] AS stream_id,
+            stream_arrays.embargo_cutoffs[idx] AS embargo_cutoff
+        FROM indexes
+        JOIN stream_arrays ON 1=1
+    ),
+    revisions AS (
+        SELECT pe.data_provider, pe.stream_id, pe.event_time, pe.created_at AS height, cs.embargo_cutoff
+        FROM primitive_events pe
+        JOIN category_streams cs
+          ON pe.data_provider = cs.data_provider
+         AND pe.stream_id = cs.stream_id
+        WHERE pe.event_time <= $effective_to
+          AND COALESCE(pe.visible_from, 0) <= cs.embargo_cutoff -- embargo, see get_embargo_cutoff
+
+        UNION
+
+        SELECT pe.data_provider, pe.stream_id, pe.event_time, pe.visible_from AS height, cs.embargo_cutoff
+        FROM primitive_events pe
+        JOIN category_streams cs
+          ON pe.data_provider = cs.data_provider
+         AND pe.stream_id = cs.stream_id
+        WHERE pe.event_time <= $effective_to
+          AND pe.visible_from > pe.created_at
+          AND pe.visible_from <= cs.embargo_cutoff
+    ),
+    revision_heights AS (
+        SELECT DISTINCT r.height
+        FROM revisions r
+        WHERE r.event_time >= $effective_from
+           OR NOT EXISTS (
+            SELECT 1
+            FROM primitive_events later
+            WHERE later.data_provider = r.data_provider
+              AND later.stream_id = r.stream_id
+              AND later.event_time > r.event_time
+              AND later.event_time <= $effective_from
+              AND later.created_at <= r.height
+              AND later.is_tombstone = false
+              AND COALESCE(later.visible_from, 0) <= LEAST(r.embargo_cutoff, r.height) -- embargo as of the height
+              -- not retracted as of the height
+              AND NOT EXISTS (
+                SELECT 1
+                FROM primitive_events retraction
+                WHERE retraction.data_provider = later.data_provider
+                  AND retraction.stream_id = later.stream_id
+                  AND retraction.event_time = later.event_time
+                  AND retraction.is_tombstone = true
+                  AND retraction.created_at > later.created_at
+                  AND retraction.created_at <= r.height
+              )
+        )
+    ),
+    taxonomy_heights AS (
+        SELECT t.created_at AS height
+        FROM taxonomies t
+        JOIN category_streams cs
+          ON t.data_provider = cs.data_provider
+         AND t.stream_id = cs.stream_id
+
+        UNION
+
+        SELECT t.disabled_at AS height
+        FROM taxonomies t
+        JOIN category_streams cs
+          ON t.data_provider = cs.data_provider
+         AND t.stream_id = cs.stream_id
+        WHERE t.disabled_at IS NOT NULL
+    )
+    SELECT height FROM revision_heights
+    UNION
+    SELECT height FROM taxonomy_heights
+    ORDER BY height ASC {
+        $heights := array_append($heights, $height_row.height);
+    }
+
+    $no_value NUMERIC(36,18);
+    $no_truflation_created_at TEXT;
+    $previous_times INT8[];
+    $previous_values NUMERIC(36,18)[];
+    $count INT := 0;
+
+    -- resume from the state of the last height before the cursor
+    if $after_created_at IS NOT NULL {
+        $baseline_height INT8;
+        for $height in ARRAY $heights {
+            if $height < $after_created_at {
+                $baseline_height := $height;
+            }
+        }
+        if $baseline_height IS NOT NULL {
+            for $row in internal_get_record_composed($data_provider, $stream_id, $effective_from, $effective_to, $baseline_height, $baseline_height) {
+                if $row.event_time >= $effective_from {
+                    $previous_times := array_append($previous_times, $row.event_time);
+                    $previous_values := array_append($previous_values, $row.value);
+                }
+            }
+        }
+    }
+
+    for $height in ARRAY $heights {
+        if $after_created_at IS NOT NULL AND $height < $after_created_at {
+            continue;
+        }
+        -- points of the cursor height up to the cursor were returned by the previous page
+        $skip_to INT8;
+        if $height = $after_created_at {
+            $skip_to := $after_event_time;
+        }
+
+        $current_times INT8[];
+        $current_values NUMERIC(36,18)[];
+        $num_previous INT := COALESCE(array_length($previous_times), 0);
+        -- both series are sorted by event_time, walk them side by side
+        $j INT := 1;
+
+        for $row in internal_get_record_composed($data_provider, $stream_id, $effective_from, $effective_to, $height, $height) {
+            if $row.event_time < $effective_from {
+                continue;
+            }
+
+            -- previous points before this one are gone
+            for $k in $j..$num_previous {
+                if $previous_times[$k] >= $row.event_time {
+                    break;
+                }
+                if $skip_to IS NULL OR $previous_times[$k] > $skip_to {
+                    if $count = $limit {
+                        RETURN;
+                    }
+                    RETURN NEXT $previous_times[$k], $no_value, $height, $no_truflation_created_at, true;
+                    $count := $count + 1;
+                }
+                $j := $j + 1;
+            }
+
+            $is_changed BOOL := true;
+            if $j <= $num_previous {
+                if $previous_times[$j] = $row.event_time {
+                    $is_changed := $previous_values[$j] != $row.value;
+                    $j := $j + 1;
+                }
+            }
+            if $is_changed AND ($skip_to IS NULL OR $row.event_time > $skip_to) {
+                if $count = $limit {
+                    RETURN;
+                }
+                RETURN NEXT $row.event_time, $row.value, $height, $no_truflation_created_at, false;
+                $count := $count + 1;
+            }
+
+            $current_times := array_append($current_times, $row.event_time);
+            $current_values := array_append($current_values, $row.value);
+        }
+
+        -- remaining previous points are gone
+        for $k in $j..$num_previous {
+            if $skip_to IS NULL OR $previous_times[$k] > $skip_to {
+                if $count = $limit {
+                    RETURN;
+                }
+                RETURN NEXT $previous_times[$k], $no_value, $height, $no_truflation_created_at, true;
+                $count := $count + 1;
+            }
+        }
+
+        $previous_times := $current_times;
+        $previous_values := $current_values;
+    }
+};
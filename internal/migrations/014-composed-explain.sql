@@ -0,0 +1,124 @@
+/**
+ * explain_composed_record: Breaks down a composed stream's values by contributing primitive.
+ *
+ * For each event_time returned by get_record for the same range, lists every primitive
+ * that contributes to the value with:
+ *   - weight: its effective weight, multiplied down the taxonomy tree
+ *   - normalized_weight: weight / sum of the weights at that event_time
+ *   - value: the value of the primitive used at that event_time, filled with the fill_mode
+ *     of the composed stream (see 022-fill-modes.sql)
+ *   - contribution: its additive part of the composed value. Contributions of an
+ *     event_time sum up to the composed value for weighted_mean (weight * value / total
+ *     weight) and weighted_sum (weight * value). NULL for weighted_median and
+ *     geometric_mean, which don't split additively.
+ *
+ * Like get_record, when both $from and $to are NULL, only the latest record is explained.
+ * With the linear and none fill modes, the event_times and primitives are those of
+ * get_record_composed_filled: the point before $from is explained at $from, or dropped
+ * with none, and primitives without a filled value don't contribute.
+ */
+CREATE OR REPLACE ACTION explain_composed_record(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8
+) PUBLIC view returns table(
+    event_time INT8,
+    child_data_provider TEXT,
+    child_stream_id TEXT,
+    weight NUMERIC(36,18),
+    normalized_weight NUMERIC(36,18),
+    value NUMERIC(36,18),
+    contribution NUMERIC(36,18)
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+    $lower_caller TEXT := LOWER(@caller);
+
+    if is_primitive_stream($data_provider, $stream_id) {
+        ERROR('explain_composed_record only supports composed streams');
+    }
+
+    IF $from IS NOT NULL AND $to IS NOT NULL AND $from > $to {
+        ERROR(format('Invalid time range: from (%s) > to (%s)', $from, $to));
+    }
+
+    -- same checks as get_record_composed
+    IF !is_allowed_to_read_all($data_provider, $stream_id, $lower_caller, $from, $to) {
+        ERROR('Not allowed to read stream');
+    }
+    IF !is_allowed_to_compose_all($data_provider, $stream_id, $from, $to) {
+        ERROR('Not allowed to compose stream');
+    }
+
+    -- for historical consistency, if both from and to are omitted, explain the latest record
+    if $from IS NULL AND $to IS NULL {
+        $latest_time INT8;
+        for $row in get_last_record_composed($data_provider, $stream_id, NULL, $frozen_at) {
+            $latest_time := $row.event_time;
+        }
+        if $latest_time IS NULL {
+            RETURN;
+        }
+        $from := $latest_time;
+        $to := $latest_time;
+    }
+
+    $aggregation_method TEXT := get_aggregation_method($data_provider, $stream_id);
+    $fill_mode TEXT := get_fill_mode($data_provider, $stream_id);
+
+    $times INT8[];
+    $child_data_providers TEXT[];
+    $child_stream_ids TEXT[];
+    $values NUMERIC(36,18)[];
+    $weights NUMERIC(36,18)[];
+    if $fill_mode = 'locf' {
+        for $row in get_composed_primitive_states($data_provider, $stream_id, $from, $to, $frozen_at, NULL) {
+            $times := array_append($times, $row.event_time);
+            $child_data_providers := array_append($child_data_providers, $row.data_provider);
+            $child_stream_ids := array_append($child_stream_ids, $row.stream_id);
+            $values := array_append($values, $row.value);
+            $weights := array_append($weights, $row.weight);
+        }
+    } else {
+        -- same points as get_record_composed_filled
+        for $row in get_filled_primitive_states($data_provider, $stream_id, $from, $to, $frozen_at, $fill_mode) {
+            $times := array_append($times, $row.event_time);
+            $child_data_providers := array_append($child_data_providers, $row.data_provider);
+            $child_stream_ids := array_append($child_stream_ids, $row.stream_id);
+            $values := array_append($values, $row.value);
+            $weights := array_append($weights, $row.weight);
+        }
+    }
+    $count INT := COALESCE(array_length($times), 0);
+
+    -- rows arrive grouped by event_time; emit a group once its total weight is known
+    $group_start INT := 1;
+    for $i in 1..$count {
+        $is_group_end BOOL := $i = $count;
+        if !$is_group_end {
+            $is_group_end := $times[$i + 1] != $times[$i];
+        }
+
+        if $is_group_end {
+            $total_weight NUMERIC(36,18) := 0::NUMERIC(36,18);
+            for $j in $group_start..$i {
+                $total_weight := $total_weight + $weights[$j];
+            }
+
+            for $j in $group_start..$i {
+                $normalized_weight NUMERIC(36,18) := ($weights[$j]::NUMERIC(72,36) / $total_weight::NUMERIC(72,36))::NUMERIC(36,18);
+                $contribution NUMERIC(36,18);
+                if $aggregation_method = 'weighted_mean' {
+                    $contribution := ($weights[$j]::NUMERIC(72,36) * $values[$j]::NUMERIC(72,36) / $total_weight::NUMERIC(72,36))::NUMERIC(36,18);
+                } elseif $aggregation_method = 'weighted_sum' {
+                    $contribution := ($weights[$j]::NUMERIC(72,36) * $values[$j]::NUMERIC(72,36))::NUMERIC(36,18);
+                }
+                RETURN NEXT $times[$j], $child_data_providers[$j], $child_stream_ids[$j], $weights[$j], $normalized_weight, $values[$j], $contribution;
+            }
+
+            $group_start := $i + 1;
+        }
+    }
+};
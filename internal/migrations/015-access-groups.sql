@@ -0,0 +1,174 @@
+/*
+ * ACCESS GROUPS
+ *
+ * An access group is a set of wallets owned by the wallet that created it. Streams grant
+ * access to all its members at once with the metadata keys:
+ *   - allow_read_group (string): group_id allowed to read a private stream
+ *   - allow_write_group (string): group_id allowed to insert records
+ * Only the owner of a group can reference it from a stream. Membership changes apply right
+ * away to every stream that references the group.
+ */
+
+/**
+ * create_access_group: Creates an empty access group owned by the caller.
+ */
+CREATE OR REPLACE ACTION create_access_group(
+    $group_id TEXT
+) PUBLIC {
+    $lower_caller TEXT := LOWER(@caller);
+
+    if $group_id IS NULL OR LENGTH($group_id) = 0 OR LENGTH($group_id) > 64 {
+        ERROR('group_id must be between 1 and 64 characters');
+    }
+
+    for $row in SELECT 1 FROM access_groups WHERE group_id = $group_id {
+        ERROR('Access group already exists: ' || $group_id);
+    }
+
+    INSERT INTO access_groups (group_id, owner, created_at)
+    VALUES ($group_id, $lower_caller, @height);
+
+    log_audit_event('create_access_group', NULL, NULL, 'group_id=' || $group_id);
+};
+
+/**
+ * delete_access_group: Deletes an access group and its memberships.
+ * The allow_read_group and allow_write_group metadata referencing the group is disabled,
+ * so a group created later with the same group_id doesn't inherit its grants.
+ */
+CREATE OR REPLACE ACTION delete_access_group(
+    $group_id TEXT
+) PUBLIC {
+    $lower_caller TEXT := LOWER(@caller);
+
+    if !is_access_group_owner($group_id, $lower_caller) {
+        ERROR('Only the group owner can delete the access group');
+    }
+
+    UPDATE metadata SET disabled_at = @height
+    WHERE (metadata_key = 'allow_read_group' OR metadata_key = 'allow_write_group')
+    AND value_s = $group_id
+    AND disabled_at IS NULL;
+
+    DELETE FROM access_groups WHERE group_id = $group_id;
+
+    log_audit_event('delete_access_group', NULL, NULL, 'group_id=' || $group_id);
+};
+
+/**
+ * add_access_group_members: Adds wallets to an access group. Existing members are skipped.
+ */
+CREATE OR REPLACE ACTION add_access_group_members(
+    $group_id TEXT,
+    $wallets TEXT[]
+) PUBLIC {
+    $lower_caller TEXT := LOWER(@caller);
+
+    if !is_access_group_owner($group_id, $lower_caller) {
+        ERROR('Only the group owner can add members');
+    }
+
+    $added TEXT := '';
+    for $i in 1..array_length($wallets) {
+        $wallet TEXT := LOWER($wallets[$i]);
+        if NOT check_ethereum_address($wallet) {
+            ERROR('Invalid member address. Must be a valid Ethereum address: ' || $wallets[$i]);
+        }
+
+        $is_member BOOL := false;
+        for $row in SELECT 1 FROM access_group_members WHERE group_id = $group_id AND wallet = $wallet {
+            $is_member := true;
+        }
+        if !$is_member {
+            INSERT INTO access_group_members (group_id, wallet, created_at)
+            VALUES ($group_id, $wallet, @height);
+            $added := $added || ',' || $wallet;
+        }
+    }
+
+    log_audit_event('add_access_group_members', NULL, NULL, 'group_id=' || $group_id || ' wallets=' || substring($added, 2, LENGTH($added)));
+};
+
+/**
+ * remove_access_group_members: Removes wallets from an access group. Non-members are skipped.
+ */
+CREATE OR REPLACE ACTION remove_access_group_members(
+    $group_id TEXT,
+    $wallets TEXT[]
+) PUBLIC {
+    $lower_caller TEXT := LOWER(@caller);
+
+    if !is_access_group_owner($group_id, $lower_caller) {
+        ERROR('Only the group owner can remove members');
+    }
+
+    $removed TEXT := '';
+    for $i in 1..array_length($wallets) {
+        DELETE FROM access_group_members
+        WHERE group_id = $group_id
+        AND wallet = LOWER($wallets[$i]);
+        $removed := $removed || ',' || LOWER($wallets[$i]);
+    }
+
+    log_audit_event('remove_access_group_members', NULL, NULL, 'group_id=' || $group_id || ' wallets=' || substring($removed, 2, LENGTH($removed)));
+};
+
+/**
+ * get_access_group_members: Lists the members of an access group.
+ */
+CREATE OR REPLACE ACTION get_access_group_members(
+    $group_id TEXT
+) PUBLIC view returns table(
+    wallet TEXT,
+    created_at INT8
+) {
+    RETURN SELECT wallet, created_at
+        FROM access_group_members
+        WHERE group_id = $group_id
+        ORDER BY created_at ASC, wallet ASC;
+};
+
+/**
+ * is_access_group_owner: Checks if a wallet owns an access group. Errors if the group doesn't exist.
+ */
+CREATE OR REPLACE ACTION is_access_group_owner(
+    $group_id TEXT,
+    $wallet TEXT
+) PUBLIC view returns (is_owner BOOL) {
+    $owner TEXT;
+    for $row in SELECT owner FROM access_groups WHERE group_id = $group_id {
+        $owner := $row.owner;
+    }
+    if $owner IS NULL {
+        ERROR('Access group does not exist: ' || COALESCE($group_id, ''));
+    }
+    RETURN $owner = LOWER($wallet);
+};
+
+/**
+ * is_wallet_in_stream_access_group: Checks if a wallet belongs to a group that the stream
+ * references with the given metadata key (allow_read_group or allow_write_group).
+ */
+CREATE OR REPLACE ACTION is_wallet_in_stream_access_group(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $key TEXT,
+    $wallet TEXT
+) PRIVATE view returns (is_member BOOL) {
+    $data_provider := LOWER($data_provider);
+    $wallet := LOWER($wallet);
+
+    for $row in SELECT 1
+        FROM metadata m
+        JOIN access_group_members gm ON gm.group_id = m.value_s
+        WHERE m.data_provider = $data_provider
+        AND m.stream_id = $stream_id
+        AND m.metadata_key = $key
+        AND m.disabled_at IS NULL
+        AND (m.expires_at IS NULL OR m.expires_at > @height)
+        AND gm.wallet = $wallet
+        LIMIT 1 {
+        RETURN true;
+    }
+    RETURN false;
+};
@@ -0,0 +1,55 @@
+/*
+ * AUDIT LOG
+ *
+ * Every mutating action appends entries to audit_log: who called it, in which transaction
+ * and block, on which stream, with a compact summary of the arguments. Entries are never
+ * updated nor deleted. Each action logs its own entries once: actions sharing a write, like
+ * insert_metadata and grant_stream_access (insert_metadata_row), call a private helper that
+ * doesn't log, so a grant is a single grant_stream_access entry.
+ * Entries are written with log_audit_event and log_record_inserts (001-common-actions.sql).
+ */
+
+/**
+ * get_audit_log: Lists audit log entries, newest first.
+ * Filters are optional: a stream ($data_provider, and $stream_id within it), the caller and the action.
+ * Paginated with $limit (default and maximum 5000) and $offset.
+ */
+CREATE OR REPLACE ACTION get_audit_log(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $caller TEXT,
+    $action TEXT,
+    $limit INT,
+    $offset INT
+) PUBLIC view returns table(
+    created_at INT8,
+    txid TEXT,
+    log_index INT8,
+    caller TEXT,
+    action TEXT,
+    data_provider TEXT,
+    stream_id TEXT,
+    payload TEXT
+) {
+    $data_provider := LOWER($data_provider);
+    $caller := LOWER($caller);
+
+    if $limit > 5000 {
+        ERROR('Limit exceeds maximum allowed value of 5000');
+    }
+    if $limit IS NULL OR $limit <= 0 {
+        $limit := 5000;
+    }
+    if $offset IS NULL {
+        $offset := 0;
+    }
+
+    RETURN SELECT a.created_at, a.txid, a.log_index, a.caller, a.action, a.data_provider, a.stream_id, a.payload
+        FROM audit_log a
+        WHERE ($data_provider IS NULL OR $data_provider = '' OR a.data_provider = $data_provider)
+        AND ($stream_id IS NULL OR $stream_id = '' OR a.stream_id = $stream_id)
+        AND ($caller IS NULL OR $caller = '' OR a.caller = $caller)
+        AND ($action IS NULL OR $action = '' OR a.action = $action)
+        ORDER BY a.created_at DESC, a.txid DESC, a.log_index DESC
+        LIMIT $limit OFFSET $offset;
+};
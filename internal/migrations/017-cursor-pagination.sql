@@ -0,0 +1,379 @@
+/*
+ * CURSOR PAGINATION
+ *
+ * Page variants of the listing queries. Every row carries a next_cursor: passing the
+ * next_cursor of the last row of a page returns the rows after it. Pages are ordered
+ * oldest first by a unique key, so rows written between two pages are never skipped nor
+ * repeated, and an iteration can be resumed later from its last cursor.
+ * Cursors are opaque to clients, they're made of the key of the row joined by ':'.
+ * A NULL or empty cursor starts from the first row. $limit defaults to and can't exceed 5000.
+ */
+
+/**
+ * cursor_part: Returns the $n-th part of a cursor, parts being joined by ':'.
+ */
+CREATE OR REPLACE ACTION cursor_part(
+    $cursor TEXT,
+    $n INT
+) PRIVATE view returns (part TEXT) {
+    $rest TEXT := $cursor;
+    $sep INT;
+    for $i in 2..$n {
+        $sep := position(':', $rest);
+        if $sep = 0 {
+            ERROR('Invalid cursor: ' || $cursor);
+        }
+        $rest := substring($rest, $sep + 1, LENGTH($rest));
+    }
+
+    $sep := position(':', $rest);
+    if $sep = 0 {
+        RETURN $rest;
+    }
+    RETURN substring($rest, 1, $sep - 1);
+};
+
+/**
+ * list_streams_page: Lists streams like list_streams, ordered by created_at, data_provider and stream_id.
+ */
+CREATE OR REPLACE ACTION list_streams_page(
+    $data_provider TEXT,
+    $limit INT,
+    $cursor TEXT
+) PUBLIC view returns table(
+    data_provider TEXT,
+    stream_id TEXT,
+    stream_type TEXT,
+    created_at INT8,
+    next_cursor TEXT
+) {
+    $data_provider := LOWER($data_provider);
+
+    if $limit > 5000 {
+        ERROR('Limit exceeds maximum allowed value of 5000');
+    }
+    if $limit IS NULL OR $limit <= 0 {
+        $limit := 5000;
+    }
+
+    $after_created_at INT8 := -1;
+    $after_data_provider TEXT := '';
+    $after_stream_id TEXT := '';
+    if $cursor IS NOT NULL AND $cursor != '' {
+        $after_created_at := cursor_part($cursor, 1)::INT8;
+        $after_data_provider := cursor_part($cursor, 2);
+        $after_stream_id := cursor_part($cursor, 3);
+    }
+
+    RETURN SELECT s.data_provider,
+                  s.stream_id,
+                  s.stream_type,
+                  s.created_at,
+                  s.created_at::TEXT || ':' || s.data_provider || ':' || s.stream_id AS next_cursor
+        FROM streams s
+        WHERE ($data_provider IS NULL OR $data_provider = '' OR s.data_provider = $data_provider)
+        AND s.archived_at IS NULL
+        AND (s.created_at > $after_created_at
+             OR (s.created_at = $after_created_at AND s.data_provider > $after_data_provider)
+             OR (s.created_at = $after_created_at AND s.data_provider = $after_data_provider AND s.stream_id > $after_stream_id))
+        ORDER BY s.created_at ASC, s.data_provider ASC, s.stream_id ASC
+        LIMIT $limit;
+};
+
+/**
+ * get_metadata_page: Lists metadata like get_metadata, ordered by created_at and row_id.
+ */
+CREATE OR REPLACE ACTION get_metadata_page(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $key TEXT,
+    $ref TEXT,
+    $limit INT,
+    $cursor TEXT
+) PUBLIC view returns table(
+    row_id uuid,
+    value_i int,
+    value_f NUMERIC(36,18),
+    value_b bool,
+    value_s TEXT,
+    value_ref TEXT,
+    created_at INT,
+    next_cursor TEXT
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+
+    if $limit > 5000 {
+        ERROR('Limit exceeds maximum allowed value of 5000');
+    }
+    if $limit IS NULL OR $limit <= 0 {
+        $limit := 5000;
+    }
+
+    $after_created_at INT8 := -1;
+    $after_row_id TEXT := '';
+    if $cursor IS NOT NULL AND $cursor != '' {
+        $after_created_at := cursor_part($cursor, 1)::INT8;
+        $after_row_id := cursor_part($cursor, 2);
+    }
+
+    RETURN SELECT m.row_id,
+                  m.value_i,
+                  m.value_f,
+                  m.value_b,
+                  m.value_s,
+                  m.value_ref,
+                  m.created_at,
+                  m.created_at::TEXT || ':' || m.row_id::TEXT AS next_cursor
+        FROM metadata m
+        WHERE m.metadata_key = $key
+        AND m.disabled_at IS NULL
+        AND (m.expires_at IS NULL OR m.expires_at > @height)
+        AND ($ref IS NULL OR LOWER(m.value_ref) = LOWER($ref))
+        AND m.stream_id = $stream_id
+        AND m.data_provider = $data_provider
+        AND (m.created_at > $after_created_at
+             OR (m.created_at = $after_created_at AND m.row_id::TEXT > $after_row_id))
+        ORDER BY m.created_at ASC, m.row_id::TEXT ASC
+        LIMIT $limit;
+};
+
+/**
+ * get_record_page: Returns the records of get_record in pages, ordered by event_time.
+ * The first page starts like get_record, with the last record at or before $from.
+ * Without $from, records are read from event_time 0. A page only reads get_record from
+ * the cursor to about $limit records after it, see get_record_page_end.
+ */
+CREATE OR REPLACE ACTION get_record_page(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $limit INT,
+    $cursor TEXT
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18),
+    next_cursor TEXT
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+
+    if $limit > 5000 {
+        ERROR('Limit exceeds maximum allowed value of 5000');
+    }
+    if $limit IS NULL OR $limit <= 0 {
+        $limit := 5000;
+    }
+
+    -- get_record only returns the latest record without range
+    $effective_from INT8 := COALESCE($from, 0);
+    $after INT8;
+    if $cursor IS NOT NULL AND $cursor != '' {
+        $after := cursor_part($cursor, 1)::INT8;
+        $effective_from := $after;
+    }
+
+    -- get_record is read in windows ending at the $limit-th record time after their start,
+    -- among the records of the stream's primitives. Retracted or embargoed records leave a
+    -- window short, so the next window doubles and the last one reads up to $to.
+    $max_windows INT := 16;
+    $count INT := 0;
+    $window_from INT8 := $effective_from;
+    $window_size INT := $limit;
+    for $window in 1..$max_windows {
+        $window_to INT8 := $to;
+        if $window < $max_windows {
+            $window_end INT8 := get_record_page_end($data_provider, $stream_id, $window_from, $to, $window_size);
+            if $window_end IS NOT NULL {
+                $window_to := $window_end;
+            }
+        }
+
+        for $row in get_record($data_provider, $stream_id, $window_from, $window_to, $frozen_at) {
+            -- the record at the cursor is returned again as the anchor of the range
+            if ($after IS NULL OR $row.event_time > $after) AND $count < $limit {
+                $count := $count + 1;
+                RETURN NEXT $row.event_time, $row.value, $row.event_time::TEXT;
+            }
+        }
+
+        if $count >= $limit OR $window_to IS NULL OR COALESCE($window_to = $to, false) {
+            RETURN;
+        }
+        -- the next window starts with the point at $window_to, already read by this one
+        $after := $window_to;
+        $window_from := $window_to;
+        $window_size := $window_size * 2;
+    }
+};
+
+/**
+ * get_record_page_end: Returns the $n-th distinct event_time after $after and up to $to
+ * among the records of the primitives of a stream, or NULL when there are fewer.
+ * Retractions and embargoes are ignored, it only sizes the windows of get_record_page.
+ */
+CREATE OR REPLACE ACTION get_record_page_end(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $after INT8,
+    $to INT8,
+    $n INT
+) PRIVATE view returns (event_time INT8) {
+    $max_int8 INT8 := 9223372036854775000;
+    $effective_to INT8 := COALESCE($to, $max_int8);
+
+    $category_data_providers TEXT[];
+    $category_stream_ids TEXT[];
+    for $stream in get_category_streams($data_provider, $stream_id, $after, $to) {
+        $category_data_providers := array_append($category_data_providers, $stream.data_provider);
+        $category_stream_ids := array_append($category_stream_ids, $stream.stream_id);
+    }
+    $num_streams INT := COALESCE(array_length($category_stream_ids), 0);
+
+    for $row in WITH RECURSIVE
+    indexes AS (
+        SELECT 1 AS idx
+        UNION ALL
+        SELECT idx + 1 FROM indexes
+        WHERE idx < $num_streams
+    ),
+    stream_arrays AS (
+        SELECT
+            $category_data_providers AS data_providers,
+            $category_stream_ids AS stream_ids
+    ),
+    category_streams AS (
+        SELECT
+            stream_arrays.data_providers[idx] AS data_provider,
+            stream_arrays.stream_ids[idx] AS stream_id
+        FROM indexes
+        JOIN stream_arrays ON 1=1
+    ),
+    event_times AS (
+        SELECT DISTINCT pe.event_time
+        FROM primitive_events pe
+        JOIN category_streams cs
+          ON pe.data_provider = cs.data_provider
+         AND pe.stream_id = cs.stream_id
+        WHERE pe.event_time > $after
+          AND pe.event_time <= $effective_to
+    )
+    SELECT event_time FROM event_times
+    ORDER BY event_time ASC
+    LIMIT 1 OFFSET $n - 1 {
+        RETURN $row.event_time;
+    }
+    RETURN NULL::INT8;
+};
+
+/**
+ * get_record_revisions_page: Returns the revisions of get_record_revisions in pages,
+ * ordered by created_at, then event_time.
+ */
+CREATE OR REPLACE ACTION get_record_revisions_page(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $limit INT,
+    $cursor TEXT
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18),
+    created_at INT8,
+    truflation_created_at TEXT,
+    is_tombstone BOOL,
+    next_cursor TEXT
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+
+    if $limit > 5000 {
+        ERROR('Limit exceeds maximum allowed value of 5000');
+    }
+    if $limit IS NULL OR $limit <= 0 {
+        $limit := 5000;
+    }
+
+    $after_created_at INT8;
+    $after_event_time INT8;
+    if $cursor IS NOT NULL AND $cursor != '' {
+        $after_created_at := cursor_part($cursor, 1)::INT8;
+        $after_event_time := cursor_part($cursor, 2)::INT8;
+    }
+
+    -- same checks as get_record_revisions, whose internal actions take the cursor and the limit
+    $lower_caller TEXT := LOWER(@caller);
+    if !is_allowed_to_read_all($data_provider, $stream_id, $lower_caller, $from, $to) {
+        ERROR('Not allowed to read stream');
+    }
+
+    if is_primitive_stream($data_provider, $stream_id) {
+        for $row in get_record_revisions_primitive($data_provider, $stream_id, $from, $to, $after_created_at, $after_event_time, $limit) {
+            RETURN NEXT $row.event_time, $row.value, $row.created_at, $row.truflation_created_at, $row.is_tombstone,
+                $row.created_at::TEXT || ':' || $row.event_time::TEXT;
+        }
+    } else {
+        for $row in get_record_revisions_composed($data_provider, $stream_id, $from, $to, $after_created_at, $after_event_time, $limit) {
+            RETURN NEXT $row.event_time, $row.value, $row.created_at, $row.truflation_created_at, $row.is_tombstone,
+                $row.created_at::TEXT || ':' || $row.event_time::TEXT;
+        }
+    }
+};
+
+/**
+ * get_audit_log_page: Lists audit log entries like get_audit_log, but oldest first,
+ * ordered by created_at, txid and log_index.
+ */
+CREATE OR REPLACE ACTION get_audit_log_page(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $caller TEXT,
+    $action TEXT,
+    $limit INT,
+    $cursor TEXT
+) PUBLIC view returns table(
+    created_at INT8,
+    txid TEXT,
+    log_index INT8,
+    caller TEXT,
+    action TEXT,
+    data_provider TEXT,
+    stream_id TEXT,
+    payload TEXT,
+    next_cursor TEXT
+) {
+    $data_provider := LOWER($data_provider);
+    $caller := LOWER($caller);
+
+    if $limit > 5000 {
+        ERROR('Limit exceeds maximum allowed value of 5000');
+    }
+    if $limit IS NULL OR $limit <= 0 {
+        $limit := 5000;
+    }
+
+    $after_created_at INT8 := -1;
+    $after_txid TEXT := '';
+    $after_log_index INT8 := -1;
+    if $cursor IS NOT NULL AND $cursor != '' {
+        $after_created_at := cursor_part($cursor, 1)::INT8;
+        $after_txid := cursor_part($cursor, 2);
+        $after_log_index := cursor_part($cursor, 3)::INT8;
+    }
+
+    RETURN SELECT a.created_at, a.txid, a.log_index, a.caller, a.action, a.data_provider, a.stream_id, a.payload,
+                  a.created_at::TEXT || ':' || a.txid || ':' || a.log_index::TEXT AS next_cursor
+        FROM audit_log a
+        WHERE ($data_provider IS NULL OR $data_provider = '' OR a.data_provider = $data_provider)
+        AND ($stream_id IS NULL OR $stream_id = '' OR a.stream_id = $stream_id)
+        AND ($caller IS NULL OR $caller = '' OR a.caller = $caller)
+        AND ($action IS NULL OR $action = '' OR a.action = $action)
+        AND (a.created_at > $after_created_at
+             OR (a.created_at = $after_created_at AND a.txid > $after_txid)
+             OR (a.created_at = $after_created_at AND a.txid = $after_txid AND a.log_index > $after_log_index))
+        ORDER BY a.created_at ASC, a.txid ASC, a.log_index ASC
+        LIMIT $limit;
+};
@@ -0,0 +1,134 @@
+/**
+ * search_streams: Finds streams matching all the given filters, paginated with a cursor
+ * like list_streams_page (see 017-cursor-pagination.sql). Every filter is optional:
+ * - $data_provider: data provider the stream was created under
+ * - $stream_type: 'primitive' or 'composed'
+ * - $owner: current owner of the stream, which can differ from the data provider
+ * - $metadata_keys, $metadata_values: pairs that must all be set on the stream. A pair matches
+ *   an active row of the key whose string, ref, int, float or bool value equals the value.
+ *   Floats compare without trailing zeros, so '1.5' matches 1.500000000000000000.
+ *   A NULL value only requires the key to be set.
+ * - $read_visibility: 0 for public streams, 1 for private ones
+ * - $created_from, $created_to: block height range of the creation, inclusive
+ */
+CREATE OR REPLACE ACTION search_streams(
+    $data_provider TEXT,
+    $stream_type TEXT,
+    $owner TEXT,
+    $metadata_keys TEXT[],
+    $metadata_values TEXT[],
+    $read_visibility INT,
+    $created_from INT8,
+    $created_to INT8,
+    $limit INT,
+    $cursor TEXT
+) PUBLIC view returns table(
+    data_provider TEXT,
+    stream_id TEXT,
+    stream_type TEXT,
+    owner TEXT,
+    created_at INT8,
+    next_cursor TEXT
+) {
+    $data_provider := LOWER($data_provider);
+    $owner := LOWER($owner);
+
+    if $stream_type IS NOT NULL AND $stream_type != 'primitive' AND $stream_type != 'composed' {
+        ERROR('Invalid stream type. Must be "primitive" or "composed": ' || $stream_type);
+    }
+
+    $num_pairs INT := COALESCE(array_length($metadata_keys), 0);
+    if $num_pairs != COALESCE(array_length($metadata_values), 0) {
+        ERROR('Metadata keys and values arrays must have the same length');
+    }
+
+    if $limit > 5000 {
+        ERROR('Limit exceeds maximum allowed value of 5000');
+    }
+    if $limit IS NULL OR $limit <= 0 {
+        $limit := 5000;
+    }
+
+    $after_created_at INT8 := -1;
+    $after_data_provider TEXT := '';
+    $after_stream_id TEXT := '';
+    if $cursor IS NOT NULL AND $cursor != '' {
+        $after_created_at := cursor_part($cursor, 1)::INT8;
+        $after_data_provider := cursor_part($cursor, 2);
+        $after_stream_id := cursor_part($cursor, 3);
+    }
+
+    RETURN WITH RECURSIVE
+    indexes AS (
+        SELECT 1 AS idx
+        UNION ALL
+        SELECT idx + 1 FROM indexes
+        WHERE idx < $num_pairs
+    ),
+    pair_arrays AS (
+        SELECT
+            $metadata_keys AS metadata_keys,
+            $metadata_values AS metadata_values
+    ),
+    pairs AS (
+        SELECT
+            idx,
+            pair_arrays.metadata_keys[idx] AS metadata_key,
+            pair_arrays.metadata_values[idx] AS metadata_value
+        FROM indexes
+        JOIN pair_arrays ON 1=1
+    )
+    SELECT s.data_provider,
+           s.stream_id,
+           s.stream_type,
+           o.value_ref AS owner,
+           s.created_at,
+           s.created_at::TEXT || ':' || s.data_provider || ':' || s.stream_id AS next_cursor
+    FROM streams s
+    JOIN metadata o
+        ON o.data_provider = s.data_provider
+        AND o.stream_id = s.stream_id
+        AND o.metadata_key = 'stream_owner'
+        AND o.disabled_at IS NULL
+    WHERE s.archived_at IS NULL
+    AND ($data_provider IS NULL OR $data_provider = '' OR s.data_provider = $data_provider)
+    AND ($stream_type IS NULL OR s.stream_type = $stream_type)
+    AND ($owner IS NULL OR $owner = '' OR o.value_ref = $owner)
+    AND ($created_from IS NULL OR s.created_at >= $created_from)
+    AND ($created_to IS NULL OR s.created_at <= $created_to)
+    AND ($read_visibility IS NULL OR $read_visibility = COALESCE((
+        SELECT v.value_i FROM metadata v
+        WHERE v.data_provider = s.data_provider
+        AND v.stream_id = s.stream_id
+        AND v.metadata_key = 'read_visibility'
+        AND v.disabled_at IS NULL
+        ORDER BY v.created_at DESC
+        LIMIT 1
+    ), 0))
+    -- every pair must match at least one active metadata row
+    AND ($num_pairs = 0 OR $num_pairs = (
+        SELECT COUNT(*) FROM pairs p
+        WHERE EXISTS (
+            SELECT 1 FROM metadata m
+            WHERE m.data_provider = s.data_provider
+            AND m.stream_id = s.stream_id
+            AND m.metadata_key = p.metadata_key
+            AND m.disabled_at IS NULL
+            AND (m.expires_at IS NULL OR m.expires_at > @height)
+            AND (p.metadata_value IS NULL
+                 OR m.value_s = p.metadata_value
+                 OR LOWER(m.value_ref) = LOWER(p.metadata_value)
+                 OR m.value_i::TEXT = p.metadata_value
+                 OR rtrim(rtrim(m.value_f::TEXT, '0'), '.') = CASE
+                     WHEN p.metadata_value LIKE '%.%' THEN rtrim(rtrim(p.metadata_value, '0'), '.')
+                     ELSE p.metadata_value
+                 END
+                 OR m.value_b::TEXT = LOWER(p.metadata_value))
+        )
+    ))
+    AND (s.created_at > $after_created_at
+         OR (s.created_at = $after_created_at AND s.data_provider > $after_data_provider)
+         OR (s.created_at = $after_created_at AND s.data_provider = $after_data_provider AND s.stream_id > $after_stream_id))
+    ORDER BY s.created_at ASC, s.data_provider ASC, s.stream_id ASC
+    LIMIT $limit;
+};
@@ -0,0 +1,157 @@
+/*
+ * STREAM ALIASES
+ *
+ * An alias is a human-readable name, like us_cpi_food, given by the owner to a stream of a
+ * data provider. Aliases are unique per data provider and can be moved to another stream of
+ * the same provider. The public queries of a stream accept an alias wherever they take a
+ * stream_id: get_record, get_index, get_index_change, get_metadata and their variants,
+ * get_record_aggregated, get_record_revisions, explain_composed_record, get_window_analytics,
+ * get_pairwise_series, get_pairwise_statistics and the record pages. See resolve_stream_alias
+ * (001-common-actions.sql). Actions that change a stream take its stream_id only.
+ * Archiving a stream with delete_stream keeps its aliases, so restore_stream brings them back;
+ * purge_stream deletes them.
+ */
+
+/**
+ * check_stream_alias_format: Validates alias format (1 to 64 lowercase alphanumeric chars or '_').
+ * An alias can't have the stream_id format, so stream ids never resolve to another stream.
+ */
+CREATE OR REPLACE ACTION check_stream_alias_format(
+    $alias TEXT
+) PUBLIC view returns (result BOOL) {
+    if $alias IS NULL OR LENGTH($alias) = 0 OR LENGTH($alias) > 64 {
+        return false;
+    }
+    if check_stream_id_format($alias) {
+        return false;
+    }
+
+    for $i in 1..LENGTH($alias) {
+        $c TEXT := substring($alias, $i, 1);
+        if NOT (
+            ($c >= '0' AND $c <= '9')
+            OR ($c >= 'a' AND $c <= 'z')
+            OR $c = '_'
+        ) {
+            return false;
+        }
+    }
+
+    return true;
+};
+
+/**
+ * register_stream_alias: Gives an alias to a stream. Only the stream owner can register it,
+ * and the alias must not be used by another stream of the data provider.
+ */
+CREATE OR REPLACE ACTION register_stream_alias(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $alias TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $lower_caller TEXT := LOWER(@caller);
+
+    if !is_stream_owner($data_provider, $stream_id, $lower_caller) {
+        ERROR('Only stream owner can register an alias');
+    }
+
+    if NOT check_stream_alias_format($alias) {
+        ERROR('Invalid alias format. Must be 1 to 64 lowercase alphanumeric characters or underscores, and not a stream_id: ' || COALESCE($alias, ''));
+    }
+
+    for $row in SELECT stream_id FROM stream_aliases
+        WHERE data_provider = $data_provider AND alias = $alias {
+        ERROR('Alias already registered for stream: ' || $row.stream_id);
+    }
+
+    INSERT INTO stream_aliases (data_provider, alias, stream_id, created_at)
+    VALUES ($data_provider, $alias, $stream_id, @height);
+
+    log_audit_event('register_stream_alias', $data_provider, $stream_id, 'alias=' || $alias);
+};
+
+/**
+ * transfer_stream_alias: Points an alias to another stream of the same data provider.
+ * The caller must own both the stream of the alias and the new stream.
+ */
+CREATE OR REPLACE ACTION transfer_stream_alias(
+    $data_provider TEXT,
+    $alias TEXT,
+    $new_stream_id TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $lower_caller TEXT := LOWER(@caller);
+
+    $stream_id TEXT;
+    for $row in SELECT stream_id FROM stream_aliases
+        WHERE data_provider = $data_provider AND alias = $alias {
+        $stream_id := $row.stream_id;
+    }
+    if $stream_id IS NULL {
+        ERROR('Alias does not exist: ' || COALESCE($alias, ''));
+    }
+
+    if !is_stream_owner($data_provider, $stream_id, $lower_caller) {
+        ERROR('Only stream owner can transfer an alias');
+    }
+    if !is_stream_owner($data_provider, $new_stream_id, $lower_caller) {
+        ERROR('Only the owner of the new stream can receive an alias');
+    }
+
+    UPDATE stream_aliases SET stream_id = $new_stream_id, created_at = @height
+    WHERE data_provider = $data_provider
+    AND alias = $alias;
+
+    log_audit_event('transfer_stream_alias', $data_provider, $new_stream_id, 'alias=' || $alias || ' previous_stream_id=' || $stream_id);
+};
+
+/**
+ * remove_stream_alias: Deletes an alias. Only the owner of its stream can remove it.
+ */
+CREATE OR REPLACE ACTION remove_stream_alias(
+    $data_provider TEXT,
+    $alias TEXT
+) PUBLIC {
+    $data_provider := LOWER($data_provider);
+    $lower_caller TEXT := LOWER(@caller);
+
+    $stream_id TEXT;
+    for $row in SELECT stream_id FROM stream_aliases
+        WHERE data_provider = $data_provider AND alias = $alias {
+        $stream_id := $row.stream_id;
+    }
+    if $stream_id IS NULL {
+        ERROR('Alias does not exist: ' || COALESCE($alias, ''));
+    }
+
+    if !is_stream_owner($data_provider, $stream_id, $lower_caller) {
+        ERROR('Only stream owner can remove an alias');
+    }
+
+    DELETE FROM stream_aliases
+    WHERE data_provider = $data_provider
+    AND alias = $alias;
+
+    log_audit_event('remove_stream_alias', $data_provider, $stream_id, 'alias=' || $alias);
+};
+
+/**
+ * get_stream_aliases: Lists the aliases of a data provider, or only those of a stream.
+ */
+CREATE OR REPLACE ACTION get_stream_aliases(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PUBLIC view returns table(
+    alias TEXT,
+    stream_id TEXT,
+    created_at INT8
+) {
+    $data_provider := LOWER($data_provider);
+
+    RETURN SELECT a.alias, a.stream_id, a.created_at
+        FROM stream_aliases a
+        WHERE a.data_provider = $data_provider
+        AND ($stream_id IS NULL OR $stream_id = '' OR a.stream_id = $stream_id)
+        ORDER BY a.alias ASC;
+};
@@ -0,0 +1,184 @@
+/*
+ * WINDOW ANALYTICS
+ *
+ * Rolling statistics over the output of get_record or get_index, so they're computed from
+ * the same data version as the underlying query (frozen_at, base_time, embargoes, revisions).
+ * The window of a row holds the rows of the last $window seconds: event_time in
+ * (row.event_time - $window, row.event_time]. Rows before $from are read to fill the windows
+ * of the first rows of the range, so a statistic only depends on the rows of its window,
+ * whatever the $from of the query.
+ * Sums and squared deviations are kept in NUMERIC(72,36), results are NUMERIC(36,18).
+ */
+
+/**
+ * numeric_sqrt: Square root of a non-negative NUMERIC(72,36), with Newton's method.
+ * Takes the wider type so callers can pass sums of squares of NUMERIC(36,18) values.
+ */
+CREATE OR REPLACE ACTION numeric_sqrt(
+    $value NUMERIC(72,36)
+) PRIVATE view returns (result NUMERIC(72,36)) {
+    if $value < 0::NUMERIC(72,36) {
+        ERROR('cannot take the square root of a negative value');
+    }
+    if $value = 0::NUMERIC(72,36) {
+        return 0::NUMERIC(72,36);
+    }
+
+    -- start above the root, so the iterations decrease until they converge
+    $x NUMERIC(72,36) := $value;
+    if $x < 1::NUMERIC(72,36) {
+        $x := 1::NUMERIC(72,36);
+    }
+    for $i in 1..200 {
+        $next NUMERIC(72,36) := ($x + $value / $x) / 2::NUMERIC(72,36);
+        if $next >= $x {
+            break;
+        }
+        $x := $next;
+    }
+    return $x;
+};
+
+/**
+ * get_window_analytics: Computes a rolling statistic for each row of get_record ($source 'record')
+ * or get_index ($source 'index', using $base_time) between $from and $to.
+ * Methods:
+ * - 'sma': simple moving average of the window
+ * - 'ema': exponential moving average of the n rows of the window, with alpha = 2 / (n + 1),
+ *   seeded with the first row of the window
+ * - 'stddev': population standard deviation of the window
+ * - 'min', 'max': lowest and highest value of the window
+ * - 'zscore': (value - sma) / stddev. Rows whose window has a zero stddev are skipped.
+ * Returns the rows get_record or get_index would return for the range, with the statistic as value.
+ */
+CREATE OR REPLACE ACTION get_window_analytics(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $base_time INT8,
+    $source TEXT,
+    $window INT8,
+    $method TEXT
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+
+    if $source IS NULL OR ($source != 'record' AND $source != 'index') {
+        ERROR(format('invalid source: %s (expected record or index)', COALESCE($source, 'NULL')));
+    }
+    if $method IS NULL OR ($method != 'sma' AND $method != 'ema' AND $method != 'stddev'
+        AND $method != 'min' AND $method != 'max' AND $method != 'zscore') {
+        ERROR(format('invalid method: %s (expected sma, ema, stddev, min, max or zscore)', COALESCE($method, 'NULL')));
+    }
+    if $window IS NULL OR $window <= 0 {
+        ERROR('window must be a positive number of seconds');
+    }
+
+    -- read the lookback of the first window too. The first row is the last one at or before
+    -- $from, so its window may start before $from - $window
+    $lookback_from INT8;
+    if $from IS NOT NULL {
+        $first_time INT8 := $from;
+        if $source = 'record' {
+            for $row in get_record($data_provider, $stream_id, $from, $from, $frozen_at) {
+                if $row.event_time < $first_time {
+                    $first_time := $row.event_time;
+                }
+            }
+        } else {
+            for $row in get_index($data_provider, $stream_id, $from, $from, $frozen_at, $base_time) {
+                if $row.event_time < $first_time {
+                    $first_time := $row.event_time;
+                }
+            }
+        }
+        $lookback_from := $first_time - $window;
+    }
+
+    $times := []::INT8[];
+    $values := []::NUMERIC(36,18)[];
+    if $source = 'record' {
+        for $row in get_record($data_provider, $stream_id, $lookback_from, $to, $frozen_at) {
+            $times := array_append($times, $row.event_time);
+            $values := array_append($values, $row.value);
+        }
+    } else {
+        for $row in get_index($data_provider, $stream_id, $lookback_from, $to, $frozen_at, $base_time) {
+            $times := array_append($times, $row.event_time);
+            $values := array_append($values, $row.value);
+        }
+    }
+
+    $count INT := COALESCE(array_length($times), 0);
+    if $count = 0 {
+        RETURN;
+    }
+
+    $start INT := 1;
+    $sum NUMERIC(72,36) := 0::NUMERIC(72,36);
+    for $i in 1..$count {
+        -- slide the start of the window past the rows that left it
+        $sum := $sum + $values[$i]::NUMERIC(72,36);
+        for $k in $start..$i {
+            if $times[$start] <= $times[$i] - $window {
+                $sum := $sum - $values[$start]::NUMERIC(72,36);
+                $start := $start + 1;
+            } else {
+                break;
+            }
+        }
+        $window_count NUMERIC(72,36) := ($i - $start + 1)::NUMERIC(72,36);
+        $mean NUMERIC(72,36) := $sum / $window_count;
+
+        -- same rows as get_record: the last row at or before $from, then the rows after it.
+        -- the interpreter doesn't short circuit, so the bounds are checked apart
+        $in_range BOOL := $from IS NULL OR $times[$i] >= $from OR $i = $count;
+        if !$in_range {
+            if $times[$i + 1] > $from {
+                $in_range := true;
+            }
+        }
+
+        if $in_range {
+            if $method = 'sma' {
+                RETURN NEXT $times[$i], $mean::NUMERIC(36,18);
+            } elseif $method = 'ema' {
+                $alpha NUMERIC(72,36) := 2::NUMERIC(72,36) / ($window_count + 1::NUMERIC(72,36));
+                $ema NUMERIC(72,36) := $values[$start]::NUMERIC(72,36);
+                for $k in $start..$i {
+                    if $k > $start {
+                        $ema := $alpha * $values[$k]::NUMERIC(72,36) + (1::NUMERIC(72,36) - $alpha) * $ema;
+                    }
+                }
+                RETURN NEXT $times[$i], $ema::NUMERIC(36,18);
+            } elseif $method = 'min' OR $method = 'max' {
+                $extreme NUMERIC(36,18) := $values[$i];
+                for $k in $start..$i {
+                    if ($method = 'min' AND $values[$k] < $extreme) OR ($method = 'max' AND $values[$k] > $extreme) {
+                        $extreme := $values[$k];
+                    }
+                }
+                RETURN NEXT $times[$i], $extreme;
+            } else {
+                -- deviations from the mean, rather than sums of squares, to keep the precision
+                $squares NUMERIC(72,36) := 0::NUMERIC(72,36);
+                for $k in $start..$i {
+                    $deviation NUMERIC(72,36) := $values[$k]::NUMERIC(72,36) - $mean;
+                    $squares := $squares + $deviation * $deviation;
+                }
+                $stddev NUMERIC(72,36) := numeric_sqrt($squares / $window_count);
+
+                if $method = 'stddev' {
+                    RETURN NEXT $times[$i], $stddev::NUMERIC(36,18);
+                } elseif $stddev != 0::NUMERIC(72,36) {
+                    RETURN NEXT $times[$i], (($values[$i]::NUMERIC(72,36) - $mean) / $stddev)::NUMERIC(36,18);
+                }
+            }
+        }
+    }
+};
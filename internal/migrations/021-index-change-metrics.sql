@@ -0,0 +1,177 @@
+/*
+ * INDEX CHANGE METRICS
+ *
+ * get_index_change_by_type compares each point of get_index with the last point at least
+ * $time_interval seconds before it, like get_index_change, with a choice of metric:
+ *   - percent: (current - previous) * 100 / previous, the value of get_index_change
+ *   - absolute: current - previous
+ *   - log_return: ln(current / previous)
+ *   - annualized: rate in percent that, compounded yearly, gives current / previous over
+ *     $time_interval: ((current / previous) ^ (31536000 / $time_interval) - 1) * 100
+ *   - compounded_annual: month-over-month rate compounded to a year, for a monthly
+ *     $time_interval: ((current / previous) ^ 12 - 1) * 100
+ * Every point is returned with a status instead of being skipped when it can't be compared:
+ *   - ok: the value is set
+ *   - missing: no point at or before event_time - $time_interval
+ *   - zero: the previous value is zero, so the change is undefined (except absolute)
+ *   - undefined: current / previous isn't positive, for log_return, annualized and compounded_annual
+ *   - overflow: the change doesn't fit NUMERIC(36,18), for percent, annualized and compounded_annual,
+ *     e.g. a change of 10% over an hour compounds to more than 10^18 percent a year
+ * annualized and compounded_annual take a positive $time_interval.
+ * The value is NULL when the status isn't ok.
+ */
+
+/**
+ * get_index_change_by_type: Index changes of a stream over $time_interval with the given metric,
+ * see the header of this file. get_index_change returns the ok rows of the percent metric.
+ */
+CREATE OR REPLACE ACTION get_index_change_by_type(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $base_time INT8,
+    $time_interval INT,
+    $change_type TEXT
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18),
+    previous_event_time INT8,
+    status TEXT
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+
+    if $time_interval IS NULL {
+        ERROR('time_interval is required');
+    }
+    if $change_type IS NULL OR ($change_type != 'percent' AND $change_type != 'absolute' AND $change_type != 'log_return'
+        AND $change_type != 'annualized' AND $change_type != 'compounded_annual') {
+        ERROR(format('invalid change type: %s (expected percent, absolute, log_return, annualized or compounded_annual)', COALESCE($change_type, 'NULL')));
+    }
+    if ($change_type = 'annualized' OR $change_type = 'compounded_annual') AND $time_interval <= 0 {
+        ERROR('time_interval must be positive to annualize a change');
+    }
+
+    $current_dates := []::INT8[];
+    $current_values := []::NUMERIC(36,18)[];
+    for $row in get_index($data_provider, $stream_id, $from, $to, $frozen_at, $base_time) {
+        $current_dates := array_append($current_dates, $row.event_time);
+        $current_values := array_append($current_values, $row.value);
+    }
+
+    $current_count INT := COALESCE(array_length($current_dates), 0);
+    if $current_count = 0 {
+        RETURN;
+    }
+
+    -- previous points of the whole range in one pass, get_index returns ascending times
+    $earliest_needed := $current_dates[1] - ($time_interval)::INT8;
+    $latest_needed := $current_dates[$current_count] - ($time_interval)::INT8;
+
+    $prev_dates := []::INT8[];
+    $prev_values := []::NUMERIC(36,18)[];
+    for $row in get_index($data_provider, $stream_id, $earliest_needed, $latest_needed, $frozen_at, $base_time) {
+        $prev_dates := array_append($prev_dates, $row.event_time);
+        $prev_values := array_append($prev_values, $row.value);
+    }
+    $prev_count INT := COALESCE(array_length($prev_dates), 0);
+
+    $zero NUMERIC(72,36) := 0::NUMERIC(72,36);
+    $one NUMERIC(72,36) := 1::NUMERIC(72,36);
+    $hundred NUMERIC(72,36) := 100::NUMERIC(72,36);
+    $seconds_per_year NUMERIC(72,36) := 31536000::NUMERIC(72,36);
+    -- rates are returned as NUMERIC(36,18), below 10^18: a growth up to 10^16 (e^36 for the
+    -- annualized exponent) fits, and below e^-50 the rate rounds to -100 at 18 decimals
+    $max_exponent NUMERIC(72,36) := 36::NUMERIC(72,36);
+    $min_exponent NUMERIC(72,36) := -50::NUMERIC(72,36);
+    $max_growth NUMERIC(72,36) := 10000000000000000::NUMERIC(72,36);
+    $max_value NUMERIC(72,36) := 1000000000000000000::NUMERIC(72,36);
+
+    -- two pointers: $j is the last previous point at or before the target of $i
+    $j := 1;
+    for $i in 1..$current_count {
+        $target := $current_dates[$i] - ($time_interval)::INT8;
+
+        for $k in $j..$prev_count {
+            -- the interpreter doesn't short circuit, so the bounds are checked apart
+            if $k < $prev_count {
+                if $prev_dates[$k + 1] <= $target {
+                    $j := $k + 1;
+                } else {
+                    break;
+                }
+            } else {
+                break;
+            }
+        }
+
+        $has_previous BOOL := false;
+        if $prev_count > 0 {
+            if $prev_dates[$j] <= $target {
+                $has_previous := true;
+            }
+        }
+
+        if !$has_previous {
+            RETURN NEXT $current_dates[$i], NULL::NUMERIC(36,18), NULL::INT8, 'missing';
+        } else {
+            $current NUMERIC(72,36) := $current_values[$i]::NUMERIC(72,36);
+            $previous NUMERIC(72,36) := $prev_values[$j]::NUMERIC(72,36);
+
+            if $change_type = 'absolute' {
+                RETURN NEXT $current_dates[$i], ($current - $previous)::NUMERIC(36,18), $prev_dates[$j], 'ok';
+            } elseif $previous = $zero {
+                RETURN NEXT $current_dates[$i], NULL::NUMERIC(36,18), $prev_dates[$j], 'zero';
+            } elseif $change_type = 'percent' {
+                -- |change| < 10^18 is checked as |delta| < 10^18 * |previous| / 100, the division
+                -- by a tiny previous value overflowing NUMERIC(72,36) too
+                $delta NUMERIC(72,36) := $current - $previous;
+                $bound NUMERIC(72,36) := $max_value * $previous / $hundred;
+                if $delta < $zero {
+                    $delta := $zero - $delta;
+                }
+                if $bound < $zero {
+                    $bound := $zero - $bound;
+                }
+                if $delta >= $bound {
+                    RETURN NEXT $current_dates[$i], NULL::NUMERIC(36,18), $prev_dates[$j], 'overflow';
+                } else {
+                    RETURN NEXT $current_dates[$i], (($current - $previous) * $hundred / $previous)::NUMERIC(36,18), $prev_dates[$j], 'ok';
+                }
+            } else {
+                $ratio NUMERIC(72,36) := $current / $previous;
+                if $ratio <= $zero {
+                    RETURN NEXT $current_dates[$i], NULL::NUMERIC(36,18), $prev_dates[$j], 'undefined';
+                } elseif $change_type = 'log_return' {
+                    RETURN NEXT $current_dates[$i], internal_ln($ratio)::NUMERIC(36,18), $prev_dates[$j], 'ok';
+                } elseif $change_type = 'annualized' {
+                    $periods NUMERIC(72,36) := $seconds_per_year / ($time_interval)::NUMERIC(72,36);
+                    $exponent NUMERIC(72,36) := internal_ln($ratio) * $periods;
+                    if $exponent > $max_exponent {
+                        RETURN NEXT $current_dates[$i], NULL::NUMERIC(36,18), $prev_dates[$j], 'overflow';
+                    } elseif $exponent < $min_exponent {
+                        RETURN NEXT $current_dates[$i], (0::NUMERIC(72,36) - $hundred)::NUMERIC(36,18), $prev_dates[$j], 'ok';
+                    } else {
+                        $rate NUMERIC(72,36) := (internal_exp($exponent) - $one) * $hundred;
+                        RETURN NEXT $current_dates[$i], $rate::NUMERIC(36,18), $prev_dates[$j], 'ok';
+                    }
+                } else {
+                    -- stops growing past the limit, so the product stays within NUMERIC(72,36)
+                    $compounded NUMERIC(72,36) := $ratio;
+                    for $m in 2..12 {
+                        if $compounded <= $max_growth {
+                            $compounded := $compounded * $ratio;
+                        }
+                    }
+                    if $compounded > $max_growth {
+                        RETURN NEXT $current_dates[$i], NULL::NUMERIC(36,18), $prev_dates[$j], 'overflow';
+                    } else {
+                        RETURN NEXT $current_dates[$i], (($compounded - $one) * $hundred)::NUMERIC(36,18), $prev_dates[$j], 'ok';
+                    }
+                }
+            }
+        }
+    }
+};
@@ -0,0 +1,446 @@
+/*
+ * FILL MODES
+ *
+ * How a stream fills the gaps between its records, from its `fill_mode` metadata (string):
+ *   - locf (default): Last Observation Carried Forward, the value of the last record
+ *     before a time holds until the next record
+ *   - linear: the value at a time between two records is interpolated linearly.
+ *     After the last record, the value is carried forward.
+ *   - none: no filling, only the records within the range are returned
+ *
+ * The fill mode changes the point get_record returns at $from when there's no record at it:
+ * locf returns the last record before $from, linear the interpolated value at $from and none
+ * nothing. get_record and get_index follow the stream's fill mode, get_record_filled and
+ * get_index_filled take it as a parameter.
+ *
+ * Composed streams fill each primitive first, then aggregate them with the stream's
+ * aggregation_method, at every time a primitive or a weight changes. locf is the delta method
+ * of get_record_composed; linear and none are computed from get_filled_primitive_states,
+ * with the fill mode of the composed stream applied to all its primitives. With none, only the
+ * primitives that have a record at a time are aggregated at that time.
+ * The index of linear and none series is the series divided by its base value filled with the
+ * same mode (get_base_value_filled).
+ */
+
+/**
+ * get_fill_mode: Returns the fill mode of a stream. Defaults to locf when the metadata is not set.
+ */
+CREATE OR REPLACE ACTION get_fill_mode(
+    $data_provider TEXT,
+    $stream_id TEXT
+) PRIVATE view returns (fill_mode TEXT) {
+    $fill_mode TEXT := get_latest_metadata_string($data_provider, $stream_id, 'fill_mode');
+    return COALESCE($fill_mode, 'locf');
+};
+
+/**
+ * is_valid_fill_mode: Checks a value for the fill_mode metadata.
+ */
+CREATE OR REPLACE ACTION is_valid_fill_mode(
+    $fill_mode TEXT
+) PRIVATE view returns (is_valid BOOL) {
+    return $fill_mode = 'locf'
+        OR $fill_mode = 'linear'
+        OR $fill_mode = 'none';
+};
+
+/**
+ * interpolate_linear: Value at $t on the line between ($t0, $v0) and ($t1, $v1).
+ * Computed in NUMERIC(72,36): the product of the value delta and the time delta
+ * overflows NUMERIC(36,18) well within the range of the values.
+ */
+CREATE OR REPLACE ACTION interpolate_linear(
+    $t0 INT8,
+    $v0 NUMERIC(36,18),
+    $t1 INT8,
+    $v1 NUMERIC(36,18),
+    $t INT8
+) PRIVATE view returns (value NUMERIC(36,18)) {
+    if $t1 = $t0 {
+        return $v0;
+    }
+    $delta NUMERIC(72,36) := $v1::NUMERIC(72,36) - $v0::NUMERIC(72,36);
+    return ($v0::NUMERIC(72,36) + $delta * ($t - $t0)::NUMERIC(72,36) / ($t1 - $t0)::NUMERIC(72,36))::NUMERIC(36,18);
+};
+
+/**
+ * get_record_primitive_filled: get_record_primitive with the linear or none fill mode.
+ * Only the point before $from differs from get_record_primitive.
+ */
+CREATE OR REPLACE ACTION get_record_primitive_filled(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $fill_mode TEXT
+) PRIVATE view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $effective_from INT8 := COALESCE($from, 0);
+
+    for $row in get_record_primitive($data_provider, $stream_id, $from, $to, $frozen_at) {
+        if $row.event_time >= $effective_from {
+            RETURN NEXT $row.event_time, $row.value;
+        } elseif $fill_mode = 'linear' {
+            $next_time INT8;
+            $next_value NUMERIC(36,18);
+            for $next in get_first_record_primitive($data_provider, $stream_id, $effective_from, $frozen_at) {
+                $next_time := $next.event_time;
+                $next_value := $next.value;
+            }
+
+            if $next_time IS NULL {
+                RETURN NEXT $row.event_time, $row.value;
+            } else {
+                RETURN NEXT $effective_from, interpolate_linear($row.event_time, $row.value, $next_time, $next_value, $effective_from);
+            }
+        }
+        -- none drops the point before $from
+    }
+};
+
+/**
+ * get_filled_primitive_states: get_composed_primitive_states with the values of the
+ * primitives filled with the linear or none mode. The states before $from are evaluated at $from,
+ * and dropped with none. Primitives without a value at a time are omitted.
+ *
+ * The records of each primitive over the range are fetched once, with the first record after $to
+ * for linear, and the states are filled in a single pass since their times are ascending.
+ * Doesn't check permissions of the composed stream, callers are responsible for it.
+ */
+CREATE OR REPLACE ACTION get_filled_primitive_states(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $fill_mode TEXT
+) PRIVATE view returns table(
+    event_time INT8,
+    data_provider TEXT,
+    stream_id TEXT,
+    value NUMERIC(36,18),
+    weight NUMERIC(36,18)
+) {
+    $effective_from INT8 := COALESCE($from, 0);
+
+    -- the states, with the index of their primitive in $primitive_data_providers/$primitive_stream_ids
+    $times := []::INT8[];
+    $state_primitives := []::INT8[];
+    $weights := []::NUMERIC(36,18)[];
+    $primitive_data_providers := []::TEXT[];
+    $primitive_stream_ids := []::TEXT[];
+    for $row in get_composed_primitive_states($data_provider, $stream_id, $from, $to, $frozen_at, NULL) {
+        $time INT8 := $row.event_time;
+        if $time < $effective_from {
+            if $fill_mode = 'none' {
+                continue;
+            }
+            $time := $effective_from;
+        }
+
+        $primitive INT8 := 0;
+        for $p in 1..COALESCE(array_length($primitive_stream_ids), 0) {
+            if $primitive_data_providers[$p] = $row.data_provider AND $primitive_stream_ids[$p] = $row.stream_id {
+                $primitive := $p;
+                break;
+            }
+        }
+        if $primitive = 0 {
+            $primitive_data_providers := array_append($primitive_data_providers, $row.data_provider);
+            $primitive_stream_ids := array_append($primitive_stream_ids, $row.stream_id);
+            $primitive := array_length($primitive_stream_ids);
+        }
+
+        $times := array_append($times, $time);
+        $state_primitives := array_append($state_primitives, $primitive);
+        $weights := array_append($weights, $row.weight);
+    }
+
+    -- the records of primitive p are $record_times/$record_values[$primitive_starts[p]..$primitive_ends[p]],
+    -- ascending; $primitive_cursors[p] is the last one at or before the current state, start - 1 before the first
+    $record_times := []::INT8[];
+    $record_values := []::NUMERIC(36,18)[];
+    $primitive_starts := []::INT8[];
+    $primitive_ends := []::INT8[];
+    $primitive_cursors := []::INT8[];
+    for $p in 1..COALESCE(array_length($primitive_stream_ids), 0) {
+        $start INT8 := COALESCE(array_length($record_times), 0) + 1;
+        for $record in get_record_primitive($primitive_data_providers[$p], $primitive_stream_ids[$p], $effective_from, $to, $frozen_at) {
+            $record_times := array_append($record_times, $record.event_time);
+            $record_values := array_append($record_values, $record.value);
+        }
+        if $fill_mode = 'linear' AND $to IS NOT NULL {
+            for $record in get_first_record_primitive($primitive_data_providers[$p], $primitive_stream_ids[$p], $to + 1, $frozen_at) {
+                $record_times := array_append($record_times, $record.event_time);
+                $record_values := array_append($record_values, $record.value);
+            }
+        }
+        $primitive_starts := array_append($primitive_starts, $start);
+        $primitive_ends := array_append($primitive_ends, COALESCE(array_length($record_times), 0));
+        $primitive_cursors := array_append($primitive_cursors, $start - 1);
+    }
+
+    for $i in 1..COALESCE(array_length($times), 0) {
+        $t INT8 := $times[$i];
+        $p INT8 := $state_primitives[$i];
+        $start INT8 := $primitive_starts[$p];
+        $end INT8 := $primitive_ends[$p];
+        $cursor INT8 := $primitive_cursors[$p];
+        $next INT8 := $cursor + 1;
+        for $k in $next..$end {
+            if $record_times[$k] > $t {
+                break;
+            }
+            $cursor := $k;
+        }
+        $primitive_cursors[$p] := $cursor;
+
+        -- no value before the first record
+        if $cursor >= $start {
+            $value NUMERIC(36,18);
+            if $record_times[$cursor] = $t {
+                $value := $record_values[$cursor];
+            } elseif $fill_mode = 'linear' {
+                $value := $record_values[$cursor];
+                -- after the last record, the value is carried forward
+                if $cursor < $end {
+                    $value := interpolate_linear($record_times[$cursor], $record_values[$cursor], $record_times[$cursor + 1], $record_values[$cursor + 1], $t);
+                }
+            }
+            if $value IS NOT NULL {
+                RETURN NEXT $t, $primitive_data_providers[$p], $primitive_stream_ids[$p], $value, $weights[$i];
+            }
+        }
+    }
+};
+
+/**
+ * get_record_composed_filled: Composed series with the linear or none fill mode,
+ * filling each primitive before aggregating them (see the header of this file).
+ */
+CREATE OR REPLACE ACTION get_record_composed_filled(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $fill_mode TEXT
+) PRIVATE view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $data_provider := LOWER($data_provider);
+    $lower_caller TEXT := LOWER(@caller);
+
+    IF $from IS NOT NULL AND $to IS NOT NULL AND $from > $to {
+        ERROR(format('Invalid time range: from (%s) > to (%s)', $from, $to));
+    }
+    IF !is_allowed_to_read_all($data_provider, $stream_id, $lower_caller, $from, $to) {
+        ERROR('Not allowed to read stream');
+    }
+    IF !is_allowed_to_compose_all($data_provider, $stream_id, $from, $to) {
+        ERROR('Not allowed to compose stream');
+    }
+
+    $method TEXT := get_aggregation_method($data_provider, $stream_id);
+
+    $current_time INT8;
+    $values := []::NUMERIC(36,18)[];
+    $weights := []::NUMERIC(36,18)[];
+
+    -- rows arrive grouped by event_time; aggregate a group whenever the next one starts
+    for $row in get_filled_primitive_states($data_provider, $stream_id, $from, $to, $frozen_at, $fill_mode) {
+        if $current_time IS NOT NULL AND $row.event_time != $current_time {
+            RETURN NEXT $current_time, aggregate_filled_primitives($values, $weights, $method);
+            $values := []::NUMERIC(36,18)[];
+            $weights := []::NUMERIC(36,18)[];
+        }
+        $current_time := $row.event_time;
+        $values := array_append($values, $row.value);
+        $weights := array_append($weights, $row.weight);
+    }
+
+    if $current_time IS NOT NULL {
+        RETURN NEXT $current_time, aggregate_filled_primitives($values, $weights, $method);
+    }
+};
+
+/**
+ * aggregate_filled_primitives: Aggregates the filled values of the primitives at a time,
+ * a group of get_filled_primitive_states.
+ * The weighted methods sum in NUMERIC(72,36), the products of values and weights
+ * overflow NUMERIC(36,18) well within the range of the values.
+ */
+CREATE OR REPLACE ACTION aggregate_filled_primitives(
+    $values NUMERIC(36,18)[],
+    $weights NUMERIC(36,18)[],
+    $method TEXT
+) PRIVATE view returns (value NUMERIC(36,18)) {
+    $count INT := COALESCE(array_length($values), 0);
+
+    if $method = 'weighted_mean' OR $method = 'weighted_sum' {
+        $weighted_sum NUMERIC(72,36) := 0::NUMERIC(72,36);
+        $total_weight NUMERIC(72,36) := 0::NUMERIC(72,36);
+        for $i in 1..$count {
+            $weighted_sum := $weighted_sum + $values[$i]::NUMERIC(72,36) * $weights[$i]::NUMERIC(72,36);
+            $total_weight := $total_weight + $weights[$i]::NUMERIC(72,36);
+        }
+        if $method = 'weighted_sum' {
+            return $weighted_sum::NUMERIC(36,18);
+        }
+        return ($weighted_sum / $total_weight)::NUMERIC(36,18);
+    }
+
+    -- aggregate_state_values takes the values sorted ascending
+    $sorted_values := []::NUMERIC(36,18)[];
+    $sorted_weights := []::NUMERIC(36,18)[];
+    for $i in 1..$count {
+        $next_values := []::NUMERIC(36,18)[];
+        $next_weights := []::NUMERIC(36,18)[];
+        $inserted BOOL := false;
+        for $k in 1..COALESCE(array_length($sorted_values), 0) {
+            if !$inserted AND $values[$i] < $sorted_values[$k] {
+                $next_values := array_append($next_values, $values[$i]);
+                $next_weights := array_append($next_weights, $weights[$i]);
+                $inserted := true;
+            }
+            $next_values := array_append($next_values, $sorted_values[$k]);
+            $next_weights := array_append($next_weights, $sorted_weights[$k]);
+        }
+        if !$inserted {
+            $next_values := array_append($next_values, $values[$i]);
+            $next_weights := array_append($next_weights, $weights[$i]);
+        }
+        $sorted_values := $next_values;
+        $sorted_weights := $next_weights;
+    }
+    return aggregate_state_values($sorted_values, $sorted_weights, $method);
+};
+
+/**
+ * get_record_filled: get_record with an explicit fill mode ('locf', 'linear' or 'none').
+ * A NULL $fill_mode uses the stream's fill_mode metadata, like get_record.
+ * Without $from and $to, the latest record is returned whatever the fill mode.
+ */
+CREATE OR REPLACE ACTION get_record_filled(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $fill_mode TEXT
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+    if $fill_mode IS NULL {
+        $fill_mode := get_fill_mode($data_provider, $stream_id);
+    }
+    if !is_valid_fill_mode($fill_mode) {
+        ERROR(format('invalid fill mode: %s (expected locf, linear or none)', $fill_mode));
+    }
+
+    $is_primitive BOOL := is_primitive_stream($data_provider, $stream_id);
+    if $fill_mode = 'locf' OR ($from IS NULL AND $to IS NULL) {
+        if $is_primitive {
+            for $row in get_record_primitive($data_provider, $stream_id, $from, $to, $frozen_at) {
+                RETURN NEXT $row.event_time, $row.value;
+            }
+        } else {
+            for $row in get_record_composed($data_provider, $stream_id, $from, $to, $frozen_at) {
+                RETURN NEXT $row.event_time, $row.value;
+            }
+        }
+        RETURN;
+    }
+
+    if $is_primitive {
+        for $row in get_record_primitive_filled($data_provider, $stream_id, $from, $to, $frozen_at, $fill_mode) {
+            RETURN NEXT $row.event_time, $row.value;
+        }
+    } else {
+        for $row in get_record_composed_filled($data_provider, $stream_id, $from, $to, $frozen_at, $fill_mode) {
+            RETURN NEXT $row.event_time, $row.value;
+        }
+    }
+};
+
+/**
+ * get_base_value_filled: get_base_value with a fill mode, the value of the stream at the base
+ * time as get_record_filled returns it. With no base time, the default_base_time metadata is
+ * used, then the first record. When the mode gives no value at the base time (no record before
+ * it, or no record at it with none), the closest record is used like get_base_value.
+ */
+CREATE OR REPLACE ACTION get_base_value_filled(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $base_time INT8,
+    $frozen_at INT8,
+    $fill_mode TEXT
+) PRIVATE view returns (value NUMERIC(36,18)) {
+    $effective_base_time INT8 := $base_time;
+    if $effective_base_time IS NULL {
+        $effective_base_time := get_latest_metadata_int($data_provider, $stream_id, 'default_base_time');
+    }
+    if $effective_base_time IS NULL {
+        return get_base_value($data_provider, $stream_id, NULL, $frozen_at);
+    }
+
+    for $row in get_record_filled($data_provider, $stream_id, $effective_base_time, $effective_base_time, $frozen_at, $fill_mode) {
+        return $row.value;
+    }
+    return get_base_value($data_provider, $stream_id, $effective_base_time, $frozen_at);
+};
+
+/**
+ * get_index_filled: get_index with an explicit fill mode ('locf', 'linear' or 'none').
+ * A NULL $fill_mode uses the stream's fill_mode metadata, like get_index.
+ */
+CREATE OR REPLACE ACTION get_index_filled(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8,
+    $base_time INT8,
+    $fill_mode TEXT
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $data_provider := LOWER($data_provider);
+    $stream_id := resolve_stream_alias($data_provider, $stream_id);
+    if $fill_mode IS NULL {
+        $fill_mode := get_fill_mode($data_provider, $stream_id);
+    }
+    if !is_valid_fill_mode($fill_mode) {
+        ERROR(format('invalid fill mode: %s (expected locf, linear or none)', $fill_mode));
+    }
+
+    if $fill_mode = 'locf' OR ($from IS NULL AND $to IS NULL) {
+        if is_primitive_stream($data_provider, $stream_id) {
+            for $row in get_index_primitive($data_provider, $stream_id, $from, $to, $frozen_at, $base_time) {
+                RETURN NEXT $row.event_time, $row.value;
+            }
+        } else {
+            for $row in get_index_composed($data_provider, $stream_id, $from, $to, $frozen_at, $base_time) {
+                RETURN NEXT $row.event_time, $row.value;
+            }
+        }
+        RETURN;
+    }
+
+    $base_value NUMERIC(36,18) := get_base_value_filled($data_provider, $stream_id, $base_time, $frozen_at, $fill_mode);
+    if $base_value = 0::NUMERIC(36,18) {
+        ERROR('base value is 0');
+    }
+
+    for $row in get_record_filled($data_provider, $stream_id, $from, $to, $frozen_at, $fill_mode) {
+        RETURN NEXT $row.event_time, ($row.value * 100::NUMERIC(36,18)) / $base_value;
+    }
+};
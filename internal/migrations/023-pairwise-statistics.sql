@@ -0,0 +1,198 @@
+/*
+ * PAIRWISE STATISTICS
+ *
+ * Relates a stream A to a stream B over a range. Both series are read with get_record, so they
+ * follow the same permissions, data version and fill mode as a query of each stream, then
+ * aligned like the children of a composed stream: at every event time of either series, each
+ * stream holds its last value (LOCF). Times before both streams have a value are skipped, and
+ * like get_record only the latest aligned point at or before $from is returned before the range.
+ *
+ * get_pairwise_series returns the aligned values with their spread (a - b) and ratio (a / b).
+ * get_pairwise_statistics summarizes the same points:
+ *   - correlation: Pearson correlation of the values of A and B
+ *   - beta: sensitivity of A to B, cov(a, b) / var(b)
+ */
+
+/**
+ * get_pairwise_series: Aligned values of streams A and B between $from and $to,
+ * see the header of this file. ratio is NULL when the value of B is zero.
+ */
+CREATE OR REPLACE ACTION get_pairwise_series(
+    $data_provider_a TEXT,
+    $stream_id_a TEXT,
+    $data_provider_b TEXT,
+    $stream_id_b TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8
+) PUBLIC view returns table(
+    event_time INT8,
+    value_a NUMERIC(36,18),
+    value_b NUMERIC(36,18),
+    spread NUMERIC(36,18),
+    ratio NUMERIC(36,18)
+) {
+    $data_provider_a := LOWER($data_provider_a);
+    $stream_id_a := resolve_stream_alias($data_provider_a, $stream_id_a);
+    $data_provider_b := LOWER($data_provider_b);
+    $stream_id_b := resolve_stream_alias($data_provider_b, $stream_id_b);
+
+    $times_a := []::INT8[];
+    $values_a := []::NUMERIC(36,18)[];
+    for $row in get_record($data_provider_a, $stream_id_a, $from, $to, $frozen_at) {
+        $times_a := array_append($times_a, $row.event_time);
+        $values_a := array_append($values_a, $row.value);
+    }
+
+    $times_b := []::INT8[];
+    $values_b := []::NUMERIC(36,18)[];
+    for $row in get_record($data_provider_b, $stream_id_b, $from, $to, $frozen_at) {
+        $times_b := array_append($times_b, $row.event_time);
+        $values_b := array_append($values_b, $row.value);
+    }
+
+    $count_a INT := COALESCE(array_length($times_a), 0);
+    $count_b INT := COALESCE(array_length($times_b), 0);
+    $effective_from INT8 := COALESCE($from, 0);
+
+    $i := 1;
+    $j := 1;
+    $current_a NUMERIC(36,18);
+    $current_b NUMERIC(36,18);
+    -- latest aligned point before $from, returned before the first point of the range
+    $anchor_time INT8;
+    $anchor_a NUMERIC(36,18);
+    $anchor_b NUMERIC(36,18);
+    $t INT8;
+
+    -- merge the two ascending series, each step consumes at least one row
+    for $step in 1..($count_a + $count_b) {
+        $t := NULL::INT8;
+        -- the interpreter doesn't short circuit, so the bounds are checked apart
+        if $i <= $count_a {
+            $t := $times_a[$i];
+        }
+        if $j <= $count_b {
+            if $t IS NULL OR $times_b[$j] < $t {
+                $t := $times_b[$j];
+            }
+        }
+        if $t IS NULL {
+            break;
+        }
+
+        if $i <= $count_a {
+            if $times_a[$i] = $t {
+                $current_a := $values_a[$i];
+                $i := $i + 1;
+            }
+        }
+        if $j <= $count_b {
+            if $times_b[$j] = $t {
+                $current_b := $values_b[$j];
+                $j := $j + 1;
+            }
+        }
+
+        if $current_a IS NOT NULL AND $current_b IS NOT NULL {
+            if $t < $effective_from {
+                $anchor_time := $t;
+                $anchor_a := $current_a;
+                $anchor_b := $current_b;
+            } else {
+                if $anchor_time IS NOT NULL {
+                    RETURN NEXT $anchor_time, $anchor_a, $anchor_b, $anchor_a - $anchor_b, pairwise_ratio($anchor_a, $anchor_b);
+                    $anchor_time := NULL::INT8;
+                }
+                RETURN NEXT $t, $current_a, $current_b, $current_a - $current_b, pairwise_ratio($current_a, $current_b);
+            }
+        }
+    }
+
+    -- no aligned point within the range
+    if $anchor_time IS NOT NULL {
+        RETURN NEXT $anchor_time, $anchor_a, $anchor_b, $anchor_a - $anchor_b, pairwise_ratio($anchor_a, $anchor_b);
+    }
+};
+
+/**
+ * pairwise_ratio: $a / $b, or NULL when $b is zero.
+ */
+CREATE OR REPLACE ACTION pairwise_ratio(
+    $a NUMERIC(36,18),
+    $b NUMERIC(36,18)
+) PRIVATE view returns (ratio NUMERIC(36,18)) {
+    if $b = 0::NUMERIC(36,18) {
+        return NULL::NUMERIC(36,18);
+    }
+    return $a / $b;
+};
+
+/**
+ * get_pairwise_statistics: Correlation and beta of stream A against stream B over the points
+ * of get_pairwise_series. correlation is NULL with fewer than two points or when either series
+ * is constant, beta is NULL with fewer than two points or when B is constant.
+ */
+CREATE OR REPLACE ACTION get_pairwise_statistics(
+    $data_provider_a TEXT,
+    $stream_id_a TEXT,
+    $data_provider_b TEXT,
+    $stream_id_b TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at INT8
+) PUBLIC view returns table(
+    point_count INT,
+    correlation NUMERIC(36,18),
+    beta NUMERIC(36,18)
+) {
+    $data_provider_a := LOWER($data_provider_a);
+    $stream_id_a := resolve_stream_alias($data_provider_a, $stream_id_a);
+    $data_provider_b := LOWER($data_provider_b);
+    $stream_id_b := resolve_stream_alias($data_provider_b, $stream_id_b);
+
+    -- sums and products of deviations in NUMERIC(72,36), squares of NUMERIC(36,18) values overflow it
+    $values_a := []::NUMERIC(36,18)[];
+    $values_b := []::NUMERIC(36,18)[];
+    $sum_a NUMERIC(72,36) := 0::NUMERIC(72,36);
+    $sum_b NUMERIC(72,36) := 0::NUMERIC(72,36);
+    for $row in get_pairwise_series($data_provider_a, $stream_id_a, $data_provider_b, $stream_id_b, $from, $to, $frozen_at) {
+        $values_a := array_append($values_a, $row.value_a);
+        $values_b := array_append($values_b, $row.value_b);
+        $sum_a := $sum_a + $row.value_a::NUMERIC(72,36);
+        $sum_b := $sum_b + $row.value_b::NUMERIC(72,36);
+    }
+
+    $count INT := COALESCE(array_length($values_a), 0);
+    if $count < 2 {
+        RETURN NEXT $count, NULL::NUMERIC(36,18), NULL::NUMERIC(36,18);
+        RETURN;
+    }
+
+    -- deviations from the means, rather than sums of squares, to keep the precision
+    $mean_a NUMERIC(72,36) := $sum_a / $count::NUMERIC(72,36);
+    $mean_b NUMERIC(72,36) := $sum_b / $count::NUMERIC(72,36);
+    $sxx NUMERIC(72,36) := 0::NUMERIC(72,36);
+    $syy NUMERIC(72,36) := 0::NUMERIC(72,36);
+    $sxy NUMERIC(72,36) := 0::NUMERIC(72,36);
+    for $k in 1..$count {
+        $dev_a NUMERIC(72,36) := $values_a[$k]::NUMERIC(72,36) - $mean_a;
+        $dev_b NUMERIC(72,36) := $values_b[$k]::NUMERIC(72,36) - $mean_b;
+        $sxx := $sxx + $dev_a * $dev_a;
+        $syy := $syy + $dev_b * $dev_b;
+        $sxy := $sxy + $dev_a * $dev_b;
+    }
+
+    -- the 1 / n of the covariance and variances cancels out in both ratios
+    $correlation NUMERIC(36,18);
+    $beta NUMERIC(36,18);
+    if $syy != 0::NUMERIC(72,36) {
+        $beta := ($sxy / $syy)::NUMERIC(36,18);
+        if $sxx != 0::NUMERIC(72,36) {
+            -- the square roots apart, their product stays within the range of sxx and syy
+            $correlation := ($sxy / (numeric_sqrt($sxx) * numeric_sqrt($syy)))::NUMERIC(36,18);
+        }
+    }
+
+    RETURN NEXT $count, $correlation, $beta;
+};
@@ -0,0 +1,154 @@
+/*
+ * BLOCK TIMESTAMPS
+ *
+ * frozen_at is a block height: records created after it are ignored. To ask for the data as
+ * published at a date, the date is mapped to the height of the chain at that time.
+ *
+ * record_block_timestamp (001-common-actions.sql) maps each height that wrote records, the only
+ * data frozen_at filters, to its block timestamp: insert_record, insert_records_batch and
+ * retract_record call it. Nodes don't map the other blocks, and embargoed records are released
+ * at such a block (visible_from) without a write. A time between two mapped heights, or between
+ * the last mapped height and the current block, is therefore resolved assuming a steady block
+ * rate between them: the writes of that interval are excluded whatever the estimate, only the
+ * embargo releases in it depend on it.
+ *
+ * Only the heights written after this migration are mapped. The chain doesn't keep the
+ * timestamps of past blocks, so the created_at heights of existing records can't be backfilled:
+ * a time before the first height written after the migration can't be resolved, and
+ * get_record_at_frozen_time and get_index_at_frozen_time reject it.
+ */
+
+/**
+ * get_height_at_time: Block height at $timestamp (unix seconds): the last mapped height at or
+ * before it, moved towards the next mapped height (or the current block) at a steady block rate.
+ * Never reaches a height mapped after $timestamp. Returns NULL when no height is mapped before it.
+ */
+CREATE OR REPLACE ACTION get_height_at_time(
+    $timestamp INT8
+) PUBLIC view returns (height INT8) {
+    if $timestamp IS NULL {
+        ERROR('timestamp is required');
+    }
+
+    $last_height INT8;
+    $last_time INT8;
+    for $row in SELECT height, block_timestamp
+        FROM block_timestamps
+        WHERE block_timestamp <= $timestamp
+        ORDER BY block_timestamp DESC, height DESC
+        LIMIT 1 {
+        $last_height := $row.height;
+        $last_time := $row.block_timestamp;
+    }
+    if $last_height IS NULL {
+        return NULL::INT8;
+    }
+
+    $next_height INT8;
+    $next_time INT8;
+    for $row in SELECT height, block_timestamp
+        FROM block_timestamps
+        WHERE block_timestamp > $timestamp
+        ORDER BY block_timestamp ASC, height ASC
+        LIMIT 1 {
+        $next_height := $row.height;
+        $next_time := $row.block_timestamp;
+    }
+
+    -- after the last mapped height, the current block bounds the interval
+    if $next_height IS NULL {
+        if @block_timestamp <= 0 OR @height <= $last_height {
+            return $last_height;
+        }
+        if @block_timestamp <= $timestamp {
+            return @height;
+        }
+        $next_height := @height;
+        $next_time := @block_timestamp;
+    }
+
+    -- $last_time <= $timestamp < $next_time, so the estimate stays below $next_height
+    return $last_height + ($timestamp - $last_time) * ($next_height - $last_height) / ($next_time - $last_time);
+};
+
+/**
+ * get_time_at_height: Timestamp (unix seconds) of the last mapped height at or before $height,
+ * the last write the data as of $height includes. It isn't the time of $height itself, which
+ * nodes don't map unless it wrote records. Returns NULL when there's none, including heights
+ * before the migration.
+ */
+CREATE OR REPLACE ACTION get_time_at_height(
+    $height INT8
+) PUBLIC view returns (block_timestamp INT8) {
+    if $height IS NULL {
+        ERROR('height is required');
+    }
+
+    for $row in SELECT block_timestamp
+        FROM block_timestamps
+        WHERE height <= $height
+        ORDER BY height DESC
+        LIMIT 1 {
+        return $row.block_timestamp;
+    }
+    return NULL::INT8;
+};
+
+/**
+ * frozen_at_from_time: frozen_at height of the data published at $frozen_at_time.
+ * A NULL $frozen_at_time gives a NULL frozen_at, the latest data.
+ */
+CREATE OR REPLACE ACTION frozen_at_from_time(
+    $frozen_at_time INT8
+) PRIVATE view returns (frozen_at INT8) {
+    if $frozen_at_time IS NULL {
+        return NULL::INT8;
+    }
+
+    $frozen_at INT8 := get_height_at_time($frozen_at_time);
+    if $frozen_at IS NULL {
+        ERROR(format('no block height recorded at or before time %s (heights are mapped from the block timestamps migration on)', $frozen_at_time));
+    }
+    return $frozen_at;
+};
+
+/**
+ * get_record_at_frozen_time: get_record with the data as published at $frozen_at_time
+ * (unix seconds) instead of a frozen_at height.
+ */
+CREATE OR REPLACE ACTION get_record_at_frozen_time(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at_time INT8
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $frozen_at INT8 := frozen_at_from_time($frozen_at_time);
+    for $row in get_record($data_provider, $stream_id, $from, $to, $frozen_at) {
+        RETURN NEXT $row.event_time, $row.value;
+    }
+};
+
+/**
+ * get_index_at_frozen_time: get_index with the data as published at $frozen_at_time
+ * (unix seconds) instead of a frozen_at height.
+ */
+CREATE OR REPLACE ACTION get_index_at_frozen_time(
+    $data_provider TEXT,
+    $stream_id TEXT,
+    $from INT8,
+    $to INT8,
+    $frozen_at_time INT8,
+    $base_time INT8
+) PUBLIC view returns table(
+    event_time INT8,
+    value NUMERIC(36,18)
+) {
+    $frozen_at INT8 := frozen_at_from_time($frozen_at_time);
+    for $row in get_index($data_provider, $stream_id, $from, $to, $frozen_at, $base_time) {
+        RETURN NEXT $row.event_time, $row.value;
+    }
+};
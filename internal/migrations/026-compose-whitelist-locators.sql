@@ -0,0 +1,13 @@
+/*
+    COMPOSE WHITELIST LOCATORS
+
+    allow_compose_stream rows whitelist a parent stream by its full locator: the stream id in
+    value_ref and the data provider in value_s (see grant_compose_permission). Rows inserted
+    before that only hold the stream id. They were written while composition was limited to
+    streams of the same owner, so the parent belongs to the data provider of the row, which
+    is filled in here. Compositions whitelisted that way keep working.
+ */
+
+UPDATE metadata SET value_s = data_provider
+WHERE metadata_key = 'allow_compose_stream'
+AND value_s IS NULL;
@@ -1,53 +1,119 @@
 package migrations
 
 import (
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+
+	"github.com/kwilteam/kwil-db/node/engine/parse"
+	"github.com/pkg/errors"
 )
 
 //go:embed *.sql test-migrations/*.sql
 var seedFiles embed.FS
 
+// GetSeedScriptPaths returns the absolute paths of the test migration set, which
+// includes the production migrations followed by the test-only actions.
+// It is what the kwilTesting harness seeds schema tests with.
 func GetSeedScriptPaths() []string {
-	var seedsFiles []string
+	return GetSeedScriptPathsFor(SetTest)
+}
 
+// GetSeedScriptPathsFor returns the absolute paths of the files in the given set, in
+// the order they must be applied. It panics if the set can't be resolved, as it's
+// meant to be used while setting up tests.
+func GetSeedScriptPathsFor(name SetName) []string {
 	// Get the absolute path to the directory where this file (migration.go) is located
 	_, filename, _, _ := runtime.Caller(0)
 	dir := filepath.Dir(filename)
 
-	// Read embedded seed files from root directory
-	entries, err := seedFiles.ReadDir(".")
+	migrations, err := GetMigrationSet(name)
 	if err != nil {
 		panic(err)
 	}
 
-	// Process root directory SQL files
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
-			// Create absolute path by joining the directory path with the file name
-			seedsFiles = append(seedsFiles, filepath.Join(dir, entry.Name()))
-		}
+	seedsFiles := make([]string, 0, len(migrations))
+	for _, migration := range migrations {
+		seedsFiles = append(seedsFiles, filepath.Join(dir, filepath.FromSlash(migration.Path)))
 	}
 
-	// Read embedded seed files from test-migrations directory
-	testSeedsEntries, err := seedFiles.ReadDir("test-migrations")
+	return seedsFiles
+}
+
+// Migration is a single migration file embedded in the binary.
+type Migration struct {
+	// Name is the file name, e.g. "001-common-actions.sql". Migrations are applied in name order.
+	Name string
+	// Path is the slash separated path of the file relative to this package.
+	Path string
+	// Set is the migration set that owns the file.
+	Set SetName
+	// Content is the raw SQL of the file.
+	Content string
+	// Checksum is the hex encoded sha256 of Content, used to detect files that changed after being applied.
+	Checksum string
+}
+
+// GetMigrations returns the production migrations embedded in this package, ordered by name.
+// Test-only migrations are never included.
+func GetMigrations() ([]Migration, error) {
+	return GetMigrationSet(SetProduction)
+}
+
+// readMigrationDir reads the sql files directly under dir, ordered by name.
+func readMigrationDir(dir string, set SetName) ([]Migration, error) {
+	entries, err := seedFiles.ReadDir(dir)
 	if err != nil {
-		panic(err)
+		return nil, errors.Wrapf(err, "failed to read embedded migrations in %s", dir)
 	}
 
-	// Process test-migrations SQL files
-	for _, entry := range testSeedsEntries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
-			// Create absolute path by joining the directory path with the test-migrations subdirectory and file name
-			seedsFiles = append(seedsFiles, filepath.Join(dir, "test-migrations", entry.Name()))
+	var migrations []Migration
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		filePath := path.Join(dir, entry.Name())
+		content, err := seedFiles.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read embedded migration %s", filePath)
 		}
-	}
 
-	if len(seedsFiles) == 0 {
-		panic("no seeds files found in embedded directory")
+		sum := sha256.Sum256(content)
+		migrations = append(migrations, Migration{
+			Name:     entry.Name(),
+			Path:     filePath,
+			Set:      set,
+			Content:  string(content),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
 	}
 
-	return seedsFiles
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+
+	return migrations, nil
+}
+
+// Replaceable reports whether the file only holds CREATE OR REPLACE ACTION statements,
+// so applying it again after a change is safe. Files that create or alter tables are not,
+// nor is content that doesn't parse.
+func (m Migration) Replaceable() bool {
+	stmts, err := parse.Parse(m.Content)
+	if err != nil || len(stmts) == 0 {
+		return false
+	}
+	for _, stmt := range stmts {
+		action, ok := stmt.(*parse.CreateActionStatement)
+		if !ok || !action.OrReplace {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,273 @@
+// Package runner applies the embedded SQL migrations to a node, keeping track of
+// what was applied in a schema version table so every file runs exactly once.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/trufnetwork/node/internal/migrations"
+)
+
+// SchemaTable is the table that records applied migrations.
+const SchemaTable = "schema_migrations"
+
+const createSchemaTableSQL = `CREATE TABLE IF NOT EXISTS ` + SchemaTable + ` (
+    name TEXT PRIMARY KEY,
+    checksum TEXT NOT NULL,
+    applied_at INT8 NOT NULL
+);`
+
+// Client is the minimal node API needed by the runner.
+type Client interface {
+	// Execute runs the statements in a single transaction and waits for it to be committed.
+	Execute(ctx context.Context, stmt string) error
+	// Query runs a read-only statement and returns its rows.
+	Query(ctx context.Context, stmt string) ([][]any, error)
+}
+
+// State describes a migration relative to what the node has recorded.
+type State string
+
+const (
+	StatePending State = "pending"
+	StateApplied State = "applied"
+	// StateChanged is an applied migration whose file changed since. Up applies it again
+	// when it's replaceable (only CREATE OR REPLACE ACTION statements) and fails otherwise.
+	StateChanged State = "changed"
+)
+
+// MigrationStatus is the state of a single local migration.
+type MigrationStatus struct {
+	Name     string
+	Checksum string
+	State    State
+	// AppliedAt is the block height the migration was last applied at, 0 if pending.
+	AppliedAt int64
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt int64
+}
+
+type Runner struct {
+	client     Client
+	migrations []migrations.Migration
+}
+
+// New creates a runner for the given migrations, which must be ordered by name.
+func New(client Client, migrations []migrations.Migration) *Runner {
+	return &Runner{client: client, migrations: migrations}
+}
+
+// Status compares the local migrations with the ones recorded on the node.
+func (r *Runner) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		status := MigrationStatus{Name: m.Name, Checksum: m.Checksum, State: StatePending}
+		if a, ok := applied[m.Name]; ok {
+			status.AppliedAt = a.appliedAt
+			status.State = StateApplied
+			if a.checksum != m.Checksum {
+				status.State = StateChanged
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that still need to be applied, in order: the new ones,
+// and the replaceable ones that changed after being applied, which are applied again.
+// It fails if a changed migration is not replaceable, if the node recorded a migration
+// that is unknown locally, or if a new migration sorts before an applied one.
+func (r *Runner) Pending(ctx context.Context) ([]migrations.Migration, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(r.migrations))
+	var pending []migrations.Migration
+	firstNew := ""
+	for _, m := range r.migrations {
+		known[m.Name] = true
+
+		a, ok := applied[m.Name]
+		if !ok {
+			if firstNew == "" {
+				firstNew = m.Name
+			}
+			pending = append(pending, m)
+			continue
+		}
+		if firstNew != "" {
+			return nil, errors.Errorf("migration %s is pending but %s was already applied after it", firstNew, m.Name)
+		}
+		if a.checksum != m.Checksum {
+			if !m.Replaceable() {
+				return nil, errors.Errorf("migration %s was changed after being applied at height %d (applied checksum %s, local checksum %s): "+
+					"only files holding nothing but CREATE OR REPLACE ACTION statements can change, schema changes go in a new migration",
+					m.Name, a.appliedAt, a.checksum, m.Checksum)
+			}
+			pending = append(pending, m)
+		}
+	}
+
+	for name := range applied {
+		if !known[name] {
+			return nil, errors.Errorf("migration %s is recorded on the node but does not exist locally", name)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies every pending migration in order. Each migration is executed in its
+// own transaction together with its schema table entry, so a failing file is
+// never recorded as applied. With dryRun set nothing is executed and the
+// migrations that would run are returned.
+func (r *Runner) Up(ctx context.Context, dryRun bool) ([]migrations.Migration, error) {
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return pending, nil
+	}
+
+	for i, m := range pending {
+		if err := r.client.Execute(ctx, ApplyStatement(m)); err != nil {
+			return pending[:i], errors.Wrapf(err, "failed to apply migration %s", m.Name)
+		}
+	}
+
+	return pending, nil
+}
+
+// Baseline records the migrations up to and including through as applied, without
+// executing them, on a node that has none recorded. It adopts nodes set up by the former
+// scripts/migrate.sh, which ran every file without recording it: baselining
+// 000-initial-data.sql, the only file it ran that can't run twice, lets Up apply the rest,
+// replacing the actions. With dryRun set nothing is recorded and the migrations that would
+// be are returned.
+func (r *Runner) Baseline(ctx context.Context, through string, dryRun bool) ([]migrations.Migration, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) > 0 {
+		return nil, errors.Errorf("the node already records %d migrations, baseline only adopts nodes without any", len(applied))
+	}
+
+	last := -1
+	for i, m := range r.migrations {
+		if m.Name == through {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return nil, errors.Errorf("migration %s does not exist locally", through)
+	}
+
+	baseline := r.migrations[:last+1]
+	if dryRun {
+		return baseline, nil
+	}
+
+	for i, m := range baseline {
+		if err := r.client.Execute(ctx, BaselineStatement(m)); err != nil {
+			return baseline[:i], errors.Wrapf(err, "failed to record migration %s", m.Name)
+		}
+	}
+
+	return baseline, nil
+}
+
+// ApplyStatement builds the transaction body that applies m and records it,
+// replacing the entry of a migration applied again.
+func ApplyStatement(m migrations.Migration) string {
+	content := strings.TrimSpace(m.Content)
+	if !strings.HasSuffix(content, ";") {
+		content += ";"
+	}
+
+	return fmt.Sprintf("%s\n\n%s\n\n%s", createSchemaTableSQL, content, recordStatement(m))
+}
+
+// BaselineStatement builds the transaction body that records m as applied without applying it.
+func BaselineStatement(m migrations.Migration) string {
+	return fmt.Sprintf("%s\n\n%s", createSchemaTableSQL, recordStatement(m))
+}
+
+// recordStatement upserts the schema table entry of m.
+func recordStatement(m migrations.Migration) string {
+	return fmt.Sprintf("INSERT INTO %s (name, checksum, applied_at) VALUES ('%s', '%s', @height) "+
+		"ON CONFLICT (name) DO UPDATE SET checksum = '%s', applied_at = @height;",
+		SchemaTable, quote(m.Name), quote(m.Checksum), quote(m.Checksum))
+}
+
+// applied returns the migrations recorded on the node, keyed by name.
+func (r *Runner) applied(ctx context.Context) (map[string]appliedMigration, error) {
+	rows, err := r.client.Query(ctx, fmt.Sprintf("SELECT name FROM info.tables WHERE name = '%s' AND namespace = 'main';", SchemaTable))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check for schema table")
+	}
+	if len(rows) == 0 {
+		return map[string]appliedMigration{}, nil
+	}
+
+	rows, err = r.client.Query(ctx, fmt.Sprintf("SELECT name, checksum, applied_at FROM %s ORDER BY name;", SchemaTable))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read applied migrations")
+	}
+
+	applied := make(map[string]appliedMigration, len(rows))
+	for _, row := range rows {
+		if len(row) != 3 {
+			return nil, errors.Errorf("unexpected row in %s: %v", SchemaTable, row)
+		}
+		appliedAt, err := toInt64(row[2])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid applied_at for migration %v", row[0])
+		}
+		applied[fmt.Sprint(row[0])] = appliedMigration{
+			checksum:  fmt.Sprint(row[1]),
+			appliedAt: appliedAt,
+		}
+	}
+
+	return applied, nil
+}
+
+func quote(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+func toInt64(v any) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case fmt.Stringer:
+		return strconv.ParseInt(v.String(), 10, 64)
+	default:
+		return 0, errors.Errorf("unsupported type %T", v)
+	}
+}
@@ -0,0 +1,223 @@
+package runner
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/trufnetwork/node/internal/migrations"
+)
+
+// fakeClient keeps the schema table in memory and records executed statements.
+type fakeClient struct {
+	applied  [][]any
+	executed []string
+	failOn   string
+}
+
+func (f *fakeClient) Execute(_ context.Context, stmt string) error {
+	if f.failOn != "" && strings.Contains(stmt, f.failOn) {
+		return context.DeadlineExceeded
+	}
+	f.executed = append(f.executed, stmt)
+
+	// the last line holds the schema table insert
+	lines := strings.Split(stmt, "\n")
+	values := lines[len(lines)-1]
+	values = values[strings.Index(values, "VALUES (")+len("VALUES ("):]
+	parts := strings.Split(values, ", ")
+	row := []any{
+		strings.Trim(parts[0], "'"),
+		strings.Trim(parts[1], "'"),
+		int64(len(f.executed)),
+	}
+	for i, applied := range f.applied {
+		if applied[0] == row[0] {
+			f.applied[i] = row
+			return nil
+		}
+	}
+	f.applied = append(f.applied, row)
+	return nil
+}
+
+func (f *fakeClient) Query(_ context.Context, stmt string) ([][]any, error) {
+	if strings.Contains(stmt, "info.tables") {
+		if len(f.applied) == 0 {
+			return nil, nil
+		}
+		return [][]any{{SchemaTable}}, nil
+	}
+	return f.applied, nil
+}
+
+func testMigrations() []migrations.Migration {
+	return []migrations.Migration{
+		{Name: "000-a.sql", Content: "CREATE TABLE a (id INT PRIMARY KEY);", Checksum: "aa"},
+		{Name: "001-b.sql", Content: "CREATE ACTION b() PUBLIC {}", Checksum: "bb"},
+	}
+}
+
+func TestUpAppliesPendingOnce(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	r := New(client, testMigrations())
+
+	applied, err := r.Up(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || len(client.executed) != 2 {
+		t.Fatalf("expected 2 migrations applied, got %d (executed %d)", len(applied), len(client.executed))
+	}
+
+	applied, err = r.Up(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 || len(client.executed) != 2 {
+		t.Fatalf("expected no migrations on second run, got %d", len(applied))
+	}
+
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.State != StateApplied {
+			t.Fatalf("expected %s to be applied, got %s", s.Name, s.State)
+		}
+	}
+}
+
+func TestDryRunExecutesNothing(t *testing.T) {
+	client := &fakeClient{}
+	pending, err := New(client, testMigrations()).Up(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || len(client.executed) != 0 {
+		t.Fatalf("expected 2 pending and nothing executed, got %d pending, %d executed", len(pending), len(client.executed))
+	}
+}
+
+func TestRefusesChangedMigration(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	if _, err := New(client, testMigrations()).Up(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := testMigrations()
+	changed[0].Checksum = "changed"
+	r := New(client, changed)
+
+	if _, err := r.Up(ctx, false); err == nil || !strings.Contains(err.Error(), "was changed after being applied") {
+		t.Fatalf("expected changed migration error, got %v", err)
+	}
+
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].State != StateChanged {
+		t.Fatalf("expected %s to be changed, got %s", statuses[0].Name, statuses[0].State)
+	}
+}
+
+func TestReappliesChangedReplaceableMigration(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	if _, err := New(client, testMigrations()).Up(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := testMigrations()
+	changed[1].Content = "CREATE OR REPLACE ACTION b() PUBLIC { }"
+	changed[1].Checksum = "changed"
+	r := New(client, changed)
+
+	applied, err := r.Up(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Name != "001-b.sql" {
+		t.Fatalf("expected 001-b.sql to be applied again, got %v", applied)
+	}
+
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[1].State != StateApplied || statuses[1].AppliedAt != 3 {
+		t.Fatalf("expected %s to be recorded again, got %s at %d", statuses[1].Name, statuses[1].State, statuses[1].AppliedAt)
+	}
+}
+
+func TestRefusesOutOfOrderMigration(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	if _, err := New(client, testMigrations()[1:]).Up(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(client, testMigrations()).Up(ctx, false); err == nil {
+		t.Fatal("expected error when a pending migration sorts before an applied one")
+	}
+}
+
+func TestFailedMigrationIsNotRecorded(t *testing.T) {
+	client := &fakeClient{failOn: "CREATE ACTION b"}
+	applied, err := New(client, testMigrations()).Up(context.Background(), false)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(applied) != 1 || len(client.applied) != 1 {
+		t.Fatalf("expected only the first migration recorded, got %d", len(client.applied))
+	}
+}
+
+func TestApplyStatementTerminatesContent(t *testing.T) {
+	stmt := ApplyStatement(testMigrations()[1])
+	if !strings.Contains(stmt, "CREATE ACTION b() PUBLIC {};") {
+		t.Fatalf("expected content to be terminated, got %s", stmt)
+	}
+	if !strings.HasSuffix(stmt, "VALUES ('001-b.sql', 'bb', @height) ON CONFLICT (name) DO UPDATE SET checksum = 'bb', applied_at = @height;") {
+		t.Fatalf("unexpected schema table insert: %s", stmt)
+	}
+}
+
+func TestBaselineRecordsWithoutExecuting(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeClient{}
+	r := New(client, testMigrations())
+
+	recorded, err := r.Baseline(ctx, "000-a.sql", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 1 || len(client.applied) != 1 {
+		t.Fatalf("expected only 000-a.sql recorded, got %d", len(client.applied))
+	}
+	if strings.Contains(client.executed[0], "CREATE TABLE a") {
+		t.Fatalf("expected the baselined migration not to be executed, got %s", client.executed[0])
+	}
+
+	applied, err := r.Up(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Name != "001-b.sql" {
+		t.Fatalf("expected only 001-b.sql to be applied after the baseline, got %v", applied)
+	}
+
+	if _, err := r.Baseline(ctx, "000-a.sql", false); err == nil {
+		t.Fatal("expected error when baselining a node that records migrations")
+	}
+}
+
+func TestBaselineRefusesUnknownMigration(t *testing.T) {
+	if _, err := New(&fakeClient{}, testMigrations()).Baseline(context.Background(), "999-z.sql", false); err == nil {
+		t.Fatal("expected error for an unknown migration")
+	}
+}
@@ -0,0 +1,130 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetName identifies a named group of migrations.
+type SetName string
+
+const (
+	// SetProduction holds the schema and actions deployed to real nodes.
+	SetProduction SetName = "production"
+	// SetTest adds test-only helper actions on top of production.
+	SetTest SetName = "test"
+	// SetBenchmark is what benchmarks seed with. It must behave like production.
+	SetBenchmark SetName = "benchmark"
+)
+
+// MigrationSet describes where the files of a set live and which sets must be
+// applied before it.
+type MigrationSet struct {
+	Name SetName
+	// Dir is the embedded directory holding the set's own files, empty if it has none.
+	Dir string
+	// DependsOn lists the sets applied before this one, in order.
+	DependsOn []SetName
+}
+
+var migrationSets = map[SetName]MigrationSet{
+	SetProduction: {Name: SetProduction, Dir: "."},
+	SetTest:       {Name: SetTest, Dir: "test-migrations", DependsOn: []SetName{SetProduction}},
+	SetBenchmark:  {Name: SetBenchmark, DependsOn: []SetName{SetProduction}},
+}
+
+// GetMigrationSetInfo returns the definition of a set.
+func GetMigrationSetInfo(name SetName) (MigrationSet, error) {
+	set, ok := migrationSets[name]
+	if !ok {
+		return MigrationSet{}, errors.Errorf("unknown migration set %q", name)
+	}
+	return set, nil
+}
+
+// GetMigrationSet returns the migrations of a set, dependencies first, in the order
+// they must be applied. The production set is checked to not define any test-only action.
+func GetMigrationSet(name SetName) ([]Migration, error) {
+	order, err := resolveSetOrder(name, nil, map[SetName]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, setName := range order {
+		set := migrationSets[setName]
+		if set.Dir == "" {
+			continue
+		}
+
+		setMigrations, err := readMigrationDir(set.Dir, setName)
+		if err != nil {
+			return nil, err
+		}
+		if setName == SetProduction {
+			if err := checkNoTestActions(setMigrations); err != nil {
+				return nil, err
+			}
+		}
+		migrations = append(migrations, setMigrations...)
+	}
+
+	if len(migrations) == 0 {
+		return nil, errors.Errorf("no migrations found for set %q", name)
+	}
+
+	return migrations, nil
+}
+
+// resolveSetOrder returns name and its dependencies, dependencies first, each once.
+func resolveSetOrder(name SetName, order []SetName, visiting map[SetName]bool) ([]SetName, error) {
+	set, err := GetMigrationSetInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, done := range order {
+		if done == name {
+			return order, nil
+		}
+	}
+	if visiting[name] {
+		return nil, errors.Errorf("migration set %q depends on itself", name)
+	}
+
+	visiting[name] = true
+	for _, dep := range set.DependsOn {
+		if order, err = resolveSetOrder(dep, order, visiting); err != nil {
+			return nil, err
+		}
+	}
+	visiting[name] = false
+
+	return append(order, name), nil
+}
+
+var actionNameRegex = regexp.MustCompile(`(?i)CREATE\s+(?:OR\s+REPLACE\s+)?ACTION\s+([a-z0-9_]+)`)
+
+// checkNoTestActions fails if any production migration defines or references an
+// action that is defined by the test set.
+func checkNoTestActions(production []Migration) error {
+	testMigrations, err := readMigrationDir(migrationSets[SetTest].Dir, SetTest)
+	if err != nil {
+		return err
+	}
+
+	for _, testMigration := range testMigrations {
+		for _, match := range actionNameRegex.FindAllStringSubmatch(testMigration.Content, -1) {
+			action := strings.ToLower(match[1])
+			for _, migration := range production {
+				if strings.Contains(strings.ToLower(migration.Content), action) {
+					return errors.Errorf("production migration %s uses test-only action %s from %s",
+						migration.Name, action, testMigration.Path)
+				}
+			}
+		}
+	}
+
+	return nil
+}
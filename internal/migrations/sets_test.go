@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestProductionSetExcludesTestActions(t *testing.T) {
+	production, err := GetMigrationSet(SetProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range production {
+		if m.Set != SetProduction || strings.Contains(m.Path, "/") {
+			t.Fatalf("unexpected file in production set: %s", m.Path)
+		}
+		if strings.Contains(m.Content, "get_all_weights_for_query") || strings.Contains(m.Content, "get_composed_stream_data") {
+			t.Fatalf("test-only action leaked into production set: %s", m.Name)
+		}
+		if i > 0 && production[i-1].Name >= m.Name {
+			t.Fatalf("migrations not ordered: %s before %s", production[i-1].Name, m.Name)
+		}
+	}
+}
+
+func TestTestSetAppliesProductionFirst(t *testing.T) {
+	production, err := GetMigrationSet(SetProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := GetMigrationSet(SetTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(test) <= len(production) {
+		t.Fatalf("expected test set to extend production, got %d files for %d production files", len(test), len(production))
+	}
+	for i, m := range production {
+		if test[i].Path != m.Path {
+			t.Fatalf("expected %s at position %d, got %s", m.Path, i, test[i].Path)
+		}
+	}
+	for _, m := range test[len(production):] {
+		if m.Set != SetTest {
+			t.Fatalf("expected %s to belong to the test set", m.Path)
+		}
+	}
+}
+
+func TestBenchmarkSetMatchesProduction(t *testing.T) {
+	production := GetSeedScriptPathsFor(SetProduction)
+	benchmark := GetSeedScriptPathsFor(SetBenchmark)
+
+	if strings.Join(production, ",") != strings.Join(benchmark, ",") {
+		t.Fatalf("expected benchmark set to equal production, got %v", benchmark)
+	}
+	for _, p := range benchmark {
+		if !filepath.IsAbs(p) {
+			t.Fatalf("expected absolute path, got %s", p)
+		}
+	}
+}
+
+func TestSeedScriptPathsUseTestSet(t *testing.T) {
+	if strings.Join(GetSeedScriptPaths(), ",") != strings.Join(GetSeedScriptPathsFor(SetTest), ",") {
+		t.Fatal("expected GetSeedScriptPaths to return the test set")
+	}
+}
+
+func TestUnknownSet(t *testing.T) {
+	if _, err := GetMigrationSet("staging"); err == nil {
+		t.Fatal("expected error for unknown set")
+	}
+}
+
+func TestCheckNoTestActions(t *testing.T) {
+	err := checkNoTestActions([]Migration{{Name: "999-bad.sql", Content: "SELECT * FROM get_all_weights_for_query($a);"}})
+	if err == nil || !strings.Contains(err.Error(), "get_all_weights_for_query") {
+		t.Fatalf("expected guard to reject test action, got %v", err)
+	}
+}
+
+// topLevelStatement matches the statements of schema and data migrations, which start at the
+// beginning of a line unlike the statements in action bodies.
+var topLevelStatement = regexp.MustCompile(`(?m)^(CREATE TABLE|CREATE INDEX|ALTER TABLE|INSERT|UPDATE|DELETE)\b`)
+
+func TestOnlyActionFilesAreReplaceable(t *testing.T) {
+	production, err := GetMigrationSet(SetProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range production {
+		changesData := topLevelStatement.MatchString(m.Content)
+		if m.Replaceable() == changesData {
+			t.Fatalf("%s: replaceable is %v for a file that changes the schema or data: %v", m.Name, m.Replaceable(), changesData)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package tests
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/node/tests/streams/utils/table"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+/*
+	AGGR09: The aggregation method of a composed stream is configurable through the
+	`aggregation_method` metadata key.
+
+	- weighted_mean (default): sum(value * weight) / sum(weight)
+	- weighted_sum: sum(value * weight)
+	- weighted_median: lower weighted median of the primitive values
+	- geometric_mean: exp(sum(weight * ln(value)) / sum(weight)), positive values only
+
+	Scenario (weights 1, 2, 1):
+	| event_time | primitive_1 | primitive_2 | primitive_3 |
+	| 1          | 20          | 40          | 100         |
+	| 2          | 10          |             | 10          |
+	| 3          |             | 115         |             |
+
+	- weighted_sum: 200, 100, 250
+	- weighted_median: 40, 10, 10
+
+	The method of the queried stream applies to the whole taxonomy tree. Composed streams
+	that don't set a method follow it, and a stream can't be set to another method than a
+	composed stream above or below it: the metadata or the taxonomy is rejected.
+*/
+
+// TestAGGR09_AggregationMethod tests the configurable aggregation methods of composed streams
+func TestAGGR09_AggregationMethod(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "aggr09_aggregation_method_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testAGGR09_WeightedSum(t),
+			testAGGR09_WeightedMedian(t),
+			testAGGR09_GeometricMean(t),
+			testAGGR09_InvalidMethod(t),
+			testAGGR09_NestedMethods(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// setupAGGR09Stream deploys the composed stream of the scenario and sets its aggregation method.
+// An empty method leaves the stream with the default one.
+func setupAGGR09Stream(ctx context.Context, platform *kwilTesting.Platform, name string, method string) (types.StreamLocator, error) {
+	composedStreamId := util.GenerateStreamId(name)
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return types.StreamLocator{}, errors.Wrap(err, "error creating ethereum address")
+	}
+
+	err = setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+		Platform: platform,
+		StreamId: composedStreamId,
+		MarkdownData: `
+		| event_time | primitive_1 | primitive_2 | primitive_3 |
+		|------------|-------------|-------------|-------------|
+		| 1          | 20          | 40          | 100         |
+		| 2          | 10          |             | 10          |
+		| 3          |             | 115         |             |
+		`,
+		Weights: []string{"1", "2", "1"},
+		Height:  1,
+	})
+	if err != nil {
+		return types.StreamLocator{}, errors.Wrap(err, "error setting up composed stream")
+	}
+
+	composedStreamLocator := types.StreamLocator{
+		StreamId:     composedStreamId,
+		DataProvider: deployer,
+	}
+
+	if method != "" {
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  composedStreamLocator,
+			Key:      "aggregation_method",
+			Value:    method,
+			ValType:  "string",
+			Height:   1,
+		})
+		if err != nil {
+			return types.StreamLocator{}, errors.Wrap(err, "error setting aggregation method")
+		}
+	}
+
+	return composedStreamLocator, nil
+}
+
+func testAGGR09_WeightedSum(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromString("0x0000000000000000000000000000000000000123")
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		composedStreamLocator, err := setupAGGR09Stream(ctx, platform, "aggr09_weighted_sum", "weighted_sum")
+		if err != nil {
+			return err
+		}
+
+		fromTime := int64(1)
+		toTime := int64(3)
+
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: composedStreamLocator,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+
+		table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+			Actual: result,
+			Expected: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 200   |
+			| 2          | 100   |
+			| 3          | 250   |
+			`,
+			ColumnTransformers: map[string]func(string) string{
+				"value": addDecimalZeros(18),
+			},
+		})
+
+		// the index is computed over the aggregated series
+		indexResult, err := procedure.GetIndex(ctx, procedure.GetIndexInput{
+			Platform:      platform,
+			StreamLocator: composedStreamLocator,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			BaseTime:      &fromTime,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting index")
+		}
+
+		table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+			Actual: indexResult,
+			Expected: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 100   |
+			| 2          | 50    |
+			| 3          | 125   |
+			`,
+			ColumnTransformers: map[string]func(string) string{
+				"value": addDecimalZeros(18),
+			},
+		})
+
+		// without a range, the latest record uses the method too
+		latestResult, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: composedStreamLocator,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting latest record")
+		}
+
+		table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+			Actual: latestResult,
+			Expected: `
+			| event_time | value |
+			|------------|-------|
+			| 3          | 250   |
+			`,
+			ColumnTransformers: map[string]func(string) string{
+				"value": addDecimalZeros(18),
+			},
+		})
+
+		return nil
+	}
+}
+
+func testAGGR09_WeightedMedian(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromString("0x0000000000000000000000000000000000000123")
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		composedStreamLocator, err := setupAGGR09Stream(ctx, platform, "aggr09_weighted_median", "weighted_median")
+		if err != nil {
+			return err
+		}
+
+		fromTime := int64(1)
+		toTime := int64(3)
+
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: composedStreamLocator,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+
+		// day 1: 20 (w1), 40 (w2), 100 (w1) -> half of the weight is reached at 40
+		// day 2: 10 (w1), 10 (w1), 40 (w2) -> half of the weight is reached at 10
+		// day 3: 10 (w1), 10 (w1), 115 (w2) -> half of the weight is reached at 10
+		table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+			Actual: result,
+			Expected: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 40    |
+			| 2          | 10    |
+			| 3          | 10    |
+			`,
+			ColumnTransformers: map[string]func(string) string{
+				"value": addDecimalZeros(18),
+			},
+		})
+
+		// a query starting after the last change carries the anchor state
+		day2 := int64(2)
+		anchorResult, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: composedStreamLocator,
+			FromTime:      &day2,
+			ToTime:        &day2,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting anchor record")
+		}
+
+		table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+			Actual: anchorResult,
+			Expected: `
+			| event_time | value |
+			|------------|-------|
+			| 2          | 10    |
+			`,
+			ColumnTransformers: map[string]func(string) string{
+				"value": addDecimalZeros(18),
+			},
+		})
+
+		return nil
+	}
+}
+
+func testAGGR09_GeometricMean(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromString("0x0000000000000000000000000000000000000123")
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		composedStreamId := util.GenerateStreamId("aggr09_geometric_mean")
+		err = setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform: platform,
+			StreamId: composedStreamId,
+			MarkdownData: `
+			| event_time | geometric_1 | geometric_2 |
+			|------------|-------------|-------------|
+			| 1          | 2           | 8           |
+			| 2          | 32          |             |
+			| 3          |             | 2           |
+			`,
+			Weights: []string{"1", "1"},
+			Height:  1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream")
+		}
+
+		composedStreamLocator := types.StreamLocator{
+			StreamId:     composedStreamId,
+			DataProvider: deployer,
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  composedStreamLocator,
+			Key:      "aggregation_method",
+			Value:    "geometric_mean",
+			ValType:  "string",
+			Height:   1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting aggregation method")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(3)
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: composedStreamLocator,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+
+		// sqrt(2 * 8) = 4, sqrt(32 * 8) = 16, sqrt(32 * 2) = 8
+		// logarithms are approximated, so only the first decimals are compared
+		expected := []struct {
+			eventTime string
+			value     float64
+		}{
+			{"1", 4},
+			{"2", 16},
+			{"3", 8},
+		}
+		if !assert.Len(t, result, len(expected)) {
+			return nil
+		}
+		for i, row := range result {
+			assert.Equal(t, expected[i].eventTime, row[0])
+			value, err := strconv.ParseFloat(row[1], 64)
+			if err != nil {
+				return errors.Wrap(err, "error parsing value")
+			}
+			assert.True(t, math.Abs(value-expected[i].value) < 1e-9, "expected %v, got %s", expected[i].value, row[1])
+		}
+
+		return nil
+	}
+}
+
+func testAGGR09_InvalidMethod(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromString("0x0000000000000000000000000000000000000123")
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		composedStreamLocator, err := setupAGGR09Stream(ctx, platform, "aggr09_invalid_method", "")
+		if err != nil {
+			return err
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  composedStreamLocator,
+			Key:      "aggregation_method",
+			Value:    "harmonic_mean",
+			ValType:  "string",
+			Height:   1,
+		})
+		assert.Error(t, err, "unknown aggregation methods should be rejected")
+		if err != nil {
+			assert.Contains(t, err.Error(), "Invalid aggregation_method")
+		}
+
+		// the stream keeps the default weighted mean: (20*1 + 40*2 + 100*1) / 4 = 50
+		day1 := int64(1)
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: composedStreamLocator,
+			FromTime:      &day1,
+			ToTime:        &day1,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+
+		table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+			Actual: result,
+			Expected: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 50    |
+			`,
+			ColumnTransformers: map[string]func(string) string{
+				"value": addDecimalZeros(18),
+			},
+		})
+
+		return nil
+	}
+}
+
+func testAGGR09_NestedMethods(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromString("0x0000000000000000000000000000000000000123")
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		createParent := func(name string, method string) (types.StreamLocator, error) {
+			locator := types.StreamLocator{
+				StreamId:     util.GenerateStreamId(name),
+				DataProvider: deployer,
+			}
+			if err := setup.CreateStream(ctx, platform, setup.StreamInfo{
+				Locator: locator,
+				Type:    setup.ContractTypeComposed,
+			}); err != nil {
+				return locator, errors.Wrap(err, "error creating parent stream")
+			}
+			if method == "" {
+				return locator, nil
+			}
+			return locator, setAGGR09Method(ctx, platform, locator, method)
+		}
+		setTaxonomy := func(parent, child types.StreamLocator) error {
+			startTime := int64(0)
+			return procedure.SetTaxonomy(ctx, procedure.SetTaxonomyInput{
+				Platform:      platform,
+				StreamLocator: parent,
+				DataProviders: []string{deployer.Address()},
+				StreamIds:     []string{child.StreamId.String()},
+				Weights:       []string{"1"},
+				StartTime:     &startTime,
+				Height:        1,
+			})
+		}
+		assertSums := func(parent types.StreamLocator) error {
+			fromTime := int64(1)
+			toTime := int64(3)
+			result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+				Platform:      platform,
+				StreamLocator: parent,
+				FromTime:      &fromTime,
+				ToTime:        &toTime,
+				Height:        1,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error getting records")
+			}
+
+			// the parent sums the primitives of the child
+			table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+				Actual: result,
+				Expected: `
+				| event_time | value |
+				|------------|-------|
+				| 1          | 200   |
+				| 2          | 100   |
+				| 3          | 250   |
+				`,
+				ColumnTransformers: map[string]func(string) string{
+					"value": addDecimalZeros(18),
+				},
+			})
+			return nil
+		}
+
+		// a parent that doesn't set a method can include a child that does
+		sumChild, err := setupAGGR09Stream(ctx, platform, "aggr09_nested_child", "weighted_sum")
+		if err != nil {
+			return err
+		}
+		parent, err := createParent("aggr09_nested_parent", "")
+		if err != nil {
+			return err
+		}
+		if err := setTaxonomy(parent, sumChild); err != nil {
+			return errors.Wrap(err, "error setting taxonomy")
+		}
+
+		// setting another method than the child's is rejected
+		err = setAGGR09Method(ctx, platform, parent, "weighted_median")
+		assert.Error(t, err, "a parent method different from its child's should be rejected")
+		if err != nil {
+			assert.Contains(t, err.Error(), "nested aggregation methods are not supported")
+		}
+
+		if err := setAGGR09Method(ctx, platform, parent, "weighted_sum"); err != nil {
+			return errors.Wrap(err, "error setting the same method as the child")
+		}
+		if err := assertSums(parent); err != nil {
+			return err
+		}
+
+		// a composed child that doesn't set a method follows its parent
+		plainChild, err := setupAGGR09Stream(ctx, platform, "aggr09_nested_plain_child", "")
+		if err != nil {
+			return err
+		}
+		sumParent, err := createParent("aggr09_nested_sum_parent", "weighted_sum")
+		if err != nil {
+			return err
+		}
+		if err := setTaxonomy(sumParent, plainChild); err != nil {
+			return errors.Wrap(err, "error setting taxonomy on a child without method")
+		}
+		if err := assertSums(sumParent); err != nil {
+			return err
+		}
+
+		// including a child that sets another method is rejected
+		geometricParent, err := createParent("aggr09_nested_geometric_parent", "geometric_mean")
+		if err != nil {
+			return err
+		}
+		err = setTaxonomy(geometricParent, sumChild)
+		assert.Error(t, err, "a child method different from its parent's should be rejected")
+		if err != nil {
+			assert.Contains(t, err.Error(), "nested aggregation methods are not supported")
+		}
+
+		return nil
+	}
+}
+
+// setAGGR09Method sets the aggregation_method metadata of a stream.
+func setAGGR09Method(ctx context.Context, platform *kwilTesting.Platform, locator types.StreamLocator, method string) error {
+	return procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+		Platform: platform,
+		Locator:  locator,
+		Key:      "aggregation_method",
+		Value:    method,
+		ValType:  "string",
+		Height:   1,
+	})
+}
@@ -0,0 +1,192 @@
+/*
+STREAM DEPENDENTS TEST SUITE
+
+- [AGGR10] The composed streams depending on a stream can be listed (TestStreamDependents)
+
+This test file covers the reverse lineage functionality:
+- Testing the get_stream_dependents action which retrieves the composed streams using a given stream
+- Testing direct and recursive lookups, at a point in time or over all time
+- Testing that disabled taxonomies are ignored
+
+It reuses the hierarchy of the category streams test suite:
+- time 0: 1c -> {1.1c, 1.2c, 1.3p, 1.4c}, 1.1c -> {1.1.1p, 1.1.2p}, 1.2c -> {1.2.1p}
+- time 5: 1c -> {1.1c}, 1.1c -> {1.1.1p}
+- time 10: 1c -> {1.5p}
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/table"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+// Helper function to get the dependents of a stream and assert results against expected
+func getDependentsAndAssert(t *testing.T, ctx context.Context, platform *kwilTesting.Platform,
+	streamName string, recursive bool, activeAt *int64, expectedTable string) error {
+
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error creating ethereum address")
+	}
+
+	streamId := util.GenerateStreamId(streamName)
+	result, err := procedure.GetStreamDependents(ctx, procedure.GetStreamDependentsInput{
+		Platform:     platform,
+		DataProvider: deployer.Address(),
+		StreamId:     streamId.String(),
+		Recursive:    recursive,
+		ActiveAt:     activeAt,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error getting dependents of %s", streamName)
+	}
+
+	table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+		Actual:   result,
+		Expected: expectedTable,
+		ColumnTransformers: map[string]func(string) string{
+			"stream_id": func(column string) string {
+				s := util.GenerateStreamId(column)
+				return s.String()
+			},
+		},
+		SortColumns: []string{"depth", "stream_id"},
+	})
+	return nil
+}
+
+func TestStreamDependents(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "stream_dependents_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithCategoryTestSetup(testGetAllDependents(t)),
+			WithCategoryTestSetup(testGetDirectDependents(t)),
+			WithCategoryTestSetup(testGetDependentsAtTime(t)),
+			WithCategoryTestSetup(testGetDependentsIgnoresDisabledTaxonomy(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// Test getting all dependents without time constraints
+func testGetAllDependents(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		expected := `
+		| data_provider                              | stream_id | depth |
+		|--------------------------------------------|-----------|-------|
+		| 0x0000000000000000000000000000000000000000 | 1.1c      | 1     |
+		| 0x0000000000000000000000000000000000000000 | 1c        | 2     |
+		`
+		if err := getDependentsAndAssert(t, ctx, platform, "1.1.2p", true, nil, expected); err != nil {
+			return err
+		}
+
+		// the root isn't used by any stream
+		return getDependentsAndAssert(t, ctx, platform, "1c", true, nil, `
+		| data_provider | stream_id | depth |
+		|---------------|-----------|-------|
+		`)
+	}
+}
+
+// Test getting only the direct parents
+func testGetDirectDependents(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		expected := `
+		| data_provider                              | stream_id | depth |
+		|--------------------------------------------|-----------|-------|
+		| 0x0000000000000000000000000000000000000000 | 1.1c      | 1     |
+		`
+		return getDependentsAndAssert(t, ctx, platform, "1.1.2p", false, nil, expected)
+	}
+}
+
+// Test getting the dependents according to the taxonomies active at a point in time
+func testGetDependentsAtTime(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		time0 := int64(0)
+		time5 := int64(5)
+		time10 := int64(10)
+
+		// at time 0, 1.1.2p is part of 1.1c, which is part of 1c
+		expected := `
+		| data_provider                              | stream_id | depth |
+		|--------------------------------------------|-----------|-------|
+		| 0x0000000000000000000000000000000000000000 | 1.1c      | 1     |
+		| 0x0000000000000000000000000000000000000000 | 1c        | 2     |
+		`
+		if err := getDependentsAndAssert(t, ctx, platform, "1.1.2p", true, &time0, expected); err != nil {
+			return err
+		}
+
+		// from time 5, 1.1c only has 1.1.1p
+		if err := getDependentsAndAssert(t, ctx, platform, "1.1.2p", true, &time5, `
+		| data_provider | stream_id | depth |
+		|---------------|-----------|-------|
+		`); err != nil {
+			return err
+		}
+
+		// at time 10, 1.1c still uses 1.1.1p, but 1c doesn't use 1.1c anymore
+		expected = `
+		| data_provider                              | stream_id | depth |
+		|--------------------------------------------|-----------|-------|
+		| 0x0000000000000000000000000000000000000000 | 1.1c      | 1     |
+		`
+		if err := getDependentsAndAssert(t, ctx, platform, "1.1.1p", true, &time10, expected); err != nil {
+			return err
+		}
+
+		expected = `
+		| data_provider                              | stream_id | depth |
+		|--------------------------------------------|-----------|-------|
+		| 0x0000000000000000000000000000000000000000 | 1c        | 1     |
+		`
+		return getDependentsAndAssert(t, ctx, platform, "1.5p", true, &time10, expected)
+	}
+}
+
+// Test that a disabled taxonomy doesn't count
+func testGetDependentsIgnoresDisabledTaxonomy(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		// disable the time 5 taxonomy of 1.1c, so the time 0 one applies again
+		err = procedure.DisableTaxonomy(ctx, procedure.DisableTaxonomyInput{
+			Platform: platform,
+			StreamLocator: types.StreamLocator{
+				StreamId:     util.GenerateStreamId("1.1c"),
+				DataProvider: deployer,
+			},
+			GroupSequence: 2,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error disabling taxonomy")
+		}
+
+		time5 := int64(5)
+		expected := `
+		| data_provider                              | stream_id | depth |
+		|--------------------------------------------|-----------|-------|
+		| 0x0000000000000000000000000000000000000000 | 1.1c      | 1     |
+		| 0x0000000000000000000000000000000000000000 | 1c        | 2     |
+		`
+		return getDependentsAndAssert(t, ctx, platform, "1.1.2p", true, &time5, expected)
+	}
+}
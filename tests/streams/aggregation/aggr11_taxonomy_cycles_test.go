@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+/*
+	AGGR11: A taxonomy can't make a composed stream include itself, directly or through other streams, at any start time.
+
+	Test cases:
+	1. A composed stream including itself is rejected
+	2. A → B → C, then C → A is rejected with the path of the cycle
+	3. A → B at time 0, then B → A at time 10 is rejected, even after A changes its children at time 5
+	4. Once the definition closing the cycle is disabled, the taxonomy is accepted
+*/
+
+var (
+	cycleStreamA  = util.GenerateStreamId("cycle_stream_a")
+	cycleStreamB  = util.GenerateStreamId("cycle_stream_b")
+	cycleStreamC  = util.GenerateStreamId("cycle_stream_c")
+	cycleDeployer = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000123")
+)
+
+// TestAGGR11_TaxonomyCyclesRejected tests that taxonomies creating cycles are rejected
+func TestAGGR11_TaxonomyCyclesRejected(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "aggr11_taxonomy_cycles_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			withCycleStreams(testAGGR11_DirectCycle(t)),
+			withCycleStreams(testAGGR11_IndirectCycle(t)),
+			withCycleStreams(testAGGR11_TimeShiftedCycle(t)),
+			withCycleStreams(testAGGR11_DisabledDefinition(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// withCycleStreams creates the composed streams A, B and C, without taxonomies
+func withCycleStreams(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, cycleDeployer.Bytes())
+
+		for _, streamId := range []util.StreamId{cycleStreamA, cycleStreamB, cycleStreamC} {
+			err := setup.CreateStream(ctx, platform, setup.StreamInfo{
+				Locator: types.StreamLocator{
+					StreamId:     streamId,
+					DataProvider: cycleDeployer,
+				},
+				Type: setup.ContractTypeComposed,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "error creating stream %s", streamId.String())
+			}
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+// setCycleTaxonomy sets a single child taxonomy for the parent at the given start time
+func setCycleTaxonomy(ctx context.Context, platform *kwilTesting.Platform, parent, child util.StreamId, startTime int64) error {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error creating ethereum address")
+	}
+
+	return procedure.SetTaxonomy(ctx, procedure.SetTaxonomyInput{
+		Platform: platform,
+		StreamLocator: types.StreamLocator{
+			StreamId:     parent,
+			DataProvider: deployer,
+		},
+		DataProviders: []string{deployer.Address()},
+		StreamIds:     []string{child.String()},
+		Weights:       []string{"1.0"},
+		StartTime:     &startTime,
+		Height:        1,
+	})
+}
+
+// cyclePath formats the path expected in the error, as provider/stream segments
+func cyclePath(streamIds ...util.StreamId) string {
+	path := ""
+	for i, streamId := range streamIds {
+		if i > 0 {
+			path += " -> "
+		}
+		path += fmt.Sprintf("%s/%s", cycleDeployer.Address(), streamId.String())
+	}
+	return path
+}
+
+// testAGGR11_DirectCycle tests that a composed stream can't include itself
+func testAGGR11_DirectCycle(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := setCycleTaxonomy(ctx, platform, cycleStreamA, cycleStreamA, 0)
+		assert.Error(t, err, "Expected error when a stream includes itself")
+		if err != nil {
+			assert.Contains(t, err.Error(), "taxonomy would create a cycle: "+cyclePath(cycleStreamA, cycleStreamA))
+		}
+		return nil
+	}
+}
+
+// testAGGR11_IndirectCycle tests that a cycle through other streams is rejected
+func testAGGR11_IndirectCycle(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		if err := setCycleTaxonomy(ctx, platform, cycleStreamA, cycleStreamB, 0); err != nil {
+			return errors.Wrap(err, "error setting taxonomy A -> B")
+		}
+		if err := setCycleTaxonomy(ctx, platform, cycleStreamB, cycleStreamC, 0); err != nil {
+			return errors.Wrap(err, "error setting taxonomy B -> C")
+		}
+
+		err := setCycleTaxonomy(ctx, platform, cycleStreamC, cycleStreamA, 0)
+		assert.Error(t, err, "Expected error when closing a cycle through other streams")
+		if err != nil {
+			assert.Contains(t, err.Error(), "taxonomy would create a cycle: "+cyclePath(cycleStreamC, cycleStreamA, cycleStreamB, cycleStreamC))
+		}
+		return nil
+	}
+}
+
+// testAGGR11_TimeShiftedCycle tests that definitions with different start times still count
+func testAGGR11_TimeShiftedCycle(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		if err := setCycleTaxonomy(ctx, platform, cycleStreamA, cycleStreamB, 0); err != nil {
+			return errors.Wrap(err, "error setting taxonomy A -> B")
+		}
+
+		err := setCycleTaxonomy(ctx, platform, cycleStreamB, cycleStreamA, 10)
+		assert.Error(t, err, "Expected error when closing a cycle at a later start time")
+		if err != nil {
+			assert.Contains(t, err.Error(), "taxonomy would create a cycle: "+cyclePath(cycleStreamB, cycleStreamA, cycleStreamB))
+		}
+
+		// A doesn't include B from time 5, but the definition at time 0 is still there
+		if err := setCycleTaxonomy(ctx, platform, cycleStreamA, cycleStreamC, 5); err != nil {
+			return errors.Wrap(err, "error setting taxonomy A -> C")
+		}
+
+		err = setCycleTaxonomy(ctx, platform, cycleStreamB, cycleStreamA, 10)
+		assert.Error(t, err, "Expected error when closing a cycle through a past definition")
+		return nil
+	}
+}
+
+// testAGGR11_DisabledDefinition tests that disabled definitions don't count
+func testAGGR11_DisabledDefinition(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		if err := setCycleTaxonomy(ctx, platform, cycleStreamA, cycleStreamB, 0); err != nil {
+			return errors.Wrap(err, "error setting taxonomy A -> B")
+		}
+
+		err = procedure.DisableTaxonomy(ctx, procedure.DisableTaxonomyInput{
+			Platform: platform,
+			StreamLocator: types.StreamLocator{
+				StreamId:     cycleStreamA,
+				DataProvider: deployer,
+			},
+			GroupSequence: 1,
+			Height:        2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error disabling taxonomy A -> B")
+		}
+
+		err = setCycleTaxonomy(ctx, platform, cycleStreamB, cycleStreamA, 0)
+		assert.NoError(t, err, "Expected taxonomy to be accepted once the cycle is disabled")
+		return nil
+	}
+}
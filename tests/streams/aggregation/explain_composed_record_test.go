@@ -0,0 +1,206 @@
+/*
+EXPLAIN COMPOSED RECORD TEST SUITE
+
+- [AGGR12] The value of a composed stream can be broken down by contributing primitive (TestExplainComposedRecord)
+
+Scenario (weights 1, 2, 1):
+| event_time | primitive_1 | primitive_2 | primitive_3 |
+| 1          | 20          | 40          | 100         |
+| 2          | 10          |             | 10          |
+| 3          |             | 115         |             |
+
+- weighted_mean: 50, 25, 62.5
+- weighted_sum: 200, 100, 250
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/node/tests/streams/utils/table"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+func TestExplainComposedRecord(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "explain_composed_record_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testExplainWeightedMean(t),
+			testExplainLatestWeightedSum(t),
+			testExplainWeightedMedian(t),
+			testExplainPrimitiveRejected(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// setupExplainStream deploys the composed stream of the scenario and sets its aggregation method.
+// An empty method leaves the stream with the default one.
+func setupExplainStream(ctx context.Context, platform *kwilTesting.Platform, name string, method string) (types.StreamLocator, error) {
+	deployer := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000123")
+	platform = procedure.WithSigner(platform, deployer.Bytes())
+	composedStreamId := util.GenerateStreamId(name)
+
+	err := setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+		Platform: platform,
+		StreamId: composedStreamId,
+		MarkdownData: `
+		| event_time | primitive_1 | primitive_2 | primitive_3 |
+		|------------|-------------|-------------|-------------|
+		| 1          | 20          | 40          | 100         |
+		| 2          | 10          |             | 10          |
+		| 3          |             | 115         |             |
+		`,
+		Weights: []string{"1", "2", "1"},
+		Height:  1,
+	})
+	if err != nil {
+		return types.StreamLocator{}, errors.Wrap(err, "error setting up composed stream")
+	}
+
+	composedStreamLocator := types.StreamLocator{
+		StreamId:     composedStreamId,
+		DataProvider: deployer,
+	}
+
+	if method != "" {
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  composedStreamLocator,
+			Key:      "aggregation_method",
+			Value:    method,
+			ValType:  "string",
+			Height:   1,
+		})
+		if err != nil {
+			return types.StreamLocator{}, errors.Wrap(err, "error setting aggregation method")
+		}
+	}
+
+	return composedStreamLocator, nil
+}
+
+// explainAndAssert explains the composed stream and compares it to the expected table
+func explainAndAssert(t *testing.T, ctx context.Context, platform *kwilTesting.Platform, locator types.StreamLocator, from, to *int64, expected string) error {
+	result, err := procedure.ExplainComposedRecord(ctx, procedure.ExplainComposedRecordInput{
+		Platform:      procedure.WithSigner(platform, locator.DataProvider.Bytes()),
+		StreamLocator: locator,
+		FromTime:      from,
+		ToTime:        to,
+		Height:        1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error explaining composed record")
+	}
+
+	table.AssertResultRowsEqualMarkdownTable(t, table.AssertResultRowsEqualMarkdownTableInput{
+		Actual:   result,
+		Expected: expected,
+		ColumnTransformers: map[string]func(string) string{
+			"child_stream_id": func(column string) string {
+				streamId := util.GenerateStreamId(column)
+				return streamId.String()
+			},
+		},
+		SortColumns: []string{"event_time", "child_stream_id"},
+	})
+	return nil
+}
+
+func testExplainWeightedMean(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		locator, err := setupExplainStream(ctx, platform, "explain_weighted_mean", "")
+		if err != nil {
+			return err
+		}
+
+		from := int64(1)
+		to := int64(3)
+		// the contributions of an event_time sum up to the composed value
+		return explainAndAssert(t, ctx, platform, locator, &from, &to, `
+		| event_time | child_data_provider | child_stream_id | weight | normalized_weight | value | contribution |
+		|------------|---------------------|-----------------|--------|-------------------|-------|--------------|
+		| 1 | 0x0000000000000000000000000000000000000123 | primitive_1 | 1.000000000000000000 | 0.250000000000000000 | 20.000000000000000000  | 5.000000000000000000  |
+		| 1 | 0x0000000000000000000000000000000000000123 | primitive_2 | 2.000000000000000000 | 0.500000000000000000 | 40.000000000000000000  | 20.000000000000000000 |
+		| 1 | 0x0000000000000000000000000000000000000123 | primitive_3 | 1.000000000000000000 | 0.250000000000000000 | 100.000000000000000000 | 25.000000000000000000 |
+		| 2 | 0x0000000000000000000000000000000000000123 | primitive_1 | 1.000000000000000000 | 0.250000000000000000 | 10.000000000000000000  | 2.500000000000000000  |
+		| 2 | 0x0000000000000000000000000000000000000123 | primitive_2 | 2.000000000000000000 | 0.500000000000000000 | 40.000000000000000000  | 20.000000000000000000 |
+		| 2 | 0x0000000000000000000000000000000000000123 | primitive_3 | 1.000000000000000000 | 0.250000000000000000 | 10.000000000000000000  | 2.500000000000000000  |
+		| 3 | 0x0000000000000000000000000000000000000123 | primitive_1 | 1.000000000000000000 | 0.250000000000000000 | 10.000000000000000000  | 2.500000000000000000  |
+		| 3 | 0x0000000000000000000000000000000000000123 | primitive_2 | 2.000000000000000000 | 0.500000000000000000 | 115.000000000000000000 | 57.500000000000000000 |
+		| 3 | 0x0000000000000000000000000000000000000123 | primitive_3 | 1.000000000000000000 | 0.250000000000000000 | 10.000000000000000000  | 2.500000000000000000  |
+		`)
+	}
+}
+
+func testExplainLatestWeightedSum(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		locator, err := setupExplainStream(ctx, platform, "explain_weighted_sum", "weighted_sum")
+		if err != nil {
+			return err
+		}
+
+		// without range, only the latest record is explained
+		return explainAndAssert(t, ctx, platform, locator, nil, nil, `
+		| event_time | child_data_provider | child_stream_id | weight | normalized_weight | value | contribution |
+		|------------|---------------------|-----------------|--------|-------------------|-------|--------------|
+		| 3 | 0x0000000000000000000000000000000000000123 | primitive_1 | 1.000000000000000000 | 0.250000000000000000 | 10.000000000000000000  | 10.000000000000000000  |
+		| 3 | 0x0000000000000000000000000000000000000123 | primitive_2 | 2.000000000000000000 | 0.500000000000000000 | 115.000000000000000000 | 230.000000000000000000 |
+		| 3 | 0x0000000000000000000000000000000000000123 | primitive_3 | 1.000000000000000000 | 0.250000000000000000 | 10.000000000000000000  | 10.000000000000000000  |
+		`)
+	}
+}
+
+func testExplainWeightedMedian(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		locator, err := setupExplainStream(ctx, platform, "explain_weighted_median", "weighted_median")
+		if err != nil {
+			return err
+		}
+
+		// the median doesn't split additively
+		at := int64(1)
+		return explainAndAssert(t, ctx, platform, locator, &at, &at, `
+		| event_time | child_data_provider | child_stream_id | weight | normalized_weight | value | contribution |
+		|------------|---------------------|-----------------|--------|-------------------|-------|--------------|
+		| 1 | 0x0000000000000000000000000000000000000123 | primitive_1 | 1.000000000000000000 | 0.250000000000000000 | 20.000000000000000000  | <nil> |
+		| 1 | 0x0000000000000000000000000000000000000123 | primitive_2 | 2.000000000000000000 | 0.500000000000000000 | 40.000000000000000000  | <nil> |
+		| 1 | 0x0000000000000000000000000000000000000123 | primitive_3 | 1.000000000000000000 | 0.250000000000000000 | 100.000000000000000000 | <nil> |
+		`)
+	}
+}
+
+func testExplainPrimitiveRejected(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		locator, err := setupExplainStream(ctx, platform, "explain_primitive_rejected", "")
+		if err != nil {
+			return err
+		}
+
+		_, err = procedure.ExplainComposedRecord(ctx, procedure.ExplainComposedRecordInput{
+			Platform: procedure.WithSigner(platform, locator.DataProvider.Bytes()),
+			StreamLocator: types.StreamLocator{
+				StreamId:     util.GenerateStreamId("primitive_1"),
+				DataProvider: locator.DataProvider,
+			},
+			Height: 1,
+		})
+		assert.Error(t, err, "Expected primitive streams to be rejected")
+		if err != nil {
+			assert.Contains(t, err.Error(), "explain_composed_record only supports composed streams")
+		}
+		return nil
+	}
+}
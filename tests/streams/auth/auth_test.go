@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/kwilteam/kwil-db/common"
 	kwilTesting "github.com/kwilteam/kwil-db/testing"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -162,6 +163,189 @@ func testInvalidAddressOwnershipTransfer(t *testing.T) kwilTesting.TestFunc {
 	}
 }
 
+// TestAUTH01_TwoStepOwnershipTransfer tests AUTH01: ownership is only transferred once the proposed owner accepts it.
+func TestAUTH01_TwoStepOwnershipTransfer(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "two_step_ownership_transfer_AUTH01",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testOwnershipProposeAccept(t),
+			testOwnershipProposalExpiry(t),
+			testOwnershipProposalCancel(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+var (
+	ownershipProposer = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+	ownershipProposed = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000002")
+	ownershipOutsider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000003")
+)
+
+// setupOwnershipProposal creates a stream owned by ownershipProposer and proposes it to ownershipProposed at height 1
+func setupOwnershipProposal(ctx context.Context, platform *kwilTesting.Platform, expiresIn *int64) (types.StreamLocator, error) {
+	streamLocator := types.StreamLocator{
+		StreamId:     util.GenerateStreamId("ownership_proposal_test"),
+		DataProvider: ownershipProposer,
+	}
+	platform = procedure.WithSigner(platform, ownershipProposer.Bytes())
+
+	if err := setup.CreateStream(ctx, platform, setup.StreamInfo{
+		Locator: streamLocator,
+		Type:    setup.ContractTypePrimitive,
+	}); err != nil {
+		return streamLocator, errors.Wrap(err, "failed to create stream")
+	}
+
+	err := procedure.ProposeStreamOwnership(ctx, procedure.ProposeStreamOwnershipInput{
+		Platform:  platform,
+		Locator:   streamLocator,
+		NewOwner:  ownershipProposed.Address(),
+		ExpiresIn: expiresIn,
+		Height:    1,
+	})
+	if err != nil {
+		return streamLocator, errors.Wrap(err, "failed to propose ownership")
+	}
+	return streamLocator, nil
+}
+
+// canInsertMetadata tells whether the signer can run an owner-only action on the stream
+func canInsertMetadata(ctx context.Context, platform *kwilTesting.Platform, streamLocator types.StreamLocator, signer util.EthereumAddress) bool {
+	err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+		Platform: procedure.WithSigner(platform, signer.Bytes()),
+		Locator:  streamLocator,
+		Key:      "new_key",
+		Value:    "new_value",
+		ValType:  "string",
+		Height:   2,
+	})
+	return err == nil
+}
+
+func testOwnershipProposeAccept(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		streamLocator, err := setupOwnershipProposal(ctx, platform, nil)
+		if err != nil {
+			return err
+		}
+
+		// the stream keeps its owner while the proposal is pending
+		assert.True(t, canInsertMetadata(ctx, platform, streamLocator, ownershipProposer), "Owner should keep the stream until the proposal is accepted")
+		assert.False(t, canInsertMetadata(ctx, platform, streamLocator, ownershipProposed), "Proposed owner should not own the stream before accepting")
+
+		pending, err := procedure.GetPendingOwnershipTransfers(ctx, procedure.GetPendingOwnershipTransfersInput{
+			Platform:      platform,
+			ProposedOwner: testutils.Ptr(ownershipProposed.Address()),
+			Height:        2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get pending ownership transfers")
+		}
+		assert.Equal(t, []procedure.ResultRow{{
+			ownershipProposer.Address(),
+			streamLocator.StreamId.String(),
+			ownershipProposed.Address(),
+			ownershipProposer.Address(),
+			"1",
+			"100801",
+		}}, pending, "Proposal should be pending")
+
+		err = procedure.AcceptStreamOwnership(ctx, procedure.OwnershipTransferInput{
+			Platform: procedure.WithSigner(platform, ownershipOutsider.Bytes()),
+			Locator:  streamLocator,
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, "Only the proposed owner can accept the ownership transfer")
+
+		err = procedure.AcceptStreamOwnership(ctx, procedure.OwnershipTransferInput{
+			Platform: procedure.WithSigner(platform, ownershipProposed.Bytes()),
+			Locator:  streamLocator,
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to accept ownership")
+		}
+
+		assert.False(t, canInsertMetadata(ctx, platform, streamLocator, ownershipProposer), "Previous owner should lose the stream")
+		assert.True(t, canInsertMetadata(ctx, platform, streamLocator, ownershipProposed), "New owner should own the stream")
+
+		pending, err = procedure.GetPendingOwnershipTransfers(ctx, procedure.GetPendingOwnershipTransfersInput{
+			Platform: platform,
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get pending ownership transfers")
+		}
+		assert.Empty(t, pending, "Accepted proposal should not be pending anymore")
+
+		return nil
+	}
+}
+
+func testOwnershipProposalExpiry(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		streamLocator, err := setupOwnershipProposal(ctx, platform, testutils.Ptr(int64(10)))
+		if err != nil {
+			return err
+		}
+
+		pending, err := procedure.GetPendingOwnershipTransfers(ctx, procedure.GetPendingOwnershipTransfersInput{
+			Platform:     platform,
+			DataProvider: testutils.Ptr(streamLocator.DataProvider.Address()),
+			StreamId:     testutils.Ptr(streamLocator.StreamId.String()),
+			Height:       11,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get pending ownership transfers")
+		}
+		assert.Empty(t, pending, "Expired proposal should not be pending")
+
+		err = procedure.AcceptStreamOwnership(ctx, procedure.OwnershipTransferInput{
+			Platform: procedure.WithSigner(platform, ownershipProposed.Bytes()),
+			Locator:  streamLocator,
+			Height:   11,
+		})
+		assert.ErrorContains(t, err, "Ownership transfer proposal expired at block 11")
+
+		return nil
+	}
+}
+
+func testOwnershipProposalCancel(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		streamLocator, err := setupOwnershipProposal(ctx, platform, nil)
+		if err != nil {
+			return err
+		}
+
+		err = procedure.CancelStreamOwnershipTransfer(ctx, procedure.OwnershipTransferInput{
+			Platform: procedure.WithSigner(platform, ownershipProposed.Bytes()),
+			Locator:  streamLocator,
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, "Only stream owner can cancel an ownership transfer")
+
+		err = procedure.CancelStreamOwnershipTransfer(ctx, procedure.OwnershipTransferInput{
+			Platform: procedure.WithSigner(platform, ownershipProposer.Bytes()),
+			Locator:  streamLocator,
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to cancel ownership transfer")
+		}
+
+		err = procedure.AcceptStreamOwnership(ctx, procedure.OwnershipTransferInput{
+			Platform: procedure.WithSigner(platform, ownershipProposed.Bytes()),
+			Locator:  streamLocator,
+			Height:   3,
+		})
+		assert.ErrorContains(t, err, "No pending ownership transfer for the stream")
+
+		return nil
+	}
+}
+
 // TestAUTH02_ReadPermissions tests AUTH02: A stream owner can control who is allowed to read data from its stream
 func TestAUTH02_ReadPermissions(t *testing.T) {
 	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
@@ -552,13 +736,11 @@ func testComposePermissionControl(t *testing.T, contractInfo setup.StreamInfo) k
 		assert.False(t, canCompose, "Upper stream should not be allowed to compose without permission")
 
 		// Grant compose permission to the foreign stream
-		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
-			Platform: platform,
-			Locator:  contractInfo.Locator,
-			Key:      "allow_compose_stream",
-			Value:    upperStreamInfo.Locator.StreamId.String(),
-			ValType:  "ref",
-			Height:   0,
+		err = procedure.GrantComposePermission(ctx, procedure.GrantComposePermissionInput{
+			Platform:      platform,
+			Locator:       contractInfo.Locator,
+			ParentLocator: upperStreamInfo.Locator,
+			Height:        0,
 		})
 		if err != nil {
 			return errors.Wrapf(err, "failed to grant compose permission to upper stream %s for contract %s",
@@ -703,13 +885,11 @@ func testNestedComposePermissionControl(t *testing.T) kwilTesting.TestFunc {
 		assert.False(t, canComposeAll, "Expected nested compose to be disallowed when child's allow_compose_stream metadata (for parent) is missing")
 
 		// Insert child's allow_compose_stream metadata whitelisting the parent.
-		if err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
-			Platform: childPlatform,
-			Locator:  childLocator,
-			Key:      "allow_compose_stream",
-			Value:    parentLocator.StreamId.String(),
-			ValType:  "ref",
-			Height:   2,
+		if err := procedure.GrantComposePermission(ctx, procedure.GrantComposePermissionInput{
+			Platform:      childPlatform,
+			Locator:       childLocator,
+			ParentLocator: parentLocator,
+			Height:        2,
 		}); err != nil {
 			return errors.Wrap(err, "failed to insert allow_compose_stream metadata on child")
 		}
@@ -750,13 +930,11 @@ func testNestedComposePermissionControl(t *testing.T) kwilTesting.TestFunc {
 		assert.False(t, canComposeAll, "Expected nested compose to be disallowed when grandchild's allow_compose_stream metadata (for child) is missing")
 
 		// Insert grandchild's allow_compose_stream metadata whitelisting the child.
-		if err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
-			Platform: grandchildPlatform,
-			Locator:  grandchildLocator,
-			Key:      "allow_compose_stream",
-			Value:    childLocator.StreamId.String(),
-			ValType:  "ref",
-			Height:   4,
+		if err := procedure.GrantComposePermission(ctx, procedure.GrantComposePermissionInput{
+			Platform:      grandchildPlatform,
+			Locator:       grandchildLocator,
+			ParentLocator: childLocator,
+			Height:        4,
 		}); err != nil {
 			return errors.Wrap(err, "failed to insert allow_compose_stream metadata on grandchild")
 		}
@@ -793,6 +971,7 @@ func TestAUTH05_StreamDeletion(t *testing.T) {
 		Name: "stream_deletion_test",
 		SeedScripts: []string{
 			"../../../internal/migrations/000-initial-data.sql",
+			"../../../internal/migrations/000a-schema-additions.sql",
 			"../../../internal/migrations/001-common-actions.sql",
 		},
 		FunctionTests: []kwilTesting.TestFunc{
@@ -850,3 +1029,1032 @@ func testStreamDeletion(t *testing.T) kwilTesting.TestFunc {
 		return nil
 	}
 }
+
+// TestAUTH05_StreamRestore tests that deleted streams are archived and can be restored within the grace period,
+// then only purged.
+func TestAUTH05_StreamRestore(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "stream_restore_AUTH05",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testStreamRestore(t),
+			testStreamRestoreAfterGracePeriod(t),
+			testStreamRestoreByNonOwner(t),
+			testStreamPurge(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// setupDeletedPrimitiveStream creates a primitive stream with a record, then deletes it at height 0
+func setupDeletedPrimitiveStream(ctx context.Context, platform *kwilTesting.Platform, streamLocator types.StreamLocator) error {
+	err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+		Platform: platform,
+		StreamId: streamLocator.StreamId,
+		Height:   0,
+		MarkdownData: `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10    |
+		`,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to setup primitive stream")
+	}
+
+	_, err = setup.DeleteStream(ctx, platform, streamLocator)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete stream")
+	}
+	return nil
+}
+
+func testStreamRestore(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		dataProvider := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("stream_restore_test"),
+			DataProvider: dataProvider,
+		}
+		platform = procedure.WithSigner(platform, dataProvider.Bytes())
+
+		if err := setupDeletedPrimitiveStream(ctx, platform, streamLocator); err != nil {
+			return err
+		}
+
+		// the archived stream is hidden from listings and queries
+		streams, err := procedure.ListStreams(ctx, procedure.ListStreamsInput{
+			Platform:     platform,
+			DataProvider: dataProvider.Address(),
+			Height:       1,
+		})
+		assert.NoError(t, err, "Error should not be returned when listing streams")
+		assert.Equal(t, 0, len(streams), "Archived stream should not be listed")
+
+		_, err = procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			Height:        1,
+		})
+		assert.Error(t, err, "Archived stream should not be queryable")
+
+		// it can't be created again while archived
+		err = setup.CreateStream(ctx, platform, setup.StreamInfo{
+			Locator: streamLocator,
+			Type:    setup.ContractTypePrimitive,
+		})
+		assert.Error(t, err, "Archived stream id should stay reserved")
+
+		err = procedure.RestoreStream(ctx, procedure.RestoreStreamInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			Height:        10,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to restore stream")
+		}
+
+		// the stream is back with its records
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			FromTime:      testutils.Ptr(int64(1)),
+			ToTime:        testutils.Ptr(int64(1)),
+			Height:        11,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to query restored stream")
+		}
+		assert.Equal(t, []procedure.ResultRow{{"1", "10.000000000000000000"}}, result, "Restored stream should keep its records")
+
+		// restoring a live stream fails
+		err = procedure.RestoreStream(ctx, procedure.RestoreStreamInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			Height:        12,
+		})
+		assert.Error(t, err, "Restoring a live stream should fail")
+
+		return nil
+	}
+}
+
+func testStreamRestoreAfterGracePeriod(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		dataProvider := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("stream_restore_test"),
+			DataProvider: dataProvider,
+		}
+		platform = procedure.WithSigner(platform, dataProvider.Bytes())
+
+		if err := setupDeletedPrimitiveStream(ctx, platform, streamLocator); err != nil {
+			return err
+		}
+
+		err := procedure.RestoreStream(ctx, procedure.RestoreStreamInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			Height:        100001,
+		})
+		assert.Error(t, err, "Restoring after the grace period should fail")
+		if err != nil {
+			assert.Contains(t, err.Error(), "Grace period to restore the stream is over")
+		}
+
+		return nil
+	}
+}
+
+func testStreamRestoreByNonOwner(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		dataProvider := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("stream_restore_test"),
+			DataProvider: dataProvider,
+		}
+		platform = procedure.WithSigner(platform, dataProvider.Bytes())
+
+		if err := setupDeletedPrimitiveStream(ctx, platform, streamLocator); err != nil {
+			return err
+		}
+
+		nonOwner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000002")
+		err := procedure.RestoreStream(ctx, procedure.RestoreStreamInput{
+			Platform:      procedure.WithSigner(platform, nonOwner.Bytes()),
+			StreamLocator: streamLocator,
+			Height:        10,
+		})
+		assert.Error(t, err, "Non-owner should not be able to restore the stream")
+		if err != nil {
+			assert.Contains(t, err.Error(), "Only stream owner can restore the stream")
+		}
+
+		return nil
+	}
+}
+
+func testStreamPurge(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		dataProvider := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("stream_restore_test"),
+			DataProvider: dataProvider,
+		}
+		platform = procedure.WithSigner(platform, dataProvider.Bytes())
+
+		if err := setupDeletedPrimitiveStream(ctx, platform, streamLocator); err != nil {
+			return err
+		}
+
+		// within the grace period, the stream can only be restored
+		err := procedure.PurgeStream(ctx, procedure.PurgeStreamInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			Height:        100000,
+		})
+		assert.Error(t, err, "Purging within the grace period should fail")
+		if err != nil {
+			assert.Contains(t, err.Error(), "Stream can still be restored")
+		}
+
+		nonOwner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000002")
+		err = procedure.PurgeStream(ctx, procedure.PurgeStreamInput{
+			Platform:      procedure.WithSigner(platform, nonOwner.Bytes()),
+			StreamLocator: streamLocator,
+			Height:        100001,
+		})
+		assert.Error(t, err, "Non-owner should not be able to purge the stream")
+		if err != nil {
+			assert.Contains(t, err.Error(), "Only stream owner can purge the stream")
+		}
+
+		err = procedure.PurgeStream(ctx, procedure.PurgeStreamInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			Height:        100001,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to purge stream")
+		}
+
+		// the stream_id is free again, and the new stream doesn't inherit the purged records
+		err = setup.CreateStream(ctx, platform, setup.StreamInfo{
+			Locator: streamLocator,
+			Type:    setup.ContractTypePrimitive,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create the stream again")
+		}
+
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			FromTime:      testutils.Ptr(int64(1)),
+			ToTime:        testutils.Ptr(int64(1)),
+			Height:        100002,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to query the new stream")
+		}
+		assert.Empty(t, result, "Purged records should be gone")
+
+		return nil
+	}
+}
+
+// TestAUTH08_DeletionGuard tests that streams with the deletion_guard metadata can't be deleted while composed streams use them.
+func TestAUTH08_DeletionGuard(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "deletion_guard_AUTH08",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testDeletionGuard(t),
+			testDeletionGuardActiveTaxonomy(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+func testDeletionGuard(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		dataProvider := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+		primitiveLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("guarded_primitive_test"),
+			DataProvider: dataProvider,
+		}
+		composedLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("guarded_composed_test"),
+			DataProvider: dataProvider,
+		}
+		platform = procedure.WithSigner(platform, dataProvider.Bytes())
+
+		for _, info := range []setup.StreamInfo{
+			{Locator: primitiveLocator, Type: setup.ContractTypePrimitive},
+			{Locator: composedLocator, Type: setup.ContractTypeComposed},
+		} {
+			if err := setup.CreateStream(ctx, platform, info); err != nil {
+				return errors.Wrapf(err, "failed to create stream %s", info.Locator.StreamId.String())
+			}
+		}
+
+		err := procedure.SetTaxonomy(ctx, procedure.SetTaxonomyInput{
+			Platform:      platform,
+			StreamLocator: composedLocator,
+			DataProviders: []string{dataProvider.Address()},
+			StreamIds:     []string{primitiveLocator.StreamId.String()},
+			Weights:       []string{"1.0"},
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to set taxonomy")
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  primitiveLocator,
+			Key:      "deletion_guard",
+			Value:    "1",
+			ValType:  "int",
+			Height:   1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to set deletion guard")
+		}
+
+		result, err := setup.DeleteStream(ctx, platform, primitiveLocator)
+		if err != nil {
+			return errors.Wrap(err, "failed to call delete_stream")
+		}
+		assert.Error(t, result.Error, "Guarded stream used by a composed stream should not be deleted")
+		if result.Error != nil {
+			assert.Contains(t, result.Error.Error(), "Stream is used by composed stream")
+		}
+
+		// once the composed stream is deleted, nothing uses the primitive anymore
+		result, err = setup.DeleteStream(ctx, platform, composedLocator)
+		if err != nil {
+			return errors.Wrap(err, "failed to call delete_stream")
+		}
+		assert.NoError(t, result.Error, "Composed stream should be deleted")
+
+		result, err = setup.DeleteStream(ctx, platform, primitiveLocator)
+		if err != nil {
+			return errors.Wrap(err, "failed to call delete_stream")
+		}
+		assert.NoError(t, result.Error, "Guarded stream without dependents should be deleted")
+
+		return nil
+	}
+}
+
+// testDeletionGuardActiveTaxonomy checks that only the taxonomy active at the block timestamp
+// blocks the deletion, not superseded or future ones
+func testDeletionGuardActiveTaxonomy(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		dataProvider := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+		primitiveLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("guarded_active_primitive"),
+			DataProvider: dataProvider,
+		}
+		otherLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("guarded_active_other"),
+			DataProvider: dataProvider,
+		}
+		composedLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("guarded_active_composed"),
+			DataProvider: dataProvider,
+		}
+		platform = procedure.WithSigner(platform, dataProvider.Bytes())
+
+		for _, info := range []setup.StreamInfo{
+			{Locator: primitiveLocator, Type: setup.ContractTypePrimitive},
+			{Locator: otherLocator, Type: setup.ContractTypePrimitive},
+			{Locator: composedLocator, Type: setup.ContractTypeComposed},
+		} {
+			if err := setup.CreateStream(ctx, platform, info); err != nil {
+				return errors.Wrapf(err, "failed to create stream %s", info.Locator.StreamId.String())
+			}
+		}
+
+		// the guarded stream is a child from time 10, replaced from time 20 and a child again from time 100
+		for _, taxonomy := range []struct {
+			startTime int64
+			child     types.StreamLocator
+		}{
+			{10, primitiveLocator},
+			{20, otherLocator},
+			{100, primitiveLocator},
+		} {
+			startTime := taxonomy.startTime
+			err := procedure.SetTaxonomy(ctx, procedure.SetTaxonomyInput{
+				Platform:      platform,
+				StreamLocator: composedLocator,
+				DataProviders: []string{dataProvider.Address()},
+				StreamIds:     []string{taxonomy.child.StreamId.String()},
+				Weights:       []string{"1.0"},
+				StartTime:     &startTime,
+				Height:        1,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to set taxonomy starting at %d", startTime)
+			}
+		}
+
+		err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  primitiveLocator,
+			Key:      "deletion_guard",
+			Value:    "1",
+			ValType:  "int",
+			Height:   1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to set deletion guard")
+		}
+
+		result, err := setup.DeleteStreamAt(ctx, platform, primitiveLocator, 15)
+		if err != nil {
+			return errors.Wrap(err, "failed to call delete_stream")
+		}
+		assert.Error(t, result.Error, "Guarded stream used by the active taxonomy should not be deleted")
+		if result.Error != nil {
+			assert.Contains(t, result.Error.Error(), "Stream is used by composed stream")
+		}
+
+		// at time 50 the active taxonomy only uses the other stream
+		result, err = setup.DeleteStreamAt(ctx, platform, primitiveLocator, 50)
+		if err != nil {
+			return errors.Wrap(err, "failed to call delete_stream")
+		}
+		assert.NoError(t, result.Error, "Superseded and future taxonomies should not block the deletion")
+
+		return nil
+	}
+}
+
+// TestAUTH09_AccessGroups tests that streams can grant read and write access to the members of an access group.
+func TestAUTH09_AccessGroups(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "access_groups_AUTH09",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testAccessGroupPermissions(t),
+			testAccessGroupManagement(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+var (
+	accessGroupOwner    = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+	accessGroupMember   = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000002")
+	accessGroupOutsider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000003")
+)
+
+// setupAccessGroupStream creates a private primitive stream and the "analysts" group with accessGroupMember,
+// then grants the group read and write access to the stream
+func setupAccessGroupStream(ctx context.Context, platform *kwilTesting.Platform) (types.StreamLocator, error) {
+	streamLocator := types.StreamLocator{
+		StreamId:     util.GenerateStreamId("access_group_test"),
+		DataProvider: accessGroupOwner,
+	}
+	platform = procedure.WithSigner(platform, accessGroupOwner.Bytes())
+
+	err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+		Platform: platform,
+		StreamId: streamLocator.StreamId,
+		Height:   1,
+		MarkdownData: `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10    |
+		`,
+	})
+	if err != nil {
+		return streamLocator, errors.Wrap(err, "failed to setup primitive stream")
+	}
+
+	err = procedure.CreateAccessGroup(ctx, procedure.AccessGroupInput{
+		Platform: platform,
+		GroupId:  "analysts",
+		Height:   1,
+	})
+	if err != nil {
+		return streamLocator, errors.Wrap(err, "failed to create access group")
+	}
+
+	err = procedure.AddAccessGroupMembers(ctx, procedure.AccessGroupMembersInput{
+		Platform: platform,
+		GroupId:  "analysts",
+		Wallets:  []string{accessGroupMember.Address()},
+		Height:   1,
+	})
+	if err != nil {
+		return streamLocator, errors.Wrap(err, "failed to add access group member")
+	}
+
+	for _, metadata := range []struct {
+		key     string
+		value   string
+		valType string
+	}{
+		{"read_visibility", "1", "int"},
+		{"allow_read_group", "analysts", "string"},
+		{"allow_write_group", "analysts", "string"},
+	} {
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			Key:      metadata.key,
+			Value:    metadata.value,
+			ValType:  metadata.valType,
+			Height:   1,
+		})
+		if err != nil {
+			return streamLocator, errors.Wrapf(err, "failed to insert metadata %s", metadata.key)
+		}
+	}
+
+	return streamLocator, nil
+}
+
+// canReadAndWrite tells whether the wallet can read the stream and insert a record into it
+func canReadAndWrite(ctx context.Context, platform *kwilTesting.Platform, streamLocator types.StreamLocator, wallet util.EthereumAddress, height int64) (bool, bool) {
+	canRead, err := procedure.CheckReadAllPermissions(ctx, procedure.CheckReadAllPermissionsInput{
+		Platform: platform,
+		Locator:  streamLocator,
+		Wallet:   wallet.Address(),
+		Height:   height,
+	})
+	if err != nil {
+		return false, false
+	}
+
+	err = setup.InsertMarkdownPrimitiveData(ctx, setup.InsertMarkdownDataInput{
+		Platform:      procedure.WithSigner(platform, wallet.Bytes()),
+		Height:        height,
+		StreamLocator: streamLocator,
+		MarkdownData: `
+		| event_time | value |
+		|------------|-------|
+		| 2          | 20    |
+		`,
+	})
+	return canRead, err == nil
+}
+
+func testAccessGroupPermissions(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		streamLocator, err := setupAccessGroupStream(ctx, platform)
+		if err != nil {
+			return err
+		}
+		platform = procedure.WithSigner(platform, accessGroupOwner.Bytes())
+
+		canRead, canWrite := canReadAndWrite(ctx, platform, streamLocator, accessGroupMember, 2)
+		assert.True(t, canRead, "Group member should be able to read the private stream")
+		assert.True(t, canWrite, "Group member should be able to write to the stream")
+
+		canRead, canWrite = canReadAndWrite(ctx, platform, streamLocator, accessGroupOutsider, 2)
+		assert.False(t, canRead, "Wallet outside of the group should not be able to read the private stream")
+		assert.False(t, canWrite, "Wallet outside of the group should not be able to write to the stream")
+
+		// a single membership change applies to every stream referencing the group
+		err = procedure.RemoveAccessGroupMembers(ctx, procedure.AccessGroupMembersInput{
+			Platform: platform,
+			GroupId:  "analysts",
+			Wallets:  []string{accessGroupMember.Address()},
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to remove access group member")
+		}
+
+		canRead, canWrite = canReadAndWrite(ctx, platform, streamLocator, accessGroupMember, 4)
+		assert.False(t, canRead, "Removed member should not be able to read the private stream")
+		assert.False(t, canWrite, "Removed member should not be able to write to the stream")
+
+		return nil
+	}
+}
+
+func testAccessGroupManagement(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		streamLocator, err := setupAccessGroupStream(ctx, platform)
+		if err != nil {
+			return err
+		}
+		platform = procedure.WithSigner(platform, accessGroupOwner.Bytes())
+
+		err = procedure.CreateAccessGroup(ctx, procedure.AccessGroupInput{
+			Platform: procedure.WithSigner(platform, accessGroupOutsider.Bytes()),
+			GroupId:  "analysts",
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, "Access group already exists")
+
+		err = procedure.AddAccessGroupMembers(ctx, procedure.AccessGroupMembersInput{
+			Platform: procedure.WithSigner(platform, accessGroupOutsider.Bytes()),
+			GroupId:  "analysts",
+			Wallets:  []string{accessGroupOutsider.Address()},
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, "Only the group owner can add members")
+
+		// adding a member twice keeps a single membership
+		err = procedure.AddAccessGroupMembers(ctx, procedure.AccessGroupMembersInput{
+			Platform: platform,
+			GroupId:  "analysts",
+			Wallets:  []string{accessGroupMember.Address(), accessGroupOutsider.Address()},
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to add access group members")
+		}
+
+		members, err := procedure.GetAccessGroupMembers(ctx, procedure.AccessGroupInput{
+			Platform: platform,
+			GroupId:  "analysts",
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get access group members")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{accessGroupMember.Address(), "1"},
+			{accessGroupOutsider.Address(), "2"},
+		}, members)
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			Key:      "allow_read_group",
+			Value:    "unknown_group",
+			ValType:  "string",
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, "Access group does not exist: unknown_group")
+
+		// a stream can only reference the groups of its owner, whose members the owner controls
+		err = procedure.CreateAccessGroup(ctx, procedure.AccessGroupInput{
+			Platform: procedure.WithSigner(platform, accessGroupOutsider.Bytes()),
+			GroupId:  "outsiders",
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create the access group of the outsider")
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			Key:      "allow_write_group",
+			Value:    "outsiders",
+			ValType:  "string",
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, "Only the group owner can grant access through the access group: outsiders")
+
+		// deleting the group revokes the access of its members
+		err = procedure.DeleteAccessGroup(ctx, procedure.AccessGroupInput{
+			Platform: platform,
+			GroupId:  "analysts",
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to delete access group")
+		}
+
+		canRead, canWrite := canReadAndWrite(ctx, platform, streamLocator, accessGroupMember, 4)
+		assert.False(t, canRead, "Members of a deleted group should not be able to read the private stream")
+		assert.False(t, canWrite, "Members of a deleted group should not be able to write to the stream")
+
+		// a group created with the same group_id doesn't inherit the grants of the deleted one
+		outsiderPlatform := procedure.WithSigner(platform, accessGroupOutsider.Bytes())
+		err = procedure.CreateAccessGroup(ctx, procedure.AccessGroupInput{
+			Platform: outsiderPlatform,
+			GroupId:  "analysts",
+			Height:   5,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create the access group again")
+		}
+
+		err = procedure.AddAccessGroupMembers(ctx, procedure.AccessGroupMembersInput{
+			Platform: outsiderPlatform,
+			GroupId:  "analysts",
+			Wallets:  []string{accessGroupOutsider.Address()},
+			Height:   5,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to add a member to the access group created again")
+		}
+
+		canRead, canWrite = canReadAndWrite(ctx, platform, streamLocator, accessGroupOutsider, 6)
+		assert.False(t, canRead, "Members of a group created again should not be able to read the private stream")
+		assert.False(t, canWrite, "Members of a group created again should not be able to write to the stream")
+
+		return nil
+	}
+}
+
+// TestAUTH10_TimeLimitedGrants tests that read and write grants stop applying at their expiry height.
+func TestAUTH10_TimeLimitedGrants(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "time_limited_grants_AUTH10",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testTimeLimitedGrants(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+func testTimeLimitedGrants(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		owner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000001")
+		partner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000002")
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("time_limited_grant_test"),
+			DataProvider: owner,
+		}
+		platform = procedure.WithSigner(platform, owner.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: streamLocator.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to setup primitive stream")
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			Key:      "read_visibility",
+			Value:    "1",
+			ValType:  "int",
+			Height:   1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to make the stream private")
+		}
+
+		for _, key := range []string{"allow_read_wallet", "allow_write_wallet"} {
+			err = procedure.GrantStreamAccess(ctx, procedure.GrantStreamAccessInput{
+				Platform:  platform,
+				Locator:   streamLocator,
+				Key:       key,
+				Grantee:   partner.Address(),
+				ExpiresAt: 10,
+				Height:    1,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to grant %s", key)
+			}
+		}
+
+		canRead, canWrite := canReadAndWrite(ctx, platform, streamLocator, partner, 5)
+		assert.True(t, canRead, "Partner should read the stream before the grant expires")
+		assert.True(t, canWrite, "Partner should write to the stream before the grant expires")
+
+		expiring, err := procedure.GetExpiringGrants(ctx, procedure.GetExpiringGrantsInput{
+			Platform:     platform,
+			DataProvider: owner.Address(),
+			WithinBlocks: 5,
+			Height:       5,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get expiring grants")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{streamLocator.StreamId.String(), "allow_read_wallet", partner.Address(), "10"},
+			{streamLocator.StreamId.String(), "allow_write_wallet", partner.Address(), "10"},
+		}, expiring, "Grants expiring within 5 blocks should be listed")
+
+		expiring, err = procedure.GetExpiringGrants(ctx, procedure.GetExpiringGrantsInput{
+			Platform:     platform,
+			DataProvider: owner.Address(),
+			WithinBlocks: 4,
+			Height:       5,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get expiring grants")
+		}
+		assert.Empty(t, expiring, "Grants expiring later should not be listed")
+
+		canRead, canWrite = canReadAndWrite(ctx, platform, streamLocator, partner, 10)
+		assert.False(t, canRead, "Partner should not read the stream once the grant expired")
+		assert.False(t, canWrite, "Partner should not write to the stream once the grant expired")
+
+		err = procedure.GrantStreamAccess(ctx, procedure.GrantStreamAccessInput{
+			Platform:  platform,
+			Locator:   streamLocator,
+			Key:       "allow_read_wallet",
+			Grantee:   partner.Address(),
+			ExpiresAt: 10,
+			Height:    10,
+		})
+		assert.ErrorContains(t, err, "expires_at must be a block height in the future")
+
+		err = procedure.GrantStreamAccess(ctx, procedure.GrantStreamAccessInput{
+			Platform:  platform,
+			Locator:   streamLocator,
+			Key:       "stream_owner",
+			Grantee:   partner.Address(),
+			ExpiresAt: 20,
+			Height:    10,
+		})
+		assert.ErrorContains(t, err, `Unknown grant key "stream_owner"`)
+
+		return nil
+	}
+}
+
+// TestAUTH11_CrossProviderCompose tests that a stream can be composed by another data provider's stream once its owner whitelists the parent locator.
+func TestAUTH11_CrossProviderCompose(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "cross_provider_compose_AUTH11",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testCrossProviderCompose(t),
+			testLegacyComposeWhitelist(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+func testCrossProviderCompose(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		parentOwner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000005555")
+		childOwner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000006666")
+		otherProvider := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000007777")
+
+		parentLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("cross_provider_parent"),
+			DataProvider: parentOwner,
+		}
+		childLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("cross_provider_child"),
+			DataProvider: childOwner,
+		}
+
+		parentPlatform := procedure.WithSigner(platform, parentOwner.Bytes())
+		childPlatform := procedure.WithSigner(platform, childOwner.Bytes())
+
+		if err := setup.CreateStream(ctx, parentPlatform, setup.StreamInfo{Locator: parentLocator, Type: setup.ContractTypeComposed}); err != nil {
+			return errors.Wrap(err, "failed to create parent")
+		}
+		if err := setup.CreateStream(ctx, childPlatform, setup.StreamInfo{Locator: childLocator, Type: setup.ContractTypePrimitive}); err != nil {
+			return errors.Wrap(err, "failed to create child")
+		}
+		if err := procedure.SetTaxonomy(ctx, procedure.SetTaxonomyInput{
+			Platform:      parentPlatform,
+			StreamLocator: parentLocator,
+			DataProviders: []string{childLocator.DataProvider.Address()},
+			StreamIds:     []string{childLocator.StreamId.String()},
+			Weights:       []string{"1.0"},
+			Height:        1,
+		}); err != nil {
+			return errors.Wrap(err, "failed to set taxonomy")
+		}
+
+		if err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: childPlatform,
+			Locator:  childLocator,
+			Key:      "compose_visibility",
+			Value:    "1",
+			ValType:  "int",
+			Height:   1,
+		}); err != nil {
+			return errors.Wrap(err, "failed to set compose_visibility on child")
+		}
+
+		checkCompose := func(height int64) (bool, bool, error) {
+			canCompose, err := procedure.CheckComposePermissions(ctx, procedure.CheckComposePermissionsInput{
+				Platform:         parentPlatform,
+				Locator:          childLocator,
+				ComposingLocator: parentLocator,
+				Height:           height,
+			})
+			if err != nil {
+				return false, false, errors.Wrap(err, "failed to check compose permissions")
+			}
+			canComposeAll, err := procedure.CheckComposeAllPermissions(ctx, procedure.CheckComposeAllPermissionsInput{
+				Platform: parentPlatform,
+				Locator:  parentLocator,
+				Height:   height,
+			})
+			if err != nil {
+				return false, false, errors.Wrap(err, "failed to check nested compose permissions")
+			}
+			return canCompose, canComposeAll, nil
+		}
+
+		canCompose, canComposeAll, err := checkCompose(1)
+		if err != nil {
+			return err
+		}
+		assert.False(t, canCompose, "Parent should not compose the private child without consent")
+		assert.False(t, canComposeAll, "Parent should not compose the private child without consent")
+
+		// a whitelist by stream id alone would match the stream id under any data provider
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: childPlatform,
+			Locator:  childLocator,
+			Key:      "allow_compose_stream",
+			Value:    parentLocator.StreamId.String(),
+			ValType:  "ref",
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, "use grant_compose_permission", "allow_compose_stream should need the data provider of the parent")
+
+		// whitelisting the same stream id under another data provider doesn't authorize the parent
+		err = procedure.GrantComposePermission(ctx, procedure.GrantComposePermissionInput{
+			Platform: childPlatform,
+			Locator:  childLocator,
+			ParentLocator: types.StreamLocator{
+				StreamId:     parentLocator.StreamId,
+				DataProvider: otherProvider,
+			},
+			Height: 2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to grant compose permission to the other provider")
+		}
+
+		canCompose, canComposeAll, err = checkCompose(2)
+		if err != nil {
+			return err
+		}
+		assert.False(t, canCompose, "A whitelist for another data provider should not authorize the parent")
+		assert.False(t, canComposeAll, "A whitelist for another data provider should not authorize the parent")
+
+		err = procedure.GrantComposePermission(ctx, procedure.GrantComposePermissionInput{
+			Platform:      parentPlatform,
+			Locator:       childLocator,
+			ParentLocator: parentLocator,
+			Height:        3,
+		})
+		assert.ErrorContains(t, err, "Only stream owner can grant compose permission", "Only the child owner should give consent")
+
+		err = procedure.GrantComposePermission(ctx, procedure.GrantComposePermissionInput{
+			Platform:      childPlatform,
+			Locator:       childLocator,
+			ParentLocator: parentLocator,
+			Height:        3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to grant compose permission to the parent")
+		}
+
+		canCompose, canComposeAll, err = checkCompose(3)
+		if err != nil {
+			return err
+		}
+		assert.True(t, canCompose, "Parent should compose the child once its locator is whitelisted")
+		assert.True(t, canComposeAll, "Parent should compose the child once its locator is whitelisted")
+
+		return nil
+	}
+}
+
+// testLegacyComposeWhitelist checks that allow_compose_stream rows holding only the stream id,
+// written before grant_compose_permission, keep authorizing their parent after
+// 026-compose-whitelist-locators.sql fills in the data provider.
+func testLegacyComposeWhitelist(t *testing.T) kwilTesting.TestFunc {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		owner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000008888")
+		parentLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("legacy_whitelist_parent"),
+			DataProvider: owner,
+		}
+		childLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("legacy_whitelist_child"),
+			DataProvider: owner,
+		}
+
+		ownerPlatform := procedure.WithSigner(platform, owner.Bytes())
+		if err := setup.CreateStream(ctx, ownerPlatform, setup.StreamInfo{Locator: parentLocator, Type: setup.ContractTypeComposed}); err != nil {
+			return errors.Wrap(err, "failed to create parent")
+		}
+		if err := setup.CreateStream(ctx, ownerPlatform, setup.StreamInfo{Locator: childLocator, Type: setup.ContractTypePrimitive}); err != nil {
+			return errors.Wrap(err, "failed to create child")
+		}
+		if err := procedure.SetTaxonomy(ctx, procedure.SetTaxonomyInput{
+			Platform:      ownerPlatform,
+			StreamLocator: parentLocator,
+			DataProviders: []string{childLocator.DataProvider.Address()},
+			StreamIds:     []string{childLocator.StreamId.String()},
+			Weights:       []string{"1.0"},
+			Height:        1,
+		}); err != nil {
+			return errors.Wrap(err, "failed to set taxonomy")
+		}
+		if err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: ownerPlatform,
+			Locator:  childLocator,
+			Key:      "compose_visibility",
+			Value:    "1",
+			ValType:  "int",
+			Height:   1,
+		}); err != nil {
+			return errors.Wrap(err, "failed to set compose_visibility on child")
+		}
+
+		execute := func(statement string, params map[string]any) error {
+			return platform.Engine.Execute(&common.EngineContext{
+				TxContext: &common.TxContext{
+					Ctx:          ctx,
+					BlockContext: &common.BlockContext{Height: 2},
+					TxID:         platform.Txid(),
+					Signer:       platform.Deployer,
+				},
+				OverrideAuthz: true,
+			}, platform.DB, statement, params, nil)
+		}
+
+		// the row as insert_metadata wrote it before grant_compose_permission existed
+		err := execute(`INSERT INTO metadata (row_id, data_provider, stream_id, metadata_key, value_ref, created_at)
+			VALUES (uuid_generate_kwil('legacy_allow_compose_stream'), $data_provider, $stream_id, 'allow_compose_stream', $parent_stream_id, 1)`,
+			map[string]any{
+				"data_provider":    childLocator.DataProvider.Address(),
+				"stream_id":        childLocator.StreamId.String(),
+				"parent_stream_id": parentLocator.StreamId.String(),
+			})
+		if err != nil {
+			return errors.Wrap(err, "failed to insert the legacy whitelist row")
+		}
+
+		production, err := migrations.GetMigrationSet(migrations.SetProduction)
+		if err != nil {
+			return errors.Wrap(err, "failed to read the production migrations")
+		}
+		applied := false
+		for _, migration := range production {
+			if migration.Name == "026-compose-whitelist-locators.sql" {
+				if err := execute(migration.Content, nil); err != nil {
+					return errors.Wrap(err, "failed to apply 026-compose-whitelist-locators.sql")
+				}
+				applied = true
+			}
+		}
+		if !applied {
+			return errors.New("026-compose-whitelist-locators.sql not found")
+		}
+
+		canComposeAll, err := procedure.CheckComposeAllPermissions(ctx, procedure.CheckComposeAllPermissionsInput{
+			Platform: ownerPlatform,
+			Locator:  parentLocator,
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to check nested compose permissions")
+		}
+		assert.True(t, canComposeAll, "A legacy whitelist row should keep authorizing its parent after the migration")
+
+		return nil
+	}
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+// [OTHER05] Mutating actions are recorded in the audit log.
+// TestAuditLog tests that get_audit_log lists who did what on a stream, filtered and paginated
+func TestAuditLog(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "audit_log_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testAuditLog(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+func testAuditLog(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		owner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000901")
+		newOwner := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000902")
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("audit_log_test"),
+			DataProvider: owner,
+		}
+		platform = procedure.WithSigner(platform, owner.Bytes())
+
+		if err := setup.CreateStream(ctx, platform, setup.StreamInfo{Locator: streamLocator, Type: setup.ContractTypePrimitive}); err != nil {
+			return errors.Wrap(err, "failed to create stream")
+		}
+
+		if err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			Key:      "default_base_time",
+			Value:    "1",
+			ValType:  "int",
+			Height:   1,
+		}); err != nil {
+			return errors.Wrap(err, "failed to insert metadata")
+		}
+
+		if err := setup.InsertPrimitiveDataBatch(ctx, setup.InsertPrimitiveDataInput{
+			Platform: platform,
+			PrimitiveStream: setup.PrimitiveStreamWithData{
+				PrimitiveStreamDefinition: setup.PrimitiveStreamDefinition{
+					StreamLocator: streamLocator,
+				},
+				Data: []setup.InsertRecordInput{
+					{EventTime: 1, Value: 10},
+					{EventTime: 3, Value: 30},
+				},
+			},
+			Height: 2,
+		}); err != nil {
+			return errors.Wrap(err, "failed to insert records")
+		}
+
+		if err := procedure.ProposeStreamOwnership(ctx, procedure.ProposeStreamOwnershipInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			NewOwner: newOwner.Address(),
+			Height:   3,
+		}); err != nil {
+			return errors.Wrap(err, "failed to propose ownership")
+		}
+
+		dataProvider := owner.Address()
+		streamId := streamLocator.StreamId.String()
+		entry := func(height, action, payload string) procedure.ResultRow {
+			return procedure.ResultRow{height, "0", owner.Address(), action, dataProvider, streamId, payload}
+		}
+
+		entries, err := procedure.GetAuditLog(ctx, procedure.GetAuditLogInput{
+			Platform:     platform,
+			DataProvider: &dataProvider,
+			StreamId:     &streamId,
+			Height:       3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get audit log")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			entry("3", "propose_stream_ownership", "proposed_owner="+newOwner.Address()+" expires_at=100803"),
+			entry("2", "insert_records", "records=2 event_time=1..3"),
+			entry("1", "insert_metadata", "key=default_base_time type=int value=1"),
+			entry("0", "create_stream", "stream_type=primitive"),
+		}, entries, "Every mutation of the stream should be logged, newest first")
+
+		action := "insert_metadata"
+		entries, err = procedure.GetAuditLog(ctx, procedure.GetAuditLogInput{
+			Platform: platform,
+			StreamId: &streamId,
+			Action:   &action,
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get audit log by action")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			entry("1", "insert_metadata", "key=default_base_time type=int value=1"),
+		}, entries, "Entries should be filtered by action")
+
+		caller := newOwner.Address()
+		entries, err = procedure.GetAuditLog(ctx, procedure.GetAuditLogInput{
+			Platform: platform,
+			Caller:   &caller,
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get audit log by caller")
+		}
+		assert.Empty(t, entries, "Entries should be filtered by caller")
+
+		limit := 1
+		offset := 1
+		entries, err = procedure.GetAuditLog(ctx, procedure.GetAuditLogInput{
+			Platform: platform,
+			StreamId: &streamId,
+			Limit:    &limit,
+			Offset:   &offset,
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get audit log page")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			entry("2", "insert_records", "records=2 event_time=1..3"),
+		}, entries, "Entries should be paginated")
+
+		// an embargoed batch is logged once, under its own action
+		if err := procedure.InsertEmbargoedRecords(ctx, procedure.InsertEmbargoedRecordsInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			EventTimes:    []int64{4, 5},
+			Values:        []string{"40", "50"},
+			VisibleFrom:   10,
+			Height:        4,
+		}); err != nil {
+			return errors.Wrap(err, "failed to insert embargoed records")
+		}
+
+		entries, err = procedure.GetAuditLog(ctx, procedure.GetAuditLogInput{
+			Platform:     platform,
+			DataProvider: &dataProvider,
+			StreamId:     &streamId,
+			Limit:        &limit,
+			Height:       4,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get audit log after the embargoed insert")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			entry("4", "insert_embargoed_records", "records=2 event_time=4..5 visible_from=10"),
+		}, entries, "An embargoed batch should be logged once")
+
+		action = "insert_records"
+		entries, err = procedure.GetAuditLog(ctx, procedure.GetAuditLogInput{
+			Platform: platform,
+			StreamId: &streamId,
+			Action:   &action,
+			Height:   4,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get audit log of insert_records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			entry("2", "insert_records", "records=2 event_time=1..3"),
+		}, entries, "An embargoed batch should not be logged as insert_records")
+
+		// a grant is logged once, not along with the metadata row it inserts
+		if err := procedure.GrantStreamAccess(ctx, procedure.GrantStreamAccessInput{
+			Platform:  platform,
+			Locator:   streamLocator,
+			Key:       "allow_read_wallet",
+			Grantee:   newOwner.Address(),
+			ExpiresAt: 20,
+			Height:    5,
+		}); err != nil {
+			return errors.Wrap(err, "failed to grant stream access")
+		}
+
+		limit = 2
+		entries, err = procedure.GetAuditLog(ctx, procedure.GetAuditLogInput{
+			Platform:     platform,
+			DataProvider: &dataProvider,
+			StreamId:     &streamId,
+			Limit:        &limit,
+			Height:       5,
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get audit log after the grant")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			entry("5", "grant_stream_access", "key=allow_read_wallet grantee="+newOwner.Address()+" expires_at=20"),
+			entry("4", "insert_embargoed_records", "records=2 event_time=4..5 visible_from=10"),
+		}, entries, "A grant should be logged once")
+
+		return nil
+	}
+}
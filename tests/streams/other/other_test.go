@@ -43,6 +43,7 @@ func TestStreamIDValidation(t *testing.T) {
 		Name: "stream_id_validation_test",
 		SeedScripts: []string{
 			"../../../internal/migrations/000-initial-data.sql",
+			"../../../internal/migrations/000a-schema-additions.sql",
 			"../../../internal/migrations/001-common-actions.sql",
 		},
 		FunctionTests: []kwilTesting.TestFunc{
@@ -59,6 +60,7 @@ func TestAnyUserCanCreateStream(t *testing.T) {
 		Name: "any_user_can_create_stream_test",
 		SeedScripts: []string{
 			"../../../internal/migrations/000-initial-data.sql",
+			"../../../internal/migrations/000a-schema-additions.sql",
 			"../../../internal/migrations/001-common-actions.sql",
 		},
 		FunctionTests: []kwilTesting.TestFunc{
@@ -232,6 +234,7 @@ func TestMultipleStreamCreation(t *testing.T) {
 		Name: "multiple_stream_creation_test",
 		SeedScripts: []string{
 			"../../../internal/migrations/000-initial-data.sql",
+			"../../../internal/migrations/000a-schema-additions.sql",
 			"../../../internal/migrations/001-common-actions.sql",
 		},
 		FunctionTests: []kwilTesting.TestFunc{
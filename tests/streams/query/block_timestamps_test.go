@@ -0,0 +1,287 @@
+/*
+BLOCK TIMESTAMPS TEST SUITE
+
+- [QUERY17] Authorized users can query the data as published at a wall-clock time (TestBlockTimestamps)
+
+The heights of the blocks that write records are mapped to their timestamps. Checked for:
+
+- get_height_at_time resolves times to heights, get_time_at_height heights to the last write
+- embargoed records released between two mapped heights are published at the estimated height
+- get_record_at_frozen_time and get_index_at_frozen_time return the data as published at a time
+- records written before the first mapped height are still part of the data
+- a time before the first mapped height is rejected
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+const (
+	march1st2024  = int64(1709251200) // height 2
+	march2nd2024  = int64(1709337600) // height 3
+	secondsPerDay = int64(86400)
+)
+
+var (
+	blockTimestampsDataProvider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000001401")
+	blockTimestampsReader       = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000001402")
+	blockTimestampsStream       = types.StreamLocator{StreamId: util.GenerateStreamId("block_timestamps"), DataProvider: blockTimestampsDataProvider}
+)
+
+func TestBlockTimestamps(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "block_timestamps_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithBlockTimestampsTestSetup(testHeightTimeMapping(t)),
+			WithBlockTimestampsTestSetup(testQueriesAtFrozenTime(t)),
+			WithBlockTimestampsTestSetup(testFrozenTimeBeforeMapping(t)),
+			WithBlockTimestampsTestSetup(testFrozenTimeEmbargoRelease(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithBlockTimestampsTestSetup creates a primitive stream at height 1, whose block has no timestamp,
+// then publishes a record on March 1st 2024 (height 2), and a revision and a record on March 2nd 2024 (height 3)
+func WithBlockTimestampsTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, blockTimestampsDataProvider.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: blockTimestampsStream.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		publications := []struct {
+			height    int64
+			timestamp int64
+			data      []setup.InsertRecordInput
+		}{
+			{2, march1st2024, []setup.InsertRecordInput{{EventTime: 2, Value: 20}}},
+			{3, march2nd2024, []setup.InsertRecordInput{{EventTime: 2, Value: 25}, {EventTime: 3, Value: 30}}},
+		}
+		for _, publication := range publications {
+			err = setup.InsertPrimitiveDataBatch(ctx, setup.InsertPrimitiveDataInput{
+				Platform: platform,
+				PrimitiveStream: setup.PrimitiveStreamWithData{
+					PrimitiveStreamDefinition: setup.PrimitiveStreamDefinition{
+						StreamLocator: blockTimestampsStream,
+					},
+					Data: publication.data,
+				},
+				Height:         publication.height,
+				BlockTimestamp: publication.timestamp,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "error publishing records at height %d", publication.height)
+			}
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+func testHeightTimeMapping(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		heightsByTime := map[int64]string{
+			march1st2024:         "2",
+			march1st2024 + 43200: "2", // noon of March 1st, half-way to height 3
+			march2nd2024:         "3",
+			march2nd2024 + 86400: "3", // no later mapped height nor block timestamp to estimate from
+		}
+		for timestamp, expected := range heightsByTime {
+			result, err := procedure.GetHeightAtTime(ctx, platform, timestamp, 3)
+			if err != nil {
+				return errors.Wrapf(err, "error getting height at %d", timestamp)
+			}
+			assert.Equal(t, []procedure.ResultRow{{expected}}, result, "height at %d", timestamp)
+		}
+
+		timesByHeight := map[int64]string{
+			2:  "1709251200",
+			3:  "1709337600",
+			10: "1709337600", // the last write at or before height 10 is at height 3
+		}
+		for blockHeight, expected := range timesByHeight {
+			result, err := procedure.GetTimeAtHeight(ctx, platform, blockHeight, 3)
+			if err != nil {
+				return errors.Wrapf(err, "error getting time at height %d", blockHeight)
+			}
+			assert.Equal(t, []procedure.ResultRow{{expected}}, result, "time at height %d", blockHeight)
+		}
+
+		return nil
+	}
+}
+
+func testQueriesAtFrozenTime(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		fromTime := int64(1)
+		toTime := int64(3)
+		frozenAtTime := march1st2024 + 43200
+
+		result, err := procedure.GetRecordAtFrozenTime(ctx, procedure.GetAtFrozenTimeInput{
+			Platform:      platform,
+			StreamLocator: blockTimestampsStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			FrozenAtTime:  &frozenAtTime,
+			Height:        3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting records as published on March 1st")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "10.000000000000000000"},
+			{"2", "20.000000000000000000"},
+		}, result, "records as published on March 1st")
+
+		result, err = procedure.GetRecordAtFrozenTime(ctx, procedure.GetAtFrozenTimeInput{
+			Platform:      platform,
+			StreamLocator: blockTimestampsStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting latest records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "10.000000000000000000"},
+			{"2", "25.000000000000000000"},
+			{"3", "30.000000000000000000"},
+		}, result, "without a frozen time, the latest records")
+
+		baseTime := int64(1)
+		result, err = procedure.GetIndexAtFrozenTime(ctx, procedure.GetAtFrozenTimeInput{
+			Platform:      platform,
+			StreamLocator: blockTimestampsStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			FrozenAtTime:  &frozenAtTime,
+			BaseTime:      &baseTime,
+			Height:        3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting index as published on March 1st")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "100.000000000000000000"},
+			{"2", "200.000000000000000000"},
+		}, result, "index as published on March 1st")
+
+		return nil
+	}
+}
+
+func testFrozenTimeBeforeMapping(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		fromTime := int64(1)
+		toTime := int64(3)
+		frozenAtTime := march1st2024 - 1
+		_, err := procedure.GetRecordAtFrozenTime(ctx, procedure.GetAtFrozenTimeInput{
+			Platform:      platform,
+			StreamLocator: blockTimestampsStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			FrozenAtTime:  &frozenAtTime,
+			Height:        3,
+		})
+		assert.ErrorContains(t, err, "no block height recorded at or before time")
+
+		return nil
+	}
+}
+
+func testFrozenTimeEmbargoRelease(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// embargoed on March 3rd (height 4) until height 6, which no write maps
+		march3rd2024 := march2nd2024 + secondsPerDay
+		err := procedure.InsertEmbargoedRecords(ctx, procedure.InsertEmbargoedRecordsInput{
+			Platform:       platform,
+			StreamLocator:  blockTimestampsStream,
+			EventTimes:     []int64{4},
+			Values:         []string{"40"},
+			VisibleFrom:    6,
+			Height:         4,
+			BlockTimestamp: march3rd2024,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting embargoed records")
+		}
+
+		// the next write, on March 7th (height 8), puts a block every day in between
+		err = setup.InsertPrimitiveDataBatch(ctx, setup.InsertPrimitiveDataInput{
+			Platform: platform,
+			PrimitiveStream: setup.PrimitiveStreamWithData{
+				PrimitiveStreamDefinition: setup.PrimitiveStreamDefinition{
+					StreamLocator: blockTimestampsStream,
+				},
+				Data: []setup.InsertRecordInput{{EventTime: 5, Value: 50}},
+			},
+			Height:         8,
+			BlockTimestamp: march3rd2024 + 4*secondsPerDay,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error publishing records at height 8")
+		}
+
+		reader := procedure.WithSigner(platform, blockTimestampsReader.Bytes())
+		fromTime := int64(1)
+		toTime := int64(5)
+		expectedByTime := map[int64][]procedure.ResultRow{
+			// height 5, still embargoed
+			march3rd2024 + secondsPerDay + 43200: {
+				{"1", "10.000000000000000000"},
+				{"2", "25.000000000000000000"},
+				{"3", "30.000000000000000000"},
+			},
+			// height 6, released, while the write of height 8 is still ahead
+			march3rd2024 + 2*secondsPerDay + 43200: {
+				{"1", "10.000000000000000000"},
+				{"2", "25.000000000000000000"},
+				{"3", "30.000000000000000000"},
+				{"4", "40.000000000000000000"},
+			},
+		}
+		for frozenAtTime, expected := range expectedByTime {
+			result, err := procedure.GetRecordAtFrozenTime(ctx, procedure.GetAtFrozenTimeInput{
+				Platform:      reader,
+				StreamLocator: blockTimestampsStream,
+				FromTime:      &fromTime,
+				ToTime:        &toTime,
+				FrozenAtTime:  &frozenAtTime,
+				Height:        8,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "error getting records as published at %d", frozenAtTime)
+			}
+			assert.Equal(t, expected, result, "records as published at %d", frozenAtTime)
+		}
+
+		return nil
+	}
+}
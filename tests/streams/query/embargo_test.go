@@ -0,0 +1,432 @@
+/*
+EMBARGOED RECORDS TEST SUITE
+
+- [PRIMITIVE06] Embargoed records are hidden from readers until their visible_from height, also in queries frozen before it, while writers can read them ahead (TestEmbargoedRecords)
+
+insert_embargoed_records is checked for:
+
+- get_record hides embargoed records before visible_from, for the primitive and for a composed parent
+- an embargoed revision keeps the previous value visible until the release
+- the latest record skips embargoed records
+- the owner of the stream reads embargoed records ahead
+- members of an access group allowed to write read embargoed records ahead
+- a query frozen before the release doesn't see the records released since
+- without a block height (views called outside of a block), readers still see the records that
+  aren't embargoed, and the embargoed ones once a write mapped a height at or after their release
+*/
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+const embargoPrimitiveStreamName = "primitive_stream_embargo_test"
+const embargoComposedStreamName = "composed_stream_embargo_test"
+const embargoChildStreamName = "primitive_child_stream_embargo_test"
+
+var embargoPrimitiveStreamId = util.GenerateStreamId(embargoPrimitiveStreamName)
+var embargoComposedStreamId = util.GenerateStreamId(embargoComposedStreamName)
+var embargoChildStreamId = util.GenerateStreamId(embargoChildStreamName)
+
+// embargoReader is a wallet without write access to the streams
+var embargoReader = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000abc")
+
+// embargoGroupWriter is allowed to write to the streams through the embargoWritersGroup access group
+var embargoGroupWriter = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000def")
+
+const embargoWritersGroup = "embargo_writers"
+
+const embargoTestData = `
+| event_time | %s |
+|------------|-------|
+| 1          | 10    |
+| 2          | 20    |
+| 3          | 30    |
+`
+
+// embargoRelease is the height from which the embargoed records are readable
+const embargoRelease = int64(10)
+
+func TestEmbargoedRecords(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "embargoed_records_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithEmbargoTestSetup(testEmbargoHiddenUntilRelease(t)),
+			WithEmbargoTestSetup(testEmbargoLatestRecord(t)),
+			WithEmbargoTestSetup(testEmbargoWriterReadsAhead(t)),
+			WithEmbargoTestSetup(testEmbargoGroupWriterReadsAhead(t)),
+			WithEmbargoTestSetup(testEmbargoFrozenBeforeRelease(t)),
+			WithEmbargoTestSetup(testEmbargoWithoutHeight(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithEmbargoTestSetup creates a primitive stream and a single child composed stream with the same data at height 1,
+// then embargoes a revision of event_time 2 and a new record at event_time 4 until embargoRelease
+func WithEmbargoTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000000")
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform:     platform,
+			StreamId:     embargoPrimitiveStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(embargoTestData, "value"),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		err = setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform:     platform,
+			StreamId:     embargoComposedStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(embargoTestData, embargoChildStreamName),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream")
+		}
+
+		for _, streamId := range []util.StreamId{embargoPrimitiveStreamId, embargoChildStreamId} {
+			err = procedure.InsertEmbargoedRecords(ctx, procedure.InsertEmbargoedRecordsInput{
+				Platform: platform,
+				StreamLocator: types.StreamLocator{
+					StreamId:     streamId,
+					DataProvider: deployer,
+				},
+				EventTimes:  []int64{2, 4},
+				Values:      []string{"25", "40"},
+				VisibleFrom: embargoRelease,
+				Height:      2,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error inserting embargoed records")
+			}
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+// runEmbargoTestForAllStreamTypes runs a test function against the primitive and the composed stream
+func runEmbargoTestForAllStreamTypes(t *testing.T, testName string, testFn func(ctx context.Context, platform *kwilTesting.Platform, testConfig TestConfig) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		testConfigs := []TestConfig{
+			{
+				WritableStreamId: embargoPrimitiveStreamId,
+				ReadableStreamId: embargoPrimitiveStreamId,
+				Name:             "Primitive Stream",
+			},
+			{
+				WritableStreamId: embargoChildStreamId,
+				ReadableStreamId: embargoComposedStreamId,
+				Name:             "Composed Stream",
+			},
+		}
+
+		for _, config := range testConfigs {
+			if err := testFn(ctx, platform, config); err != nil {
+				t.Errorf("%s test failed for %s (StreamId: %s): %v", testName, config.Name, config.ReadableStreamId.String(), err)
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// getEmbargoRecords reads the stream as the given wallet at the given height
+func getEmbargoRecords(ctx context.Context, platform *kwilTesting.Platform, config TestConfig, reader util.EthereumAddress, from, to *int64, height int64) ([]procedure.ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ethereum address")
+	}
+
+	return procedure.GetRecord(ctx, procedure.GetRecordInput{
+		Platform: procedure.WithSigner(platform, reader.Bytes()),
+		StreamLocator: types.StreamLocator{
+			StreamId:     config.ReadableStreamId,
+			DataProvider: deployer,
+		},
+		FromTime: from,
+		ToTime:   to,
+		Height:   height,
+	})
+}
+
+func testEmbargoHiddenUntilRelease(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runEmbargoTestForAllStreamTypes(t, "EmbargoHiddenUntilRelease", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		fromTime := int64(1)
+		toTime := int64(4)
+
+		// before the release, the revision of event_time 2 and the new record are hidden
+		result, err := getEmbargoRecords(ctx, platform, config, embargoReader, &fromTime, &toTime, embargoRelease-1)
+		if err != nil {
+			return errors.Wrap(err, "error getting records before the release")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 20.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		result, err = getEmbargoRecords(ctx, platform, config, embargoReader, &fromTime, &toTime, embargoRelease)
+		if err != nil {
+			return errors.Wrap(err, "error getting records at the release")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 25.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		| 4          | 40.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testEmbargoLatestRecord(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runEmbargoTestForAllStreamTypes(t, "EmbargoLatestRecord", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		// without range, the latest record is the last one released
+		result, err := getEmbargoRecords(ctx, platform, config, embargoReader, nil, nil, embargoRelease-1)
+		if err != nil {
+			return errors.Wrap(err, "error getting latest record before the release")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 3          | 30.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		result, err = getEmbargoRecords(ctx, platform, config, embargoReader, nil, nil, embargoRelease)
+		if err != nil {
+			return errors.Wrap(err, "error getting latest record at the release")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 4          | 40.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testEmbargoWriterReadsAhead(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runEmbargoTestForAllStreamTypes(t, "EmbargoWriterReadsAhead", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		owner, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(4)
+		result, err := getEmbargoRecords(ctx, platform, config, owner, &fromTime, &toTime, embargoRelease-1)
+		if err != nil {
+			return errors.Wrap(err, "error getting records as the owner")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 25.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		| 4          | 40.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testEmbargoGroupWriterReadsAhead(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	readAhead := runEmbargoTestForAllStreamTypes(t, "EmbargoGroupWriterReadsAhead", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator: types.StreamLocator{
+				StreamId:     config.WritableStreamId,
+				DataProvider: deployer,
+			},
+			Key:     "allow_write_group",
+			Value:   embargoWritersGroup,
+			ValType: "string",
+			Height:  2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error allowing the access group to write")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(4)
+		result, err := getEmbargoRecords(ctx, platform, config, embargoGroupWriter, &fromTime, &toTime, embargoRelease-1)
+		if err != nil {
+			return errors.Wrap(err, "error getting records as a group writer")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 25.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		| 4          | 40.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := procedure.CreateAccessGroup(ctx, procedure.AccessGroupInput{
+			Platform: platform,
+			GroupId:  embargoWritersGroup,
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error creating access group")
+		}
+
+		err = procedure.AddAccessGroupMembers(ctx, procedure.AccessGroupMembersInput{
+			Platform: platform,
+			GroupId:  embargoWritersGroup,
+			Wallets:  []string{embargoGroupWriter.Address()},
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error adding access group member")
+		}
+
+		return readAhead(ctx, platform)
+	}
+}
+
+func testEmbargoFrozenBeforeRelease(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runEmbargoTestForAllStreamTypes(t, "EmbargoFrozenBeforeRelease", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		// after the release, a query frozen before it still sees the records as they were published then
+		fromTime := int64(1)
+		toTime := int64(4)
+		frozenAt := embargoRelease - 1
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform: procedure.WithSigner(platform, embargoReader.Bytes()),
+			StreamLocator: types.StreamLocator{
+				StreamId:     config.ReadableStreamId,
+				DataProvider: deployer,
+			},
+			FromTime: &fromTime,
+			ToTime:   &toTime,
+			FrozenAt: &frozenAt,
+			Height:   embargoRelease + 5,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting frozen records after the release")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 20.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testEmbargoWithoutHeight(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		fromTime := int64(1)
+		toTime := int64(4)
+
+		// no height has been mapped yet, only the records that were never embargoed are readable
+		err := runEmbargoTestForAllStreamTypes(t, "EmbargoWithoutHeight", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+			result, err := getEmbargoRecords(ctx, platform, config, embargoReader, &fromTime, &toTime, -1)
+			if err != nil {
+				return errors.Wrap(err, "error getting records without height")
+			}
+
+			expected := `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10.000000000000000000 |
+			| 2          | 20.000000000000000000 |
+			| 3          | 30.000000000000000000 |
+			`
+			return validateTableResult(t, result, expected, config)
+		})(ctx, platform)
+		if err != nil {
+			return err
+		}
+
+		// a write at the release height maps it, so the records released by then are readable
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		err = procedure.InsertEmbargoedRecords(ctx, procedure.InsertEmbargoedRecordsInput{
+			Platform: platform,
+			StreamLocator: types.StreamLocator{
+				StreamId:     embargoPrimitiveStreamId,
+				DataProvider: deployer,
+			},
+			EventTimes:     []int64{5},
+			Values:         []string{"50"},
+			VisibleFrom:    embargoRelease + 100,
+			Height:         embargoRelease,
+			BlockTimestamp: 1700000000,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting records at the release height")
+		}
+
+		return runEmbargoTestForAllStreamTypes(t, "EmbargoWithoutHeightAfterRelease", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+			result, err := getEmbargoRecords(ctx, platform, config, embargoReader, &fromTime, &toTime, -1)
+			if err != nil {
+				return errors.Wrap(err, "error getting records without height after the release")
+			}
+
+			expected := `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10.000000000000000000 |
+			| 2          | 25.000000000000000000 |
+			| 3          | 30.000000000000000000 |
+			| 4          | 40.000000000000000000 |
+			`
+			return validateTableResult(t, result, expected, config)
+		})(ctx, platform)
+	}
+}
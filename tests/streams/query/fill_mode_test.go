@@ -0,0 +1,366 @@
+/*
+FILL MODE TEST SUITE
+
+- [QUERY15] Authorized users can choose how gaps between records are filled: LOCF, linear interpolation or none (TestFillMode)
+
+get_record_filled and get_index_filled are checked for:
+
+- the point returned at $from of a primitive stream with each fill mode
+- composed streams filling each primitive before aggregating them, interpolating towards records after $to
+- composed weighted means of values whose sum overflows NUMERIC(36,18)
+- get_record following the fill_mode metadata of the stream
+- the index of a filled series, divided by the base value filled with the same mode
+- explain_composed_record following the fill_mode metadata of the composed stream
+- invalid fill modes are rejected
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+var (
+	fillModeDataProvider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000001201")
+	fillModeComposed     = types.StreamLocator{StreamId: util.GenerateStreamId("fill_mode_composed"), DataProvider: fillModeDataProvider}
+	fillModePrimitiveA   = types.StreamLocator{StreamId: util.GenerateStreamId("fill_mode_a"), DataProvider: fillModeDataProvider}
+	fillModePrimitiveB   = types.StreamLocator{StreamId: util.GenerateStreamId("fill_mode_b"), DataProvider: fillModeDataProvider}
+)
+
+func TestFillMode(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "fill_mode_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithFillModeTestSetup(testFillModePrimitive(t)),
+			WithFillModeTestSetup(testFillModeComposed(t)),
+			WithFillModeTestSetup(testFillModeComposedLargeValues(t)),
+			WithFillModeTestSetup(testFillModeMetadata(t)),
+			WithFillModeTestSetup(testFillModeIndex(t)),
+			WithFillModeTestSetup(testFillModeExplain(t)),
+			WithFillModeTestSetup(testFillModeInvalid(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithFillModeTestSetup creates a composed stream averaging two primitives whose records alternate
+func WithFillModeTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, fillModeDataProvider.Bytes())
+
+		err := setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform: platform,
+			StreamId: fillModeComposed.StreamId,
+			MarkdownData: `
+			| event_time | fill_mode_a | fill_mode_b |
+			|------------|-------------|-------------|
+			| 1          | 10          |             |
+			| 2          |             | 20          |
+			| 4          |             | 40          |
+			| 5          | 50          |             |
+			`,
+			Height: 1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+func getRecordFilled(ctx context.Context, platform *kwilTesting.Platform, locator types.StreamLocator, fromTime, toTime int64, fillMode string) ([]procedure.ResultRow, error) {
+	return procedure.GetRecordFilled(ctx, procedure.GetRecordFilledInput{
+		Platform:      platform,
+		StreamLocator: locator,
+		FromTime:      &fromTime,
+		ToTime:        &toTime,
+		FillMode:      &fillMode,
+		Height:        1,
+	})
+}
+
+func testFillModePrimitive(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// no record at 3: the last one before it, the interpolated value at 3, or nothing
+		expectedByMode := map[string][]procedure.ResultRow{
+			"locf":   {{"1", "10.000000000000000000"}, {"5", "50.000000000000000000"}},
+			"linear": {{"3", "30.000000000000000000"}, {"5", "50.000000000000000000"}},
+			"none":   {{"5", "50.000000000000000000"}},
+		}
+
+		for _, fillMode := range []string{"locf", "linear", "none"} {
+			result, err := getRecordFilled(ctx, platform, fillModePrimitiveA, 3, 5, fillMode)
+			if err != nil {
+				return errors.Wrapf(err, "error getting %s records", fillMode)
+			}
+			assert.Equal(t, expectedByMode[fillMode], result, fillMode)
+		}
+
+		// the last record is carried forward when there's nothing to interpolate towards
+		result, err := getRecordFilled(ctx, platform, fillModePrimitiveA, 7, 9, "linear")
+		if err != nil {
+			return errors.Wrap(err, "error getting records after the last one")
+		}
+		assert.Equal(t, []procedure.ResultRow{{"5", "50.000000000000000000"}}, result, "linear after the last record")
+
+		return nil
+	}
+}
+
+func testFillModeComposed(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		result, err := getRecordFilled(ctx, platform, fillModeComposed, 2, 5, "locf")
+		if err != nil {
+			return errors.Wrap(err, "error getting locf composed records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"2", "15.000000000000000000"},
+			{"4", "25.000000000000000000"},
+			{"5", "45.000000000000000000"},
+		}, result, "locf composed")
+
+		// a is interpolated between its records, b carried forward after its last one
+		result, err = getRecordFilled(ctx, platform, fillModeComposed, 2, 5, "linear")
+		if err != nil {
+			return errors.Wrap(err, "error getting linear composed records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"2", "20.000000000000000000"},
+			{"4", "40.000000000000000000"},
+			{"5", "45.000000000000000000"},
+		}, result, "linear composed")
+
+		// a is interpolated towards its record at 5, after the range
+		result, err = getRecordFilled(ctx, platform, fillModeComposed, 2, 3, "linear")
+		if err != nil {
+			return errors.Wrap(err, "error getting linear composed records before the last one")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"2", "20.000000000000000000"},
+		}, result, "linear composed before the last record")
+
+		// only the primitives with a record at a time are aggregated
+		result, err = getRecordFilled(ctx, platform, fillModeComposed, 1, 5, "none")
+		if err != nil {
+			return errors.Wrap(err, "error getting none composed records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "10.000000000000000000"},
+			{"2", "20.000000000000000000"},
+			{"4", "40.000000000000000000"},
+			{"5", "50.000000000000000000"},
+		}, result, "none composed")
+
+		return nil
+	}
+}
+
+func testFillModeComposedLargeValues(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		largeComposed := types.StreamLocator{StreamId: util.GenerateStreamId("fill_mode_large_composed"), DataProvider: fillModeDataProvider}
+		err := setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform: platform,
+			StreamId: largeComposed.StreamId,
+			MarkdownData: `
+			| event_time | fill_mode_large_a  | fill_mode_large_b  |
+			|------------|--------------------|--------------------|
+			| 1          | 900000000000000000 |                    |
+			| 2          |                    | 900000000000000000 |
+			`,
+			Height: 1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream with large values")
+		}
+
+		// the weighted sum at 2 exceeds NUMERIC(36,18), the mean doesn't
+		result, err := getRecordFilled(ctx, platform, largeComposed, 1, 2, "linear")
+		if err != nil {
+			return errors.Wrap(err, "error getting linear composed records with large values")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "900000000000000000.000000000000000000"},
+			{"2", "900000000000000000.000000000000000000"},
+		}, result, "linear composed with large values")
+
+		return nil
+	}
+}
+
+func testFillModeMetadata(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  fillModePrimitiveA,
+			Key:      "fill_mode",
+			Value:    "linear",
+			ValType:  "string",
+			Height:   1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting fill mode")
+		}
+
+		fromTime := int64(3)
+		toTime := int64(5)
+		result, err := procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: fillModePrimitiveA,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"3", "30.000000000000000000"},
+			{"5", "50.000000000000000000"},
+		}, result, "get_record should interpolate with the linear fill mode")
+
+		// a nil fill mode follows the metadata too
+		result, err = procedure.GetRecordFilled(ctx, procedure.GetRecordFilledInput{
+			Platform:      platform,
+			StreamLocator: fillModePrimitiveA,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting filled records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"3", "30.000000000000000000"},
+			{"5", "50.000000000000000000"},
+		}, result, "get_record_filled without a fill mode")
+
+		return nil
+	}
+}
+
+func testFillModeIndex(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		fromTime := int64(3)
+		toTime := int64(5)
+		baseTime := int64(1)
+		fillMode := "linear"
+		result, err := procedure.GetIndexFilled(ctx, procedure.GetIndexFilledInput{
+			Platform:      platform,
+			StreamLocator: fillModePrimitiveA,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			BaseTime:      &baseTime,
+			FillMode:      &fillMode,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting filled index")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"3", "300.000000000000000000"},
+			{"5", "500.000000000000000000"},
+		}, result, "linear index")
+
+		// no record at the base time: the base value is interpolated too
+		baseTime = 2
+		result, err = procedure.GetIndexFilled(ctx, procedure.GetIndexFilledInput{
+			Platform:      platform,
+			StreamLocator: fillModePrimitiveA,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			BaseTime:      &baseTime,
+			FillMode:      &fillMode,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting filled index with an interpolated base")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"3", "150.000000000000000000"},
+			{"5", "250.000000000000000000"},
+		}, result, "linear index with an interpolated base")
+
+		return nil
+	}
+}
+
+func testFillModeExplain(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  fillModeComposed,
+			Key:      "fill_mode",
+			Value:    "linear",
+			ValType:  "string",
+			Height:   1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting fill mode")
+		}
+
+		fromTime := int64(2)
+		toTime := int64(5)
+		result, err := procedure.ExplainComposedRecord(ctx, procedure.ExplainComposedRecordInput{
+			Platform:      platform,
+			StreamLocator: fillModeComposed,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error explaining composed records")
+		}
+
+		// the values of get_record_composed_filled: a interpolated, b carried forward
+		streamNames := map[string]string{
+			fillModePrimitiveA.StreamId.String(): "a",
+			fillModePrimitiveB.StreamId.String(): "b",
+		}
+		values := map[string]string{}
+		for _, row := range result {
+			values[row[0]+" "+streamNames[row[2]]] = row[5]
+		}
+		assert.Equal(t, map[string]string{
+			"2 a": "20.000000000000000000",
+			"2 b": "20.000000000000000000",
+			"4 a": "40.000000000000000000",
+			"4 b": "40.000000000000000000",
+			"5 a": "50.000000000000000000",
+			"5 b": "40.000000000000000000",
+		}, values, "linear explain")
+
+		return nil
+	}
+}
+
+func testFillModeInvalid(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		_, err := getRecordFilled(ctx, platform, fillModePrimitiveA, 3, 5, "cubic")
+		assert.ErrorContains(t, err, "invalid fill mode")
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  fillModePrimitiveA,
+			Key:      "fill_mode",
+			Value:    "cubic",
+			ValType:  "string",
+			Height:   1,
+		})
+		assert.ErrorContains(t, err, "Invalid fill_mode")
+
+		return nil
+	}
+}
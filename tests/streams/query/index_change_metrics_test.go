@@ -0,0 +1,314 @@
+/*
+INDEX CHANGE METRICS TEST SUITE
+
+- [QUERY14] Authorized users can query index changes as percent, absolute difference, log return, annualized or compounded annual rate (TestIndexChangeMetrics)
+
+get_index_change_by_type is checked for:
+
+- every change type over an interval of half a year
+- annualized changes over a day, and over an hour where the rate overflows
+- percent changes from a tiny previous value overflow instead of failing
+- points without a comparison are flagged as missing, zero or undefined instead of being skipped
+- get_index_change keeps returning only the comparable percent changes
+- invalid change types, and annualizing over a non-positive interval, are rejected
+*/
+
+package tests
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+// half a year, so an annualized change compounds the change of the interval twice
+const changeMetricsInterval = 15768000
+
+var (
+	changeMetricsDataProvider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000001101")
+	changeMetricsStream       = types.StreamLocator{StreamId: util.GenerateStreamId("index_change_metrics"), DataProvider: changeMetricsDataProvider}
+	changeMetricsTinyStream   = types.StreamLocator{StreamId: util.GenerateStreamId("index_change_metrics_tiny"), DataProvider: changeMetricsDataProvider}
+)
+
+// expectedChange is a row of get_index_change_by_type, the value being compared only for ok rows
+type expectedChange struct {
+	eventTime string
+	value     float64
+	status    string
+}
+
+func TestIndexChangeMetrics(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "index_change_metrics_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithIndexChangeMetricsTestSetup(testIndexChangeByType(t)),
+			WithIndexChangeMetricsTestSetup(testIndexChangeAnnualizedShortIntervals(t)),
+			WithIndexChangeMetricsTestSetup(testIndexChangePercentOverflow(t)),
+			WithIndexChangeMetricsTestSetup(testIndexChangeSkipsFlaggedRows(t)),
+			WithIndexChangeMetricsTestSetup(testIndexChangeByTypeInvalidInput(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithIndexChangeMetricsTestSetup creates a primitive stream with a point every half a year.
+// The base value is 100, so the index equals the value: +10%, +10%, -100%, then a change from zero.
+func WithIndexChangeMetricsTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, changeMetricsDataProvider.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: changeMetricsStream.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 15768000   | 100   |
+			| 31536000   | 110   |
+			| 47304000   | 121   |
+			| 63072000   | 0     |
+			| 78840000   | 50    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+func getIndexChangeByType(ctx context.Context, platform *kwilTesting.Platform, changeType string) ([]procedure.ResultRow, error) {
+	return getIndexChangeByTypeOverInterval(ctx, platform, changeType, changeMetricsInterval)
+}
+
+func getIndexChangeByTypeOverInterval(ctx context.Context, platform *kwilTesting.Platform, changeType string, interval int) ([]procedure.ResultRow, error) {
+	fromTime := int64(15768000)
+	toTime := int64(78840000)
+	baseTime := int64(15768000)
+	return procedure.GetIndexChangeByType(ctx, procedure.GetIndexChangeByTypeInput{
+		Platform:      platform,
+		StreamLocator: changeMetricsStream,
+		FromTime:      &fromTime,
+		ToTime:        &toTime,
+		BaseTime:      &baseTime,
+		Interval:      &interval,
+		ChangeType:    changeType,
+		Height:        1,
+	})
+}
+
+func testIndexChangeByType(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		expectedByType := map[string][]expectedChange{
+			"percent": {
+				{"15768000", 0, "missing"},
+				{"31536000", 10, "ok"},
+				{"47304000", 10, "ok"},
+				{"63072000", -100, "ok"},
+				{"78840000", 0, "zero"},
+			},
+			"absolute": {
+				{"15768000", 0, "missing"},
+				{"31536000", 10, "ok"},
+				{"47304000", 11, "ok"},
+				{"63072000", -121, "ok"},
+				{"78840000", 50, "ok"},
+			},
+			"log_return": {
+				{"15768000", 0, "missing"},
+				{"31536000", 0.09531017980432486, "ok"},
+				{"47304000", 0.09531017980432486, "ok"},
+				{"63072000", 0, "undefined"},
+				{"78840000", 0, "zero"},
+			},
+			"annualized": {
+				{"15768000", 0, "missing"},
+				{"31536000", 21, "ok"},
+				{"47304000", 21, "ok"},
+				{"63072000", 0, "undefined"},
+				{"78840000", 0, "zero"},
+			},
+			"compounded_annual": {
+				{"15768000", 0, "missing"},
+				{"31536000", 213.8428376721, "ok"},
+				{"47304000", 213.8428376721, "ok"},
+				{"63072000", 0, "undefined"},
+				{"78840000", 0, "zero"},
+			},
+		}
+
+		for _, changeType := range []string{"percent", "absolute", "log_return", "annualized", "compounded_annual"} {
+			result, err := getIndexChangeByType(ctx, platform, changeType)
+			if err != nil {
+				return errors.Wrapf(err, "error getting %s changes", changeType)
+			}
+			expected := expectedByType[changeType]
+			if !assert.Len(t, result, len(expected), changeType) {
+				continue
+			}
+			for i, row := range result {
+				assert.Equal(t, expected[i].eventTime, row[0], changeType)
+				assert.Equal(t, expected[i].status, row[3], "%s status at %s", changeType, row[0])
+				if expected[i].status != "ok" {
+					continue
+				}
+				value, err := strconv.ParseFloat(row[1], 64)
+				if err != nil {
+					return errors.Wrapf(err, "error parsing %s value %s", changeType, row[1])
+				}
+				assert.InDelta(t, expected[i].value, value, 1e-9, "%s value at %s", changeType, row[0])
+			}
+		}
+
+		return nil
+	}
+}
+
+func testIndexChangeAnnualizedShortIntervals(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// a day before each point is still the point half a year earlier: +10% a day compounds
+		// to (1.1^365 - 1) * 100 a year, an hour to 1.1^8760, beyond NUMERIC(36,18)
+		expectedByInterval := map[int][]expectedChange{
+			86400: {
+				{"15768000", 0, "missing"},
+				{"31536000", 128330558031335169.69, "ok"},
+				{"47304000", 128330558031335169.69, "ok"},
+				{"63072000", 0, "undefined"},
+				{"78840000", 0, "zero"},
+			},
+			3600: {
+				{"15768000", 0, "missing"},
+				{"31536000", 0, "overflow"},
+				{"47304000", 0, "overflow"},
+				{"63072000", 0, "undefined"},
+				{"78840000", 0, "zero"},
+			},
+		}
+
+		for _, interval := range []int{86400, 3600} {
+			result, err := getIndexChangeByTypeOverInterval(ctx, platform, "annualized", interval)
+			if err != nil {
+				return errors.Wrapf(err, "error getting annualized changes over %d seconds", interval)
+			}
+			expected := expectedByInterval[interval]
+			if !assert.Len(t, result, len(expected), "interval %d", interval) {
+				continue
+			}
+			for i, row := range result {
+				assert.Equal(t, expected[i].eventTime, row[0], "interval %d", interval)
+				assert.Equal(t, expected[i].status, row[3], "interval %d status at %s", interval, row[0])
+				if expected[i].status != "ok" {
+					continue
+				}
+				value, err := strconv.ParseFloat(row[1], 64)
+				if err != nil {
+					return errors.Wrapf(err, "error parsing value %s", row[1])
+				}
+				assert.InEpsilon(t, expected[i].value, value, 1e-12, "interval %d value at %s", interval, row[0])
+			}
+		}
+
+		return nil
+	}
+}
+
+func testIndexChangePercentOverflow(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// indexed against 1: 100, 10^-16 then 10^14, a change of 10^32 percent
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: changeMetricsTinyStream.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value                |
+			|------------|----------------------|
+			| 1          | 1                    |
+			| 2          | 0.000000000000000001 |
+			| 3          | 1000000000000        |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream with a tiny value")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(3)
+		baseTime := int64(1)
+		interval := 1
+		result, err := procedure.GetIndexChangeByType(ctx, procedure.GetIndexChangeByTypeInput{
+			Platform:      platform,
+			StreamLocator: changeMetricsTinyStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			BaseTime:      &baseTime,
+			Interval:      &interval,
+			ChangeType:    "percent",
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting percent changes")
+		}
+
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "<nil>", "<nil>", "missing"},
+			{"2", "-99.999999999999999900", "1", "ok"},
+			{"3", "<nil>", "2", "overflow"},
+		}, result, "percent changes from a tiny previous value")
+
+		return nil
+	}
+}
+
+func testIndexChangeSkipsFlaggedRows(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		fromTime := int64(15768000)
+		toTime := int64(78840000)
+		baseTime := int64(15768000)
+		interval := changeMetricsInterval
+		result, err := procedure.GetIndexChange(ctx, procedure.GetIndexChangeInput{
+			Platform:      platform,
+			StreamLocator: changeMetricsStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			BaseTime:      &baseTime,
+			Interval:      &interval,
+			Height:        1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting index change")
+		}
+
+		assert.Equal(t, []procedure.ResultRow{
+			{"31536000", "10.000000000000000000"},
+			{"47304000", "10.000000000000000000"},
+			{"63072000", "-100.000000000000000000"},
+		}, result, "get_index_change should skip the points without a comparison")
+
+		return nil
+	}
+}
+
+func testIndexChangeByTypeInvalidInput(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		_, err := getIndexChangeByType(ctx, platform, "geometric")
+		assert.ErrorContains(t, err, "invalid change type")
+
+		_, err = getIndexChangeByTypeOverInterval(ctx, platform, "compounded_annual", 0)
+		assert.ErrorContains(t, err, "time_interval must be positive")
+
+		return nil
+	}
+}
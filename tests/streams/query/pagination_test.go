@@ -0,0 +1,425 @@
+/*
+CURSOR PAGINATION TEST SUITE
+
+- [QUERY10] Listings can be iterated page by page with a cursor (TestCursorPagination)
+
+The page actions are checked for:
+
+- list_streams_page returns every stream once, including streams created between two pages
+- get_record_page splits the records of a range by event_time, retracted records included
+- get_record_revisions_page splits the revisions of primitive and composed streams
+- get_metadata_page splits the metadata of a key by creation
+*/
+
+package tests
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/kwilteam/kwil-db/common"
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+var paginationDataProvider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000701")
+
+func TestCursorPagination(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "cursor_pagination_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			testListStreamsPage(t),
+			testGetRecordPage(t),
+			testGetRecordPageRetracted(t),
+			testGetRecordRevisionsPage(t),
+			testGetMetadataPage(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// createStreamAtHeight creates a stream of the platform deployer at a block height
+func createStreamAtHeight(ctx context.Context, platform *kwilTesting.Platform, streamId util.StreamId, streamType string, height int64) error {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error creating ethereum address")
+	}
+
+	r, err := platform.Engine.Call(&common.EngineContext{
+		TxContext: &common.TxContext{
+			Ctx:          ctx,
+			BlockContext: &common.BlockContext{Height: height},
+			Signer:       platform.Deployer,
+			Caller:       deployer.Address(),
+			TxID:         platform.Txid(),
+		},
+	}, platform.DB, "", "create_stream", []any{streamId.String(), streamType}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in create_stream")
+	}
+	return nil
+}
+
+// lastCursor returns the next_cursor of the last row of a page
+func lastCursor(page []procedure.ResultRow) string {
+	last := page[len(page)-1]
+	return last[len(last)-1]
+}
+
+func testListStreamsPage(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, paginationDataProvider.Bytes())
+
+		var firstStreamIds []string
+		for _, name := range []string{"pagination_stream_1", "pagination_stream_2", "pagination_stream_3"} {
+			streamId := util.GenerateStreamId(name)
+			if err := createStreamAtHeight(ctx, platform, streamId, "primitive", 1); err != nil {
+				return errors.Wrapf(err, "error creating stream %s", name)
+			}
+			firstStreamIds = append(firstStreamIds, streamId.String())
+		}
+		// streams of the same block are ordered by data provider and stream id
+		sort.Strings(firstStreamIds)
+
+		page, err := procedure.ListStreamsPage(ctx, procedure.ListStreamsPageInput{
+			Platform:     platform,
+			DataProvider: paginationDataProvider.Address(),
+			Limit:        2,
+			Height:       1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error listing the first page")
+		}
+		if !assert.Len(t, page, 2, "the first page should be full") {
+			return nil
+		}
+		assert.Equal(t, firstStreamIds[0], page[0][1])
+		assert.Equal(t, firstStreamIds[1], page[1][1])
+
+		// a stream created between two pages is listed after the streams already known
+		lateStreamId := util.GenerateStreamId("pagination_stream_late")
+		if err := createStreamAtHeight(ctx, platform, lateStreamId, "primitive", 2); err != nil {
+			return errors.Wrap(err, "error creating the late stream")
+		}
+
+		page, err = procedure.ListStreamsPage(ctx, procedure.ListStreamsPageInput{
+			Platform:     platform,
+			DataProvider: paginationDataProvider.Address(),
+			Limit:        2,
+			Cursor:       lastCursor(page),
+			Height:       2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error listing the second page")
+		}
+		if !assert.Len(t, page, 2, "the second page should hold the last stream and the late one") {
+			return nil
+		}
+		assert.Equal(t, firstStreamIds[2], page[0][1])
+		assert.Equal(t, lateStreamId.String(), page[1][1])
+
+		page, err = procedure.ListStreamsPage(ctx, procedure.ListStreamsPageInput{
+			Platform:     platform,
+			DataProvider: paginationDataProvider.Address(),
+			Limit:        2,
+			Cursor:       lastCursor(page),
+			Height:       2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error listing the last page")
+		}
+		assert.Empty(t, page, "there should be no stream after the last page")
+
+		return nil
+	}
+}
+
+func testGetRecordPage(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, paginationDataProvider.Bytes())
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("pagination_records"),
+			DataProvider: paginationDataProvider,
+		}
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: streamLocator.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10    |
+			| 2          | 20    |
+			| 3          | 30    |
+			| 4          | 40    |
+			| 5          | 50    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		var pages [][]procedure.ResultRow
+		cursor := ""
+		for {
+			page, err := procedure.GetRecordPage(ctx, procedure.GetRecordPageInput{
+				Platform:      platform,
+				StreamLocator: streamLocator,
+				Limit:         2,
+				Cursor:        cursor,
+				Height:        1,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error getting record page")
+			}
+			if len(page) == 0 {
+				break
+			}
+			pages = append(pages, page)
+			cursor = lastCursor(page)
+		}
+
+		assert.Equal(t, [][]procedure.ResultRow{
+			{{"1", "10.000000000000000000", "1"}, {"2", "20.000000000000000000", "2"}},
+			{{"3", "30.000000000000000000", "3"}, {"4", "40.000000000000000000", "4"}},
+			{{"5", "50.000000000000000000", "5"}},
+		}, pages, "records should be split in pages of 2")
+
+		return nil
+	}
+}
+
+// getRecordPages reads every page of a stream's records
+func getRecordPages(ctx context.Context, platform *kwilTesting.Platform, streamLocator types.StreamLocator, limit int, height int64) ([][]procedure.ResultRow, error) {
+	var pages [][]procedure.ResultRow
+	cursor := ""
+	for {
+		page, err := procedure.GetRecordPage(ctx, procedure.GetRecordPageInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			Limit:         limit,
+			Cursor:        cursor,
+			Height:        height,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting record page")
+		}
+		if len(page) == 0 {
+			return pages, nil
+		}
+		pages = append(pages, page)
+		cursor = lastCursor(page)
+	}
+}
+
+func testGetRecordPageRetracted(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, paginationDataProvider.Bytes())
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("pagination_retracted"),
+			DataProvider: paginationDataProvider,
+		}
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: streamLocator.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10    |
+			| 2          | 20    |
+			| 3          | 30    |
+			| 4          | 40    |
+			| 5          | 50    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		err = procedure.RetractRecord(ctx, procedure.RetractRecordInput{
+			Platform:      platform,
+			StreamLocator: streamLocator,
+			EventTime:     3,
+			Height:        2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error retracting record")
+		}
+
+		// the window of the second page ends at 4 and only holds one record, the next one is read too
+		pages, err := getRecordPages(ctx, platform, streamLocator, 2, 2)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, [][]procedure.ResultRow{
+			{{"1", "10.000000000000000000", "1"}, {"2", "20.000000000000000000", "2"}},
+			{{"4", "40.000000000000000000", "4"}, {"5", "50.000000000000000000", "5"}},
+		}, pages, "pages should stay full around a retracted record")
+
+		return nil
+	}
+}
+
+func testGetRecordRevisionsPage(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, paginationDataProvider.Bytes())
+		composedLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("pagination_revisions_composed"),
+			DataProvider: paginationDataProvider,
+		}
+		primitiveLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("pagination_revisions_primitive"),
+			DataProvider: paginationDataProvider,
+		}
+
+		err := setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform: platform,
+			StreamId: composedLocator.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | pagination_revisions_primitive |
+			|------------|--------------------------------|
+			| 1          | 10                             |
+			| 2          | 20                             |
+			| 3          | 30                             |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream")
+		}
+
+		err = setup.InsertMarkdownPrimitiveData(ctx, setup.InsertMarkdownDataInput{
+			Platform:      platform,
+			Height:        2,
+			StreamLocator: primitiveLocator,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 15    |
+			| 3          | 35    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting revisions")
+		}
+
+		// the page boundary falls inside the revisions of height 1, then of height 2
+		expected := [][]procedure.ResultRow{
+			{
+				{"1", "10.000000000000000000", "1", "<nil>", "false", "1:1"},
+				{"2", "20.000000000000000000", "1", "<nil>", "false", "1:2"},
+			},
+			{
+				{"3", "30.000000000000000000", "1", "<nil>", "false", "1:3"},
+				{"1", "15.000000000000000000", "2", "<nil>", "false", "2:1"},
+			},
+			{
+				{"3", "35.000000000000000000", "2", "<nil>", "false", "2:3"},
+			},
+		}
+		for _, locator := range []types.StreamLocator{primitiveLocator, composedLocator} {
+			var pages [][]procedure.ResultRow
+			cursor := ""
+			for {
+				page, err := procedure.GetRecordRevisionsPage(ctx, procedure.GetRecordRevisionsPageInput{
+					Platform:      platform,
+					StreamLocator: locator,
+					Limit:         2,
+					Cursor:        cursor,
+					Height:        2,
+				})
+				if err != nil {
+					return errors.Wrap(err, "error getting record revisions page")
+				}
+				if len(page) == 0 {
+					break
+				}
+				pages = append(pages, page)
+				cursor = lastCursor(page)
+			}
+			assert.Equal(t, expected, pages, "revisions of %s should be split in pages of 2", locator.StreamId.String())
+		}
+
+		return nil
+	}
+}
+
+func testGetMetadataPage(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, paginationDataProvider.Bytes())
+		streamLocator := types.StreamLocator{
+			StreamId:     util.GenerateStreamId("pagination_metadata"),
+			DataProvider: paginationDataProvider,
+		}
+
+		if err := setup.CreateStream(ctx, platform, setup.StreamInfo{Locator: streamLocator, Type: setup.ContractTypePrimitive}); err != nil {
+			return errors.Wrap(err, "error creating stream")
+		}
+
+		for i, tag := range []string{"first", "second", "third"} {
+			err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+				Platform: platform,
+				Locator:  streamLocator,
+				Key:      "tag",
+				Value:    tag,
+				ValType:  "string",
+				Height:   int64(i + 1),
+			})
+			if err != nil {
+				return errors.Wrap(err, "error inserting metadata")
+			}
+		}
+
+		page, err := procedure.GetMetadataPage(ctx, procedure.GetMetadataPageInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			Key:      "tag",
+			Limit:    2,
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting the first metadata page")
+		}
+		if !assert.Len(t, page, 2, "the first page should be full") {
+			return nil
+		}
+		// value_s is the 5th column
+		assert.Equal(t, "first", page[0][4])
+		assert.Equal(t, "second", page[1][4])
+
+		page, err = procedure.GetMetadataPage(ctx, procedure.GetMetadataPageInput{
+			Platform: platform,
+			Locator:  streamLocator,
+			Key:      "tag",
+			Limit:    2,
+			Cursor:   lastCursor(page),
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting the second metadata page")
+		}
+		if !assert.Len(t, page, 1, "the second page should hold the remaining row") {
+			return nil
+		}
+		assert.Equal(t, "third", page[0][4])
+
+		return nil
+	}
+}
@@ -0,0 +1,241 @@
+/*
+PAIRWISE STATISTICS TEST SUITE
+
+- [QUERY16] Authorized users can relate two streams: aligned values, spread, ratio, correlation and beta (TestPairwiseStatistics)
+
+get_pairwise_series and get_pairwise_statistics are checked for:
+
+- LOCF alignment of two streams at the event times of either stream
+- the latest aligned point at or before $from is returned like get_record does
+- Pearson correlation and beta of the aligned values
+- ranges with a single aligned point have no statistics
+- values whose squared deviations exceed NUMERIC(36,18)
+*/
+
+package tests
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+var (
+	pairwiseDataProvider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000001301")
+	pairwiseStreamA      = types.StreamLocator{StreamId: util.GenerateStreamId("pairwise_regional"), DataProvider: pairwiseDataProvider}
+	pairwiseStreamB      = types.StreamLocator{StreamId: util.GenerateStreamId("pairwise_national"), DataProvider: pairwiseDataProvider}
+	pairwiseLargeStreamA = types.StreamLocator{StreamId: util.GenerateStreamId("pairwise_regional_large"), DataProvider: pairwiseDataProvider}
+	pairwiseLargeStreamB = types.StreamLocator{StreamId: util.GenerateStreamId("pairwise_national_large"), DataProvider: pairwiseDataProvider}
+)
+
+func TestPairwiseStatistics(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "pairwise_statistics_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithPairwiseTestSetup(testPairwiseSeries(t)),
+			WithPairwiseTestSetup(testPairwiseStatistics(t)),
+			WithPairwiseTestSetup(testPairwiseStatisticsLargeValues(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithPairwiseTestSetup creates two primitive streams whose records are at different times
+func WithPairwiseTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, pairwiseDataProvider.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: pairwiseStreamA.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10    |
+			| 2          | 20    |
+			| 4          | 40    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up stream a")
+		}
+
+		err = setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: pairwiseStreamB.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 5     |
+			| 3          | 15    |
+			| 4          | 10    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up stream b")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+func getPairwiseInput(platform *kwilTesting.Platform, fromTime, toTime int64) procedure.GetPairwiseInput {
+	return procedure.GetPairwiseInput{
+		Platform: platform,
+		StreamA:  pairwiseStreamA,
+		StreamB:  pairwiseStreamB,
+		FromTime: &fromTime,
+		ToTime:   &toTime,
+		Height:   1,
+	}
+}
+
+func testPairwiseSeries(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		result, err := procedure.GetPairwiseSeries(ctx, getPairwiseInput(platform, 1, 4))
+		if err != nil {
+			return errors.Wrap(err, "error getting pairwise series")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "10.000000000000000000", "5.000000000000000000", "5.000000000000000000", "2.000000000000000000"},
+			{"2", "20.000000000000000000", "5.000000000000000000", "15.000000000000000000", "4.000000000000000000"},
+			{"3", "20.000000000000000000", "15.000000000000000000", "5.000000000000000000", "1.333333333333333333"},
+			{"4", "40.000000000000000000", "10.000000000000000000", "30.000000000000000000", "4.000000000000000000"},
+		}, result, "each stream should hold its last value at the times of the other")
+
+		// no record of a at 3: its record at 2 is carried forward
+		result, err = procedure.GetPairwiseSeries(ctx, getPairwiseInput(platform, 3, 3))
+		if err != nil {
+			return errors.Wrap(err, "error getting pairwise series from 3")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"3", "20.000000000000000000", "15.000000000000000000", "5.000000000000000000", "1.333333333333333333"},
+		}, result, "a should hold its value at the record of b")
+
+		result, err = procedure.GetPairwiseSeries(ctx, getPairwiseInput(platform, 5, 6))
+		if err != nil {
+			return errors.Wrap(err, "error getting pairwise series after the last records")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"4", "40.000000000000000000", "10.000000000000000000", "30.000000000000000000", "4.000000000000000000"},
+		}, result, "the latest aligned point before the range")
+
+		return nil
+	}
+}
+
+func testPairwiseStatistics(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		result, err := procedure.GetPairwiseStatistics(ctx, getPairwiseInput(platform, 1, 4))
+		if err != nil {
+			return errors.Wrap(err, "error getting pairwise statistics")
+		}
+		if !assert.Len(t, result, 1) {
+			return nil
+		}
+		assert.Equal(t, "4", result[0][0], "point count")
+
+		// a: 10 20 20 40, b: 5 5 15 10
+		correlation, err := strconv.ParseFloat(result[0][1], 64)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing correlation %s", result[0][1])
+		}
+		assert.InDelta(t, 0.3458572319330373, correlation, 1e-9, "correlation")
+
+		beta, err := strconv.ParseFloat(result[0][2], 64)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing beta %s", result[0][2])
+		}
+		assert.InDelta(t, 0.9090909090909091, beta, 1e-9, "beta")
+
+		// a single point has no variance, so correlation and beta are NULL
+		result, err = procedure.GetPairwiseStatistics(ctx, getPairwiseInput(platform, 5, 6))
+		if err != nil {
+			return errors.Wrap(err, "error getting pairwise statistics of a single point")
+		}
+		if !assert.Len(t, result, 1) {
+			return nil
+		}
+		assert.Equal(t, "1", result[0][0], "point count")
+		for _, value := range result[0][1:] {
+			_, err := strconv.ParseFloat(value, 64)
+			assert.Error(t, err, "statistics of a single point should be NULL, got %s", value)
+		}
+
+		return nil
+	}
+}
+
+func testPairwiseStatisticsLargeValues(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// the values of a and b times 10^9: squared deviations of about 10^20
+		for _, stream := range []struct {
+			locator types.StreamLocator
+			data    string
+		}{
+			{pairwiseLargeStreamA, `
+			| event_time | value       |
+			|------------|-------------|
+			| 1          | 10000000000 |
+			| 2          | 20000000000 |
+			| 4          | 40000000000 |
+			`},
+			{pairwiseLargeStreamB, `
+			| event_time | value       |
+			|------------|-------------|
+			| 1          | 5000000000  |
+			| 3          | 15000000000 |
+			| 4          | 10000000000 |
+			`},
+		} {
+			err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+				Platform:     platform,
+				StreamId:     stream.locator.StreamId,
+				Height:       1,
+				MarkdownData: stream.data,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error setting up large stream")
+			}
+		}
+
+		input := getPairwiseInput(platform, 1, 4)
+		input.StreamA = pairwiseLargeStreamA
+		input.StreamB = pairwiseLargeStreamB
+		result, err := procedure.GetPairwiseStatistics(ctx, input)
+		if err != nil {
+			return errors.Wrap(err, "error getting pairwise statistics of large values")
+		}
+		if !assert.Len(t, result, 1) {
+			return nil
+		}
+
+		// correlation and beta don't change when both series are scaled alike
+		correlation, err := strconv.ParseFloat(result[0][1], 64)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing correlation %s", result[0][1])
+		}
+		assert.InDelta(t, 0.3458572319330373, correlation, 1e-9, "correlation")
+
+		beta, err := strconv.ParseFloat(result[0][2], 64)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing beta %s", result[0][2])
+		}
+		assert.InDelta(t, 0.9090909090909091, beta, 1e-9, "beta")
+
+		return nil
+	}
+}
@@ -0,0 +1,465 @@
+/*
+RECORD AGGREGATION TEST SUITE
+
+- [QUERY08] Authorized users can query records rolled up into calendar buckets (TestRecordAggregated)
+
+get_record_aggregated is checked for:
+
+- day, week (Monday based) and month buckets, keyed by the bucket start
+- avg, first, last, min and max methods
+- the LOCF anchor before $from is attributed to the bucket containing $from
+- frozen_at is honored the same way as get_record
+- invalid buckets/methods and unauthorized wallets are rejected
+- timestamps before 1970 fall in their calendar bucket, and averages of buckets whose sum
+  exceeds NUMERIC(36,18) don't overflow
+*/
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+const aggregatedPrimitiveStreamName = "primitive_stream_aggregated_test"
+const aggregatedComposedStreamName = "composed_stream_aggregated_test"
+const aggregatedChildStreamName = "primitive_child_stream_aggregated_test"
+
+var aggregatedPrimitiveStreamId = util.GenerateStreamId(aggregatedPrimitiveStreamName)
+var aggregatedComposedStreamId = util.GenerateStreamId(aggregatedComposedStreamName)
+var aggregatedChildStreamId = util.GenerateStreamId(aggregatedChildStreamName)
+
+// 2024-01-30 (Tue), 2024-01-31 (Wed), 2024-02-01 (Thu), 2024-02-02 (Fri), 2024-03-01 (Fri)
+const aggregatedTestData = `
+| event_time | %s |
+|------------|-------|
+| 1706572800 | 10    |
+| 1706659200 | 20    |
+| 1706745600 | 30    |
+| 1706832000 | 40    |
+| 1709251200 | 50    |
+`
+
+func TestRecordAggregated(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "record_aggregated_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithAggregatedTestSetup(testRecordAggregatedMonthly(t)),
+			WithAggregatedTestSetup(testRecordAggregatedWeekly(t)),
+			WithAggregatedTestSetup(testRecordAggregatedDaily(t)),
+			WithAggregatedTestSetup(testRecordAggregatedAnchor(t)),
+			WithAggregatedTestSetup(testRecordAggregatedFrozenAt(t)),
+			WithAggregatedTestSetup(testRecordAggregatedInvalidInput(t)),
+			WithAggregatedTestSetup(testRecordAggregatedPrivateStream(t)),
+			testRecordAggregatedBeforeEpochLargeValues(t),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithAggregatedTestSetup creates a primitive stream and a single child composed stream with the same data
+func WithAggregatedTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000000")
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform:     platform,
+			StreamId:     aggregatedPrimitiveStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(aggregatedTestData, "value"),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		err = setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform:     platform,
+			StreamId:     aggregatedComposedStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(aggregatedTestData, aggregatedChildStreamName),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+// runAggregatedTestForAllStreamTypes runs a test function against the primitive and the composed stream
+func runAggregatedTestForAllStreamTypes(t *testing.T, testName string, testFn func(ctx context.Context, platform *kwilTesting.Platform, testConfig TestConfig) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		testConfigs := []TestConfig{
+			{
+				WritableStreamId: aggregatedPrimitiveStreamId,
+				ReadableStreamId: aggregatedPrimitiveStreamId,
+				Name:             "Primitive Stream",
+			},
+			{
+				WritableStreamId: aggregatedChildStreamId,
+				ReadableStreamId: aggregatedComposedStreamId,
+				Name:             "Composed Stream",
+			},
+		}
+
+		for _, config := range testConfigs {
+			if err := testFn(ctx, platform, config); err != nil {
+				t.Errorf("%s test failed for %s (StreamId: %s): %v", testName, config.Name, config.ReadableStreamId.String(), err)
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func getRecordAggregated(ctx context.Context, platform *kwilTesting.Platform, config TestConfig, from, to, frozenAt *int64, bucket, method string) ([]procedure.ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ethereum address")
+	}
+
+	return procedure.GetRecordAggregated(ctx, procedure.GetRecordAggregatedInput{
+		Platform: platform,
+		StreamLocator: types.StreamLocator{
+			StreamId:     config.ReadableStreamId,
+			DataProvider: deployer,
+		},
+		FromTime: from,
+		ToTime:   to,
+		FrozenAt: frozenAt,
+		Bucket:   bucket,
+		Method:   method,
+		Height:   1,
+	})
+}
+
+func testRecordAggregatedMonthly(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runAggregatedTestForAllStreamTypes(t, "RecordAggregatedMonthly", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		fromTime := int64(1706572800)
+		toTime := int64(1709251200)
+
+		expectedByMethod := map[string]string{
+			"avg": `
+			| event_time | value |
+			|------------|-------|
+			| 1704067200 | 15.000000000000000000 |
+			| 1706745600 | 35.000000000000000000 |
+			| 1709251200 | 50.000000000000000000 |
+			`,
+			"first": `
+			| event_time | value |
+			|------------|-------|
+			| 1704067200 | 10.000000000000000000 |
+			| 1706745600 | 30.000000000000000000 |
+			| 1709251200 | 50.000000000000000000 |
+			`,
+			"last": `
+			| event_time | value |
+			|------------|-------|
+			| 1704067200 | 20.000000000000000000 |
+			| 1706745600 | 40.000000000000000000 |
+			| 1709251200 | 50.000000000000000000 |
+			`,
+			"min": `
+			| event_time | value |
+			|------------|-------|
+			| 1704067200 | 10.000000000000000000 |
+			| 1706745600 | 30.000000000000000000 |
+			| 1709251200 | 50.000000000000000000 |
+			`,
+			"max": `
+			| event_time | value |
+			|------------|-------|
+			| 1704067200 | 20.000000000000000000 |
+			| 1706745600 | 40.000000000000000000 |
+			| 1709251200 | 50.000000000000000000 |
+			`,
+		}
+
+		for _, method := range []string{"avg", "first", "last", "min", "max"} {
+			result, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "month", method)
+			if err != nil {
+				return errors.Wrapf(err, "error getting monthly %s", method)
+			}
+			if err := validateTableResult(t, result, expectedByMethod[method], config); err != nil {
+				return errors.Wrapf(err, "monthly %s", method)
+			}
+		}
+		return nil
+	})
+}
+
+func testRecordAggregatedWeekly(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runAggregatedTestForAllStreamTypes(t, "RecordAggregatedWeekly", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		fromTime := int64(1706572800)
+		toTime := int64(1709251200)
+
+		result, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "week", "avg")
+		if err != nil {
+			return errors.Wrap(err, "error getting weekly avg")
+		}
+
+		// weeks start on Monday: 2024-01-29 and 2024-02-26
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1706486400 | 25.000000000000000000 |
+		| 1708905600 | 50.000000000000000000 |
+		`
+
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRecordAggregatedDaily(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runAggregatedTestForAllStreamTypes(t, "RecordAggregatedDaily", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		fromTime := int64(1706572800)
+		toTime := int64(1706832000)
+
+		result, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "day", "max")
+		if err != nil {
+			return errors.Wrap(err, "error getting daily max")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1706572800 | 10.000000000000000000 |
+		| 1706659200 | 20.000000000000000000 |
+		| 1706745600 | 30.000000000000000000 |
+		| 1706832000 | 40.000000000000000000 |
+		`
+
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRecordAggregatedAnchor(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runAggregatedTestForAllStreamTypes(t, "RecordAggregatedAnchor", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		// 2024-02-15, no data on that date: the 2024-02-02 value is carried into February
+		fromTime := int64(1707955200)
+		toTime := int64(1709251200)
+
+		result, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "month", "avg")
+		if err != nil {
+			return errors.Wrap(err, "error getting monthly avg")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1706745600 | 40.000000000000000000 |
+		| 1709251200 | 50.000000000000000000 |
+		`
+
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRecordAggregatedFrozenAt(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runAggregatedTestForAllStreamTypes(t, "RecordAggregatedFrozenAt", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		// revise 2024-03-01 at height 2
+		err = setup.InsertMarkdownPrimitiveData(ctx, setup.InsertMarkdownDataInput{
+			Platform: platform,
+			Height:   2,
+			StreamLocator: types.StreamLocator{
+				StreamId:     config.WritableStreamId,
+				DataProvider: deployer,
+			},
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1709251200 | 70    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting revision")
+		}
+
+		fromTime := int64(1706745600)
+		toTime := int64(1709251200)
+		frozenAt := int64(1)
+
+		result, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, &frozenAt, "month", "last")
+		if err != nil {
+			return errors.Wrap(err, "error getting frozen monthly last")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1706745600 | 40.000000000000000000 |
+		| 1709251200 | 50.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		result, err = getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "month", "last")
+		if err != nil {
+			return errors.Wrap(err, "error getting monthly last")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 1706745600 | 40.000000000000000000 |
+		| 1709251200 | 70.000000000000000000 |
+		`
+
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRecordAggregatedInvalidInput(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runAggregatedTestForAllStreamTypes(t, "RecordAggregatedInvalidInput", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		fromTime := int64(1706572800)
+		toTime := int64(1709251200)
+
+		_, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "year", "avg")
+		if err == nil || !strings.Contains(err.Error(), "invalid bucket") {
+			return errors.Errorf("expected invalid bucket error, got %v", err)
+		}
+
+		_, err = getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "month", "median")
+		if err == nil || !strings.Contains(err.Error(), "invalid method") {
+			return errors.Errorf("expected invalid method error, got %v", err)
+		}
+		return nil
+	})
+}
+
+func testRecordAggregatedPrivateStream(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runAggregatedTestForAllStreamTypes(t, "RecordAggregatedPrivateStream", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator: types.StreamLocator{
+				StreamId:     config.ReadableStreamId,
+				DataProvider: deployer,
+			},
+			Key:     "read_visibility",
+			Value:   "1",
+			ValType: "int",
+			Height:  1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error making stream private")
+		}
+
+		fromTime := int64(1706572800)
+		toTime := int64(1709251200)
+
+		// the owner can still read
+		if _, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "month", "avg"); err != nil {
+			return errors.Wrap(err, "owner should be able to read private stream")
+		}
+
+		// query as another wallet, keeping the owner as data provider
+		reader := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000abc")
+		_, err = procedure.GetRecordAggregated(ctx, procedure.GetRecordAggregatedInput{
+			Platform: procedure.WithSigner(platform, reader.Bytes()),
+			StreamLocator: types.StreamLocator{
+				StreamId:     config.ReadableStreamId,
+				DataProvider: deployer,
+			},
+			FromTime: &fromTime,
+			ToTime:   &toTime,
+			Bucket:   "month",
+			Method:   "avg",
+			Height:   1,
+		})
+		if err == nil {
+			return errors.New("expected unauthorized wallet to be rejected")
+		}
+		return nil
+	})
+}
+
+func testRecordAggregatedBeforeEpochLargeValues(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000000")
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+		streamId := util.GenerateStreamId("primitive_stream_aggregated_edge_test")
+
+		// 1969-12-30 23:59:59 (Tue), 1969-12-31 22:00 and 23:00 (Wed)
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: streamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| -86401     | 3                  |
+			| -7200      | 900000000000000000 |
+			| -3600      | 900000000000000000 |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		config := TestConfig{
+			WritableStreamId: streamId,
+			ReadableStreamId: streamId,
+			Name:             "Primitive Stream",
+		}
+		fromTime := int64(-86401)
+		toTime := int64(-3600)
+
+		result, err := getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, "day", "avg")
+		if err != nil {
+			return errors.Wrap(err, "error getting daily avg")
+		}
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| -172800 | 3.000000000000000000 |
+		| -86400  | 900000000000000000.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		// the week starts on Monday 1969-12-29, the month on 1969-12-01
+		for bucket, start := range map[string]string{"week": "-259200", "month": "-2678400"} {
+			result, err = getRecordAggregated(ctx, platform, config, &fromTime, &toTime, nil, bucket, "avg")
+			if err != nil {
+				return errors.Wrapf(err, "error getting %s avg", bucket)
+			}
+			expected = fmt.Sprintf(`
+			| event_time | value |
+			|------------|-------|
+			| %s | 600000000000000001.000000000000000000 |
+			`, start)
+			if err := validateTableResult(t, result, expected, config); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,347 @@
+/*
+RECORD REVISIONS TEST SUITE
+
+- [QUERY09] Authorized users can query the revision history of records (TestRecordRevisions)
+
+get_record_revisions is checked for:
+
+- every stored revision of a primitive stream, retractions included
+- the changes of a composed stream's computed value by block height
+- taxonomy changes of a composed stream, each height replayed with the taxonomies as of that height
+- the range filter on event_time
+- revisions before the range that don't change the value carried into it are left out
+- unauthorized wallets are rejected
+*/
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+const revisionsPrimitiveStreamName = "primitive_stream_revisions_test"
+const revisionsComposedStreamName = "composed_stream_revisions_test"
+const revisionsChildStreamName = "primitive_child_stream_revisions_test"
+const revisionsOtherChildStreamName = "primitive_other_child_revisions_test"
+
+var revisionsPrimitiveStreamId = util.GenerateStreamId(revisionsPrimitiveStreamName)
+var revisionsComposedStreamId = util.GenerateStreamId(revisionsComposedStreamName)
+var revisionsChildStreamId = util.GenerateStreamId(revisionsChildStreamName)
+var revisionsOtherChildStreamId = util.GenerateStreamId(revisionsOtherChildStreamName)
+
+const revisionsTestData = `
+| event_time | %s |
+|------------|-------|
+| 1          | 10    |
+| 2          | 20    |
+| 3          | 30    |
+`
+
+func TestRecordRevisions(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "record_revisions_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithRevisionsTestSetup(testRecordRevisionsHistory(t)),
+			WithRevisionsTestSetup(testRecordRevisionsRange(t)),
+			WithRevisionsTestSetup(testRecordRevisionsBeforeRange(t)),
+			WithRevisionsTestSetup(testRecordRevisionsTaxonomyChanges(t)),
+			WithRevisionsTestSetup(testRecordRevisionsPrivateStream(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithRevisionsTestSetup creates a primitive stream and a single child composed stream with the same data.
+// The record at 2 is revised at height 2 and the record at 3 is retracted at height 3.
+func WithRevisionsTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000000")
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform:     platform,
+			StreamId:     revisionsPrimitiveStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(revisionsTestData, "value"),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		err = setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform:     platform,
+			StreamId:     revisionsComposedStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(revisionsTestData, revisionsChildStreamName),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream")
+		}
+
+		for _, streamId := range []util.StreamId{revisionsPrimitiveStreamId, revisionsChildStreamId} {
+			locator := types.StreamLocator{
+				StreamId:     streamId,
+				DataProvider: deployer,
+			}
+
+			err = setup.InsertMarkdownPrimitiveData(ctx, setup.InsertMarkdownDataInput{
+				Platform:      platform,
+				Height:        2,
+				StreamLocator: locator,
+				MarkdownData: `
+				| event_time | value |
+				|------------|-------|
+				| 2          | 25    |
+				`,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error inserting revision")
+			}
+
+			err = procedure.RetractRecord(ctx, procedure.RetractRecordInput{
+				Platform:      platform,
+				StreamLocator: locator,
+				EventTime:     3,
+				Height:        3,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error retracting record")
+			}
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+// runRevisionsTestForAllStreamTypes runs a test function against the primitive and the composed stream
+func runRevisionsTestForAllStreamTypes(t *testing.T, testName string, testFn func(ctx context.Context, platform *kwilTesting.Platform, testConfig TestConfig) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		testConfigs := []TestConfig{
+			{
+				WritableStreamId: revisionsPrimitiveStreamId,
+				ReadableStreamId: revisionsPrimitiveStreamId,
+				Name:             "Primitive Stream",
+			},
+			{
+				WritableStreamId: revisionsChildStreamId,
+				ReadableStreamId: revisionsComposedStreamId,
+				Name:             "Composed Stream",
+			},
+		}
+
+		for _, config := range testConfigs {
+			if err := testFn(ctx, platform, config); err != nil {
+				t.Errorf("%s test failed for %s (StreamId: %s): %v", testName, config.Name, config.ReadableStreamId.String(), err)
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func getRecordRevisions(ctx context.Context, platform *kwilTesting.Platform, config TestConfig, from, to *int64) ([]procedure.ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ethereum address")
+	}
+
+	return procedure.GetRecordRevisions(ctx, procedure.GetRecordRevisionsInput{
+		Platform: platform,
+		StreamLocator: types.StreamLocator{
+			StreamId:     config.ReadableStreamId,
+			DataProvider: deployer,
+		},
+		FromTime: from,
+		ToTime:   to,
+		Height:   10,
+	})
+}
+
+func testRecordRevisionsHistory(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRevisionsTestForAllStreamTypes(t, "RecordRevisionsHistory", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		result, err := getRecordRevisions(ctx, platform, config, nil, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting revisions")
+		}
+
+		expected := `
+		| event_time | value | created_at | truflation_created_at | is_tombstone |
+		|------------|-------|------------|-----------------------|--------------|
+		| 1          | 10.000000000000000000 | 1 | <nil> | false |
+		| 2          | 20.000000000000000000 | 1 | <nil> | false |
+		| 3          | 30.000000000000000000 | 1 | <nil> | false |
+		| 2          | 25.000000000000000000 | 2 | <nil> | false |
+		| 3          | <nil>                 | 3 | <nil> | true  |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRecordRevisionsRange(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRevisionsTestForAllStreamTypes(t, "RecordRevisionsRange", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		day2 := int64(2)
+		result, err := getRecordRevisions(ctx, platform, config, &day2, &day2)
+		if err != nil {
+			return errors.Wrap(err, "error getting revisions")
+		}
+
+		expected := `
+		| event_time | value | created_at | truflation_created_at | is_tombstone |
+		|------------|-------|------------|-----------------------|--------------|
+		| 2          | 20.000000000000000000 | 1 | <nil> | false |
+		| 2          | 25.000000000000000000 | 2 | <nil> | false |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRecordRevisionsBeforeRange(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRevisionsTestForAllStreamTypes(t, "RecordRevisionsBeforeRange", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		// the revision of 2 at height 2 is hidden behind the record at 3 until its retraction
+		day3 := int64(3)
+		result, err := getRecordRevisions(ctx, platform, config, &day3, &day3)
+		if err != nil {
+			return errors.Wrap(err, "error getting revisions")
+		}
+
+		expected := `
+		| event_time | value | created_at | truflation_created_at | is_tombstone |
+		|------------|-------|------------|-----------------------|--------------|
+		| 3          | 30.000000000000000000 | 1 | <nil> | false |
+		| 3          | <nil>                 | 3 | <nil> | true  |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRecordRevisionsTaxonomyChanges(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		composedLocator := types.StreamLocator{
+			StreamId:     revisionsComposedStreamId,
+			DataProvider: deployer,
+		}
+
+		// a second child gets its record at height 4, before it joins the composed stream at height 5
+		err = setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: revisionsOtherChildStreamId,
+			Height:   4,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 40    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up second child stream")
+		}
+
+		err = procedure.SetTaxonomy(ctx, procedure.SetTaxonomyInput{
+			Platform:      platform,
+			StreamLocator: composedLocator,
+			DataProviders: []string{deployer.Address(), deployer.Address()},
+			StreamIds:     []string{revisionsChildStreamId.String(), revisionsOtherChildStreamId.String()},
+			Weights:       []string{"1", "1"},
+			Height:        5,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error adding the second child")
+		}
+
+		err = procedure.DisableTaxonomy(ctx, procedure.DisableTaxonomyInput{
+			Platform:      platform,
+			StreamLocator: composedLocator,
+			GroupSequence: 2,
+			Height:        6,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error disabling the taxonomy with the second child")
+		}
+
+		config := TestConfig{
+			WritableStreamId: revisionsChildStreamId,
+			ReadableStreamId: revisionsComposedStreamId,
+			Name:             "Composed Stream",
+		}
+		result, err := getRecordRevisions(ctx, platform, config, nil, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting revisions")
+		}
+
+		// nothing changes at height 4, the second child isn't part of the stream yet
+		expected := `
+		| event_time | value | created_at | truflation_created_at | is_tombstone |
+		|------------|-------|------------|-----------------------|--------------|
+		| 1          | 10.000000000000000000 | 1 | <nil> | false |
+		| 2          | 20.000000000000000000 | 1 | <nil> | false |
+		| 3          | 30.000000000000000000 | 1 | <nil> | false |
+		| 2          | 25.000000000000000000 | 2 | <nil> | false |
+		| 3          | <nil>                 | 3 | <nil> | true  |
+		| 1          | 25.000000000000000000 | 5 | <nil> | false |
+		| 2          | 32.500000000000000000 | 5 | <nil> | false |
+		| 1          | 10.000000000000000000 | 6 | <nil> | false |
+		| 2          | 25.000000000000000000 | 6 | <nil> | false |
+		`
+		return validateTableResult(t, result, expected, config)
+	}
+}
+
+func testRecordRevisionsPrivateStream(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRevisionsTestForAllStreamTypes(t, "RecordRevisionsPrivateStream", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator: types.StreamLocator{
+				StreamId:     config.ReadableStreamId,
+				DataProvider: deployer,
+			},
+			Key:     "read_visibility",
+			Value:   "1",
+			ValType: "int",
+			Height:  4,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error making stream private")
+		}
+
+		// the owner can still read
+		if _, err := getRecordRevisions(ctx, platform, config, nil, nil); err != nil {
+			return errors.Wrap(err, "owner should be able to read private stream")
+		}
+
+		reader := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000abc")
+		_, err = procedure.GetRecordRevisions(ctx, procedure.GetRecordRevisionsInput{
+			Platform: procedure.WithSigner(platform, reader.Bytes()),
+			StreamLocator: types.StreamLocator{
+				StreamId:     config.ReadableStreamId,
+				DataProvider: deployer,
+			},
+			Height: 10,
+		})
+		if err == nil {
+			return errors.New("expected unauthorized wallet to be rejected")
+		}
+		return nil
+	})
+}
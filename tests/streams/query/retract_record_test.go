@@ -0,0 +1,427 @@
+/*
+RECORD RETRACTION TEST SUITE
+
+- [PRIMITIVE05] Authorized wallets can retract a primitive record; queries skip it unless frozen before the retraction (TestRetractRecord)
+
+retract_record is checked for:
+
+- get_record skips the retracted record, for the primitive and for a composed parent
+- frozen_at before the retraction height still returns the old value
+- the LOCF anchor and get_first_record skip retracted records
+- a new insert at the same event time makes the record visible again
+- a record written in the same block is retracted in place
+- retracting a missing or already retracted record, or a composed stream, is rejected
+*/
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+const retractPrimitiveStreamName = "primitive_stream_retract_test"
+const retractComposedStreamName = "composed_stream_retract_test"
+const retractChildStreamName = "primitive_child_stream_retract_test"
+
+var retractPrimitiveStreamId = util.GenerateStreamId(retractPrimitiveStreamName)
+var retractComposedStreamId = util.GenerateStreamId(retractComposedStreamName)
+var retractChildStreamId = util.GenerateStreamId(retractChildStreamName)
+
+const retractTestData = `
+| event_time | %s |
+|------------|-------|
+| 1          | 10    |
+| 2          | 20    |
+| 3          | 30    |
+`
+
+func TestRetractRecord(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "retract_record_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithRetractTestSetup(testRetractRecordFrozenAt(t)),
+			WithRetractTestSetup(testRetractRecordAnchorAndFirst(t)),
+			WithRetractTestSetup(testRetractRecordReinsert(t)),
+			WithRetractTestSetup(testRetractRecordSameBlock(t)),
+			WithRetractTestSetup(testRetractRecordInvalid(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithRetractTestSetup creates a primitive stream and a single child composed stream with the same data at height 1
+func WithRetractTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		deployer := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000000")
+		platform = procedure.WithSigner(platform, deployer.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform:     platform,
+			StreamId:     retractPrimitiveStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(retractTestData, "value"),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		err = setup.SetupComposedFromMarkdown(ctx, setup.MarkdownComposedSetupInput{
+			Platform:     platform,
+			StreamId:     retractComposedStreamId,
+			Height:       1,
+			MarkdownData: fmt.Sprintf(retractTestData, retractChildStreamName),
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up composed stream")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+// runRetractTestForAllStreamTypes runs a test function against the primitive and the composed stream
+func runRetractTestForAllStreamTypes(t *testing.T, testName string, testFn func(ctx context.Context, platform *kwilTesting.Platform, testConfig TestConfig) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		testConfigs := []TestConfig{
+			{
+				WritableStreamId: retractPrimitiveStreamId,
+				ReadableStreamId: retractPrimitiveStreamId,
+				Name:             "Primitive Stream",
+			},
+			{
+				WritableStreamId: retractChildStreamId,
+				ReadableStreamId: retractComposedStreamId,
+				Name:             "Composed Stream",
+			},
+		}
+
+		for _, config := range testConfigs {
+			if err := testFn(ctx, platform, config); err != nil {
+				t.Errorf("%s test failed for %s (StreamId: %s): %v", testName, config.Name, config.ReadableStreamId.String(), err)
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func retractRecord(ctx context.Context, platform *kwilTesting.Platform, streamId util.StreamId, eventTime int64, height int64) error {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error creating ethereum address")
+	}
+
+	return procedure.RetractRecord(ctx, procedure.RetractRecordInput{
+		Platform: platform,
+		StreamLocator: types.StreamLocator{
+			StreamId:     streamId,
+			DataProvider: deployer,
+		},
+		EventTime: eventTime,
+		Height:    height,
+	})
+}
+
+func getRetractRecords(ctx context.Context, platform *kwilTesting.Platform, config TestConfig, from, to, frozenAt *int64) ([]procedure.ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ethereum address")
+	}
+
+	return procedure.GetRecord(ctx, procedure.GetRecordInput{
+		Platform: platform,
+		StreamLocator: types.StreamLocator{
+			StreamId:     config.ReadableStreamId,
+			DataProvider: deployer,
+		},
+		FromTime: from,
+		ToTime:   to,
+		FrozenAt: frozenAt,
+		Height:   10,
+	})
+}
+
+func testRetractRecordFrozenAt(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRetractTestForAllStreamTypes(t, "RetractRecordFrozenAt", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		if err := retractRecord(ctx, platform, config.WritableStreamId, 2, 5); err != nil {
+			return errors.Wrap(err, "error retracting record")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(3)
+
+		result, err := getRetractRecords(ctx, platform, config, &fromTime, &toTime, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		// frozen before the retraction, the record is still there
+		frozenAt := int64(4)
+		result, err = getRetractRecords(ctx, platform, config, &fromTime, &toTime, &frozenAt)
+		if err != nil {
+			return errors.Wrap(err, "error getting frozen records")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 20.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRetractRecordAnchorAndFirst(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRetractTestForAllStreamTypes(t, "RetractRecordAnchorAndFirst", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		if err := retractRecord(ctx, platform, config.WritableStreamId, 2, 5); err != nil {
+			return errors.Wrap(err, "error retracting record")
+		}
+
+		// the anchor of a range starting at the retracted time is the previous record
+		day2 := int64(2)
+		result, err := getRetractRecords(ctx, platform, config, &day2, &day2, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting anchor record")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		result, err = procedure.GetFirstRecord(ctx, procedure.GetFirstRecordInput{
+			Platform: platform,
+			StreamLocator: types.StreamLocator{
+				StreamId:     config.ReadableStreamId,
+				DataProvider: deployer,
+			},
+			AfterTime: &day2,
+			Height:    10,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting first record")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 3          | 30.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		// with the last record retracted too, the latest record is the first one
+		if err := retractRecord(ctx, platform, config.WritableStreamId, 3, 6); err != nil {
+			return errors.Wrap(err, "error retracting last record")
+		}
+
+		result, err = getRetractRecords(ctx, platform, config, nil, nil, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting latest record")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRetractRecordReinsert(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRetractTestForAllStreamTypes(t, "RetractRecordReinsert", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		if err := retractRecord(ctx, platform, config.WritableStreamId, 2, 5); err != nil {
+			return errors.Wrap(err, "error retracting record")
+		}
+
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		err = setup.InsertMarkdownPrimitiveData(ctx, setup.InsertMarkdownDataInput{
+			Platform: platform,
+			Height:   6,
+			StreamLocator: types.StreamLocator{
+				StreamId:     config.WritableStreamId,
+				DataProvider: deployer,
+			},
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 2          | 25    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting new value")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(3)
+		result, err := getRetractRecords(ctx, platform, config, &fromTime, &toTime, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 25.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		// between the retraction and the new insert, the record is hidden
+		frozenAt := int64(5)
+		result, err = getRetractRecords(ctx, platform, config, &fromTime, &toTime, &frozenAt)
+		if err != nil {
+			return errors.Wrap(err, "error getting frozen records")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRetractRecordSameBlock(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return runRetractTestForAllStreamTypes(t, "RetractRecordSameBlock", func(ctx context.Context, platform *kwilTesting.Platform, config TestConfig) error {
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+
+		err = setup.InsertMarkdownPrimitiveData(ctx, setup.InsertMarkdownDataInput{
+			Platform: platform,
+			Height:   5,
+			StreamLocator: types.StreamLocator{
+				StreamId:     config.WritableStreamId,
+				DataProvider: deployer,
+			},
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 2          | 25    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting new value")
+		}
+
+		// the revision of the same block becomes the tombstone
+		if err := retractRecord(ctx, platform, config.WritableStreamId, 2, 5); err != nil {
+			return errors.Wrap(err, "error retracting record written in the same block")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(3)
+		result, err := getRetractRecords(ctx, platform, config, &fromTime, &toTime, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting records")
+		}
+
+		expected := `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		if err := validateTableResult(t, result, expected, config); err != nil {
+			return err
+		}
+
+		frozenAt := int64(4)
+		result, err = getRetractRecords(ctx, platform, config, &fromTime, &toTime, &frozenAt)
+		if err != nil {
+			return errors.Wrap(err, "error getting frozen records")
+		}
+
+		expected = `
+		| event_time | value |
+		|------------|-------|
+		| 1          | 10.000000000000000000 |
+		| 2          | 20.000000000000000000 |
+		| 3          | 30.000000000000000000 |
+		`
+		return validateTableResult(t, result, expected, config)
+	})
+}
+
+func testRetractRecordInvalid(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := retractRecord(ctx, platform, retractPrimitiveStreamId, 4, 5)
+		assert.ErrorContains(t, err, "no record to retract", "missing records can't be retracted")
+
+		err = retractRecord(ctx, platform, retractPrimitiveStreamId, 2, 5)
+		assert.NoError(t, err, "existing record should be retracted")
+
+		err = retractRecord(ctx, platform, retractPrimitiveStreamId, 2, 6)
+		assert.ErrorContains(t, err, "no record to retract", "a record can't be retracted twice")
+
+		err = retractRecord(ctx, platform, retractComposedStreamId, 1, 6)
+		assert.ErrorContains(t, err, "stream is not a primitive stream", "composed streams have no records to retract")
+
+		// another wallet can't retract the owner's records
+		otherWallet := util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000456")
+		deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+		if err != nil {
+			return errors.Wrap(err, "error creating ethereum address")
+		}
+		err = procedure.RetractRecord(ctx, procedure.RetractRecordInput{
+			Platform: procedure.WithSigner(platform, otherWallet.Bytes()),
+			StreamLocator: types.StreamLocator{
+				StreamId:     retractPrimitiveStreamId,
+				DataProvider: deployer,
+			},
+			EventTime: 1,
+			Height:    6,
+		})
+		assert.ErrorContains(t, err, "wallet not allowed to write", "only writers can retract records")
+
+		return nil
+	}
+}
@@ -0,0 +1,253 @@
+/*
+STREAM SEARCH TEST SUITE
+
+- [QUERY11] Streams can be searched by data provider, type, current owner, metadata, read visibility and creation height (TestSearchStreams)
+
+The streams of the suite:
+
+| stream    | data provider  | type      | created_at | owner          | metadata                           |
+| primitive | deployer       | primitive | 1          | new owner      |                                    |
+| food      | deployer       | composed  | 2          | deployer       | category=food, score=1.5 (float)   |
+| energy    | deployer       | composed  | 3          | deployer       | category=energy, read_visibility=1 |
+| other     | other provider | primitive | 3          | other provider |                                    |
+*/
+
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+var (
+	searchDeployer  = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000801")
+	searchNewOwner  = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000802")
+	searchOther     = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000803")
+	searchPrimitive = util.GenerateStreamId("search_primitive")
+	searchFood      = util.GenerateStreamId("search_food")
+	searchEnergy    = util.GenerateStreamId("search_energy")
+	searchOtherId   = util.GenerateStreamId("search_other")
+)
+
+func TestSearchStreams(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "search_streams_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithSearchStreamsTestSetup(testSearchStreamsFilters(t)),
+			WithSearchStreamsTestSetup(testSearchStreamsPagination(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithSearchStreamsTestSetup creates the streams of the suite with their metadata and owners
+func WithSearchStreamsTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, searchDeployer.Bytes())
+		locator := func(streamId util.StreamId) types.StreamLocator {
+			return types.StreamLocator{StreamId: streamId, DataProvider: searchDeployer}
+		}
+
+		if err := createStreamAtHeight(ctx, platform, searchPrimitive, "primitive", 1); err != nil {
+			return errors.Wrap(err, "error creating primitive stream")
+		}
+		for height, streamId := range map[int64]util.StreamId{2: searchFood, 3: searchEnergy} {
+			if err := createStreamAtHeight(ctx, platform, streamId, "composed", height); err != nil {
+				return errors.Wrap(err, "error creating composed stream")
+			}
+		}
+
+		metadata := []struct {
+			streamId util.StreamId
+			key      string
+			value    string
+			valType  string
+		}{
+			{searchFood, "category", "food", "string"},
+			{searchFood, "score", "1.5", "float"},
+			{searchEnergy, "category", "energy", "string"},
+			{searchEnergy, "read_visibility", "1", "int"},
+		}
+		for _, m := range metadata {
+			err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+				Platform: platform,
+				Locator:  locator(m.streamId),
+				Key:      m.key,
+				Value:    m.value,
+				ValType:  m.valType,
+				Height:   3,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "error inserting metadata %s", m.key)
+			}
+		}
+
+		err := procedure.TransferStreamOwnership(ctx, procedure.TransferStreamOwnershipInput{
+			Platform: platform,
+			Locator:  locator(searchPrimitive),
+			NewOwner: searchNewOwner.Address(),
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error transferring ownership")
+		}
+
+		otherPlatform := procedure.WithSigner(platform, searchOther.Bytes())
+		if err := createStreamAtHeight(ctx, otherPlatform, searchOtherId, "primitive", 3); err != nil {
+			return errors.Wrap(err, "error creating stream of the other data provider")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+// searchStreamIds returns the stream ids of search_streams rows
+func searchStreamIds(rows []procedure.ResultRow) []string {
+	streamIds := []string{}
+	for _, row := range rows {
+		streamIds = append(streamIds, row[1])
+	}
+	return streamIds
+}
+
+func testSearchStreamsFilters(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		composed := "composed"
+		deployer := "0x" + strings.ToUpper(searchDeployer.Address()[2:])
+		other := searchOther.Address()
+		newOwner := searchNewOwner.Address()
+		private := 1
+		public := 0
+		from := int64(2)
+		to := int64(2)
+
+		testCases := []struct {
+			name     string
+			input    procedure.SearchStreamsInput
+			expected []string
+		}{
+			{
+				name:     "data provider",
+				input:    procedure.SearchStreamsInput{DataProvider: &other},
+				expected: []string{searchOtherId.String()},
+			},
+			{
+				name:     "data provider in upper case",
+				input:    procedure.SearchStreamsInput{DataProvider: &deployer},
+				expected: []string{searchPrimitive.String(), searchFood.String(), searchEnergy.String()},
+			},
+			{
+				name:     "stream type",
+				input:    procedure.SearchStreamsInput{StreamType: &composed},
+				expected: []string{searchFood.String(), searchEnergy.String()},
+			},
+			{
+				name:     "current owner",
+				input:    procedure.SearchStreamsInput{Owner: &newOwner},
+				expected: []string{searchPrimitive.String()},
+			},
+			{
+				name:     "metadata pair",
+				input:    procedure.SearchStreamsInput{MetadataKeys: []string{"category"}, MetadataValues: []string{"food"}},
+				expected: []string{searchFood.String()},
+			},
+			{
+				name:     "float metadata pair",
+				input:    procedure.SearchStreamsInput{MetadataKeys: []string{"score"}, MetadataValues: []string{"1.50"}},
+				expected: []string{searchFood.String()},
+			},
+			{
+				name:     "float metadata pair of another value",
+				input:    procedure.SearchStreamsInput{MetadataKeys: []string{"score"}, MetadataValues: []string{"15"}},
+				expected: []string{},
+			},
+			{
+				name:     "private composed streams",
+				input:    procedure.SearchStreamsInput{StreamType: &composed, ReadVisibility: &private},
+				expected: []string{searchEnergy.String()},
+			},
+			{
+				name:     "public composed streams",
+				input:    procedure.SearchStreamsInput{StreamType: &composed, ReadVisibility: &public},
+				expected: []string{searchFood.String()},
+			},
+			{
+				name:     "creation range",
+				input:    procedure.SearchStreamsInput{CreatedFrom: &from, CreatedTo: &to},
+				expected: []string{searchFood.String()},
+			},
+			{
+				name:     "no match",
+				input:    procedure.SearchStreamsInput{Owner: &newOwner, MetadataKeys: []string{"category"}, MetadataValues: []string{"food"}},
+				expected: []string{},
+			},
+		}
+
+		for _, tc := range testCases {
+			tc.input.Platform = platform
+			tc.input.Height = 3
+			rows, err := procedure.SearchStreams(ctx, tc.input)
+			if err != nil {
+				return errors.Wrapf(err, "error searching streams by %s", tc.name)
+			}
+			assert.Equal(t, tc.expected, searchStreamIds(rows), "unexpected streams when searching by %s", tc.name)
+		}
+
+		rows, err := procedure.SearchStreams(ctx, procedure.SearchStreamsInput{
+			Platform: platform,
+			Owner:    &newOwner,
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error searching streams by owner")
+		}
+		if assert.Len(t, rows, 1) {
+			assert.Equal(t, searchDeployer.Address(), rows[0][0], "the data provider stays the deployer")
+			assert.Equal(t, newOwner, rows[0][3], "the owner is the current one")
+		}
+
+		return nil
+	}
+}
+
+func testSearchStreamsPagination(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		composed := "composed"
+
+		page, err := procedure.SearchStreams(ctx, procedure.SearchStreamsInput{
+			Platform:   platform,
+			StreamType: &composed,
+			Limit:      1,
+			Height:     3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error searching the first page")
+		}
+		assert.Equal(t, []string{searchFood.String()}, searchStreamIds(page))
+
+		page, err = procedure.SearchStreams(ctx, procedure.SearchStreamsInput{
+			Platform:   platform,
+			StreamType: &composed,
+			Limit:      1,
+			Cursor:     lastCursor(page),
+			Height:     3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error searching the second page")
+		}
+		assert.Equal(t, []string{searchEnergy.String()}, searchStreamIds(page))
+
+		return nil
+	}
+}
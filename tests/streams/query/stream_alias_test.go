@@ -0,0 +1,312 @@
+/*
+STREAM ALIAS TEST SUITE
+
+- [QUERY12] Streams can be queried by an alias of their data provider (TestStreamAliases)
+
+The aliases are checked for:
+
+- get_record, get_index and get_metadata resolve an alias to its stream
+- the other stream queries (aggregation, revisions, explain, window analytics, pairwise, pages) do too
+- aliases are unique per data provider, well formed and registered by the stream owner
+- a transferred alias resolves to its new stream, a removed one no longer resolves
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+var (
+	aliasDataProvider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000901")
+	aliasOtherWallet  = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000902")
+	aliasFoodStream   = types.StreamLocator{StreamId: util.GenerateStreamId("alias_food"), DataProvider: aliasDataProvider}
+	aliasEnergyStream = types.StreamLocator{StreamId: util.GenerateStreamId("alias_energy"), DataProvider: aliasDataProvider}
+)
+
+func TestStreamAliases(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "stream_alias_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithStreamAliasTestSetup(testQueriesByAlias(t)),
+			WithStreamAliasTestSetup(testOtherQueriesByAlias(t)),
+			WithStreamAliasTestSetup(testRegisterStreamAliasRules(t)),
+			WithStreamAliasTestSetup(testTransferAndRemoveStreamAlias(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithStreamAliasTestSetup creates two primitive streams and registers the alias us_cpi_food for the first one
+func WithStreamAliasTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, aliasDataProvider.Bytes())
+
+		for streamId, data := range map[util.StreamId]string{
+			aliasFoodStream.StreamId: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10    |
+			| 2          | 20    |
+			`,
+			aliasEnergyStream.StreamId: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 50    |
+			| 2          | 25    |
+			`,
+		} {
+			err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+				Platform:     platform,
+				StreamId:     streamId,
+				Height:       1,
+				MarkdownData: data,
+			})
+			if err != nil {
+				return errors.Wrap(err, "error setting up primitive stream")
+			}
+		}
+
+		err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  aliasFoodStream,
+			Key:      "category",
+			Value:    "food",
+			ValType:  "string",
+			Height:   1,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting metadata")
+		}
+
+		err = procedure.RegisterStreamAlias(ctx, procedure.StreamAliasInput{
+			Platform: platform,
+			Locator:  aliasFoodStream,
+			Alias:    "us_cpi_food",
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error registering alias")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+func testQueriesByAlias(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		fromTime := int64(1)
+		toTime := int64(2)
+		input := procedure.GetByAliasInput{
+			Platform:     platform,
+			DataProvider: aliasDataProvider,
+			Alias:        "us_cpi_food",
+			Key:          "category",
+			FromTime:     &fromTime,
+			ToTime:       &toTime,
+			Height:       2,
+		}
+
+		records, err := procedure.GetRecordByAlias(ctx, input)
+		if err != nil {
+			return errors.Wrap(err, "error getting records by alias")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "10.000000000000000000"},
+			{"2", "20.000000000000000000"},
+		}, records, "get_record should read the aliased stream")
+
+		index, err := procedure.GetIndexByAlias(ctx, input)
+		if err != nil {
+			return errors.Wrap(err, "error getting index by alias")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "100.000000000000000000"},
+			{"2", "200.000000000000000000"},
+		}, index, "get_index should read the aliased stream")
+
+		metadata, err := procedure.GetMetadataByAlias(ctx, input)
+		if err != nil {
+			return errors.Wrap(err, "error getting metadata by alias")
+		}
+		if assert.Len(t, metadata, 1, "get_metadata should read the aliased stream") {
+			assert.Equal(t, "food", metadata[0][4])
+		}
+
+		// stream ids are still accepted
+		records, err = procedure.GetRecord(ctx, procedure.GetRecordInput{
+			Platform:      platform,
+			StreamLocator: aliasEnergyStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Height:        2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting records by stream id")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "50.000000000000000000"},
+			{"2", "25.000000000000000000"},
+		}, records)
+
+		return nil
+	}
+}
+
+func testOtherQueriesByAlias(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		fromTime := int64(1)
+		toTime := int64(2)
+		// arguments after the data provider and the stream_id
+		argsByAction := map[string][]any{
+			"get_record_aggregated":     {fromTime, toTime, nil, "day", "avg"},
+			"get_record_revisions":      {fromTime, toTime},
+			"get_window_analytics":      {fromTime, toTime, nil, nil, "record", int64(86400), "sma"},
+			"get_pairwise_series":       {aliasDataProvider.Address(), aliasEnergyStream.StreamId.String(), fromTime, toTime, nil},
+			"get_pairwise_statistics":   {aliasDataProvider.Address(), aliasEnergyStream.StreamId.String(), fromTime, toTime, nil},
+			"get_record_page":           {fromTime, toTime, nil, 10, nil},
+			"get_record_revisions_page": {fromTime, toTime, 10, nil},
+		}
+
+		for action, args := range argsByAction {
+			expected, err := procedure.CallByAlias(ctx, procedure.GetByAliasInput{
+				Platform:     platform,
+				DataProvider: aliasDataProvider,
+				Alias:        aliasFoodStream.StreamId.String(),
+				Height:       1,
+			}, action, args)
+			if err != nil {
+				return errors.Wrapf(err, "error calling %s by stream_id", action)
+			}
+
+			result, err := procedure.CallByAlias(ctx, procedure.GetByAliasInput{
+				Platform:     platform,
+				DataProvider: aliasDataProvider,
+				Alias:        "us_cpi_food",
+				Height:       1,
+			}, action, args)
+			if err != nil {
+				return errors.Wrapf(err, "error calling %s by alias", action)
+			}
+			assert.NotEmpty(t, expected, action)
+			assert.Equal(t, expected, result, "%s by alias", action)
+		}
+
+		// the alias resolves to the primitive stream, which can't be explained
+		_, err := procedure.CallByAlias(ctx, procedure.GetByAliasInput{
+			Platform:     platform,
+			DataProvider: aliasDataProvider,
+			Alias:        "us_cpi_food",
+			Height:       1,
+		}, "explain_composed_record", []any{fromTime, toTime, nil})
+		assert.ErrorContains(t, err, "only supports composed streams")
+
+		return nil
+	}
+}
+
+func testRegisterStreamAliasRules(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := procedure.RegisterStreamAlias(ctx, procedure.StreamAliasInput{
+			Platform: platform,
+			Locator:  aliasEnergyStream,
+			Alias:    "us_cpi_food",
+			Height:   3,
+		})
+		assert.ErrorContains(t, err, "Alias already registered for stream")
+
+		aliasAsId := util.GenerateStreamId("alias_as_id")
+		for _, alias := range []string{"", "US_CPI", "us-cpi", aliasAsId.String()} {
+			err = procedure.RegisterStreamAlias(ctx, procedure.StreamAliasInput{
+				Platform: platform,
+				Locator:  aliasEnergyStream,
+				Alias:    alias,
+				Height:   3,
+			})
+			assert.ErrorContains(t, err, "Invalid alias format", "alias %q should be rejected", alias)
+		}
+
+		err = procedure.RegisterStreamAlias(ctx, procedure.StreamAliasInput{
+			Platform: procedure.WithSigner(platform, aliasOtherWallet.Bytes()),
+			Locator:  aliasEnergyStream,
+			Alias:    "us_energy",
+			Height:   3,
+		})
+		assert.ErrorContains(t, err, "Only stream owner can register an alias")
+
+		// a stream can have several aliases
+		err = procedure.RegisterStreamAlias(ctx, procedure.StreamAliasInput{
+			Platform: platform,
+			Locator:  aliasFoodStream,
+			Alias:    "food",
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error registering a second alias")
+		}
+
+		return nil
+	}
+}
+
+func testTransferAndRemoveStreamAlias(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := procedure.TransferStreamAlias(ctx, procedure.StreamAliasInput{
+			Platform: platform,
+			Locator:  aliasEnergyStream,
+			Alias:    "us_cpi_food",
+			Height:   3,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error transferring alias")
+		}
+
+		fromTime := int64(1)
+		toTime := int64(2)
+		input := procedure.GetByAliasInput{
+			Platform:     platform,
+			DataProvider: aliasDataProvider,
+			Alias:        "us_cpi_food",
+			FromTime:     &fromTime,
+			ToTime:       &toTime,
+			Height:       3,
+		}
+
+		records, err := procedure.GetRecordByAlias(ctx, input)
+		if err != nil {
+			return errors.Wrap(err, "error getting records by alias")
+		}
+		assert.Equal(t, []procedure.ResultRow{
+			{"1", "50.000000000000000000"},
+			{"2", "25.000000000000000000"},
+		}, records, "the alias should resolve to its new stream")
+
+		err = procedure.RemoveStreamAlias(ctx, procedure.StreamAliasInput{
+			Platform: platform,
+			Locator:  aliasEnergyStream,
+			Alias:    "us_cpi_food",
+			Height:   4,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error removing alias")
+		}
+
+		input.Height = 4
+		_, err = procedure.GetRecordByAlias(ctx, input)
+		assert.Error(t, err, "a removed alias should no longer resolve")
+
+		return nil
+	}
+}
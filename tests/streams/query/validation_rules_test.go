@@ -0,0 +1,284 @@
+/*
+VALIDATION RULES TEST SUITE
+
+- [PRIMITIVE07] Inserts are rejected when they break the stream's validation rules (TestValidationRules)
+
+The stream has the rules min_value 0, max_value 1000, max_pct_change 50, min_event_time 1
+and allow_backfill false, with the records:
+
+| event_time | value |
+| 1          | 100   |
+| 2          | 110   |
+
+A second stream without rules is interleaved in batches, the latest record of the first
+stream is tracked across its rows.
+*/
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+var validationStreamLocator = types.StreamLocator{
+	StreamId:     util.GenerateStreamId("primitive_stream_validation_rules"),
+	DataProvider: util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000000123"),
+}
+
+var validationOtherStreamLocator = types.StreamLocator{
+	StreamId:     util.GenerateStreamId("primitive_stream_validation_rules_other"),
+	DataProvider: validationStreamLocator.DataProvider,
+}
+
+func TestValidationRules(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "validation_rules_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithValidationRulesTestSetup(testValidationValueBounds(t)),
+			WithValidationRulesTestSetup(testValidationMaxPctChange(t)),
+			WithValidationRulesTestSetup(testValidationEventTime(t)),
+			WithValidationRulesTestSetup(testValidationRuleTypes(t)),
+			WithValidationRulesTestSetup(testValidationInterleavedBatch(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithValidationRulesTestSetup creates the primitive stream with its records, then sets the validation rules
+func WithValidationRulesTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, validationStreamLocator.DataProvider.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: validationStreamLocator.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 100   |
+			| 2          | 110   |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		err = setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: validationOtherStreamLocator.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 1     |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up the stream without rules")
+		}
+
+		rules := []struct {
+			key     string
+			value   string
+			valType string
+		}{
+			{"min_value", "0", "float"},
+			{"max_value", "1000", "float"},
+			{"max_pct_change", "50", "float"},
+			{"min_event_time", "1", "int"},
+			{"allow_backfill", "false", "bool"},
+		}
+		for _, rule := range rules {
+			err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+				Platform: platform,
+				Locator:  validationStreamLocator,
+				Key:      rule.key,
+				Value:    rule.value,
+				ValType:  rule.valType,
+				Height:   1,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "error setting validation rule %s", rule.key)
+			}
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+func insertValidationRecord(ctx context.Context, platform *kwilTesting.Platform, eventTime int64, value float64) error {
+	return setup.ExecuteInsertRecord(ctx, platform, validationStreamLocator, setup.InsertRecordInput{
+		EventTime: eventTime,
+		Value:     value,
+	}, 2)
+}
+
+func insertValidationRecords(ctx context.Context, platform *kwilTesting.Platform, records []setup.InsertRecordInput) error {
+	return setup.InsertPrimitiveDataBatch(ctx, setup.InsertPrimitiveDataInput{
+		Platform: platform,
+		PrimitiveStream: setup.PrimitiveStreamWithData{
+			PrimitiveStreamDefinition: setup.PrimitiveStreamDefinition{
+				StreamLocator: validationStreamLocator,
+			},
+			Data: records,
+		},
+		Height: 2,
+	})
+}
+
+func testValidationValueBounds(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := insertValidationRecord(ctx, platform, 3, -1)
+		assert.ErrorContains(t, err, "value is below min_value", "values below min_value should be rejected")
+
+		err = insertValidationRecords(ctx, platform, []setup.InsertRecordInput{
+			{EventTime: 3, Value: 120},
+			{EventTime: 4, Value: 2000},
+		})
+		assert.ErrorContains(t, err, "record 2 (stream_id="+validationStreamLocator.StreamId.String()+", event_time=4", "the error should point to the invalid row")
+		assert.ErrorContains(t, err, "value is above max_value", "values above max_value should be rejected")
+
+		err = insertValidationRecord(ctx, platform, 3, 120)
+		assert.NoError(t, err, "values within the rules should be accepted")
+
+		return nil
+	}
+}
+
+func testValidationMaxPctChange(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// 110 -> 200 is a change of ~81%
+		err := insertValidationRecord(ctx, platform, 3, 200)
+		assert.ErrorContains(t, err, "exceeds max_pct_change", "jumps above max_pct_change should be rejected")
+
+		// the previous row of the batch is the reference of the next one: 150 -> 500
+		err = insertValidationRecords(ctx, platform, []setup.InsertRecordInput{
+			{EventTime: 3, Value: 150},
+			{EventTime: 4, Value: 500},
+		})
+		assert.ErrorContains(t, err, "record 2", "the jump from the previous batch row should be rejected")
+		assert.ErrorContains(t, err, "exceeds max_pct_change", "the jump from the previous batch row should be rejected")
+
+		err = insertValidationRecords(ctx, platform, []setup.InsertRecordInput{
+			{EventTime: 3, Value: 150},
+			{EventTime: 4, Value: 200},
+		})
+		assert.NoError(t, err, "gradual changes should be accepted")
+
+		return nil
+	}
+}
+
+func testValidationEventTime(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := insertValidationRecord(ctx, platform, 0, 100)
+		assert.ErrorContains(t, err, "event_time is before min_event_time", "event times before min_event_time should be rejected")
+
+		// a new revision of a stored record is a backfill
+		err = insertValidationRecord(ctx, platform, 2, 105)
+		assert.ErrorContains(t, err, "backfill is not allowed", "backfills should be rejected")
+
+		err = insertValidationRecords(ctx, platform, []setup.InsertRecordInput{
+			{EventTime: 4, Value: 110},
+			{EventTime: 3, Value: 110},
+		})
+		assert.ErrorContains(t, err, "record 2", "out of order batch rows should be rejected")
+		assert.ErrorContains(t, err, "backfill is not allowed", "out of order batch rows should be rejected")
+
+		// backfills are accepted again once allowed
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  validationStreamLocator,
+			Key:      "allow_backfill",
+			Value:    "true",
+			ValType:  "bool",
+			Height:   2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error allowing backfill")
+		}
+
+		err = insertValidationRecord(ctx, platform, 2, 105)
+		assert.NoError(t, err, "backfills should be accepted when allowed")
+
+		return nil
+	}
+}
+
+func testValidationRuleTypes(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		err := procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  validationStreamLocator,
+			Key:      "max_value",
+			Value:    "1000",
+			ValType:  "string",
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, `Validation rule "max_value" must be of type "float"`, "rules with the wrong type would be ignored")
+
+		err = procedure.InsertMetadata(ctx, procedure.InsertMetadataInput{
+			Platform: platform,
+			Locator:  validationStreamLocator,
+			Key:      "allow_backfill",
+			Value:    "1",
+			ValType:  "int",
+			Height:   2,
+		})
+		assert.ErrorContains(t, err, `Validation rule "allow_backfill" must be of type "bool"`, "rules with the wrong type would be ignored")
+
+		return nil
+	}
+}
+
+func testValidationInterleavedBatch(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		interleaved := []types.StreamLocator{validationStreamLocator, validationOtherStreamLocator, validationStreamLocator}
+
+		// 150 -> 500 is checked against the row before the other stream's row
+		err := procedure.InsertRecords(ctx, procedure.InsertRecordsInput{
+			Platform:       platform,
+			StreamLocators: interleaved,
+			EventTimes:     []int64{3, 2, 4},
+			Values:         []string{"150", "1000", "500"},
+			Height:         2,
+		})
+		assert.ErrorContains(t, err, "record 3", "the jump from the stream's previous batch row should be rejected")
+		assert.ErrorContains(t, err, "exceeds max_pct_change", "the jump from the stream's previous batch row should be rejected")
+
+		// event_time 3 comes after event_time 4 of the same stream
+		err = procedure.InsertRecords(ctx, procedure.InsertRecordsInput{
+			Platform:       platform,
+			StreamLocators: interleaved,
+			EventTimes:     []int64{4, 2, 3},
+			Values:         []string{"110", "1", "110"},
+			Height:         2,
+		})
+		assert.ErrorContains(t, err, "record 3", "out of order rows of the stream should be rejected")
+		assert.ErrorContains(t, err, "backfill is not allowed, latest event_time is 4", "out of order rows of the stream should be rejected")
+
+		err = procedure.InsertRecords(ctx, procedure.InsertRecordsInput{
+			Platform:       platform,
+			StreamLocators: interleaved,
+			EventTimes:     []int64{3, 2, 4},
+			Values:         []string{"150", "1000", "200"},
+			Height:         2,
+		})
+		assert.NoError(t, err, "gradual changes should be accepted")
+
+		return nil
+	}
+}
@@ -0,0 +1,250 @@
+/*
+WINDOW ANALYTICS TEST SUITE
+
+- [QUERY13] Authorized users can query rolling statistics of a stream (TestWindowAnalytics)
+
+get_window_analytics is checked for:
+
+- sma, ema, stddev, min, max and zscore over a window in seconds
+- rows before $from fill the windows of the first rows of the range
+- a statistic doesn't depend on $from, the ema being seeded with the first row of its window
+- the index source uses base_time like get_index
+- frozen_at is honored the same way as get_record
+- invalid sources, methods and windows are rejected
+*/
+
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trufnetwork/node/internal/migrations"
+	testutils "github.com/trufnetwork/node/tests/streams/utils"
+	"github.com/trufnetwork/node/tests/streams/utils/procedure"
+	"github.com/trufnetwork/node/tests/streams/utils/setup"
+	"github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+var (
+	windowDataProvider = util.Unsafe_NewEthereumAddressFromString("0x0000000000000000000000000000000000001001")
+	windowStream       = types.StreamLocator{StreamId: util.GenerateStreamId("window_analytics"), DataProvider: windowDataProvider}
+)
+
+func TestWindowAnalytics(t *testing.T) {
+	kwilTesting.RunSchemaTest(t, kwilTesting.SchemaTest{
+		Name:        "window_analytics_test",
+		SeedScripts: migrations.GetSeedScriptPaths(),
+		FunctionTests: []kwilTesting.TestFunc{
+			WithWindowAnalyticsTestSetup(testWindowAnalyticsMethods(t)),
+			WithWindowAnalyticsTestSetup(testWindowAnalyticsIndependentOfFrom(t)),
+			WithWindowAnalyticsTestSetup(testWindowAnalyticsIndexSource(t)),
+			WithWindowAnalyticsTestSetup(testWindowAnalyticsFrozenAt(t)),
+			WithWindowAnalyticsTestSetup(testWindowAnalyticsInvalidInput(t)),
+		},
+	}, testutils.GetTestOptions())
+}
+
+// WithWindowAnalyticsTestSetup creates a primitive stream with a value per second, and a revision of the last one at height 2
+func WithWindowAnalyticsTestSetup(testFn func(ctx context.Context, platform *kwilTesting.Platform) error) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		platform = procedure.WithSigner(platform, windowDataProvider.Bytes())
+
+		err := setup.SetupPrimitiveFromMarkdown(ctx, setup.MarkdownPrimitiveSetupInput{
+			Platform: platform,
+			StreamId: windowStream.StreamId,
+			Height:   1,
+			MarkdownData: `
+			| event_time | value |
+			|------------|-------|
+			| 1          | 10    |
+			| 2          | 20    |
+			| 3          | 30    |
+			| 4          | 40    |
+			| 5          | 50    |
+			`,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error setting up primitive stream")
+		}
+
+		err = setup.InsertPrimitiveDataBatch(ctx, setup.InsertPrimitiveDataInput{
+			Platform: platform,
+			PrimitiveStream: setup.PrimitiveStreamWithData{
+				PrimitiveStreamDefinition: setup.PrimitiveStreamDefinition{
+					StreamLocator: windowStream,
+				},
+				Data: []setup.InsertRecordInput{
+					{EventTime: 5, Value: 80},
+				},
+			},
+			Height: 2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error inserting revision")
+		}
+
+		return testFn(ctx, platform)
+	}
+}
+
+func getWindowAnalytics(ctx context.Context, platform *kwilTesting.Platform, source string, window int64, method string, frozenAt, baseTime *int64) ([]procedure.ResultRow, error) {
+	return getWindowAnalyticsFrom(ctx, platform, 3, source, window, method, frozenAt, baseTime)
+}
+
+func getWindowAnalyticsFrom(ctx context.Context, platform *kwilTesting.Platform, fromTime int64, source string, window int64, method string, frozenAt, baseTime *int64) ([]procedure.ResultRow, error) {
+	toTime := int64(5)
+	return procedure.GetWindowAnalytics(ctx, procedure.GetWindowAnalyticsInput{
+		Platform:      platform,
+		StreamLocator: windowStream,
+		FromTime:      &fromTime,
+		ToTime:        &toTime,
+		FrozenAt:      frozenAt,
+		BaseTime:      baseTime,
+		Source:        source,
+		Window:        window,
+		Method:        method,
+		Height:        2,
+	})
+}
+
+// assertWindowValues compares the rows with the expected event times and values.
+// Values are compared on the digits given, the last digits of square roots and divisions being rounded.
+func assertWindowValues(t *testing.T, rows []procedure.ResultRow, expected [][2]string, msg string) {
+	if !assert.Len(t, rows, len(expected), msg) {
+		return
+	}
+	for i, row := range rows {
+		assert.Equal(t, expected[i][0], row[0], msg)
+		assert.True(t, strings.HasPrefix(row[1], expected[i][1]), "%s: value %s at %s should start with %s", msg, row[1], row[0], expected[i][1])
+	}
+}
+
+func testWindowAnalyticsMethods(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// windows of 3 seconds hold 3 records: 10 20 30, 20 30 40, 30 40 80
+		expectedByMethod := map[string][][2]string{
+			"sma":    {{"3", "20.000000000000000000"}, {"4", "30.000000000000000000"}, {"5", "50.000000000000000000"}},
+			"ema":    {{"3", "22.500000000000000000"}, {"4", "32.500000000000000000"}, {"5", "57.500000000000000000"}},
+			"stddev": {{"3", "8.16496580927"}, {"4", "8.16496580927"}, {"5", "21.6024689946"}},
+			"min":    {{"3", "10.000000000000000000"}, {"4", "20.000000000000000000"}, {"5", "30.000000000000000000"}},
+			"max":    {{"3", "30.000000000000000000"}, {"4", "40.000000000000000000"}, {"5", "80.000000000000000000"}},
+			"zscore": {{"3", "1.22474487139"}, {"4", "1.22474487139"}, {"5", "1.38873014965"}},
+		}
+
+		for _, method := range []string{"sma", "ema", "stddev", "min", "max", "zscore"} {
+			result, err := getWindowAnalytics(ctx, platform, "record", 3, method, nil, nil)
+			if err != nil {
+				return errors.Wrapf(err, "error getting %s", method)
+			}
+			assertWindowValues(t, result, expectedByMethod[method], method)
+		}
+
+		// a window shorter than the spacing of the records only holds the current record
+		result, err := getWindowAnalytics(ctx, platform, "record", 1, "stddev", nil, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting stddev of single record windows")
+		}
+		assertWindowValues(t, result, [][2]string{{"3", "0.000000000000000000"}, {"4", "0.000000000000000000"}, {"5", "0.000000000000000000"}}, "single record stddev")
+
+		result, err = getWindowAnalytics(ctx, platform, "record", 1, "zscore", nil, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting zscore of single record windows")
+		}
+		assert.Empty(t, result, "rows with a zero stddev should have no zscore")
+
+		return nil
+	}
+}
+
+func testWindowAnalyticsIndependentOfFrom(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		// the window of event_time 5 holds 30 40 80 whether the range starts at 1 or at 5
+		for _, fromTime := range []int64{1, 5} {
+			result, err := getWindowAnalyticsFrom(ctx, platform, fromTime, "record", 3, "ema", nil, nil)
+			if err != nil {
+				return errors.Wrapf(err, "error getting ema from %d", fromTime)
+			}
+			if !assert.NotEmpty(t, result, "ema from %d", fromTime) {
+				continue
+			}
+			last := result[len(result)-1]
+			assert.Equal(t, procedure.ResultRow{"5", "57.500000000000000000"}, last, "ema at 5 from %d", fromTime)
+		}
+
+		// from 6, the first row is the last one at or before it, with its whole window
+		fromTime := int64(6)
+		toTime := int64(6)
+		result, err := procedure.GetWindowAnalytics(ctx, procedure.GetWindowAnalyticsInput{
+			Platform:      platform,
+			StreamLocator: windowStream,
+			FromTime:      &fromTime,
+			ToTime:        &toTime,
+			Source:        "record",
+			Window:        3,
+			Method:        "sma",
+			Height:        2,
+		})
+		if err != nil {
+			return errors.Wrap(err, "error getting sma from after the last record")
+		}
+		assertWindowValues(t, result, [][2]string{{"5", "50.000000000000000000"}}, "sma of the anchor row")
+
+		return nil
+	}
+}
+
+func testWindowAnalyticsIndexSource(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		baseTime := int64(1)
+		result, err := getWindowAnalytics(ctx, platform, "index", 3, "sma", nil, &baseTime)
+		if err != nil {
+			return errors.Wrap(err, "error getting index sma")
+		}
+		assertWindowValues(t, result, [][2]string{
+			{"3", "200.000000000000000000"},
+			{"4", "300.000000000000000000"},
+			{"5", "500.000000000000000000"},
+		}, "index sma")
+
+		return nil
+	}
+}
+
+func testWindowAnalyticsFrozenAt(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		frozenAt := int64(1)
+		result, err := getWindowAnalytics(ctx, platform, "record", 3, "max", &frozenAt, nil)
+		if err != nil {
+			return errors.Wrap(err, "error getting frozen max")
+		}
+		assertWindowValues(t, result, [][2]string{
+			{"3", "30.000000000000000000"},
+			{"4", "40.000000000000000000"},
+			{"5", "50.000000000000000000"},
+		}, "the revision at height 2 should be ignored")
+
+		return nil
+	}
+}
+
+func testWindowAnalyticsInvalidInput(t *testing.T) func(ctx context.Context, platform *kwilTesting.Platform) error {
+	return func(ctx context.Context, platform *kwilTesting.Platform) error {
+		_, err := getWindowAnalytics(ctx, platform, "median", 3, "sma", nil, nil)
+		assert.ErrorContains(t, err, "invalid source")
+
+		_, err = getWindowAnalytics(ctx, platform, "record", 3, "median", nil, nil)
+		assert.ErrorContains(t, err, "invalid method")
+
+		_, err = getWindowAnalytics(ctx, platform, "record", 0, "sma", nil, nil)
+		assert.ErrorContains(t, err, "window must be a positive number of seconds")
+
+		return nil
+	}
+}
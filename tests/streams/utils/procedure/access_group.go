@@ -0,0 +1,113 @@
+package procedure
+
+import (
+	"context"
+
+	"github.com/kwilteam/kwil-db/common"
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+type AccessGroupInput struct {
+	Platform *kwilTesting.Platform
+	GroupId  string
+	Height   int64
+}
+
+type AccessGroupMembersInput struct {
+	Platform *kwilTesting.Platform
+	GroupId  string
+	Wallets  []string
+	Height   int64
+}
+
+// CreateAccessGroup creates an access group owned by the platform deployer
+func CreateAccessGroup(ctx context.Context, input AccessGroupInput) error {
+	return callAccessGroupAction(ctx, input.Platform, input.Height, "create_access_group", []any{input.GroupId})
+}
+
+// DeleteAccessGroup deletes an access group and its memberships
+func DeleteAccessGroup(ctx context.Context, input AccessGroupInput) error {
+	return callAccessGroupAction(ctx, input.Platform, input.Height, "delete_access_group", []any{input.GroupId})
+}
+
+// AddAccessGroupMembers adds wallets to an access group
+func AddAccessGroupMembers(ctx context.Context, input AccessGroupMembersInput) error {
+	return callAccessGroupAction(ctx, input.Platform, input.Height, "add_access_group_members", []any{input.GroupId, input.Wallets})
+}
+
+// RemoveAccessGroupMembers removes wallets from an access group
+func RemoveAccessGroupMembers(ctx context.Context, input AccessGroupMembersInput) error {
+	return callAccessGroupAction(ctx, input.Platform, input.Height, "remove_access_group_members", []any{input.GroupId, input.Wallets})
+}
+
+// GetAccessGroupMembers lists the members of an access group
+func GetAccessGroupMembers(ctx context.Context, input AccessGroupInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_access_group_members", []any{
+		input.GroupId,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		copy(values, row.Values)
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in get_access_group_members")
+	}
+
+	return processResultRows(resultRows)
+}
+
+// callAccessGroupAction calls an access group action that returns nothing, signed by the platform deployer
+func callAccessGroupAction(ctx context.Context, platform *kwilTesting.Platform, height int64, action string, args []any) error {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: height},
+		Signer:       platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := platform.Engine.Call(engineContext, platform.DB, "", action, args, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrapf(r.Error, "error in %s", action)
+	}
+
+	return nil
+}
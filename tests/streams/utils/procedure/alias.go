@@ -0,0 +1,131 @@
+package procedure
+
+import (
+	"context"
+
+	"github.com/kwilteam/kwil-db/common"
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	trufTypes "github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+type StreamAliasInput struct {
+	Platform *kwilTesting.Platform
+	Locator  trufTypes.StreamLocator
+	Alias    string
+	Height   int64
+}
+
+// RegisterStreamAlias gives an alias to the stream, signed by the platform deployer
+func RegisterStreamAlias(ctx context.Context, input StreamAliasInput) error {
+	return callAliasAction(ctx, input.Platform, input.Height, "register_stream_alias", []any{
+		input.Locator.DataProvider.Address(),
+		input.Locator.StreamId.String(),
+		input.Alias,
+	})
+}
+
+// TransferStreamAlias points the alias of the locator's data provider to the locator's stream
+func TransferStreamAlias(ctx context.Context, input StreamAliasInput) error {
+	return callAliasAction(ctx, input.Platform, input.Height, "transfer_stream_alias", []any{
+		input.Locator.DataProvider.Address(),
+		input.Alias,
+		input.Locator.StreamId.String(),
+	})
+}
+
+// RemoveStreamAlias deletes the alias of the locator's data provider
+func RemoveStreamAlias(ctx context.Context, input StreamAliasInput) error {
+	return callAliasAction(ctx, input.Platform, input.Height, "remove_stream_alias", []any{
+		input.Locator.DataProvider.Address(),
+		input.Alias,
+	})
+}
+
+type GetByAliasInput struct {
+	Platform     *kwilTesting.Platform
+	DataProvider util.EthereumAddress
+	Alias        string
+	Key          string // metadata key, for GetMetadataByAlias
+	FromTime     *int64
+	ToTime       *int64
+	Height       int64
+}
+
+// GetRecordByAlias calls get_record with the alias in place of the stream_id
+func GetRecordByAlias(ctx context.Context, input GetByAliasInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_record", []any{
+		input.DataProvider.Address(),
+		input.Alias,
+		input.FromTime,
+		input.ToTime,
+		nil,
+	})
+}
+
+// GetIndexByAlias calls get_index with the alias in place of the stream_id
+func GetIndexByAlias(ctx context.Context, input GetByAliasInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_index", []any{
+		input.DataProvider.Address(),
+		input.Alias,
+		input.FromTime,
+		input.ToTime,
+		nil,
+		nil,
+	})
+}
+
+// GetMetadataByAlias calls get_metadata with the alias in place of the stream_id
+func GetMetadataByAlias(ctx context.Context, input GetByAliasInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_metadata", []any{
+		input.DataProvider.Address(),
+		input.Alias,
+		input.Key,
+		nil,
+		nil,
+		nil,
+		nil,
+	})
+}
+
+// CallByAlias calls a stream query with the data provider and the alias in place of the stream_id,
+// followed by the remaining arguments of the action
+func CallByAlias(ctx context.Context, input GetByAliasInput, action string, args []any) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, action, append([]any{
+		input.DataProvider.Address(),
+		input.Alias,
+	}, args...))
+}
+
+// callAliasAction calls an alias action that returns nothing, signed by the platform deployer
+func callAliasAction(ctx context.Context, platform *kwilTesting.Platform, height int64, action string, args []any) error {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: height},
+		Signer:       platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := platform.Engine.Call(engineContext, platform.DB, "", action, args, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrapf(r.Error, "error in %s", action)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package procedure
+
+import (
+	"context"
+
+	"github.com/kwilteam/kwil-db/common"
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+type GetAuditLogInput struct {
+	Platform     *kwilTesting.Platform
+	DataProvider *string
+	StreamId     *string
+	Caller       *string
+	Action       *string
+	Limit        *int
+	Offset       *int
+	Height       int64
+}
+
+// GetAuditLog lists audit log entries, newest first.
+// The txid column is left out, as it changes on every run.
+func GetAuditLog(ctx context.Context, input GetAuditLogInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_audit_log", []any{
+		input.DataProvider,
+		input.StreamId,
+		input.Caller,
+		input.Action,
+		input.Limit,
+		input.Offset,
+	}, func(row *common.Row) error {
+		values := append([]any{row.Values[0]}, row.Values[2:]...)
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in get_audit_log")
+	}
+
+	return processResultRows(resultRows)
+}
@@ -0,0 +1,51 @@
+package procedure
+
+import (
+	"context"
+
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	trufTypes "github.com/trufnetwork/sdk-go/core/types"
+)
+
+// GetHeightAtTime calls get_height_at_time, the height of the chain at the timestamp
+func GetHeightAtTime(ctx context.Context, platform *kwilTesting.Platform, timestamp int64, height int64) ([]ResultRow, error) {
+	return callPageAction(ctx, platform, height, "get_height_at_time", []any{timestamp})
+}
+
+// GetTimeAtHeight calls get_time_at_height, the timestamp of the last mapped height at or before blockHeight
+func GetTimeAtHeight(ctx context.Context, platform *kwilTesting.Platform, blockHeight int64, height int64) ([]ResultRow, error) {
+	return callPageAction(ctx, platform, height, "get_time_at_height", []any{blockHeight})
+}
+
+type GetAtFrozenTimeInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator trufTypes.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAtTime  *int64
+	BaseTime      *int64 // for GetIndexAtFrozenTime
+	Height        int64
+}
+
+// GetRecordAtFrozenTime calls get_record_at_frozen_time
+func GetRecordAtFrozenTime(ctx context.Context, input GetAtFrozenTimeInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_record_at_frozen_time", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAtTime,
+	})
+}
+
+// GetIndexAtFrozenTime calls get_index_at_frozen_time
+func GetIndexAtFrozenTime(ctx context.Context, input GetAtFrozenTimeInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_index_at_frozen_time", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAtTime,
+		input.BaseTime,
+	})
+}
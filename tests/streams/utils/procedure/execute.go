@@ -65,6 +65,191 @@ func GetRecord(ctx context.Context, input GetRecordInput) ([]ResultRow, error) {
 	return processResultRows(resultRows)
 }
 
+func GetRecordAggregated(ctx context.Context, input GetRecordAggregatedInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getRecordAggregated")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_record_aggregated", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+		input.Bucket,
+		input.Method,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getRecordAggregated")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getRecordAggregated")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func GetWindowAnalytics(ctx context.Context, input GetWindowAnalyticsInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getWindowAnalytics")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_window_analytics", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+		input.BaseTime,
+		input.Source,
+		input.Window,
+		input.Method,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getWindowAnalytics")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getWindowAnalytics")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func GetRecordRevisions(ctx context.Context, input GetRecordRevisionsInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getRecordRevisions")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_record_revisions", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getRecordRevisions")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getRecordRevisions")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func ExplainComposedRecord(ctx context.Context, input ExplainComposedRecordInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in explainComposedRecord")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "explain_composed_record", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in explainComposedRecord")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in explainComposedRecord")
+	}
+
+	return processResultRows(resultRows)
+}
+
 func GetIndex(ctx context.Context, input GetIndexInput) ([]ResultRow, error) {
 	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
 	if err != nil {
@@ -86,15 +271,204 @@ func GetIndex(ctx context.Context, input GetIndexInput) ([]ResultRow, error) {
 	}
 
 	var resultRows [][]any
-	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_index", []any{
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_index", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+		input.BaseTime,
+	}, func(row *common.Row) error {
+		// Convert the row values to []any
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getIndex")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getIndex")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func GetIndexChange(ctx context.Context, input GetIndexChangeInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getIndexChange")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_index_change", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+		input.BaseTime,
+		input.Interval,
+	}, func(row *common.Row) error {
+		// Convert the row values to []any
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getIndexChange")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getIndexChange")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func GetIndexChangeByType(ctx context.Context, input GetIndexChangeByTypeInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getIndexChangeByType")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_index_change_by_type", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+		input.BaseTime,
+		input.Interval,
+		input.ChangeType,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getIndexChangeByType")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getIndexChangeByType")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func GetRecordFilled(ctx context.Context, input GetRecordFilledInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getRecordFilled")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_record_filled", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+		input.FillMode,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getRecordFilled")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getRecordFilled")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func GetIndexFilled(ctx context.Context, input GetIndexFilledInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getIndexFilled")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_index_filled", []any{
 		input.StreamLocator.DataProvider.Address(),
 		input.StreamLocator.StreamId.String(),
 		input.FromTime,
 		input.ToTime,
 		input.FrozenAt,
 		input.BaseTime,
+		input.FillMode,
 	}, func(row *common.Row) error {
-		// Convert the row values to []any
 		values := make([]any, len(row.Values))
 		for i, v := range row.Values {
 			values[i] = v
@@ -103,19 +477,19 @@ func GetIndex(ctx context.Context, input GetIndexInput) ([]ResultRow, error) {
 		return nil
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "error in getIndex")
+		return nil, errors.Wrap(err, "error in getIndexFilled")
 	}
 	if r.Error != nil {
-		return nil, errors.Wrap(r.Error, "error in getIndex")
+		return nil, errors.Wrap(r.Error, "error in getIndexFilled")
 	}
 
 	return processResultRows(resultRows)
 }
 
-func GetIndexChange(ctx context.Context, input GetIndexChangeInput) ([]ResultRow, error) {
+func GetPairwiseSeries(ctx context.Context, input GetPairwiseInput) ([]ResultRow, error) {
 	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
 	if err != nil {
-		return nil, errors.Wrap(err, "error in getIndexChange")
+		return nil, errors.Wrap(err, "error in getPairwiseSeries")
 	}
 
 	txContext := &common.TxContext{
@@ -133,16 +507,15 @@ func GetIndexChange(ctx context.Context, input GetIndexChangeInput) ([]ResultRow
 	}
 
 	var resultRows [][]any
-	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_index_change", []any{
-		input.StreamLocator.DataProvider.Address(),
-		input.StreamLocator.StreamId.String(),
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_pairwise_series", []any{
+		input.StreamA.DataProvider.Address(),
+		input.StreamA.StreamId.String(),
+		input.StreamB.DataProvider.Address(),
+		input.StreamB.StreamId.String(),
 		input.FromTime,
 		input.ToTime,
 		input.FrozenAt,
-		input.BaseTime,
-		input.Interval,
 	}, func(row *common.Row) error {
-		// Convert the row values to []any
 		values := make([]any, len(row.Values))
 		for i, v := range row.Values {
 			values[i] = v
@@ -151,10 +524,57 @@ func GetIndexChange(ctx context.Context, input GetIndexChangeInput) ([]ResultRow
 		return nil
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "error in getIndexChange")
+		return nil, errors.Wrap(err, "error in getPairwiseSeries")
 	}
 	if r.Error != nil {
-		return nil, errors.Wrap(r.Error, "error in getIndexChange")
+		return nil, errors.Wrap(r.Error, "error in getPairwiseSeries")
+	}
+
+	return processResultRows(resultRows)
+}
+
+func GetPairwiseStatistics(ctx context.Context, input GetPairwiseInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getPairwiseStatistics")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_pairwise_statistics", []any{
+		input.StreamA.DataProvider.Address(),
+		input.StreamA.StreamId.String(),
+		input.StreamB.DataProvider.Address(),
+		input.StreamB.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getPairwiseStatistics")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getPairwiseStatistics")
 	}
 
 	return processResultRows(resultRows)
@@ -408,6 +828,50 @@ func GetCategoryStreams(ctx context.Context, input GetCategoryStreamsInput) ([]R
 	return processResultRows(resultRows)
 }
 
+func GetStreamDependents(ctx context.Context, input GetStreamDependentsInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getStreamDependents")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: 0,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_stream_dependents", []any{
+		input.DataProvider,
+		input.StreamId,
+		input.Recursive,
+		input.ActiveAt,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		for i, v := range row.Values {
+			values[i] = v
+		}
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error in getStreamDependents")
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in getStreamDependents")
+	}
+
+	return processResultRows(resultRows)
+}
+
 // FilterStreamsByExistence filters streams based on existence, returning either existing or non-existing streams
 // based on the ReturnExisting flag in the input
 func FilterStreamsByExistence(ctx context.Context, input FilterStreamsByExistenceInput) ([]types.StreamLocator, error) {
@@ -504,6 +968,222 @@ func DisableTaxonomy(ctx context.Context, input DisableTaxonomyInput) error {
 	return nil
 }
 
+func RetractRecord(ctx context.Context, input RetractRecordInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error in RetractRecord")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "retract_record", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.EventTime,
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error in RetractRecord")
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in RetractRecord")
+	}
+
+	return nil
+}
+
+// InsertRecords calls insert_records with a batch that may span several streams
+func InsertRecords(ctx context.Context, input InsertRecordsInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error in InsertRecords")
+	}
+
+	dataProviders := []string{}
+	streamIds := []string{}
+	for _, locator := range input.StreamLocators {
+		dataProviders = append(dataProviders, locator.DataProvider.Address())
+		streamIds = append(streamIds, locator.StreamId.String())
+	}
+	values := []*kwilTypes.Decimal{}
+	for _, value := range input.Values {
+		valueDecimal, err := kwilTypes.ParseDecimalExplicit(value, 36, 18)
+		if err != nil {
+			return errors.Wrap(err, "error parsing value")
+		}
+		values = append(values, valueDecimal)
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "insert_records", []any{
+		dataProviders,
+		streamIds,
+		input.EventTimes,
+		values,
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error in InsertRecords")
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in InsertRecords")
+	}
+
+	return nil
+}
+
+func InsertEmbargoedRecords(ctx context.Context, input InsertEmbargoedRecordsInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error in InsertEmbargoedRecords")
+	}
+
+	dataProviders := []string{}
+	streamIds := []string{}
+	values := []*kwilTypes.Decimal{}
+	for _, value := range input.Values {
+		dataProviders = append(dataProviders, input.StreamLocator.DataProvider.Address())
+		streamIds = append(streamIds, input.StreamLocator.StreamId.String())
+		valueDecimal, err := kwilTypes.ParseDecimalExplicit(value, 36, 18)
+		if err != nil {
+			return errors.Wrap(err, "error parsing value")
+		}
+		values = append(values, valueDecimal)
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height:    input.Height,
+			Timestamp: input.BlockTimestamp,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "insert_embargoed_records", []any{
+		dataProviders,
+		streamIds,
+		input.EventTimes,
+		values,
+		input.VisibleFrom,
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error in InsertEmbargoedRecords")
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in InsertEmbargoedRecords")
+	}
+
+	return nil
+}
+
+func RestoreStream(ctx context.Context, input RestoreStreamInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error in RestoreStream")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "restore_stream", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error in RestoreStream")
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in RestoreStream")
+	}
+
+	return nil
+}
+
+func PurgeStream(ctx context.Context, input PurgeStreamInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "error in PurgeStream")
+	}
+
+	txContext := &common.TxContext{
+		Ctx: ctx,
+		BlockContext: &common.BlockContext{
+			Height: input.Height,
+		},
+		TxID:   input.Platform.Txid(),
+		Signer: input.Platform.Deployer,
+		Caller: deployer.Address(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "purge_stream", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error in PurgeStream")
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in PurgeStream")
+	}
+
+	return nil
+}
+
 type ListStreamsInput struct {
 	Platform     *kwilTesting.Platform
 	Height       int64
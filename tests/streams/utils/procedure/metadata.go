@@ -353,6 +353,313 @@ func TransferStreamOwnership(ctx context.Context, input TransferStreamOwnershipI
 	return nil
 }
 
+type ProposeStreamOwnershipInput struct {
+	Platform  *kwilTesting.Platform
+	Locator   trufTypes.StreamLocator
+	NewOwner  string
+	ExpiresIn *int64
+	Height    int64
+}
+
+// ProposeStreamOwnership proposes a new owner for a stream, who has to accept it
+func ProposeStreamOwnership(ctx context.Context, input ProposeStreamOwnershipInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "propose_stream_ownership", []any{
+		input.Locator.DataProvider.Address(),
+		input.Locator.StreamId.String(),
+		input.NewOwner,
+		input.ExpiresIn,
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in propose_stream_ownership")
+	}
+
+	return nil
+}
+
+type OwnershipTransferInput struct {
+	Platform *kwilTesting.Platform
+	Locator  trufTypes.StreamLocator
+	Height   int64
+}
+
+// AcceptStreamOwnership accepts the pending ownership transfer of a stream as the proposed owner
+func AcceptStreamOwnership(ctx context.Context, input OwnershipTransferInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "accept_stream_ownership", []any{
+		input.Locator.DataProvider.Address(),
+		input.Locator.StreamId.String(),
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in accept_stream_ownership")
+	}
+
+	return nil
+}
+
+// CancelStreamOwnershipTransfer cancels the pending ownership transfer of a stream
+func CancelStreamOwnershipTransfer(ctx context.Context, input OwnershipTransferInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "cancel_stream_ownership_transfer", []any{
+		input.Locator.DataProvider.Address(),
+		input.Locator.StreamId.String(),
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in cancel_stream_ownership_transfer")
+	}
+
+	return nil
+}
+
+type GetPendingOwnershipTransfersInput struct {
+	Platform      *kwilTesting.Platform
+	DataProvider  *string
+	StreamId      *string
+	ProposedOwner *string
+	Height        int64
+}
+
+// GetPendingOwnershipTransfers lists the ownership transfers that can still be accepted
+func GetPendingOwnershipTransfers(ctx context.Context, input GetPendingOwnershipTransfersInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_pending_ownership_transfers", []any{
+		input.DataProvider,
+		input.StreamId,
+		input.ProposedOwner,
+	}, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		copy(values, row.Values)
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in get_pending_ownership_transfers")
+	}
+
+	return processResultRows(resultRows)
+}
+
+type GrantStreamAccessInput struct {
+	Platform  *kwilTesting.Platform
+	Locator   trufTypes.StreamLocator
+	Key       string
+	Grantee   string
+	ExpiresAt int64
+	Height    int64
+}
+
+// GrantStreamAccess grants read or write access to a wallet or an access group until a block height
+func GrantStreamAccess(ctx context.Context, input GrantStreamAccessInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "grant_stream_access", []any{
+		input.Locator.DataProvider.Address(),
+		input.Locator.StreamId.String(),
+		input.Key,
+		input.Grantee,
+		input.ExpiresAt,
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in grant_stream_access")
+	}
+
+	return nil
+}
+
+type GrantComposePermissionInput struct {
+	Platform      *kwilTesting.Platform
+	Locator       trufTypes.StreamLocator
+	ParentLocator trufTypes.StreamLocator
+	Height        int64
+}
+
+// GrantComposePermission whitelists a parent stream, possibly from another data provider, to compose the stream
+func GrantComposePermission(ctx context.Context, input GrantComposePermissionInput) error {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "grant_compose_permission", []any{
+		input.Locator.DataProvider.Address(),
+		input.Locator.StreamId.String(),
+		input.ParentLocator.DataProvider.Address(),
+		input.ParentLocator.StreamId.String(),
+	}, func(row *common.Row) error {
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return errors.Wrap(r.Error, "error in grant_compose_permission")
+	}
+
+	return nil
+}
+
+type GetExpiringGrantsInput struct {
+	Platform     *kwilTesting.Platform
+	DataProvider string
+	StreamId     *string
+	WithinBlocks int64
+	Height       int64
+}
+
+// GetExpiringGrants lists the grants of a data provider's streams that expire soon.
+// The row_id column is left out, as it's derived from the transaction id.
+func GetExpiringGrants(ctx context.Context, input GetExpiringGrantsInput) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(input.Platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: input.Height},
+		Signer:       input.Platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         input.Platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := input.Platform.Engine.Call(engineContext, input.Platform.DB, "", "get_expiring_grants", []any{
+		input.DataProvider,
+		input.StreamId,
+		input.WithinBlocks,
+	}, func(row *common.Row) error {
+		resultRows = append(resultRows, []any{row.Values[0], row.Values[2], row.Values[3], row.Values[4]})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Error != nil {
+		return nil, errors.Wrap(r.Error, "error in get_expiring_grants")
+	}
+
+	return processResultRows(resultRows)
+}
+
 type GetMetadataInput struct {
 	Platform *kwilTesting.Platform
 	Locator  trufTypes.StreamLocator
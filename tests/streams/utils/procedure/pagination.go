@@ -0,0 +1,165 @@
+package procedure
+
+import (
+	"context"
+
+	"github.com/kwilteam/kwil-db/common"
+	kwilTesting "github.com/kwilteam/kwil-db/testing"
+	"github.com/pkg/errors"
+	trufTypes "github.com/trufnetwork/sdk-go/core/types"
+	"github.com/trufnetwork/sdk-go/core/util"
+)
+
+// The page actions return the next_cursor of each row as the last column.
+// An empty cursor starts from the first row.
+
+type ListStreamsPageInput struct {
+	Platform     *kwilTesting.Platform
+	DataProvider string
+	Limit        int
+	Cursor       string
+	Height       int64
+}
+
+// ListStreamsPage lists streams ordered by creation, starting after the cursor
+func ListStreamsPage(ctx context.Context, input ListStreamsPageInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "list_streams_page", []any{
+		input.DataProvider,
+		input.Limit,
+		input.Cursor,
+	})
+}
+
+type GetMetadataPageInput struct {
+	Platform *kwilTesting.Platform
+	Locator  trufTypes.StreamLocator
+	Key      string
+	Limit    int
+	Cursor   string
+	Height   int64
+}
+
+// GetMetadataPage lists the metadata of a key ordered by creation, starting after the cursor
+func GetMetadataPage(ctx context.Context, input GetMetadataPageInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_metadata_page", []any{
+		input.Locator.DataProvider.Address(),
+		input.Locator.StreamId.String(),
+		input.Key,
+		nil,
+		input.Limit,
+		input.Cursor,
+	})
+}
+
+type GetRecordPageInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator trufTypes.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAt      *int64
+	Limit         int
+	Cursor        string
+	Height        int64
+}
+
+// GetRecordPage returns the records of a stream ordered by event time, starting after the cursor
+func GetRecordPage(ctx context.Context, input GetRecordPageInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_record_page", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.FrozenAt,
+		input.Limit,
+		input.Cursor,
+	})
+}
+
+type GetRecordRevisionsPageInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator trufTypes.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	Limit         int
+	Cursor        string
+	Height        int64
+}
+
+// GetRecordRevisionsPage returns the revisions of a stream ordered by created_at and event time, starting after the cursor
+func GetRecordRevisionsPage(ctx context.Context, input GetRecordRevisionsPageInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "get_record_revisions_page", []any{
+		input.StreamLocator.DataProvider.Address(),
+		input.StreamLocator.StreamId.String(),
+		input.FromTime,
+		input.ToTime,
+		input.Limit,
+		input.Cursor,
+	})
+}
+
+type SearchStreamsInput struct {
+	Platform       *kwilTesting.Platform
+	DataProvider   *string
+	StreamType     *string
+	Owner          *string
+	MetadataKeys   []string
+	MetadataValues []string
+	ReadVisibility *int
+	CreatedFrom    *int64
+	CreatedTo      *int64
+	Limit          int
+	Cursor         string
+	Height         int64
+}
+
+// SearchStreams finds the streams matching all the given filters, starting after the cursor
+func SearchStreams(ctx context.Context, input SearchStreamsInput) ([]ResultRow, error) {
+	return callPageAction(ctx, input.Platform, input.Height, "search_streams", []any{
+		input.DataProvider,
+		input.StreamType,
+		input.Owner,
+		input.MetadataKeys,
+		input.MetadataValues,
+		input.ReadVisibility,
+		input.CreatedFrom,
+		input.CreatedTo,
+		input.Limit,
+		input.Cursor,
+	})
+}
+
+// callPageAction calls a page action signed by the platform deployer and returns its rows
+func callPageAction(ctx context.Context, platform *kwilTesting.Platform, height int64, action string, args []any) ([]ResultRow, error) {
+	deployer, err := util.NewEthereumAddressFromBytes(platform.Deployer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Ethereum address from deployer bytes")
+	}
+
+	txContext := &common.TxContext{
+		Ctx:          ctx,
+		BlockContext: &common.BlockContext{Height: height},
+		Signer:       platform.Deployer,
+		Caller:       deployer.Address(),
+		TxID:         platform.Txid(),
+	}
+
+	engineContext := &common.EngineContext{
+		TxContext: txContext,
+	}
+
+	var resultRows [][]any
+	r, err := platform.Engine.Call(engineContext, platform.DB, "", action, args, func(row *common.Row) error {
+		values := make([]any, len(row.Values))
+		copy(values, row.Values)
+		resultRows = append(resultRows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Error != nil {
+		return nil, errors.Wrapf(r.Error, "error in %s", action)
+	}
+
+	return processResultRows(resultRows)
+}
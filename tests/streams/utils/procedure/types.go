@@ -15,6 +15,47 @@ type GetRecordInput struct {
 	PrintLogs     *bool
 }
 
+type GetRecordAggregatedInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAt      *int64
+	Bucket        string
+	Method        string
+	Height        int64
+}
+
+type GetWindowAnalyticsInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAt      *int64
+	BaseTime      *int64
+	Source        string
+	Window        int64
+	Method        string
+	Height        int64
+}
+
+type GetRecordRevisionsInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	Height        int64
+}
+
+type ExplainComposedRecordInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAt      *int64
+	Height        int64
+}
+
 type GetIndexInput struct {
 	Platform      *kwilTesting.Platform
 	StreamLocator types.StreamLocator
@@ -38,6 +79,49 @@ type GetIndexChangeInput struct {
 	Interval      *int
 }
 
+type GetIndexChangeByTypeInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAt      *int64
+	Height        int64
+	BaseTime      *int64
+	Interval      *int
+	ChangeType    string
+}
+
+type GetRecordFilledInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAt      *int64
+	FillMode      *string
+	Height        int64
+}
+
+type GetIndexFilledInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	FromTime      *int64
+	ToTime        *int64
+	FrozenAt      *int64
+	BaseTime      *int64
+	FillMode      *string
+	Height        int64
+}
+
+type GetPairwiseInput struct {
+	Platform *kwilTesting.Platform
+	StreamA  types.StreamLocator
+	StreamB  types.StreamLocator
+	FromTime *int64
+	ToTime   *int64
+	FrozenAt *int64
+	Height   int64
+}
+
 type GetFirstRecordInput struct {
 	Platform      *kwilTesting.Platform
 	StreamLocator types.StreamLocator
@@ -73,6 +157,14 @@ type GetCategoryStreamsInput struct {
 	ActiveTo     *int64
 }
 
+type GetStreamDependentsInput struct {
+	Platform     *kwilTesting.Platform
+	DataProvider string
+	StreamId     string
+	Recursive    bool
+	ActiveAt     *int64
+}
+
 type FilterStreamsByExistenceInput struct {
 	Platform       *kwilTesting.Platform
 	StreamLocators []types.StreamLocator
@@ -86,3 +178,41 @@ type DisableTaxonomyInput struct {
 	GroupSequence int
 	Height        int64
 }
+
+type RetractRecordInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	EventTime     int64
+	Height        int64
+}
+
+// InsertRecordsInput is a batch of records, each row for its own stream
+type InsertRecordsInput struct {
+	Platform       *kwilTesting.Platform
+	StreamLocators []types.StreamLocator
+	EventTimes     []int64
+	Values         []string
+	Height         int64
+}
+
+type InsertEmbargoedRecordsInput struct {
+	Platform       *kwilTesting.Platform
+	StreamLocator  types.StreamLocator
+	EventTimes     []int64
+	Values         []string
+	VisibleFrom    int64
+	Height         int64
+	BlockTimestamp int64 // unix seconds of the block, optional
+}
+
+type RestoreStreamInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	Height        int64
+}
+
+type PurgeStreamInput struct {
+	Platform      *kwilTesting.Platform
+	StreamLocator types.StreamLocator
+	Height        int64
+}
@@ -118,9 +118,14 @@ func CreateStreams(ctx context.Context, platform *kwilTesting.Platform, streamIn
 }
 
 func DeleteStream(ctx context.Context, platform *kwilTesting.Platform, streamLocator types.StreamLocator) (*common.CallResult, error) {
+	return DeleteStreamAt(ctx, platform, streamLocator, 0)
+}
+
+// DeleteStreamAt deletes a stream in a block with the given timestamp (unix seconds)
+func DeleteStreamAt(ctx context.Context, platform *kwilTesting.Platform, streamLocator types.StreamLocator, blockTimestamp int64) (*common.CallResult, error) {
 	txContext := &common.TxContext{
 		Ctx:          ctx,
-		BlockContext: &common.BlockContext{Height: 0},
+		BlockContext: &common.BlockContext{Height: 0, Timestamp: blockTimestamp},
 		Signer:       streamLocator.DataProvider.Bytes(),
 		Caller:       streamLocator.DataProvider.Address(),
 		TxID:         platform.Txid(),
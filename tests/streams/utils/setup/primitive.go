@@ -219,6 +219,7 @@ type InsertPrimitiveDataInput struct {
 	Platform        *kwilTesting.Platform
 	PrimitiveStream PrimitiveStreamWithData
 	Height          int64
+	BlockTimestamp  int64 // unix seconds of the block, optional
 }
 
 func insertPrimitiveData(ctx context.Context, input InsertPrimitiveDataInput) error {
@@ -247,7 +248,8 @@ func insertPrimitiveData(ctx context.Context, input InsertPrimitiveDataInput) er
 		txContext := &common.TxContext{
 			Ctx: ctx,
 			BlockContext: &common.BlockContext{
-				Height: input.Height,
+				Height:    input.Height,
+				Timestamp: input.BlockTimestamp,
 			},
 			TxID:   txid,
 			Signer: deployer.Bytes(),
@@ -325,7 +327,8 @@ func InsertPrimitiveDataBatch(ctx context.Context, input InsertPrimitiveDataInpu
 	txContext := &common.TxContext{
 		Ctx: ctx,
 		BlockContext: &common.BlockContext{
-			Height: input.Height,
+			Height:    input.Height,
+			Timestamp: input.BlockTimestamp,
 		},
 		TxID:   txid,
 		Signer: deployer.Bytes(),